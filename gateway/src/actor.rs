@@ -0,0 +1,90 @@
+//! Signs the actors forwarded to the post service, for it to trust them
+
+use hmac::{Hmac, Mac, NewMac};
+use sha2::{Digest, Sha256};
+use std::fmt;
+
+/// Error returned when the signer can't be created
+#[derive(Debug)]
+pub struct SignerError {
+    pub message: String,
+}
+
+impl std::error::Error for SignerError {
+    fn description(&self) -> &str {
+        &self.message[..]
+    }
+}
+
+impl fmt::Display for SignerError {
+    fn fmt(&self, f: &mut fmt::Formatter<'_>) -> fmt::Result {
+        write!(f, "actor signer error: {}", self.message)
+    }
+}
+
+/// Signs actors with the secret shared with the post service
+pub struct ActorSigner {
+    key: Hmac<Sha256>,
+}
+
+impl ActorSigner {
+    /// Creates a new ActorSigner
+    pub fn new(secret: &str) -> Result<ActorSigner, SignerError> {
+        match Hmac::new_from_slice(secret.as_bytes()) {
+            Ok(key) => Ok(ActorSigner { key }),
+            Err(_) => Err(SignerError {
+                message: String::from("invalid key length"),
+            }),
+        }
+    }
+
+    /// Signature of the actor bound to the values passed: the hex encoded HMAC-SHA256
+    /// of the actor and the values joined by "\n", as checked by the post service
+    pub fn sign(&self, actor: &str, bound: &[&str]) -> String {
+        let mut parts = vec![actor];
+        parts.extend_from_slice(bound);
+        let mut mac = self.key.clone();
+        mac.update(parts.join("\n").as_bytes());
+        to_hex(&mac.finalize().into_bytes())
+    }
+}
+
+/// Hex encoded SHA-256 of data, bound by the signatures to cover the data sent along
+pub fn digest(data: &[u8]) -> String {
+    to_hex(&Sha256::digest(data))
+}
+
+/// Hex encodes the passed bytes
+pub fn to_hex(bytes: &[u8]) -> String {
+    bytes.iter().map(|byte| format!("{:02x}", byte)).collect()
+}
+
+mod test {
+    use super::*;
+
+    #[test]
+    fn test_sign() {
+        let signer = ActorSigner::new("un secreto").unwrap();
+        assert_eq!(
+            signer.sign("noice", &["some-id", "posts.v1.update"]),
+            "bf2f004a8f751ab58d83a0aa72718cb6577a6f809e6a581ed832a5c4a01212c2".to_string()
+        )
+    }
+
+    #[test]
+    fn test_digest() {
+        assert_eq!(
+            digest(br#"{"title":"heroes"}"#),
+            "29dadc0e2d0b60a9874e58600ec882eedf3d0629464364855b611dbcb1f21b2a".to_string()
+        )
+    }
+
+    #[test]
+    fn test_sign_bound() {
+        let signer = ActorSigner::new("un secreto").unwrap();
+        assert_ne!(
+            signer.sign("noice", &["some-id", "posts.v1.update"]),
+            signer.sign("noice", &["other-id", "posts.v1.update"])
+        )
+    }
+}
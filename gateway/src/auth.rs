@@ -196,12 +196,18 @@ impl AuthService {
         }
     }
 
-    /// Checks whether the received token is still authorized
-    pub fn authorize(&self, token_value: &str) -> Result<bool, AuthenticationError> {
+    /// Checks whether the received token is still authorized, returning the username
+    /// it belongs to, or None when it's evicted
+    pub fn authorize(&self, token_value: &str) -> Result<Option<String>, AuthenticationError> {
         match JWTToken::get_username(token_value, &self.token_key) {
             Ok(usr) => match self.store.retrieve(&usr[..]) {
                 Ok(saved_token) => match saved_token.is_evicted() {
-                    Ok(evicted) => Ok(evicted),
+                    Ok(evicted) => {
+                        if evicted {
+                            return Ok(None);
+                        }
+                        Ok(Some(usr))
+                    }
                     Err(e) => Err(AuthenticationError { message: e.message }),
                 },
                 Err(e) => Err(AuthenticationError { message: e.message }),
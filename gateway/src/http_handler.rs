@@ -177,8 +177,8 @@ impl HTTPHandler {
         Ok(self._post(&id[..]).await)
     }
 
-    fn create_post(&self, create: CreatePost) -> EmptyResponse {
-        match self.creator.create(create) {
+    fn create_post(&self, actor: &str, create: CreatePost) -> EmptyResponse {
+        match self.creator.create(actor, create) {
             Ok(_) => EmptyResponse(Ok(warp::reply::with_status(
                 "OK".to_string(),
                 StatusCode::CREATED,
@@ -189,8 +189,8 @@ impl HTTPHandler {
         }
     }
 
-    fn update_post(&self, id: String, update: UpdatePost) -> EmptyResponse {
-        match self.updater.update(&id[..], update) {
+    fn update_post(&self, id: String, actor: &str, update: UpdatePost) -> EmptyResponse {
+        match self.updater.update(&id[..], actor, update) {
             Ok(_) => EmptyResponse(Ok(warp::reply::with_status(
                 "OK".to_string(),
                 StatusCode::NO_CONTENT,
@@ -221,15 +221,12 @@ impl HTTPHandler {
         Ok(self.login(creds).await)
     }
 
-    fn authorize(&self) -> impl Filter<Extract = ((),), Error = Rejection> + Copy + '_ {
+    /// Extracts the username of the authorized user
+    fn authorize(&self) -> impl Filter<Extract = (String,), Error = Rejection> + Copy + '_ {
         warp::header::<String>("Authorization").and_then(move |token: String| async move {
             match self.auth.authorize(token.trim_start_matches(TOKEN_PREFIX)) {
-                Ok(is_evicted) => {
-                    if is_evicted {
-                        return Err(reject::custom(Unauthorized));
-                    }
-                    Ok(())
-                }
+                Ok(Some(username)) => Ok(username),
+                Ok(None) => Err(reject::custom(Unauthorized)),
                 Err(err) => Err(reject::custom(HandlerError {
                     message: err.message,
                 })),
@@ -261,13 +258,15 @@ impl HTTPHandler {
             .and(warp::post())
             .and(self.authorize())
             .and(warp::body::json())
-            .map(move |_, create: CreatePost| self.create_post(create));
+            .map(move |actor: String, create: CreatePost| self.create_post(&actor[..], create));
 
         let update_post = warp::path!("posts" / String)
             .and(warp::put())
             .and(self.authorize())
             .and(warp::body::json())
-            .map(move |id: String, _, update: UpdatePost| self.update_post(id, update));
+            .map(move |id: String, actor: String, update: UpdatePost| {
+                self.update_post(id, &actor[..], update)
+            });
 
         let cors = warp::cors().allow_any_origin().allow_methods(vec!["GET"]);
 
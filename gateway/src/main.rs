@@ -1,3 +1,4 @@
+mod actor;
 mod auth;
 mod grpc_authenticator;
 mod http_handler;
@@ -29,6 +30,7 @@ fn parse_nats_config() -> Config {
         subject: env::var("POST_SERVER_SUBJECT").expect("post server's subject not set"),
         host: env::var("POST_SERVER_HOST").expect("post server's host not set"),
         port: env::var("POST_SERVER_PORT").expect("post server's port not set"),
+        actor_secret: env::var("ACTOR_SECRET").expect("actor secret not set"),
     }
 }
 
@@ -1,40 +1,28 @@
+use crate::actor::{digest, to_hex, ActorSigner};
 use crate::post::{CreatePost, FullUpdatePost, MutatorClient, MutatorError};
 use serde::Serialize;
 use std::fmt;
 
-/// CreatePostEvent is self described
-#[derive(Serialize)]
-pub struct CreatePostEvent {
-    event_name: String,
-    #[serde(flatten)]
-    payload: CreatePost,
-}
+/// Version of the CloudEvents specification the events follow
+const SPEC_VERSION: &str = "1.0";
+/// Source of the events sent
+const SOURCE: &str = "/gateway";
+const CREATE_POST_EVENT: &str = "posts.v1.create";
+const UPDATE_POST_EVENT: &str = "posts.v1.update";
 
-/// UpdatePostEvent is self described
+/// Envelope wraps the events sent in CloudEvents' structured mode, along with
+/// the actor that sent them, signed for the post service to trust it. The
+/// signature is bound to the event's id and type, and the digest of its data
 #[derive(Serialize)]
-pub struct UpdatePostEvent {
-    event_name: String,
-    #[serde(flatten)]
-    payload: FullUpdatePost,
-}
-
-impl CreatePostEvent {
-    /// Creates a CreatePostEvent with default event_name
-    fn new(payload: CreatePost) -> Self {
-        CreatePostEvent {
-            event_name: "posts.v1.create".to_string(),
-            payload,
-        }
-    }
-}
-impl UpdatePostEvent {
-    /// Creates an UpdatePostEvent with default event_name
-    fn new(payload: FullUpdatePost) -> Self {
-        UpdatePostEvent {
-            event_name: "posts.v1.update".to_string(),
-            payload,
-        }
-    }
+struct Envelope<T> {
+    specversion: &'static str,
+    id: String,
+    source: &'static str,
+    #[serde(rename = "type")]
+    event_type: &'static str,
+    actor: String,
+    actorsignature: String,
+    data: T,
 }
 
 /// Config encodes the necessary data for a NATS connection
@@ -44,6 +32,8 @@ pub struct Config {
     pub subject: String,
     pub host: String,
     pub port: String,
+    /// Secret shared with the post service for signing the actors
+    pub actor_secret: String,
 }
 
 impl Config {
@@ -75,28 +65,63 @@ impl fmt::Display for ClientError {
 pub struct Client {
     config: Config,
     conn: nats::Connection,
+    signer: ActorSigner,
 }
 
 impl Client {
     /// Creates a new NATS' client with passed config's data
     pub fn connect(config: Config) -> Result<Client, ClientError> {
+        let signer = match ActorSigner::new(&config.actor_secret[..]) {
+            Ok(signer) => signer,
+            Err(e) => return Err(ClientError { message: e.message }),
+        };
         let mut options = nats::Options::new();
         if !config.user.is_empty() {
             options = nats::Options::with_user_pass(&config.user[..], &config.pass[..]);
         }
         match options.connect(&config.url()[..]) {
-            Ok(conn) => Ok(Client { config, conn }),
+            Ok(conn) => Ok(Client {
+                config,
+                conn,
+                signer,
+            }),
             Err(e) => Err(ClientError {
                 message: e.to_string(),
             }),
         }
     }
 
-    fn send<T: Serialize>(&self, payload: T) -> Result<(), MutatorError> {
-        let payload_str = serde_json::to_string(&payload).unwrap();
-        match bincode::serialize(&payload_str) {
-            // TODO Ignoring first element as it's sent like 'D' (coming from bincode)
-            Ok(bytes) => match self.conn.publish(&self.config.subject[..], &bytes[1..]) {
+    fn send<T: Serialize>(
+        &self,
+        event_type: &'static str,
+        actor: &str,
+        payload: T,
+    ) -> Result<(), MutatorError> {
+        // serialized as it's embedded in the envelope, for the post service
+        // to check the digest of the data as it arrives
+        let data = match serde_json::to_vec(&payload) {
+            Ok(data) => data,
+            Err(e) => {
+                return Err(MutatorError {
+                    message: e.to_string(),
+                })
+            }
+        };
+        let id = to_hex(&rand::random::<[u8; 16]>());
+        let actorsignature = self
+            .signer
+            .sign(actor, &[&id[..], event_type, &digest(&data)[..]]);
+        let envelope = Envelope {
+            specversion: SPEC_VERSION,
+            id,
+            source: SOURCE,
+            event_type,
+            actor: actor.to_string(),
+            actorsignature,
+            data: payload,
+        };
+        match serde_json::to_vec(&envelope) {
+            Ok(bytes) => match self.conn.publish(&self.config.subject[..], &bytes) {
                 Ok(()) => Ok(()),
                 Err(e) => Err(MutatorError {
                     message: e.to_string(),
@@ -111,17 +136,15 @@ impl Client {
 
 impl MutatorClient<CreatePost> for Client {
     /// Implements the send method for post creation
-    fn send(&self, payload: CreatePost) -> Result<(), MutatorError> {
-        let create_post = CreatePostEvent::new(payload);
-        self.send(create_post)
+    fn send(&self, actor: &str, payload: CreatePost) -> Result<(), MutatorError> {
+        self.send(CREATE_POST_EVENT, actor, payload)
     }
 }
 
 impl MutatorClient<FullUpdatePost> for Client {
     /// Implements the send method for post updating
-    fn send(&self, payload: FullUpdatePost) -> Result<(), MutatorError> {
-        let update_post = UpdatePostEvent::new(payload);
-        self.send(update_post)
+    fn send(&self, actor: &str, payload: FullUpdatePost) -> Result<(), MutatorError> {
+        self.send(UPDATE_POST_EVENT, actor, payload)
     }
 }
 
@@ -136,6 +159,7 @@ mod test {
             subject: "not_important".to_string(),
             host: "127.0.0.1".to_string(),
             port: "4222".to_string(),
+            actor_secret: "not_important".to_string(),
         };
         assert_eq!(config.url(), "nats://127.0.0.1:4222".to_string())
     }
@@ -33,8 +33,10 @@ impl fmt::Display for MutatorError {
 }
 
 /// DTO with the data needed for creating a post
+/// The creator is always the authenticated user, whatever the one passed
 #[derive(Serialize, Deserialize)]
 pub struct CreatePost {
+    #[serde(default)]
     pub creator: String,
     pub title: String,
     pub content: String,
@@ -47,11 +49,13 @@ pub struct UpdatePost {
     pub title: String,
     pub content: String,
     pub tags: Vec<String>,
+    /// Version of the post the update is based on
+    pub version: u32,
 }
 
-/// Defines the mutator client
+/// Defines the mutator client, actor being the authenticated user sending the payload
 pub trait MutatorClient<T: Serialize> {
-    fn send(&self, payload: T) -> Result<(), MutatorError>;
+    fn send(&self, actor: &str, payload: T) -> Result<(), MutatorError>;
 }
 
 /// A service for creating posts
@@ -64,9 +68,10 @@ unsafe impl Send for PostCreator {}
 unsafe impl Sync for PostCreator {}
 
 impl PostCreator {
-    /// Creates a post with the corresponding data passed
-    pub fn create(&self, post: CreatePost) -> Result<(), MutatorError> {
-        match self.client.send(post) {
+    /// Creates a post with the corresponding data passed, on behalf of actor
+    pub fn create(&self, actor: &str, mut post: CreatePost) -> Result<(), MutatorError> {
+        post.creator = actor.to_string();
+        match self.client.send(actor, post) {
             Ok(()) => Ok(()),
             Err(e) => Err(MutatorError {
                 message: format!("post creator: {}", e.message),
@@ -82,6 +87,7 @@ pub struct FullUpdatePost {
     pub title: String,
     pub content: String,
     pub tags: Vec<String>,
+    pub version: u32,
 }
 
 /// A service for updating a post
@@ -94,15 +100,16 @@ unsafe impl Send for PostUpdater {}
 unsafe impl Sync for PostUpdater {}
 
 impl PostUpdater {
-    /// Updates a post with the corresponding data passed
-    pub fn update(&self, id: &str, post: UpdatePost) -> Result<(), MutatorError> {
+    /// Updates a post with the corresponding data passed, on behalf of actor
+    pub fn update(&self, id: &str, actor: &str, post: UpdatePost) -> Result<(), MutatorError> {
         let update_post = FullUpdatePost {
             id: id.to_string(),
             title: post.title,
             content: post.content,
             tags: post.tags,
+            version: post.version,
         };
-        match self.client.send(update_post) {
+        match self.client.send(actor, update_post) {
             Ok(()) => Ok(()),
             Err(e) => Err(MutatorError {
                 message: format!("post update: {}", e.message),
@@ -164,7 +171,8 @@ mod test {
     }
 
     impl MutatorClient<CreatePost> for MockClient {
-        fn send(&self, _: CreatePost) -> Result<(), MutatorError> {
+        fn send(&self, actor: &str, post: CreatePost) -> Result<(), MutatorError> {
+            assert_eq!(post.creator, actor, "the creator should be the actor");
             if self.errored {
                 return Err(MutatorError {
                     message: String::from("whatever error"),
@@ -188,7 +196,7 @@ mod test {
         let creator = PostCreator {
             client: Box::new(MockClient { errored: true }),
         };
-        match creator.create(create_post()) {
+        match creator.create("some-actor", create_post()) {
             Ok(()) => assert!(false, "shouldn't return Ok"),
             Err(_) => assert!(true, "should return Err"),
         }
@@ -199,14 +207,14 @@ mod test {
         let creator = PostCreator {
             client: Box::new(MockClient { errored: false }),
         };
-        match creator.create(create_post()) {
+        match creator.create("some-actor", create_post()) {
             Ok(()) => assert!(true, "should return Ok"),
             Err(e) => assert!(false, "shouldn't return Err {}", e),
         }
     }
 
     impl MutatorClient<FullUpdatePost> for MockClient {
-        fn send(&self, _: FullUpdatePost) -> Result<(), MutatorError> {
+        fn send(&self, _: &str, _: FullUpdatePost) -> Result<(), MutatorError> {
             if self.errored {
                 return Err(MutatorError {
                     message: String::from("another whatever error"),
@@ -221,6 +229,7 @@ mod test {
             title: String::from("some-title"),
             content: String::from("some-content"),
             tags: vec![String::from("amazing"), String::from("superb")],
+            version: 1,
         }
     }
 
@@ -229,7 +238,7 @@ mod test {
         let creator = PostUpdater {
             client: Box::new(MockClient { errored: true }),
         };
-        match creator.update("some-id", update_post()) {
+        match creator.update("some-id", "some-actor", update_post()) {
             Ok(()) => assert!(false, "shouldn't return Ok"),
             Err(_) => assert!(true, "should return Err"),
         }
@@ -240,7 +249,7 @@ mod test {
         let creator = PostUpdater {
             client: Box::new(MockClient { errored: false }),
         };
-        match creator.update("other-id", update_post()) {
+        match creator.update("other-id", "some-actor", update_post()) {
             Ok(()) => assert!(true, "should return Ok"),
             Err(e) => assert!(false, "shouldn't return Err {}", e),
         }
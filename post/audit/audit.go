@@ -0,0 +1,114 @@
+// Keeps an append-only log of the commands handled by the EventBus,
+// recording who changed what and when
+package audit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/mountolive/back-blog-go/post/eventbus"
+)
+
+// ErrAuditStore is self-described
+var ErrAuditStore = errors.New("audit store error")
+
+// idKey is the key of the id of the entity a command is about, in its
+// data, or in the eventbus.Result recorded by its handler on creation
+const idKey = "id"
+
+// Entry is the record of a command handled, Outcome being either
+// eventbus.StatusSucceeded or eventbus.StatusFailed
+// Duration is marshaled in nanoseconds
+type Entry struct {
+	Seq           int64           `json:"seq"`
+	EventID       string          `json:"event_id,omitempty"`
+	Name          string          `json:"name"`
+	AggregateID   string          `json:"aggregate_id,omitempty"`
+	Payload       eventbus.Params `json:"payload"`
+	Actor         string          `json:"actor,omitempty"`
+	CorrelationID string          `json:"correlation_id,omitempty"`
+	Outcome       string          `json:"outcome"`
+	Error         string          `json:"error,omitempty"`
+	Duration      time.Duration   `json:"duration"`
+	OccurredAt    time.Time       `json:"occurred_at"`
+}
+
+// Succeeded is self-described
+func (e Entry) Succeeded() bool {
+	return e.Outcome == eventbus.StatusSucceeded
+}
+
+// Filter narrows the entries queried, empty fields match any
+// From and To bound OccurredAt, both included
+type Filter struct {
+	Actor  string
+	From   time.Time
+	To     time.Time
+	Limit  int
+	Offset int
+}
+
+// Store keeps the entries, it's append-only
+type Store interface {
+	// Append records entry, assigning its Seq
+	Append(ctx context.Context, entry *Entry) error
+	// History returns the entries of the passed aggregate, oldest first
+	History(ctx context.Context, aggregateID string) ([]*Entry, error)
+	// Query returns the entries matching filter, oldest first
+	Query(ctx context.Context, filter Filter) ([]*Entry, error)
+}
+
+// Middleware records every command handled in store, along with its
+// outcome and duration. Entries are appended after the command is handled,
+// so a failure to record one doesn't fail the command: it's passed to
+// onError, if not nil
+// The aggregate of an entry is the envelope's subject, or else the id in
+// its data, or else the id recorded by the handler, as on creation
+func Middleware(store Store, onError func(error)) eventbus.Middleware {
+	return func(handler eventbus.CommandHandler) eventbus.CommandHandler {
+		return eventbus.HandlerFunc(func(ctx context.Context, params eventbus.Params) error {
+			result, ok := eventbus.ResultFromContext(ctx)
+			if !ok {
+				ctx, result = eventbus.ContextWithResult(ctx)
+			}
+			start := time.Now()
+			err := handler.Handle(ctx, params)
+			envelope, _ := eventbus.EnvelopeFromContext(ctx)
+			entry := &Entry{
+				EventID:       envelope.ID,
+				Name:          envelope.Type,
+				AggregateID:   aggregateID(envelope, params, result),
+				Payload:       params,
+				Actor:         envelope.Actor,
+				CorrelationID: envelope.CorrelationID,
+				Outcome:       eventbus.StatusSucceeded,
+				Duration:      time.Since(start),
+				OccurredAt:    start.UTC(),
+			}
+			if err != nil {
+				entry.Outcome = eventbus.StatusFailed
+				entry.Error = err.Error()
+			}
+			// the entry is recorded even if the event's ctx is done
+			appendErr := store.Append(context.Background(), entry)
+			if appendErr != nil && onError != nil {
+				onError(fmt.Errorf("%w: append %s: %v", ErrAuditStore, entry.Name, appendErr))
+			}
+			return err
+		})
+	}
+}
+
+func aggregateID(envelope eventbus.Envelope, params eventbus.Params,
+	result *eventbus.Result) string {
+	if envelope.Subject != "" {
+		return envelope.Subject
+	}
+	if id, ok := params[idKey].(string); ok && id != "" {
+		return id
+	}
+	id, _ := result.Values()[idKey].(string)
+	return id
+}
@@ -0,0 +1,132 @@
+package audit
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/mountolive/back-blog-go/post/eventbus"
+	"github.com/stretchr/testify/require"
+)
+
+type mockStore struct {
+	entries   []*Entry
+	appendErr error
+}
+
+func (m *mockStore) Append(_ context.Context, entry *Entry) error {
+	if m.appendErr != nil {
+		return m.appendErr
+	}
+	entry.Seq = int64(len(m.entries) + 1)
+	m.entries = append(m.entries, entry)
+	return nil
+}
+
+func (m *mockStore) History(context.Context, string) ([]*Entry, error) {
+	return m.entries, nil
+}
+
+func (m *mockStore) Query(context.Context, Filter) ([]*Entry, error) {
+	return m.entries, nil
+}
+
+type rawEvent string
+
+func (r rawEvent) Data() []byte { return []byte(r) }
+
+func TestMiddleware(t *testing.T) {
+	envelope := eventbus.Envelope{
+		ID:            "event-id",
+		Type:          "posts.v1.update",
+		Actor:         "someone",
+		CorrelationID: "correlation-id",
+	}
+	ctx := eventbus.ContextWithEnvelope(context.Background(), envelope)
+
+	t.Run("Succeeded", func(t *testing.T) {
+		store := &mockStore{}
+		handler := Middleware(store, nil)(eventbus.HandlerFunc(
+			func(context.Context, eventbus.Params) error { return nil },
+		))
+		params := eventbus.Params{"id": "post-id", "title": "new"}
+		require.NoError(t, handler.Handle(ctx, params))
+
+		require.Len(t, store.entries, 1)
+		entry := store.entries[0]
+		require.Equal(t, "event-id", entry.EventID)
+		require.Equal(t, "posts.v1.update", entry.Name)
+		require.Equal(t, "post-id", entry.AggregateID)
+		require.Equal(t, params, entry.Payload)
+		require.Equal(t, "someone", entry.Actor)
+		require.Equal(t, "correlation-id", entry.CorrelationID)
+		require.True(t, entry.Succeeded())
+		require.Empty(t, entry.Error)
+		require.False(t, entry.OccurredAt.IsZero())
+	})
+
+	t.Run("Failed", func(t *testing.T) {
+		store := &mockStore{}
+		handlerErr := errors.New("boom")
+		handler := Middleware(store, nil)(eventbus.HandlerFunc(
+			func(context.Context, eventbus.Params) error { return handlerErr },
+		))
+		err := handler.Handle(ctx, eventbus.Params{"id": "post-id"})
+		require.Equal(t, handlerErr, err)
+
+		require.Len(t, store.entries, 1)
+		require.Equal(t, eventbus.StatusFailed, store.entries[0].Outcome)
+		require.Equal(t, "boom", store.entries[0].Error)
+	})
+
+	t.Run("Aggregate created", func(t *testing.T) {
+		store := &mockStore{}
+		handler := Middleware(store, nil)(eventbus.HandlerFunc(
+			func(ctx context.Context, _ eventbus.Params) error {
+				eventbus.RecordResult(ctx, "id", "created-id")
+				return nil
+			},
+		))
+		resultCtx, result := eventbus.ContextWithResult(ctx)
+		require.NoError(t, handler.Handle(resultCtx, eventbus.Params{"title": "new"}))
+
+		require.Equal(t, "created-id", store.entries[0].AggregateID)
+		require.Equal(t, "created-id", result.Values()["id"],
+			"the result of the event's sender should be kept")
+	})
+
+	t.Run("Retried", func(t *testing.T) {
+		store := &mockStore{}
+		calls := 0
+		bus := eventbus.NewEventBus(
+			eventbus.Retry(eventbus.RetryPolicy{Attempts: 3}),
+			Middleware(store, nil),
+		)
+		bus.Register("posts.v1.update", eventbus.HandlerFunc(
+			func(context.Context, eventbus.Params) error {
+				calls++
+				if calls == 1 {
+					return errors.New("db down")
+				}
+				return nil
+			},
+		))
+		event := rawEvent(`{"specversion":"1.0","id":"event-id","source":"/gateway",` +
+			`"type":"posts.v1.update","data":{"id":"post-id"}}`)
+		require.NoError(t, bus.Resolve(context.Background(), event))
+
+		require.Equal(t, 2, calls)
+		require.Len(t, store.entries, 1, "retries shouldn't be recorded as commands")
+		require.True(t, store.entries[0].Succeeded())
+	})
+
+	t.Run("Append failed", func(t *testing.T) {
+		store := &mockStore{appendErr: errors.New("db down")}
+		var reported error
+		handler := Middleware(store, func(err error) { reported = err })(eventbus.HandlerFunc(
+			func(context.Context, eventbus.Params) error { return nil },
+		))
+		require.NoError(t, handler.Handle(ctx, eventbus.Params{"id": "post-id"}))
+		require.True(t, errors.Is(reported, ErrAuditStore), reported)
+	})
+}
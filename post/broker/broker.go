@@ -2,12 +2,16 @@ package broker
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/mountolive/back-blog-go/post/eventbus"
+	"github.com/mountolive/back-blog-go/post/usecase"
 	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nuid"
 )
 
 var (
@@ -24,6 +28,8 @@ var (
 	ErrFlushSubscription = errors.New("NATS in flushing subscription (roundtrip)")
 	// ErrDeadLetterPublish is self-described
 	ErrDeadLetterPublish = errors.New("NATS publish to dead letter failed")
+	// ErrDomainEventPublish is self-described
+	ErrDomainEventPublish = errors.New("NATS publish of domain event failed")
 )
 
 // EventBus is the needed functionality from the corresponding Broker
@@ -31,6 +37,51 @@ type EventBus interface {
 	Resolve(context.Context, eventbus.Event) error
 }
 
+// Broker feeds an EventBus with the messages received through a transport,
+// subscribing on construction; the ones that couldn't be processed are
+// dead-lettered. It also publishes the domain events
+// The dead letters are passed as DeadLetter, whatever the transport
+type Broker interface {
+	usecase.Publisher
+	// Process resolves the messages received until ctx is done,
+	// the errors are sent through the channel returned
+	Process(ctx context.Context) <-chan error
+	// ProcessDead passes the dead letters to msgHandler until ctx is done,
+	// the errors are sent through the channel returned
+	ProcessDead(ctx context.Context, msgHandler func(DeadLetter) error) <-chan error
+	// CloseConnection releases the transport
+	CloseConnection()
+}
+
+// DeadLetter is a message that couldn't be processed, with the headers
+// telling why, DeadLetterReasonHeader and the like, along with its own
+type DeadLetter struct {
+	// Subject is the dead letter subject it was sent to
+	Subject string
+	Data    []byte
+	Header  Header
+}
+
+// Header holds the headers of a DeadLetter, its keys are case-sensitive
+type Header map[string][]string
+
+// Get returns the first value of key, empty if it's missing
+func (h Header) Get(key string) string {
+	if values := h[key]; len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+// newDeadLetter copies the dead letter msg, as sent through NATS
+func newDeadLetter(msg *nats.Msg) DeadLetter {
+	header := Header{}
+	for key, values := range msg.Header {
+		header[key] = append([]string(nil), values...)
+	}
+	return DeadLetter{Subject: msg.Subject, Data: msg.Data, Header: header}
+}
+
 // NATSConfig is the basic configuration for a NATS connection
 type NATSConfig struct {
 	port uint16
@@ -41,6 +92,10 @@ type NATSConfig struct {
 	host string
 	pollingTime int
 	opts        []nats.Option
+	jetStream   *JetStreamConfig
+	queueGroup  string
+	workers     int
+	queueSize   int
 }
 
 // NewNATSConfig is a standard constructor
@@ -61,6 +116,27 @@ func NewNATSConfig(
 	}
 }
 
+// WithQueueGroup returns a copy of the configuration subscribing as a member
+// of the passed queue group, so each message is received by only one of the
+// instances sharing it; dead letters too. JetStream's consumers are already
+// shared by the instances using the same durable name
+func (n NATSConfig) WithQueueGroup(group string) NATSConfig {
+	n.queueGroup = group
+	return n
+}
+
+// WithWorkers returns a copy of the configuration handling up to workers
+// messages at once. Messages about the same aggregate (see
+// eventbus.AggregateKey) are handled by the same worker, in order. Each
+// worker queues up to queueSize messages; once full, consumption waits:
+// JetStream's messages aren't fetched, while core NATS' ones are
+// buffered by the client, up to its pending limits
+func (n NATSConfig) WithWorkers(workers, queueSize int) NATSConfig {
+	n.workers = workers
+	n.queueSize = queueSize
+	return n
+}
+
 // URL returns the necessary URL to connect to a given NATS server
 func (n NATSConfig) URL() string {
 	port := n.port
@@ -76,6 +152,57 @@ func (n NATSConfig) URL() string {
 	return fmt.Sprintf("nats://%s:%s@%s:%d", n.user, n.pass, n.host, port)
 }
 
+const (
+	// DeadLetterReasonHeader is the header of a dead letter holding
+	// the reason why the message couldn't be processed
+	DeadLetterReasonHeader = "Dead-Letter-Reason"
+	// DeadLetterErrorHeader is the header of a dead letter holding
+	// the error returned when processing the message
+	DeadLetterErrorHeader = "Dead-Letter-Error"
+	// DeadLetterSubjectHeader is the header of a dead letter holding
+	// the subject the message was sent to
+	DeadLetterSubjectHeader = "Dead-Letter-Subject"
+	// DeadLetterFailedAtHeader is the header of a dead letter holding
+	// when the message was dead-lettered, RFC 3339
+	DeadLetterFailedAtHeader = "Dead-Letter-Failed-At"
+	// DeadLetterHeaderPrefix is the prefix of the headers
+	// added to the dead letters
+	DeadLetterHeaderPrefix = "Dead-Letter-"
+)
+
+// Reasons for a message to be dead-lettered
+const (
+	ReasonMalformedMessage   = "malformed_message"
+	ReasonEventNotRegistered = "event_not_registered"
+	ReasonVersionConflict    = "version_conflict"
+	ReasonEventInProgress    = "event_in_progress"
+	ReasonForbidden          = "forbidden"
+	ReasonHandlerError       = "handler_error"
+)
+
+// DeadLetterReason maps the error returned when processing a message
+// to the reason sent along with its dead letter
+func DeadLetterReason(err error) string {
+	switch {
+	case errors.Is(err, eventbus.ErrUnmarshalingMessage),
+		errors.Is(err, eventbus.ErrMissingNameParam),
+		errors.Is(err, eventbus.ErrWrongDataTypeName),
+		errors.Is(err, eventbus.ErrInvalidEnvelope),
+		errors.Is(err, eventbus.ErrUpcast):
+		return ReasonMalformedMessage
+	case errors.Is(err, eventbus.ErrEventNotRegistered):
+		return ReasonEventNotRegistered
+	case errors.Is(err, usecase.ErrVersionConflict):
+		return ReasonVersionConflict
+	case errors.Is(err, eventbus.ErrEventInProgress):
+		return ReasonEventInProgress
+	case errors.Is(err, usecase.ErrForbidden):
+		return ReasonForbidden
+	default:
+		return ReasonHandlerError
+	}
+}
+
 const (
 	deadLetter = "dead.%s"
 	// Milliseconds
@@ -99,25 +226,51 @@ type NATSBroker struct {
 	conf                   NATSConfig
 	messagesChan           chan *nats.Msg
 	deadLetterMessagesChan chan *nats.Msg
+	jsSub                  *nats.Subscription
 }
 
 // NewNATSBroker is a standard constructor
+// With a JetStream configuration, the messages are consumed through its
+// durable pull consumer, see NATSConfig.WithJetStream
 func NewNATSBroker(bus EventBus, conf NATSConfig) (*NATSBroker, error) {
 	conn, err := nats.Connect(conf.URL(), conf.opts...)
 	if err != nil {
 		return nil, wrapError(ErrNATSServerConnection, err.Error())
 	}
+	var jsSub *nats.Subscription
 	messagesChan := make(chan *nats.Msg)
-	_, err = conn.Subscribe(conf.subscriptionName, func(msg *nats.Msg) {
-		messagesChan <- msg
-	})
-	if err != nil {
-		return nil, wrapError(ErrNATSubscription, err.Error())
+	if conf.jetStream != nil {
+		jsConf := conf.jetStream.withDefaults()
+		conf.jetStream = &jsConf
+		jsSub, err = subscribeJetStream(conn, conf)
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+	} else {
+		handler := func(msg *nats.Msg) {
+			messagesChan <- msg
+		}
+		if conf.queueGroup != "" {
+			_, err = conn.QueueSubscribe(conf.subscriptionName, conf.queueGroup, handler)
+		} else {
+			_, err = conn.Subscribe(conf.subscriptionName, handler)
+		}
+		if err != nil {
+			return nil, wrapError(ErrNATSubscription, err.Error())
+		}
 	}
 	deadLetterMessagesChan := make(chan *nats.Msg)
-	_, err = conn.Subscribe(conf.deadLetterSubscriptionName, func(msg *nats.Msg) {
+	deadLetterHandler := func(msg *nats.Msg) {
 		deadLetterMessagesChan <- msg
-	})
+	}
+	if conf.queueGroup != "" {
+		_, err = conn.QueueSubscribe(
+			conf.deadLetterSubscriptionName, conf.queueGroup, deadLetterHandler,
+		)
+	} else {
+		_, err = conn.Subscribe(conf.deadLetterSubscriptionName, deadLetterHandler)
+	}
 	if err != nil {
 		return nil, wrapError(ErrNATSubscription, err.Error())
 	}
@@ -127,6 +280,7 @@ func NewNATSBroker(bus EventBus, conf NATSConfig) (*NATSBroker, error) {
 		conf:                   conf,
 		messagesChan:           messagesChan,
 		deadLetterMessagesChan: deadLetterMessagesChan,
+		jsSub:                  jsSub,
 	}, nil
 }
 
@@ -136,14 +290,17 @@ func (n *NATSBroker) CloseConnection() {
 	n.conn.Close()
 }
 
-// Process starts cosuming messages from a given subscription
+// Process starts cosuming messages from a given subscription, handling
+// them through the configured workers (see NATSConfig.WithWorkers)
+// Messages with a reply subject are answered with a Reply once processed,
+// whether they failed or not; but for JetStream's, whose reply subject is
+// the one for acknowledging them
 func (n *NATSBroker) Process(ctx context.Context) <-chan error {
 	errChan := make(chan error)
 	errMsgHandler := func(err error, msg *nats.Msg) {
 		errChan <- wrapError(ErrEventBus, err.Error())
-		err = n.conn.Publish(fmt.Sprintf(deadLetter, msg.Subject), msg.Data)
-		if err != nil {
-			errChan <- wrapError(ErrDeadLetterPublish, err.Error())
+		if err := n.publishDeadLetter(msg, err, nil); err != nil {
+			errChan <- err
 		}
 	}
 	errHandler := func(err error) {
@@ -151,16 +308,43 @@ func (n *NATSBroker) Process(ctx context.Context) <-chan error {
 	}
 	msgHandler := func(msg *nats.Msg) error {
 		event := Message{
-			data: msg.Data,
+			data:   msg.Data,
+			header: msg.Header,
+		}
+		if msg.Reply == "" {
+			return n.bus.Resolve(ctx, event)
+		}
+		resultCtx, result := eventbus.ContextWithResult(ctx)
+		err := n.bus.Resolve(resultCtx, event)
+		if replyErr := n.reply(msg, NewReply(result, err)); replyErr != nil {
+			errHandler(replyErr)
 		}
-		return n.bus.Resolve(ctx, event)
+		return err
 	}
 	go func() {
 		defer close(errChan)
+		if n.jsSub != nil {
+			pool := newWorkerPool(ctx, n.conf.workers, n.conf.queueSize, func(msg *nats.Msg) {
+				n.handleJetStreamMsg(ctx, msg, errHandler)
+			})
+			defer pool.wait()
+			n.processJetStream(ctx, pool, errHandler)
+			return
+		}
+		pool := newWorkerPool(ctx, n.conf.workers, n.conf.queueSize, func(msg *nats.Msg) {
+			if err := msgHandler(msg); err != nil {
+				errMsgHandler(err, msg)
+			}
+		})
+		defer pool.wait()
+		dispatch := func(msg *nats.Msg) error {
+			pool.dispatch(ctx, msg)
+			return nil
+		}
 		n.processMsgChan(
 			ctx,
 			n.messagesChan,
-			msgHandler,
+			dispatch,
 			errHandler,
 			errMsgHandler,
 		)
@@ -168,10 +352,37 @@ func (n *NATSBroker) Process(ctx context.Context) <-chan error {
 	return errChan
 }
 
+// publishDeadLetter sends msg to its dead letter subject, see deadLetterMsg
+func (n *NATSBroker) publishDeadLetter(msg *nats.Msg, err error,
+	headers map[string]string) error {
+	if err := n.conn.PublishMsg(deadLetterMsg(msg, err, headers)); err != nil {
+		return wrapError(ErrDeadLetterPublish, err.Error())
+	}
+	return nil
+}
+
+// deadLetterMsg builds the dead letter of msg, addressed to its dead letter
+// subject, with the reason and error of its failure, err, and the passed headers
+func deadLetterMsg(msg *nats.Msg, err error, headers map[string]string) *nats.Msg {
+	deadMsg := nats.NewMsg(fmt.Sprintf(deadLetter, msg.Subject))
+	deadMsg.Data = msg.Data
+	for key, values := range msg.Header {
+		deadMsg.Header[key] = values
+	}
+	deadMsg.Header.Set(DeadLetterReasonHeader, DeadLetterReason(err))
+	deadMsg.Header.Set(DeadLetterErrorHeader, err.Error())
+	deadMsg.Header.Set(DeadLetterSubjectHeader, msg.Subject)
+	deadMsg.Header.Set(DeadLetterFailedAtHeader, time.Now().UTC().Format(time.RFC3339))
+	for key, value := range headers {
+		deadMsg.Header.Set(key, value)
+	}
+	return deadMsg
+}
+
 // ProcessDead starts cosuming messages from a given subscription's deadLetter
 func (n *NATSBroker) ProcessDead(
 	ctx context.Context,
-	msgHandler func(msg *nats.Msg) error,
+	msgHandler func(DeadLetter) error,
 ) <-chan error {
 	errChan := make(chan error)
 	errHandler := func(err error) {
@@ -185,7 +396,9 @@ func (n *NATSBroker) ProcessDead(
 		n.processMsgChan(
 			ctx,
 			n.deadLetterMessagesChan,
-			msgHandler,
+			func(msg *nats.Msg) error {
+				return msgHandler(newDeadLetter(msg))
+			},
 			errHandler,
 			errMsgHandler,
 		)
@@ -223,14 +436,111 @@ func (n *NATSBroker) processMsgChan(
 	}
 }
 
+// DomainEventSource is the CloudEvents' source of the domain events published
+const DomainEventSource = "/posts"
+
+var _ Broker = &NATSBroker{}
+
+// Publish implements usecase.Publisher, sending the event to the subject
+// named after it, see domainEventMsg
+func (n *NATSBroker) Publish(ctx context.Context, event usecase.DomainEvent) error {
+	msg, err := domainEventMsg(ctx, event)
+	if err != nil {
+		return err
+	}
+	if err := n.conn.PublishMsg(msg); err != nil {
+		return wrapError(ErrDomainEventPublish, err.Error())
+	}
+	return nil
+}
+
+// domainEventMsg builds the message of event, addressed to the subject
+// named after it, in CloudEvents' binary content mode: the post is the
+// message's data, and the attributes travel as ce- headers, ce-id being
+// the event's ID. The actor and correlation id of the event being
+// handled, if any, are propagated
+func domainEventMsg(ctx context.Context, event usecase.DomainEvent) (*nats.Msg, error) {
+	data, err := json.Marshal(event.Post)
+	if err != nil {
+		return nil, wrapError(ErrDomainEventPublish, err.Error())
+	}
+	msg := nats.NewMsg(event.Name)
+	msg.Data = data
+	msg.Header.Set(CloudEventsHeaderPrefix+"specversion", eventbus.SpecVersion)
+	id := event.ID
+	if id == "" {
+		id = nuid.Next()
+	}
+	msg.Header.Set(CloudEventsHeaderPrefix+"id", id)
+	msg.Header.Set(CloudEventsHeaderPrefix+"source", DomainEventSource)
+	msg.Header.Set(CloudEventsHeaderPrefix+"type", event.Name)
+	msg.Header.Set(CloudEventsHeaderPrefix+"time", event.OccurredAt.Format(time.RFC3339Nano))
+	msg.Header.Set(CloudEventsHeaderPrefix+"subject", event.Post.Id)
+	msg.Header.Set(contentTypeHeader, "application/json")
+	if envelope, ok := eventbus.EnvelopeFromContext(ctx); ok {
+		correlationID := envelope.CorrelationID
+		if correlationID == "" {
+			correlationID = envelope.ID
+		}
+		if correlationID != "" {
+			msg.Header.Set(CloudEventsHeaderPrefix+"correlationid", correlationID)
+		}
+		if envelope.Actor != "" {
+			msg.Header.Set(CloudEventsHeaderPrefix+"actor", envelope.Actor)
+		}
+	}
+	return msg, nil
+}
+
 // Message is a wrapper for *nats.Msg
 type Message struct {
-	data []byte
+	data   []byte
+	header nats.Header
+}
+
+var _ eventbus.AttributedEvent = Message{}
+
+// NewMessage is a constructor, for messages not received through
+// a NATSBroker, such as the ones replayed from dead letters
+func NewMessage(data []byte, header nats.Header) Message {
+	return Message{data: data, header: header}
 }
 
 // Data returns the data associated to the Message
 func (m Message) Data() []byte { return m.data }
 
+const (
+	// CloudEventsHeaderPrefix is the prefix of the headers holding
+	// CloudEvents' attributes, in binary content mode
+	CloudEventsHeaderPrefix = "ce-"
+	contentTypeHeader       = "Content-Type"
+)
+
+// Attributes maps the CloudEvents' headers of the Message (ce-id, ce-type...)
+// to the event's attributes. The Content-Type header is mapped to
+// datacontenttype. No attributes are returned when ce-specversion is missing
+func (m Message) Attributes() map[string]string {
+	attributes := map[string]string{}
+	for key, values := range m.header {
+		if len(values) == 0 {
+			continue
+		}
+		lowered := strings.ToLower(key)
+		if strings.HasPrefix(lowered, CloudEventsHeaderPrefix) {
+			attributes[strings.TrimPrefix(lowered, CloudEventsHeaderPrefix)] = values[0]
+		}
+	}
+	if _, ok := attributes["specversion"]; !ok {
+		return nil
+	}
+	for key, values := range m.header {
+		if strings.EqualFold(key, contentTypeHeader) && len(values) > 0 {
+			attributes["datacontenttype"] = values[0]
+		}
+	}
+	return attributes
+}
+
 func wrapError(err error, msg string) error {
 	return fmt.Errorf("%w: %s", err, msg)
 }
@@ -2,18 +2,20 @@ package broker
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io/ioutil"
 	"log"
 	"math/rand"
 	"os"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/mountolive/back-blog-go/post/eventbus"
+	"github.com/mountolive/back-blog-go/post/usecase"
 	"github.com/nats-io/nats.go"
-	"github.com/ory/dockertest/v3"
-	"github.com/ory/dockertest/v3/docker"
 	"github.com/stretchr/testify/require"
 )
 
@@ -46,6 +48,74 @@ func TestNATSConfig(t *testing.T) {
 	})
 }
 
+func TestDeadLetterReason(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name     string
+		err      error
+		expected string
+	}{
+		{"Malformed message", eventbus.ErrUnmarshalingMessage, ReasonMalformedMessage},
+		{"Missing name", eventbus.ErrMissingNameParam, ReasonMalformedMessage},
+		{"Invalid envelope", eventbus.ErrInvalidEnvelope, ReasonMalformedMessage},
+		{"Upcast failed", eventbus.ErrUpcast, ReasonMalformedMessage},
+		{"Not registered", eventbus.ErrEventNotRegistered, ReasonEventNotRegistered},
+		{
+			"Version conflict",
+			fmt.Errorf("update post: %w", usecase.ErrVersionConflict),
+			ReasonVersionConflict,
+		},
+		{
+			"Event in progress",
+			fmt.Errorf("%w: some-key", eventbus.ErrEventInProgress),
+			ReasonEventInProgress,
+		},
+		{"Forbidden", fmt.Errorf("delete post: %w", usecase.ErrForbidden), ReasonForbidden},
+		{"Any other error", errors.New("boom"), ReasonHandlerError},
+	}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			require.Equal(t, tc.expected, DeadLetterReason(tc.err))
+		})
+	}
+}
+
+func TestMessageAttributes(t *testing.T) {
+	t.Parallel()
+
+	t.Run("CloudEvents headers", func(t *testing.T) {
+		msg := Message{header: nats.Header{
+			"Ce-Specversion":   {"1.0"},
+			"ce-id":            {"some-id"},
+			"CE-TYPE":          {"posts.v1.create"},
+			"ce-correlationid": {"some-correlation"},
+			"Content-Type":     {"application/json"},
+			"Nats-Msg-Id":      {"ignored"},
+		}}
+		require.Equal(t, map[string]string{
+			"specversion":     "1.0",
+			"id":              "some-id",
+			"type":            "posts.v1.create",
+			"correlationid":   "some-correlation",
+			"datacontenttype": "application/json",
+		}, msg.Attributes())
+	})
+
+	t.Run("No specversion", func(t *testing.T) {
+		msg := Message{header: nats.Header{
+			"ce-id":        {"some-id"},
+			"Content-Type": {"application/json"},
+		}}
+		require.Empty(t, msg.Attributes())
+	})
+
+	t.Run("No headers", func(t *testing.T) {
+		require.Empty(t, Message{data: []byte("{}")}.Attributes())
+	})
+}
+
 var _ eventbus.Event = mockEvent{}
 
 type mockEvent struct {
@@ -179,12 +249,16 @@ func TestNATSBroker(t *testing.T) {
 				require.Error(t, err)
 				errCount++
 			}
-			deadMsgHandler := func(msg *nats.Msg) error {
+			deadMsgHandler := func(msg DeadLetter) error {
 				require.Equal(
 					t,
 					fmt.Sprintf(testingMsg, msgNameNum),
 					string(msg.Data),
 				)
+				require.Equal(t, ReasonHandlerError, msg.Header.Get(DeadLetterReasonHeader))
+				require.Equal(t, mockErr.Error(), msg.Header.Get(DeadLetterErrorHeader))
+				require.Equal(t, subscriptionName, msg.Header.Get(DeadLetterSubjectHeader))
+				require.NotEmpty(t, msg.Header.Get(DeadLetterFailedAtHeader))
 				return nil
 			}
 			for err := range broker.ProcessDead(ctx, deadMsgHandler) {
@@ -194,61 +268,288 @@ func TestNATSBroker(t *testing.T) {
 			require.Equal(t, 3, errCount)
 		})
 	})
-}
 
-func testMainWrapper(m *testing.M) int {
-	pool, err := dockertest.NewPool("")
-	if err != nil {
-		log.Fatalf("error starting docker: %s\n", err)
-	}
+	t.Run("Request reply", func(t *testing.T) {
+		subscriptionName := "request"
+		bus := &mockNonErroredEventBus{}
+		bus.resolveFunc = func(ctx context.Context, ev eventbus.Event) error {
+			if string(ev.Data()) == "fail" {
+				return fmt.Errorf("update post: %w", usecase.ErrVersionConflict)
+			}
+			eventbus.RecordResult(ctx, "id", "some-id")
+			return nil
+		}
+		broker, err := NewNATSBroker(bus, DefaultNATSConfig(subscriptionName))
+		require.NoError(t, err)
+		defer broker.CloseConnection()
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		errChan := broker.Process(ctx)
+		go func() {
+			for range errChan {
+			}
+		}()
 
-	containerName := "blog_post_nats"
-	basePort := "4222"
-	runOptions := &dockertest.RunOptions{
-		Repository:   "nats",
-		Tag:          "2.1",
-		Name:         containerName,
-		ExposedPorts: []string{basePort},
-		PortBindings: map[docker.Port][]docker.PortBinding{
-			docker.Port(basePort): {
-				{
-					HostIP:   "0.0.0.0",
-					HostPort: basePort,
+		requestCtx, cancelRequest := context.WithTimeout(ctx, 5*time.Second)
+		defer cancelRequest()
+		msg := nats.NewMsg(subscriptionName)
+		msg.Data = []byte("succeed")
+		reply, err := Request(requestCtx, broker.conn, msg)
+		require.NoError(t, err)
+		require.True(t, reply.Success)
+		require.Equal(t, "some-id", reply.Result["id"])
+
+		msg = nats.NewMsg(subscriptionName)
+		msg.Data = []byte("fail")
+		reply, err = Request(requestCtx, broker.conn, msg)
+		require.NoError(t, err)
+		require.False(t, reply.Success)
+		require.Equal(t, CodeVersionConflict, reply.Error.Code)
+	})
+
+	t.Run("Queue group", func(t *testing.T) {
+		subscriptionName := "grouped"
+		total := 20
+		var mu sync.Mutex
+		handled := []int{0, 0}
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+		var wg sync.WaitGroup
+		for i := range handled {
+			i := i
+			bus := &mockNonErroredEventBus{
+				resolveFunc: func(context.Context, eventbus.Event) error {
+					mu.Lock()
+					defer mu.Unlock()
+					handled[i]++
+					return nil
 				},
-			},
-		},
-	}
+			}
+			conf := DefaultNATSConfig(subscriptionName).
+				WithQueueGroup("posts").
+				WithWorkers(4, 10)
+			broker, err := NewNATSBroker(bus, conf)
+			require.NoError(t, err)
+			defer broker.CloseConnection()
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for range broker.Process(ctx) {
+				}
+			}()
+		}
+		producerConn, err := nats.Connect(DefaultNATSConfig(subscriptionName).URL())
+		require.NoError(t, err)
+		defer producerConn.Close()
+		for i := 0; i < total; i++ {
+			err := producerConn.Publish(subscriptionName, []byte(fmt.Sprintf(testingMsg, i)))
+			require.NoError(t, err)
+		}
+		require.NoError(t, producerConn.Flush())
+		wg.Wait()
+		mu.Lock()
+		defer mu.Unlock()
+		require.Equal(t, total, handled[0]+handled[1], "each message should be handled once")
+		require.NotZero(t, handled[0], "load should be shared")
+		require.NotZero(t, handled[1], "load should be shared")
+	})
 
-	container, err := pool.RunWithOptions(runOptions)
-	if err != nil {
-		log.Fatalf("error occurred setting the container: %s", err)
-	}
-	defer func() {
-		if err := pool.Purge(container); err != nil {
-			errRemove := pool.RemoveContainerByName(containerName)
-			if errRemove != nil {
-				log.Fatalf("error removing the container: %s\n", errRemove)
+	t.Run("JetStream", func(t *testing.T) {
+		// jetStreamBroker consumes subject through a JetStream consumer, resolving
+		// the messages with resolve; it returns the broker and its dead letters
+		jetStreamBroker := func(subject string, maxDeliver int,
+			resolve func(context.Context, eventbus.Event) error,
+		) (*NATSBroker, *nats.Subscription) {
+			bus := &mockNonErroredEventBus{resolveFunc: resolve}
+			jsConf := DefaultJetStreamConfig(subject+"-stream", subject+"-consumer")
+			jsConf.MaxDeliver = maxDeliver
+			jsConf.InitialBackoff = 10 * time.Millisecond
+			jsConf.Retryable = func(err error) bool {
+				return !errors.Is(err, usecase.ErrVersionConflict)
+			}
+			conf := DefaultNATSConfig(subject).WithJetStream(jsConf)
+			broker, err := NewNATSBroker(bus, conf)
+			require.NoError(t, err)
+			t.Cleanup(broker.CloseConnection)
+			deadLetters, err := broker.conn.SubscribeSync(fmt.Sprintf(deadLetter, subject))
+			require.NoError(t, err)
+			return broker, deadLetters
+		}
+		// publish sends the messages to the stream, before processing
+		// starts, as if they were sent while the service was down
+		publish := func(broker *NATSBroker, subject string, data ...string) {
+			js, err := broker.conn.JetStream()
+			require.NoError(t, err)
+			for _, d := range data {
+				_, err := js.Publish(subject, []byte(d))
+				require.NoError(t, err)
 			}
-			_ = pool.RemoveContainerByName(containerName)
-			log.Fatalf("error purging the container: %s\n", err)
 		}
-	}()
+		process := func(broker *NATSBroker, timeout time.Duration) {
+			ctx, cancel := context.WithTimeout(context.Background(), timeout)
+			defer cancel()
+			for range broker.Process(ctx) {
+			}
+		}
+		var mu sync.Mutex
 
-	retryFunc := func() error {
-		conn, err := nats.Connect(nats.DefaultURL)
-		if err != nil {
-			return err
+		t.Run("Ack", func(t *testing.T) {
+			resolved := []string{}
+			broker, deadLetters := jetStreamBroker("jsack", 3,
+				func(_ context.Context, ev eventbus.Event) error {
+					mu.Lock()
+					defer mu.Unlock()
+					resolved = append(resolved, string(ev.Data()))
+					return nil
+				})
+			publish(broker, "jsack", "first", "second")
+			process(broker, time.Second)
+			mu.Lock()
+			require.Equal(t, []string{"first", "second"}, resolved)
+			mu.Unlock()
+			info, err := broker.jsSub.ConsumerInfo()
+			require.NoError(t, err)
+			require.Zero(t, info.NumPending)
+			require.Zero(t, info.NumAckPending)
+			_, err = deadLetters.NextMsg(100 * time.Millisecond)
+			require.True(t, errors.Is(err, nats.ErrTimeout))
+		})
+
+		t.Run("Redelivery", func(t *testing.T) {
+			calls := 0
+			broker, deadLetters := jetStreamBroker("jsredelivery", 3,
+				func(context.Context, eventbus.Event) error {
+					mu.Lock()
+					defer mu.Unlock()
+					calls++
+					if calls < 3 {
+						return errors.New("transient")
+					}
+					return nil
+				})
+			publish(broker, "jsredelivery", "retried")
+			process(broker, 2*time.Second)
+			mu.Lock()
+			require.Equal(t, 3, calls)
+			mu.Unlock()
+			_, err := deadLetters.NextMsg(100 * time.Millisecond)
+			require.True(t, errors.Is(err, nats.ErrTimeout))
+		})
+
+		t.Run("Redelivery doesn't hold the following messages", func(t *testing.T) {
+			resolved := []string{}
+			failed := false
+			broker, _ := jetStreamBroker("jsorder", 3,
+				func(_ context.Context, ev eventbus.Event) error {
+					mu.Lock()
+					defer mu.Unlock()
+					if string(ev.Data()) == "first" && !failed {
+						failed = true
+						return errors.New("transient")
+					}
+					resolved = append(resolved, string(ev.Data()))
+					return nil
+				})
+			publish(broker, "jsorder", "first", "second")
+			process(broker, time.Second)
+			mu.Lock()
+			require.Equal(t, []string{"second", "first"}, resolved,
+				"a retried message should be redelivered after its backoff")
+			mu.Unlock()
+		})
+
+		t.Run("Dead letter after max deliver", func(t *testing.T) {
+			mockErr := errors.New("always failing")
+			broker, deadLetters := jetStreamBroker("jsmaxdeliver", 2,
+				func(context.Context, eventbus.Event) error { return mockErr })
+			publish(broker, "jsmaxdeliver", "dead")
+			process(broker, 2*time.Second)
+			msg, err := deadLetters.NextMsg(time.Second)
+			require.NoError(t, err)
+			require.Equal(t, "dead", string(msg.Data))
+			require.Equal(t, ReasonHandlerError, msg.Header.Get(DeadLetterReasonHeader))
+			require.Equal(t, mockErr.Error(), msg.Header.Get(DeadLetterErrorHeader))
+			require.Equal(t, "2", msg.Header.Get(DeadLetterDeliveriesHeader))
+			require.Equal(t, "jsmaxdeliver-stream", msg.Header.Get(DeadLetterStreamHeader))
+			require.Equal(t, "1", msg.Header.Get(DeadLetterStreamSequenceHeader))
+			require.NotEmpty(t, msg.Header.Get(DeadLetterFailedAtHeader))
+		})
+
+		t.Run("Dead letter on permanent failure", func(t *testing.T) {
+			calls := 0
+			broker, deadLetters := jetStreamBroker("jspermanent", 5,
+				func(context.Context, eventbus.Event) error {
+					mu.Lock()
+					defer mu.Unlock()
+					calls++
+					return fmt.Errorf("update post: %w", usecase.ErrVersionConflict)
+				})
+			publish(broker, "jspermanent", "conflicting")
+			process(broker, time.Second)
+			msg, err := deadLetters.NextMsg(time.Second)
+			require.NoError(t, err)
+			require.Equal(t, ReasonVersionConflict, msg.Header.Get(DeadLetterReasonHeader))
+			require.Equal(t, "1", msg.Header.Get(DeadLetterDeliveriesHeader))
+			mu.Lock()
+			require.Equal(t, 1, calls)
+			mu.Unlock()
+		})
+	})
+
+	t.Run("Publish", func(t *testing.T) {
+		broker, err := NewNATSBroker(notErroredBus, DefaultNATSConfig("publish"))
+		require.NoError(t, err)
+		defer broker.CloseConnection()
+		sub, err := broker.conn.SubscribeSync(usecase.PostCreatedEventNameV1)
+		require.NoError(t, err)
+
+		post := usecase.Post{Id: "some-id", Title: "title", Creator: "someone", Version: 1}
+		ctx := eventbus.ContextWithEnvelope(context.Background(), eventbus.Envelope{
+			ID:    "command-id",
+			Actor: "someone",
+		})
+		event := usecase.DomainEvent{
+			Name:       usecase.PostCreatedEventNameV1,
+			Post:       post,
+			OccurredAt: time.Now(),
 		}
-		defer conn.Close()
-		return nil
+		require.NoError(t, broker.Publish(ctx, event))
+
+		msg, err := sub.NextMsg(5 * time.Second)
+		require.NoError(t, err)
+		attributes := Message{data: msg.Data, header: msg.Header}.Attributes()
+		require.Equal(t, eventbus.SpecVersion, attributes["specversion"])
+		require.NotEmpty(t, attributes["id"])
+		require.Equal(t, DomainEventSource, attributes["source"])
+		require.Equal(t, usecase.PostCreatedEventNameV1, attributes["type"])
+		require.Equal(t, post.Id, attributes["subject"])
+		require.Equal(t, "command-id", attributes["correlationid"])
+		require.Equal(t, "someone", attributes["actor"])
+		require.Equal(t, "application/json", attributes["datacontenttype"])
+		published := usecase.Post{}
+		require.NoError(t, json.Unmarshal(msg.Data, &published))
+		require.Equal(t, post.Title, published.Title)
+		require.Equal(t, post.Version, published.Version)
+	})
+}
+
+// testMainWrapper runs the tests against an embedded NATS server,
+// with JetStream, on the default port
+func testMainWrapper(m *testing.M) int {
+	storeDir, err := ioutil.TempDir("", "blog_post_nats")
+	if err != nil {
+		log.Fatalf("error creating the JetStream's store dir: %s\n", err)
 	}
-	if err := pool.Retry(retryFunc); err != nil {
-		err2 := pool.RemoveContainerByName(containerName)
-		if err2 != nil {
-			log.Fatalf("error removing the container: %s\n", err2)
-		}
+	defer os.RemoveAll(storeDir)
+
+	srv, err := StartEmbeddedNATSServer(EmbeddedNATSConfig{
+		Port:     nats.DefaultPort,
+		StoreDir: storeDir,
+	})
+	if err != nil {
 		log.Fatalf("error occurred initializing the nats server: %s\n", err)
 	}
+	defer srv.Shutdown()
 
 	return m.Run()
 }
@@ -0,0 +1,91 @@
+package broker
+
+import (
+	"errors"
+	"net"
+	"time"
+
+	"github.com/nats-io/nats-server/v2/server"
+)
+
+// ErrEmbeddedNATSServer indicates that the embedded NATS server couldn't start
+var ErrEmbeddedNATSServer = errors.New("embedded NATS server failed")
+
+// embeddedNATSReadyTimeout is the time the embedded NATS server
+// can take to accept connections
+const embeddedNATSReadyTimeout = 10 * time.Second
+
+// EmbeddedNATSConfig configures a NATS server running in the same process
+type EmbeddedNATSConfig struct {
+	// Host to listen on, 127.0.0.1 if empty
+	Host string
+	// Port to listen on, a random one if 0
+	Port int
+	// StoreDir is the directory of JetStream's streams; JetStream
+	// is only enabled along with one
+	StoreDir string
+}
+
+// EmbeddedNATSServer is a NATS server running in the same process, so
+// the service (or its integration tests) doesn't need an external one
+type EmbeddedNATSServer struct {
+	srv  *server.Server
+	host string
+	port uint16
+}
+
+// StartEmbeddedNATSServer starts a NATS server, waiting until
+// it accepts connections
+func StartEmbeddedNATSServer(conf EmbeddedNATSConfig) (*EmbeddedNATSServer, error) {
+	opts := &server.Options{
+		Host:   conf.Host,
+		Port:   conf.Port,
+		NoLog:  true,
+		NoSigs: true,
+	}
+	if opts.Host == "" {
+		opts.Host = "127.0.0.1"
+	}
+	if opts.Port == 0 {
+		opts.Port = server.RANDOM_PORT
+	}
+	if conf.StoreDir != "" {
+		opts.JetStream = true
+		opts.StoreDir = conf.StoreDir
+	}
+	srv, err := server.NewServer(opts)
+	if err != nil {
+		return nil, wrapError(ErrEmbeddedNATSServer, err.Error())
+	}
+	go srv.Start()
+	if !srv.ReadyForConnections(embeddedNATSReadyTimeout) {
+		srv.Shutdown()
+		return nil, wrapError(ErrEmbeddedNATSServer, "not ready for connections")
+	}
+	addr, ok := srv.Addr().(*net.TCPAddr)
+	if !ok {
+		srv.Shutdown()
+		return nil, wrapError(ErrEmbeddedNATSServer, "unknown listening address")
+	}
+	return &EmbeddedNATSServer{srv: srv, host: opts.Host, port: uint16(addr.Port)}, nil
+}
+
+// NATSConfig returns a standard configuration for the passed
+// subscription's name, connecting to the embedded server
+func (e *EmbeddedNATSServer) NATSConfig(subsName string) NATSConfig {
+	conf := DefaultNATSConfig(subsName)
+	conf.host = e.host
+	conf.port = e.port
+	return conf
+}
+
+// URL returns the necessary URL to connect to the embedded server
+func (e *EmbeddedNATSServer) URL() string {
+	return e.NATSConfig("").URL()
+}
+
+// Shutdown stops the embedded server, waiting until it's done
+func (e *EmbeddedNATSServer) Shutdown() {
+	e.srv.Shutdown()
+	e.srv.WaitForShutdown()
+}
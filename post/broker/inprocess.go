@@ -0,0 +1,210 @@
+package broker
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/mountolive/back-blog-go/post/eventbus"
+	"github.com/mountolive/back-blog-go/post/usecase"
+	"github.com/nats-io/nats.go"
+)
+
+var (
+	// ErrBrokerClosed is self-described
+	ErrBrokerClosed = errors.New("in-process broker closed")
+	// ErrDeadLetterQueueFull indicates that a dead letter was dropped,
+	// as nobody is processing them
+	ErrDeadLetterQueueFull = errors.New("in-process dead letter queue full")
+)
+
+// defaultDeadLetterQueueSize is the number of dead letters an
+// InProcessBroker keeps while they aren't processed
+const defaultDeadLetterQueueSize = 64
+
+// inProcessMsg is a message sent to an InProcessBroker, along with
+// where to send its Reply, if anyone is waiting for it
+type inProcessMsg struct {
+	msg   *nats.Msg
+	reply chan Reply
+}
+
+// InProcessBroker implementation of a Broker on top of channels, for
+// feeding the EventBus from the same process in tests, without a NATS
+// server. The service always runs a NATSBroker; in single binary mode,
+// against an embedded NATS server (see StartEmbeddedNATSServer)
+// Messages are sent through Send or Request, and resolved one at a time,
+// in order. Failed ones are dead-lettered as a NATSBroker does; they're
+// dropped while the dead letter queue is full
+type InProcessBroker struct {
+	bus         EventBus
+	subject     string
+	messages    chan inProcessMsg
+	deadLetters chan *nats.Msg
+	closed      chan struct{}
+	closeOnce   sync.Once
+	mu          sync.RWMutex
+	subscribers map[string][]func(*nats.Msg)
+}
+
+var _ Broker = &InProcessBroker{}
+
+// NewInProcessBroker is a constructor, subject is the one
+// assigned to the messages sent without one
+func NewInProcessBroker(bus EventBus, subject string) *InProcessBroker {
+	return &InProcessBroker{
+		bus:         bus,
+		subject:     subject,
+		messages:    make(chan inProcessMsg),
+		deadLetters: make(chan *nats.Msg, defaultDeadLetterQueueSize),
+		closed:      make(chan struct{}),
+		subscribers: map[string][]func(*nats.Msg){},
+	}
+}
+
+// Send queues msg to be processed, waiting until it's taken,
+// ctx is done or the broker is closed
+func (b *InProcessBroker) Send(ctx context.Context, msg *nats.Msg) error {
+	return b.send(ctx, inProcessMsg{msg: msg})
+}
+
+// Request sends msg and waits for its Reply, until ctx is done
+func (b *InProcessBroker) Request(ctx context.Context, msg *nats.Msg) (Reply, error) {
+	reply := make(chan Reply, 1)
+	if err := b.send(ctx, inProcessMsg{msg: msg, reply: reply}); err != nil {
+		return Reply{}, err
+	}
+	select {
+	case <-ctx.Done():
+		return Reply{}, wrapError(ErrRequest, ctx.Err().Error())
+	case r := <-reply:
+		return r, nil
+	}
+}
+
+func (b *InProcessBroker) send(ctx context.Context, msg inProcessMsg) error {
+	if msg.msg.Subject == "" {
+		msg.msg.Subject = b.subject
+	}
+	select {
+	case <-ctx.Done():
+		return wrapError(ErrContextCanceled, ctx.Err().Error())
+	case <-b.closed:
+		return ErrBrokerClosed
+	case b.messages <- msg:
+		return nil
+	}
+}
+
+// Process starts consuming the messages sent, until ctx is done
+// or the broker is closed. Messages sent through Request are
+// answered with a Reply once processed, whether they failed or not
+func (b *InProcessBroker) Process(ctx context.Context) <-chan error {
+	errChan := make(chan error)
+	go func() {
+		defer close(errChan)
+		for {
+			select {
+			case <-ctx.Done():
+				errChan <- wrapError(ErrContextCanceled, ctx.Err().Error())
+				return
+			case <-b.closed:
+				errChan <- ErrBrokerClosed
+				return
+			case msg := <-b.messages:
+				if err := b.resolve(ctx, msg); err != nil {
+					errChan <- wrapError(ErrEventBus, err.Error())
+					if err := b.deadLetter(msg.msg, err); err != nil {
+						errChan <- err
+					}
+				}
+			}
+		}
+	}()
+	return errChan
+}
+
+func (b *InProcessBroker) resolve(ctx context.Context, msg inProcessMsg) error {
+	event := Message{data: msg.msg.Data, header: msg.msg.Header}
+	if msg.reply == nil {
+		return b.bus.Resolve(ctx, event)
+	}
+	resultCtx, result := eventbus.ContextWithResult(ctx)
+	err := b.bus.Resolve(resultCtx, event)
+	msg.reply <- NewReply(result, err)
+	return err
+}
+
+// deadLetter queues the dead letter of msg, failed with err
+func (b *InProcessBroker) deadLetter(msg *nats.Msg, err error) error {
+	select {
+	case b.deadLetters <- deadLetterMsg(msg, err, nil):
+		return nil
+	default:
+		return wrapError(ErrDeadLetterQueueFull, msg.Subject)
+	}
+}
+
+// ProcessDead starts consuming the dead letters, until ctx is
+// done or the broker is closed
+func (b *InProcessBroker) ProcessDead(
+	ctx context.Context,
+	msgHandler func(DeadLetter) error,
+) <-chan error {
+	errChan := make(chan error)
+	go func() {
+		defer close(errChan)
+		for {
+			select {
+			case <-ctx.Done():
+				errChan <- wrapError(ErrContextCanceled, ctx.Err().Error())
+				return
+			case <-b.closed:
+				errChan <- ErrBrokerClosed
+				return
+			case msg := <-b.deadLetters:
+				if err := msgHandler(newDeadLetter(msg)); err != nil {
+					errChan <- err
+				}
+			}
+		}
+	}()
+	return errChan
+}
+
+// Subscribe calls handler with every domain event published to subject,
+// synchronously, as they're published
+func (b *InProcessBroker) Subscribe(subject string, handler func(*nats.Msg)) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.subscribers[subject] = append(b.subscribers[subject], handler)
+}
+
+// Publish implements usecase.Publisher, passing the event to the
+// subscribers of the subject named after it, as a NATSBroker would send it
+func (b *InProcessBroker) Publish(ctx context.Context, event usecase.DomainEvent) error {
+	select {
+	case <-b.closed:
+		return wrapError(ErrDomainEventPublish, ErrBrokerClosed.Error())
+	default:
+	}
+	msg, err := domainEventMsg(ctx, event)
+	if err != nil {
+		return err
+	}
+	b.mu.RLock()
+	handlers := b.subscribers[msg.Subject]
+	b.mu.RUnlock()
+	for _, handler := range handlers {
+		handler(msg)
+	}
+	return nil
+}
+
+// CloseConnection stops the processing of messages,
+// the ones sent afterwards are rejected
+func (b *InProcessBroker) CloseConnection() {
+	b.closeOnce.Do(func() {
+		close(b.closed)
+	})
+}
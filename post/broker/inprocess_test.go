@@ -0,0 +1,155 @@
+package broker
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/mountolive/back-blog-go/post/eventbus"
+	"github.com/mountolive/back-blog-go/post/usecase"
+	"github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInProcessBroker(t *testing.T) {
+	t.Parallel()
+
+	newMsg := func(data string) *nats.Msg {
+		return &nats.Msg{Data: []byte(data), Header: nats.Header{}}
+	}
+
+	t.Run("Process", func(t *testing.T) {
+		resolved := make(chan string, 2)
+		bus := &mockNonErroredEventBus{
+			resolveFunc: func(_ context.Context, ev eventbus.Event) error {
+				resolved <- string(ev.Data())
+				return nil
+			},
+		}
+		broker := NewInProcessBroker(bus, "in-process")
+		ctx, cancel := context.WithCancel(context.Background())
+		errChan := broker.Process(ctx)
+
+		require.NoError(t, broker.Send(ctx, newMsg("first")))
+		require.NoError(t, broker.Send(ctx, newMsg("second")))
+		require.Equal(t, "first", <-resolved)
+		require.Equal(t, "second", <-resolved)
+		cancel()
+		err := <-errChan
+		require.True(t, errors.Is(err, ErrContextCanceled), err)
+	})
+
+	t.Run("Request reply", func(t *testing.T) {
+		bus := &mockNonErroredEventBus{
+			resolveFunc: func(ctx context.Context, _ eventbus.Event) error {
+				eventbus.RecordResult(ctx, "id", "some-id")
+				return nil
+			},
+		}
+		broker := NewInProcessBroker(bus, "in-process")
+		defer broker.CloseConnection()
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		go func() {
+			for range broker.Process(ctx) {
+			}
+		}()
+
+		reply, err := broker.Request(ctx, newMsg("request"))
+		require.NoError(t, err)
+		require.True(t, reply.Success)
+		require.Equal(t, map[string]interface{}{"id": "some-id"}, reply.Result)
+	})
+
+	t.Run("Dead letter", func(t *testing.T) {
+		mockErr := errors.New("I exploded")
+		broker := NewInProcessBroker(mockErroredEventBus{mockErr}, "in-process")
+		defer broker.CloseConnection()
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		errChan := broker.Process(ctx)
+
+		require.NoError(t, broker.Send(ctx, newMsg("failing")))
+		err := <-errChan
+		require.True(t, errors.Is(err, ErrEventBus), err)
+		deadLetters := make(chan DeadLetter, 1)
+		broker.ProcessDead(ctx, func(msg DeadLetter) error {
+			deadLetters <- msg
+			return nil
+		})
+		msg := <-deadLetters
+		require.Equal(t, "dead.in-process", msg.Subject)
+		require.Equal(t, "failing", string(msg.Data))
+		require.Equal(t, ReasonHandlerError, msg.Header.Get(DeadLetterReasonHeader))
+		require.Equal(t, mockErr.Error(), msg.Header.Get(DeadLetterErrorHeader))
+		require.Equal(t, "in-process", msg.Header.Get(DeadLetterSubjectHeader))
+	})
+
+	t.Run("Publish", func(t *testing.T) {
+		broker := NewInProcessBroker(&mockNonErroredEventBus{}, "in-process")
+		defer broker.CloseConnection()
+		var published *nats.Msg
+		broker.Subscribe(usecase.PostCreatedEventNameV1, func(msg *nats.Msg) {
+			published = msg
+		})
+
+		err := broker.Publish(context.Background(), usecase.DomainEvent{
+			Name: usecase.PostCreatedEventNameV1,
+			Post: usecase.Post{Id: "some-id"},
+		})
+		require.NoError(t, err)
+		require.NotNil(t, published)
+		attributes := Message{data: published.Data, header: published.Header}.Attributes()
+		require.Equal(t, usecase.PostCreatedEventNameV1, attributes["type"])
+		require.Equal(t, "some-id", attributes["subject"])
+	})
+
+	t.Run("Closed", func(t *testing.T) {
+		broker := NewInProcessBroker(&mockNonErroredEventBus{}, "in-process")
+		errChan := broker.Process(context.Background())
+		broker.CloseConnection()
+
+		require.True(t, errors.Is(<-errChan, ErrBrokerClosed))
+		err := broker.Send(context.Background(), newMsg("late"))
+		require.True(t, errors.Is(err, ErrBrokerClosed), err)
+	})
+}
+
+func TestEmbeddedNATSServer(t *testing.T) {
+	t.Parallel()
+
+	srv, err := StartEmbeddedNATSServer(EmbeddedNATSConfig{})
+	require.NoError(t, err)
+	defer srv.Shutdown()
+	require.NotEqual(t, nats.DefaultURL, srv.URL(), "a random port should be picked")
+
+	received := make(chan string, 1)
+	bus := &mockNonErroredEventBus{
+		resolveFunc: func(_ context.Context, ev eventbus.Event) error {
+			received <- string(ev.Data())
+			return nil
+		},
+	}
+	broker, err := NewNATSBroker(bus, srv.NATSConfig("embedded"))
+	require.NoError(t, err)
+	defer broker.CloseConnection()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	go func() {
+		for range broker.Process(ctx) {
+		}
+	}()
+
+	conn, err := nats.Connect(srv.URL())
+	require.NoError(t, err)
+	defer conn.Close()
+	require.NoError(t, conn.Publish("embedded", []byte("embedded message")))
+	require.NoError(t, conn.Flush())
+	select {
+	case data := <-received:
+		require.Equal(t, "embedded message", data)
+	case <-ctx.Done():
+		t.Fatal("message not received through the embedded server")
+	}
+}
@@ -0,0 +1,237 @@
+package broker
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/mountolive/back-blog-go/post/eventbus"
+	"github.com/nats-io/nats.go"
+)
+
+var (
+	// ErrJetStream indicates that the JetStream's stream or consumer couldn't be set up
+	ErrJetStream = errors.New("NATS JetStream setup failed")
+	// ErrJetStreamFetch is self-described
+	ErrJetStreamFetch = errors.New("NATS JetStream fetch failed")
+	// ErrJetStreamAck is self-described
+	ErrJetStreamAck = errors.New("NATS JetStream acknowledgement failed")
+)
+
+// Headers of the dead letters of JetStream messages, along with the ones
+// of every dead letter (DeadLetterReasonHeader, DeadLetterErrorHeader...)
+const (
+	// DeadLetterDeliveriesHeader holds the times the message was delivered
+	DeadLetterDeliveriesHeader = "Dead-Letter-Deliveries"
+	// DeadLetterStreamHeader holds the stream the message was stored in
+	DeadLetterStreamHeader = "Dead-Letter-Stream"
+	// DeadLetterStreamSequenceHeader holds the message's sequence in its stream
+	DeadLetterStreamSequenceHeader = "Dead-Letter-Stream-Sequence"
+)
+
+// JetStreamConfig configures the consumption of messages through a
+// JetStream durable pull consumer, so they're kept while the service is down
+type JetStreamConfig struct {
+	// Stream is the name of the stream storing the messages of the
+	// subscription's subject, it's created when missing
+	Stream string
+	// Durable is the name of the consumer, it keeps its position across restarts
+	Durable string
+	// MaxDeliver is the number of deliveries of a message before dead-lettering
+	// it, retries included
+	MaxDeliver int
+	// AckWait is the time a message can be processed before being redelivered
+	AckWait time.Duration
+	// InitialBackoff is the wait before redelivering a message failed, it
+	// doubles on each delivery, up to MaxBackoff
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	// BatchSize is the number of messages fetched at once
+	BatchSize int
+	// Retryable tells whether a failure is transient, eventbus.IsTransient if nil
+	// Messages malformed, or whose event isn't registered, are never retried
+	Retryable func(error) bool
+}
+
+// DefaultJetStreamConfig returns a standard configuration for the passed
+// stream and durable consumer
+func DefaultJetStreamConfig(stream, durable string) JetStreamConfig {
+	return JetStreamConfig{
+		Stream:         stream,
+		Durable:        durable,
+		MaxDeliver:     5,
+		AckWait:        30 * time.Second,
+		InitialBackoff: time.Second,
+		MaxBackoff:     20 * time.Second,
+		BatchSize:      10,
+	}
+}
+
+// WithJetStream returns a copy of the configuration consuming the messages
+// through a JetStream durable pull consumer, instead of a core NATS
+// subscription. Dead letters are still published through core NATS
+func (n NATSConfig) WithJetStream(js JetStreamConfig) NATSConfig {
+	n.jetStream = &js
+	return n
+}
+
+// withDefaults fills the fields unset with DefaultJetStreamConfig's
+func (j JetStreamConfig) withDefaults() JetStreamConfig {
+	defaults := DefaultJetStreamConfig(j.Stream, j.Durable)
+	if j.MaxDeliver <= 0 {
+		j.MaxDeliver = defaults.MaxDeliver
+	}
+	if j.AckWait <= 0 {
+		j.AckWait = defaults.AckWait
+	}
+	if j.InitialBackoff <= 0 {
+		j.InitialBackoff = defaults.InitialBackoff
+	}
+	if j.MaxBackoff <= 0 {
+		j.MaxBackoff = defaults.MaxBackoff
+	}
+	if j.BatchSize <= 0 {
+		j.BatchSize = defaults.BatchSize
+	}
+	return j
+}
+
+// backoff returns the wait before redelivering a message delivered the
+// passed number of times
+func (j JetStreamConfig) backoff(delivered uint64) time.Duration {
+	backoff := j.InitialBackoff
+	for i := uint64(1); i < delivered; i++ {
+		backoff *= 2
+		if j.MaxBackoff > 0 && backoff >= j.MaxBackoff {
+			return j.MaxBackoff
+		}
+	}
+	return backoff
+}
+
+// retryable tells whether the failure err, of a message, may not happen again
+func (j JetStreamConfig) retryable(err error) bool {
+	switch DeadLetterReason(err) {
+	case ReasonMalformedMessage, ReasonEventNotRegistered:
+		return false
+	}
+	if j.Retryable != nil {
+		return j.Retryable(err)
+	}
+	return eventbus.IsTransient(err)
+}
+
+// subscribeJetStream binds a durable pull consumer to the subscription's
+// subject, creating its stream if missing
+func subscribeJetStream(conn *nats.Conn, conf NATSConfig) (*nats.Subscription, error) {
+	jsConf := conf.jetStream
+	js, err := conn.JetStream()
+	if err != nil {
+		return nil, wrapError(ErrJetStream, err.Error())
+	}
+	if _, err := js.StreamInfo(jsConf.Stream); err != nil {
+		_, err = js.AddStream(&nats.StreamConfig{
+			Name:     jsConf.Stream,
+			Subjects: []string{conf.subscriptionName},
+			Storage:  nats.FileStorage,
+		})
+		if err != nil {
+			return nil, wrapError(ErrJetStream, err.Error())
+		}
+	}
+	sub, err := js.PullSubscribe(
+		conf.subscriptionName,
+		jsConf.Durable,
+		nats.BindStream(jsConf.Stream),
+		nats.AckExplicit(),
+		nats.MaxDeliver(jsConf.MaxDeliver),
+		nats.AckWait(jsConf.AckWait),
+	)
+	if err != nil {
+		return nil, wrapError(ErrJetStream, err.Error())
+	}
+	return sub, nil
+}
+
+// processJetStream fetches the messages of the pull consumer until ctx is
+// done, dispatching them to pool; it only fetches while the workers keep up,
+// the time queued counts towards AckWait. Messages are acknowledged once
+// resolved. On transient failures they're redelivered after a backoff,
+// until MaxDeliver; then, or on any other failure, they're dead-lettered
+func (n *NATSBroker) processJetStream(ctx context.Context, pool *workerPool,
+	errHandler func(error)) {
+	pollingTime := time.Duration(n.conf.pollingTime) * time.Millisecond
+	for {
+		select {
+		case <-ctx.Done():
+			errHandler(wrapError(ErrContextCanceled, ctx.Err().Error()))
+			return
+		default:
+		}
+		msgs, err := n.jsSub.Fetch(n.conf.jetStream.BatchSize, nats.MaxWait(pollingTime))
+		if err != nil {
+			if !errors.Is(err, nats.ErrTimeout) {
+				errHandler(wrapError(ErrJetStreamFetch, err.Error()))
+				time.Sleep(pollingTime)
+			}
+			continue
+		}
+		for _, msg := range msgs {
+			if !pool.dispatch(ctx, msg) {
+				// left unacknowledged, to be redelivered after AckWait
+				break
+			}
+		}
+	}
+}
+
+// handleJetStreamMsg resolves msg, acknowledging it once resolved. On
+// transient failures it's negatively acknowledged, for the server to
+// redeliver it after the backoff of its deliveries, which the server counts;
+// the following messages aren't held meanwhile, so they may overtake it
+func (n *NATSBroker) handleJetStreamMsg(ctx context.Context, msg *nats.Msg,
+	errHandler func(error)) {
+	jsConf := n.conf.jetStream
+	delivered := uint64(1)
+	metadata, err := msg.Metadata()
+	if err == nil {
+		delivered = metadata.NumDelivered
+	} else {
+		metadata = nil
+	}
+	err = n.bus.Resolve(ctx, Message{data: msg.Data, header: msg.Header})
+	if err == nil {
+		if err := msg.Ack(); err != nil {
+			errHandler(wrapError(ErrJetStreamAck, err.Error()))
+		}
+		return
+	}
+	errHandler(wrapError(ErrEventBus, err.Error()))
+	if !jsConf.retryable(err) || delivered >= uint64(jsConf.MaxDeliver) {
+		n.deadLetterJetStreamMsg(msg, err, delivered, metadata, errHandler)
+		return
+	}
+	if err := msg.NakWithDelay(jsConf.backoff(delivered)); err != nil {
+		errHandler(wrapError(ErrJetStreamAck, err.Error()))
+	}
+}
+
+// deadLetterJetStreamMsg publishes msg, failed with err after the passed
+// deliveries, as a dead letter, terminating it; metadata may be nil
+func (n *NATSBroker) deadLetterJetStreamMsg(msg *nats.Msg, err error,
+	delivered uint64, metadata *nats.MsgMetadata, errHandler func(error)) {
+	headers := map[string]string{
+		DeadLetterDeliveriesHeader: strconv.FormatUint(delivered, 10),
+	}
+	if metadata != nil {
+		headers[DeadLetterStreamHeader] = metadata.Stream
+		headers[DeadLetterStreamSequenceHeader] = strconv.FormatUint(metadata.Sequence.Stream, 10)
+	}
+	if err := n.publishDeadLetter(msg, err, headers); err != nil {
+		errHandler(err)
+	}
+	if err := msg.Term(); err != nil {
+		errHandler(wrapError(ErrJetStreamAck, err.Error()))
+	}
+}
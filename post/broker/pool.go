@@ -0,0 +1,77 @@
+package broker
+
+import (
+	"context"
+	"hash/fnv"
+	"sync"
+
+	"github.com/mountolive/back-blog-go/post/eventbus"
+	"github.com/nats-io/nats.go"
+)
+
+// workerPool handles messages concurrently, keeping the order of the ones
+// about the same aggregate: they all go to the same worker, by their key
+// Each worker has a bounded queue; dispatching blocks while it's full
+type workerPool struct {
+	queues []chan *nats.Msg
+	wg     sync.WaitGroup
+}
+
+// newWorkerPool starts workers calling handle, until ctx is done;
+// the messages still queued by then are dropped
+func newWorkerPool(ctx context.Context, workers, queueSize int,
+	handle func(*nats.Msg)) *workerPool {
+	if workers < 1 {
+		workers = 1
+	}
+	pool := &workerPool{queues: make([]chan *nats.Msg, workers)}
+	for i := range pool.queues {
+		queue := make(chan *nats.Msg, queueSize)
+		pool.queues[i] = queue
+		pool.wg.Add(1)
+		go func() {
+			defer pool.wg.Done()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case msg := <-queue:
+					handle(msg)
+				}
+			}
+		}()
+	}
+	return pool
+}
+
+// dispatch queues msg to the worker of its aggregate, waiting while its
+// queue is full. It returns false when ctx is done before queueing it
+func (p *workerPool) dispatch(ctx context.Context, msg *nats.Msg) bool {
+	select {
+	case <-ctx.Done():
+		return false
+	case p.queues[p.worker(msg)] <- msg:
+		return true
+	}
+}
+
+// worker picks the worker of msg by its aggregate key; messages
+// without one are spread by their data
+func (p *workerPool) worker(msg *nats.Msg) int {
+	if len(p.queues) == 1 {
+		return 0
+	}
+	hash := fnv.New32a()
+	key := eventbus.AggregateKey(Message{data: msg.Data, header: msg.Header})
+	if key != "" {
+		_, _ = hash.Write([]byte(key))
+	} else {
+		_, _ = hash.Write(msg.Data)
+	}
+	return int(hash.Sum32() % uint32(len(p.queues)))
+}
+
+// wait blocks until every worker has stopped
+func (p *workerPool) wait() {
+	p.wg.Wait()
+}
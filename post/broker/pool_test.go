@@ -0,0 +1,102 @@
+package broker
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mountolive/back-blog-go/post/eventbus"
+	"github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/require"
+)
+
+func testPoolMsg(id string, seq int) *nats.Msg {
+	msg := nats.NewMsg("pool")
+	msg.Data = []byte(fmt.Sprintf(`{"event_name": "posts.v1.patch", "id": %q, "seq": %d}`, id, seq))
+	return msg
+}
+
+func TestWorkerPool(t *testing.T) {
+	t.Run("Order per aggregate", func(t *testing.T) {
+		t.Parallel()
+		ctx, cancel := context.WithCancel(context.Background())
+		var mu sync.Mutex
+		handled := map[string][]string{}
+		var wg sync.WaitGroup
+		pool := newWorkerPool(ctx, 4, 2, func(msg *nats.Msg) {
+			defer wg.Done()
+			key := eventbus.AggregateKey(Message{data: msg.Data})
+			mu.Lock()
+			defer mu.Unlock()
+			handled[key] = append(handled[key], string(msg.Data))
+		})
+		expected := map[string][]string{}
+		for seq := 0; seq < 10; seq++ {
+			for _, id := range []string{"post-1", "post-2", "post-3"} {
+				msg := testPoolMsg(id, seq)
+				expected[id] = append(expected[id], string(msg.Data))
+				wg.Add(1)
+				require.True(t, pool.dispatch(ctx, msg))
+			}
+		}
+		wg.Wait()
+		cancel()
+		pool.wait()
+		require.Len(t, handled, 3)
+		require.Equal(t, expected, handled)
+	})
+
+	t.Run("Concurrency", func(t *testing.T) {
+		t.Parallel()
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		workers := 3
+		started := make(chan struct{}, workers)
+		release := make(chan struct{})
+		pool := newWorkerPool(ctx, workers, 0, func(*nats.Msg) {
+			started <- struct{}{}
+			<-release
+		})
+		// ids picked for landing on different workers
+		dispatched := map[int]bool{}
+		for i := 0; len(dispatched) < workers; i++ {
+			msg := testPoolMsg(fmt.Sprintf("post-%d", i), 0)
+			if worker := pool.worker(msg); !dispatched[worker] {
+				dispatched[worker] = true
+				require.True(t, pool.dispatch(ctx, msg))
+			}
+		}
+		for i := 0; i < workers; i++ {
+			select {
+			case <-started:
+			case <-time.After(time.Second):
+				t.Fatalf("only %d of %d workers handling messages at once", i, workers)
+			}
+		}
+		close(release)
+	})
+
+	t.Run("Backpressure", func(t *testing.T) {
+		t.Parallel()
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		release := make(chan struct{})
+		defer close(release)
+		pool := newWorkerPool(ctx, 1, 1, func(*nats.Msg) {
+			<-release
+		})
+		// one being handled, one queued
+		require.True(t, pool.dispatch(ctx, testPoolMsg("post-1", 0)))
+		require.True(t, pool.dispatch(ctx, testPoolMsg("post-1", 1)))
+		dispatchCtx, cancelDispatch := context.WithTimeout(ctx, 50*time.Millisecond)
+		defer cancelDispatch()
+		for i := 2; ; i++ {
+			if !pool.dispatch(dispatchCtx, testPoolMsg("post-1", i)) {
+				require.LessOrEqual(t, i, 3, "dispatch should block while the queue is full")
+				break
+			}
+		}
+	})
+}
@@ -0,0 +1,130 @@
+package broker
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+
+	"github.com/mountolive/back-blog-go/post/eventbus"
+	"github.com/mountolive/back-blog-go/post/usecase"
+	"github.com/nats-io/nats.go"
+)
+
+var (
+	// ErrReplyPublish is self-described
+	ErrReplyPublish = errors.New("NATS publish of reply failed")
+	// ErrRequest is self-described
+	ErrRequest = errors.New("NATS request failed")
+	// ErrMalformedReply is self-described
+	ErrMalformedReply = errors.New("NATS reply malformed")
+)
+
+// Codes of the errors sent in replies
+const (
+	CodeMalformedMessage   = "malformed_message"
+	CodeEventNotRegistered = "event_not_registered"
+	CodeInvalidPayload     = "invalid_payload"
+	CodeNotFound           = "not_found"
+	CodeForbidden          = "forbidden"
+	CodeVersionConflict    = "version_conflict"
+	CodeEventInProgress    = "event_in_progress"
+	CodeTimeout            = "timeout"
+	CodeInternal           = "internal"
+)
+
+// Reply is the outcome of a message with a reply subject,
+// sent back to the sender once the message is processed
+// Result holds the values recorded by the handler, through eventbus.RecordResult
+// Events repeated, already handled, succeed with no result
+type Reply struct {
+	Success bool                   `json:"success"`
+	Result  map[string]interface{} `json:"result,omitempty"`
+	Error   *ReplyError            `json:"error,omitempty"`
+}
+
+// ReplyError describes why a message couldn't be processed
+type ReplyError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// NewReply builds the Reply of a message processed, from the
+// result recorded and the error returned by the EventBus
+func NewReply(result *eventbus.Result, err error) Reply {
+	if err != nil {
+		return Reply{Error: &ReplyError{Code: ReplyCode(err), Message: err.Error()}}
+	}
+	reply := Reply{Success: true}
+	if result != nil {
+		reply.Result = result.Values()
+	}
+	return reply
+}
+
+// ReplyCode maps the error returned when processing a message
+// to the code sent along with its reply
+func ReplyCode(err error) string {
+	switch {
+	case errors.Is(err, eventbus.ErrUnmarshalingMessage),
+		errors.Is(err, eventbus.ErrMissingNameParam),
+		errors.Is(err, eventbus.ErrWrongDataTypeName),
+		errors.Is(err, eventbus.ErrInvalidEnvelope):
+		return CodeMalformedMessage
+	case errors.Is(err, eventbus.ErrEventNotRegistered):
+		return CodeEventNotRegistered
+	case errors.Is(err, eventbus.ErrInvalidPayload),
+		errors.Is(err, eventbus.ErrMissingField),
+		errors.Is(err, eventbus.ErrWrongFieldType),
+		errors.Is(err, eventbus.ErrUpcast),
+		errors.Is(err, usecase.ErrMissingID),
+		errors.Is(err, usecase.ErrMissingVersion),
+		errors.Is(err, usecase.ErrEmptyTags),
+		errors.Is(err, usecase.ErrNothingToUpdate),
+		errors.Is(err, usecase.ErrConflictingTagsUpdate),
+		errors.Is(err, usecase.ErrInvalidAuthorRole),
+		errors.Is(err, usecase.ErrDuplicatedAuthor),
+		errors.Is(err, usecase.ErrEmptyAuthors),
+		errors.Is(err, usecase.ErrUserNotFound):
+		return CodeInvalidPayload
+	case errors.Is(err, usecase.ErrPostNotFound):
+		return CodeNotFound
+	case errors.Is(err, usecase.ErrForbidden):
+		return CodeForbidden
+	case errors.Is(err, usecase.ErrVersionConflict):
+		return CodeVersionConflict
+	case errors.Is(err, eventbus.ErrEventInProgress):
+		return CodeEventInProgress
+	case errors.Is(err, eventbus.ErrHandlerTimeout):
+		return CodeTimeout
+	default:
+		return CodeInternal
+	}
+}
+
+// reply sends the outcome of msg to its reply subject
+func (n *NATSBroker) reply(msg *nats.Msg, reply Reply) error {
+	data, err := json.Marshal(reply)
+	if err != nil {
+		return wrapError(ErrReplyPublish, err.Error())
+	}
+	err = n.conn.Publish(msg.Reply, data)
+	if err != nil {
+		return wrapError(ErrReplyPublish, err.Error())
+	}
+	return nil
+}
+
+// Request sends msg through conn and waits for its Reply, until ctx is done
+// It's meant for the senders of the messages processed by a NATSBroker
+func Request(ctx context.Context, conn *nats.Conn, msg *nats.Msg) (Reply, error) {
+	response, err := conn.RequestMsgWithContext(ctx, msg)
+	if err != nil {
+		return Reply{}, wrapError(ErrRequest, err.Error())
+	}
+	reply := Reply{}
+	err = json.Unmarshal(response.Data, &reply)
+	if err != nil {
+		return Reply{}, wrapError(ErrMalformedReply, err.Error())
+	}
+	return reply, nil
+}
@@ -0,0 +1,88 @@
+package broker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/mountolive/back-blog-go/post/eventbus"
+	"github.com/mountolive/back-blog-go/post/usecase"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReplyCode(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name     string
+		err      error
+		expected string
+	}{
+		{"Malformed message", eventbus.ErrUnmarshalingMessage, CodeMalformedMessage},
+		{"Not registered", eventbus.ErrEventNotRegistered, CodeEventNotRegistered},
+		{
+			"Invalid payload",
+			fmt.Errorf("create post: %w", eventbus.FieldErrors{eventbus.NewMissingFieldError("title")}),
+			CodeInvalidPayload,
+		},
+		{"Nothing to update", usecase.ErrNothingToUpdate, CodeInvalidPayload},
+		{"Upcast failed", eventbus.ErrUpcast, CodeInvalidPayload},
+		{
+			"Invalid author role",
+			fmt.Errorf("update post: %w", usecase.ErrInvalidAuthorRole),
+			CodeInvalidPayload,
+		},
+		{
+			"Duplicated author",
+			fmt.Errorf("create post: %w", usecase.ErrDuplicatedAuthor),
+			CodeInvalidPayload,
+		},
+		{"Empty authors", fmt.Errorf("patch post: %w", usecase.ErrEmptyAuthors), CodeInvalidPayload},
+		{"Not found", fmt.Errorf("patch post: %w", usecase.ErrPostNotFound), CodeNotFound},
+		{"Forbidden", fmt.Errorf("patch post: %w", usecase.ErrForbidden), CodeForbidden},
+		{
+			"Version conflict",
+			fmt.Errorf("update post: %w", usecase.ErrVersionConflict),
+			CodeVersionConflict,
+		},
+		{"Event in progress", eventbus.ErrEventInProgress, CodeEventInProgress},
+		{"Timeout", eventbus.ErrHandlerTimeout, CodeTimeout},
+		{"Any other error", errors.New("boom"), CodeInternal},
+	}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			require.Equal(t, tc.expected, ReplyCode(tc.err))
+		})
+	}
+}
+
+func TestNewReply(t *testing.T) {
+	t.Parallel()
+
+	t.Run("Success", func(t *testing.T) {
+		ctx, result := eventbus.ContextWithResult(context.Background())
+		eventbus.RecordResult(ctx, "id", "some-id")
+		reply := NewReply(result, nil)
+		require.True(t, reply.Success)
+		require.Nil(t, reply.Error)
+		require.Equal(t, map[string]interface{}{"id": "some-id"}, reply.Result)
+	})
+
+	t.Run("Success without result", func(t *testing.T) {
+		_, result := eventbus.ContextWithResult(context.Background())
+		reply := NewReply(result, nil)
+		require.True(t, reply.Success)
+		require.Nil(t, reply.Result)
+	})
+
+	t.Run("Error", func(t *testing.T) {
+		err := fmt.Errorf("delete post: %w", usecase.ErrPostNotFound)
+		reply := NewReply(nil, err)
+		require.False(t, reply.Success)
+		require.Nil(t, reply.Result)
+		require.Equal(t, CodeNotFound, reply.Error.Code)
+		require.Equal(t, err.Error(), reply.Error.Message)
+	})
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"expvar"
 	"fmt"
 	"log"
 	"net/http"
@@ -9,19 +10,32 @@ import (
 	"os/signal"
 	"strconv"
 	"syscall"
+	"time"
 
+	"github.com/mountolive/back-blog-go/post/audit"
 	"github.com/mountolive/back-blog-go/post/broker"
 	"github.com/mountolive/back-blog-go/post/command"
+	"github.com/mountolive/back-blog-go/post/deadletter"
 	"github.com/mountolive/back-blog-go/post/eventbus"
 	"github.com/mountolive/back-blog-go/post/httpx"
+	"github.com/mountolive/back-blog-go/post/identity"
+	"github.com/mountolive/back-blog-go/post/outbox"
 	"github.com/mountolive/back-blog-go/post/pgstore"
 	"github.com/mountolive/back-blog-go/post/sanitizer"
+	"github.com/mountolive/back-blog-go/post/sqlitestore"
 	"github.com/mountolive/back-blog-go/post/usecase"
 	"github.com/mountolive/back-blog-go/post/user"
 	"github.com/mountolive/back-blog-go/post/user/transport"
 	"google.golang.org/grpc"
 )
 
+// defaultHandlerTimeout is the time each attempt of handling an event can take
+const defaultHandlerTimeout = 10 * time.Second
+
+// defaultWorkerQueueSize is the number of events each of the broker's
+// workers can have waiting
+const defaultWorkerQueueSize = 16
+
 func main() {
 	ctx, cancel := context.WithCancel(context.Background())
 	go func() {
@@ -32,39 +46,105 @@ func main() {
 		cancel()
 		log.Fatalf("posts server shutting down...")
 	}()
-	dbUser := os.Getenv("POSTS_DB_USER")
-	dbPassword := os.Getenv("POSTS_DB_PASS")
-	dbName := os.Getenv("POSTS_DB_NAME")
-	dbPort := os.Getenv("POSTS_DB_PORT")
-	dbHost := os.Getenv("POSTS_DB_HOST")
-	dbUrl := fmt.Sprintf(
-		"postgresql://%s:%s@%s:%s/%s?sslmode=disable",
-		dbUser, dbPassword, dbHost, dbPort, dbName,
-	)
-	store, err := pgstore.NewPostPgStore(ctx, dbUrl)
+	store, err := newStore(ctx, os.Getenv("POSTS_STORE_DRIVER"))
 	if err != nil {
 		log.Fatalf("posts db conn: %v", err)
 	}
 	gRPCHost := os.Getenv("POSTS_USERS_GRPC_HOST")
 	gRPCPort := os.Getenv("POSTS_USERS_GRPC_PORT")
+	usersCredentials, err := usersTransportCredentials(ctx)
+	if err != nil {
+		log.Fatalf("posts gRPC TLS setup: %v", err)
+	}
 	gRPCConn, err := grpc.Dial(
 		fmt.Sprintf("%s:%s", gRPCHost, gRPCPort),
-		// TODO Make gRPC connection to users' server to be secured
-		grpc.WithInsecure(),
+		usersCredentials,
 	)
 	if err != nil {
 		log.Fatalf("posts gRPC conn: %v", err)
 	}
 	client := transport.NewUserCheckerClient(gRPCConn)
-	checker := user.NewGRPCUserChecker(client)
+	usersConfig, err := usersResilienceConfig()
+	if err != nil {
+		log.Fatalf("posts users checker config: %v", err)
+	}
+	checker := user.NewResilientGRPCUserChecker(client, usersConfig)
 	repo := &usecase.PostRepository{
 		Store:     store,
 		Checker:   checker,
+		Roles:     checker,
+		Resolver:  checker,
 		Sanitizer: sanitizer.NewSanitizer(),
 	}
-	eventBus := eventbus.NewEventBus()
-	eventBus.Register(command.CreatePostEventNameV1, command.NewCreatePost(repo))
-	eventBus.Register(command.UpdatePostEventNameV1, command.NewUpdatePost(repo))
+	// posts written before their users were identified by ID keep their
+	// logins until they're migrated, which is retried on every start
+	if refStore, ok := store.(usecase.UserRefStore); ok {
+		go migrateUserIDs(ctx, refStore, checker)
+	}
+	processedEvents, err := newProcessedEventStore(ctx, os.Getenv("POSTS_STORE_DRIVER"))
+	if err != nil {
+		log.Fatalf("posts processed events store: %v", err)
+	}
+	idempotencyTTL := eventbus.DefaultIdempotencyTTL
+	if ttl := os.Getenv("POSTS_IDEMPOTENCY_TTL"); ttl != "" {
+		idempotencyTTL, err = time.ParseDuration(ttl)
+		if err != nil {
+			log.Fatalf("posts idempotency ttl parsing: %v", err)
+		}
+	}
+	go eventbus.PurgeProcessedEvents(ctx, processedEvents, time.Hour, func(err error) {
+		fmt.Printf("posts processed events: %v\n", err)
+	})
+	handlerTimeout := defaultHandlerTimeout
+	if timeout := os.Getenv("POSTS_HANDLER_TIMEOUT"); timeout != "" {
+		handlerTimeout, err = time.ParseDuration(timeout)
+		if err != nil {
+			log.Fatalf("posts handler timeout parsing: %v", err)
+		}
+	}
+	auditLog, err := newAuditStore(ctx, os.Getenv("POSTS_STORE_DRIVER"))
+	if err != nil {
+		log.Fatalf("posts audit store: %v", err)
+	}
+	retryPolicy := eventbus.DefaultRetryPolicy
+	retryPolicy.Retryable = command.IsTransient
+	metrics := eventbus.NewMetrics("posts_events")
+	// the actors are only trusted when signed by the gateway, with the secret shared
+	actorSecret := os.Getenv("POSTS_ACTOR_SECRET")
+	if actorSecret == "" {
+		fmt.Println("posts, POSTS_ACTOR_SECRET not set: no actor is trusted, posts can't be changed")
+	}
+	actors := identity.NewVerifier(actorSecret)
+	// the first middleware wraps the handler, the last one is called first
+	eventBus := eventbus.NewEventBus(
+		eventbus.Recover(),
+		eventbus.Timeout(handlerTimeout),
+		eventbus.Retry(retryPolicy),
+		// outside Retry: a single entry per command, with its final outcome
+		audit.Middleware(auditLog, func(err error) {
+			fmt.Printf("posts audit: %v\n", err)
+		}),
+		eventbus.Logging(log.New(os.Stdout, "posts events: ", log.LstdFlags)),
+		metrics.Middleware(),
+		// last, for the unsigned actors to be dropped before anything else
+		actors.Middleware(),
+	)
+	eventBus.Register(
+		command.CreatePostEventNameV1,
+		eventbus.Idempotent(command.NewCreatePost(repo), processedEvents, idempotencyTTL),
+	)
+	eventBus.Register(
+		command.UpdatePostEventNameV1,
+		eventbus.Idempotent(command.NewUpdatePost(repo), processedEvents, idempotencyTTL),
+	)
+	eventBus.Register(
+		command.PatchPostEventNameV1,
+		eventbus.Idempotent(command.NewPatchPost(repo), processedEvents, idempotencyTTL),
+	)
+	eventBus.Register(
+		command.DeletePostEventNameV1,
+		eventbus.Idempotent(command.NewDeletePost(repo), processedEvents, idempotencyTTL),
+	)
 	// milliseconds
 	pollingTime := 250
 	port := os.Getenv("POSTS_NATS_PORT")
@@ -72,6 +152,18 @@ func main() {
 	if err != nil {
 		log.Fatalf("posts nats port parsing: %v", err)
 	}
+	// single-binary mode: the NATS server runs within the service
+	if os.Getenv("POSTS_NATS_EMBEDDED") == "true" {
+		embeddedNATS, err := broker.StartEmbeddedNATSServer(broker.EmbeddedNATSConfig{
+			Host:     os.Getenv("POSTS_NATS_HOST"),
+			Port:     natsPort,
+			StoreDir: os.Getenv("POSTS_NATS_STORE_DIR"),
+		})
+		if err != nil {
+			log.Fatalf("posts embedded nats server: %v", err)
+		}
+		defer embeddedNATS.Shutdown()
+	}
 	natsConf := broker.NewNATSConfig(
 		os.Getenv("POSTS_NATS_USER"),
 		os.Getenv("POSTS_NATS_PASS"),
@@ -81,29 +173,291 @@ func main() {
 		uint16(natsPort),
 		pollingTime,
 	)
+	if group := os.Getenv("POSTS_NATS_QUEUE_GROUP"); group != "" {
+		natsConf = natsConf.WithQueueGroup(group)
+	}
+	if workers := os.Getenv("POSTS_NATS_WORKERS"); workers != "" {
+		natsWorkers, err := strconv.Atoi(workers)
+		if err != nil {
+			log.Fatalf("posts nats workers parsing: %v", err)
+		}
+		natsConf = natsConf.WithWorkers(natsWorkers, defaultWorkerQueueSize)
+	}
+	if stream := os.Getenv("POSTS_NATS_JETSTREAM_STREAM"); stream != "" {
+		jsConf := broker.DefaultJetStreamConfig(
+			stream, os.Getenv("POSTS_NATS_JETSTREAM_DURABLE"),
+		)
+		jsConf.Retryable = command.IsTransient
+		natsConf = natsConf.WithJetStream(jsConf)
+	}
 	natsBroker, err := broker.NewNATSBroker(eventBus, natsConf)
 	if err != nil {
 		log.Fatalf("posts nats broker: %v", err)
 	}
+	// Stores with an outbox write their domain events along with the changes,
+	// the relay publishes them; the rest publish them right after
+	// Every instance runs a relay, the outbox's lock elects the one relaying
+	if box, ok := store.(outbox.Store); ok {
+		relay := outbox.NewRelay(box, natsBroker, outbox.DefaultRelayConfig)
+		go relay.Run(ctx, func(err error) {
+			fmt.Printf("posts outbox relay: %v\n", err)
+		})
+	} else {
+		repo.Publisher = natsBroker
+	}
 	go func() {
 		errChan := natsBroker.Process(ctx)
 		for err := range errChan {
 			fmt.Printf("posts nats process: %v\n", err)
 		}
 	}()
+	deadLetters, err := newDeadLetterStore(ctx, os.Getenv("POSTS_STORE_DRIVER"))
+	if err != nil {
+		log.Fatalf("posts dead letters store: %v", err)
+	}
+	deadLetterManager := deadletter.NewManager(deadLetters, eventBus)
+	go func() {
+		errChan := natsBroker.ProcessDead(ctx, func(dead broker.DeadLetter) error {
+			return deadLetterManager.Record(ctx, dead)
+		})
+		for err := range errChan {
+			fmt.Printf("posts nats process dead letters: %v\n", err)
+		}
+	}()
 	httpServer := httpx.NewServer(repo)
 	router := httpx.NewRouter()
-	err = router.Add("GET /posts/([A-Za-z0-9]*)", httpServer.GetPost)
+	auditServer := httpx.NewAuditServer(auditLog, repo.Sanitizer)
+	err = router.Add("^GET /posts/([A-Za-z0-9-]+)/history$", auditServer.GetPostHistory)
+	if err != nil {
+		log.Fatalf("posts router register, post's history: %v", err)
+	}
+	err = router.Add("^GET /posts/([A-Za-z0-9-]+)$", httpServer.GetPost)
 	if err != nil {
 		log.Fatalf("posts router register, post by id: %v", err)
 	}
-	err = router.Add("GET /posts([\\?&_=A-Za-z0-9]*)?", httpServer.Filter)
+	err = router.Add("^GET /posts/?$", httpServer.Filter)
 	if err != nil {
 		log.Fatalf("posts router register, post by tag and date: %v", err)
 	}
+	trustedActor := httpx.TrustedActor(actors)
+	err = router.Add("^PUT /posts/([A-Za-z0-9-]+)$", httpServer.UpdatePost, trustedActor)
+	if err != nil {
+		log.Fatalf("posts router register, update post: %v", err)
+	}
+	err = router.Add("^PATCH /posts/([A-Za-z0-9-]+)$", httpServer.PatchPost, trustedActor)
+	if err != nil {
+		log.Fatalf("posts router register, patch post: %v", err)
+	}
+	err = router.Add("^DELETE /posts/([A-Za-z0-9-]+)$", httpServer.DeletePost, trustedActor)
+	if err != nil {
+		log.Fatalf("posts router register, delete post: %v", err)
+	}
+	err = router.Add("^GET /debug/vars$", expvar.Handler().ServeHTTP)
+	if err != nil {
+		log.Fatalf("posts router register, metrics: %v", err)
+	}
+	schemasServer := httpx.NewSchemasServer(eventBus.Schemas())
+	err = router.Add("^GET /events/schemas/?$", schemasServer.ListSchemas)
+	if err != nil {
+		log.Fatalf("posts router register, events' schemas: %v", err)
+	}
+	err = router.Add("^GET /events/schemas/([A-Za-z0-9._-]+)$", schemasServer.GetSchema)
+	if err != nil {
+		log.Fatalf("posts router register, event's schema: %v", err)
+	}
+	deprecationsServer := httpx.NewDeprecationsServer(eventBus.DeprecationReport)
+	err = router.Add("^GET /events/deprecations/?$", deprecationsServer.GetDeprecations)
+	if err != nil {
+		log.Fatalf("posts router register, events' deprecations: %v", err)
+	}
+	// the administration is only exposed along with a token
+	if token := os.Getenv("POSTS_ADMIN_TOKEN"); token != "" {
+		registerDeadLetterRoutes(router, httpx.NewDeadLettersServer(deadLetterManager), token)
+		registerAuditRoutes(router, auditServer, token)
+	}
 	httpPort := os.Getenv("POSTS_HTTP_PORT")
 	fmt.Printf("posts, starting http server at %s\n", httpPort)
 	if err := http.ListenAndServe(fmt.Sprintf(":%s", httpPort), router); err != nil {
 		log.Fatalf("posts http listen and serve: %v", err)
 	}
 }
+
+// newStore builds the store selected by driver, either
+// postgres (default) or sqlite
+func newStore(ctx context.Context, driver string) (usecase.PostStore, error) {
+	switch driver {
+	case "", "postgres":
+		return pgstore.NewPostPgStore(ctx, postgresURL())
+	case "sqlite":
+		return sqlitestore.NewPostSQLiteStore(ctx, os.Getenv("POSTS_SQLITE_PATH"))
+	default:
+		return nil, fmt.Errorf("unknown store driver %q", driver)
+	}
+}
+
+// newProcessedEventStore builds the store of the events handled for driver
+func newProcessedEventStore(ctx context.Context,
+	driver string) (eventbus.ProcessedEventStore, error) {
+	switch driver {
+	case "", "postgres":
+		return pgstore.NewProcessedEventPgStore(ctx, postgresURL())
+	case "sqlite":
+		return sqlitestore.NewProcessedEventSQLiteStore(ctx, os.Getenv("POSTS_SQLITE_PATH"))
+	default:
+		return nil, fmt.Errorf("unknown store driver %q", driver)
+	}
+}
+
+// newDeadLetterStore builds the store of the dead letters for driver
+func newDeadLetterStore(ctx context.Context, driver string) (deadletter.Store, error) {
+	switch driver {
+	case "", "postgres":
+		return pgstore.NewDeadLetterPgStore(ctx, postgresURL())
+	case "sqlite":
+		return sqlitestore.NewDeadLetterSQLiteStore(ctx, os.Getenv("POSTS_SQLITE_PATH"))
+	default:
+		return nil, fmt.Errorf("unknown store driver %q", driver)
+	}
+}
+
+// newAuditStore builds the audit log for driver
+func newAuditStore(ctx context.Context, driver string) (audit.Store, error) {
+	switch driver {
+	case "", "postgres":
+		return pgstore.NewAuditPgStore(ctx, postgresURL())
+	case "sqlite":
+		return sqlitestore.NewAuditSQLiteStore(ctx, os.Getenv("POSTS_SQLITE_PATH"))
+	default:
+		return nil, fmt.Errorf("unknown store driver %q", driver)
+	}
+}
+
+// usersResilienceConfig reads the configuration of the calls to the users
+// service, user.DefaultResilienceConfig's being the defaults
+func usersResilienceConfig() (user.ResilienceConfig, error) {
+	config := user.DefaultResilienceConfig
+	durations := []struct {
+		env   string
+		field *time.Duration
+	}{
+		{"POSTS_USERS_TIMEOUT", &config.CallTimeout},
+		{"POSTS_USERS_CACHE_TTL", &config.CacheTTL},
+		{"POSTS_USERS_NEGATIVE_CACHE_TTL", &config.NegativeCacheTTL},
+		{"POSTS_USERS_CIRCUIT_OPEN_TIMEOUT", &config.OpenTimeout},
+	}
+	for _, duration := range durations {
+		value := os.Getenv(duration.env)
+		if value == "" {
+			continue
+		}
+		parsed, err := time.ParseDuration(value)
+		if err != nil {
+			return config, fmt.Errorf("%s parsing: %w", duration.env, err)
+		}
+		*duration.field = parsed
+	}
+	config.FailOpen = os.Getenv("POSTS_USERS_FAIL_OPEN") == "true"
+	return config, nil
+}
+
+// defaultTLSReloadInterval is how often the certificates are reloaded
+const defaultTLSReloadInterval = time.Minute
+
+// usersTransportCredentials secures the connection to the users service with
+// the CAs at POSTS_USERS_TLS_CA, the system's if unset, and the certificate
+// and key at POSTS_USERS_TLS_CERT and POSTS_USERS_TLS_KEY, for mutual TLS.
+// The connection is plaintext if none of them is set
+func usersTransportCredentials(ctx context.Context) (grpc.DialOption, error) {
+	config := user.TLSConfig{
+		CAFile:     os.Getenv("POSTS_USERS_TLS_CA"),
+		CertFile:   os.Getenv("POSTS_USERS_TLS_CERT"),
+		KeyFile:    os.Getenv("POSTS_USERS_TLS_KEY"),
+		ServerName: os.Getenv("POSTS_USERS_TLS_SERVER_NAME"),
+	}
+	if config.CAFile == "" && config.CertFile == "" && config.KeyFile == "" {
+		log.Printf("posts gRPC TLS disabled, dialing users in plaintext")
+		return grpc.WithInsecure(), nil
+	}
+	reloader, err := user.NewCertReloader(config)
+	if err != nil {
+		return nil, err
+	}
+	interval := defaultTLSReloadInterval
+	if value := os.Getenv("POSTS_USERS_TLS_RELOAD_INTERVAL"); value != "" {
+		interval, err = time.ParseDuration(value)
+		if err != nil {
+			return nil, fmt.Errorf("POSTS_USERS_TLS_RELOAD_INTERVAL parsing: %w", err)
+		}
+	}
+	go reloader.Watch(ctx, interval, func(err error) {
+		log.Printf("posts gRPC TLS: %v", err)
+	})
+	return grpc.WithTransportCredentials(reloader.TransportCredentials()), nil
+}
+
+// migrateUserIDs replaces the logins of the posts' creators and authors
+// by the IDs of their users, logging the outcome
+func migrateUserIDs(ctx context.Context, store usecase.UserRefStore,
+	resolver usecase.AuthorResolver) {
+	migration, err := usecase.MigrateUserIDs(ctx, store, resolver)
+	if err != nil {
+		fmt.Printf("posts user ids migration: %v\n", err)
+		return
+	}
+	if len(migration.Migrated) > 0 || len(migration.Unresolved) > 0 {
+		fmt.Printf("posts user ids migration: %d logins migrated, unresolved: %v\n",
+			len(migration.Migrated), migration.Unresolved)
+	}
+}
+
+// registerDeadLetterRoutes exposes the administration of the dead letters,
+// under `/admin/dead-letters`, to the bearers of token
+func registerDeadLetterRoutes(router *httpx.Router,
+	server httpx.DeadLettersServer, token string) {
+	adminToken := httpx.AdminToken(token)
+	routes := []struct {
+		path    string
+		handler http.HandlerFunc
+	}{
+		{"^GET /admin/dead-letters/?$", server.ListDeadLetters},
+		{"^GET /admin/dead-letters/([A-Za-z0-9-]+)$", server.GetDeadLetter},
+		{"^PATCH /admin/dead-letters/([A-Za-z0-9-]+)$", server.EditDeadLetter},
+		{"^POST /admin/dead-letters/([A-Za-z0-9-]+)/replay$", server.ReplayDeadLetter},
+		{"^DELETE /admin/dead-letters/([A-Za-z0-9-]+)$", server.DiscardDeadLetter},
+	}
+	for _, route := range routes {
+		if err := router.Add(route.path, route.handler, adminToken); err != nil {
+			log.Fatalf("posts router register, dead letters %q: %v", route.path, err)
+		}
+	}
+}
+
+// registerAuditRoutes exposes the queries of the audit log and the
+// rebuilding of posts out of it to the bearers of token
+func registerAuditRoutes(router *httpx.Router, server httpx.AuditServer, token string) {
+	adminToken := httpx.AdminToken(token)
+	routes := []struct {
+		path    string
+		handler http.HandlerFunc
+	}{
+		{"^GET /admin/audit/?$", server.QueryAudit},
+		{"^GET /admin/posts/([A-Za-z0-9-]+)/rebuild$", server.RebuildPost},
+	}
+	for _, route := range routes {
+		if err := router.Add(route.path, route.handler, adminToken); err != nil {
+			log.Fatalf("posts router register, audit %q: %v", route.path, err)
+		}
+	}
+}
+
+func postgresURL() string {
+	dbUser := os.Getenv("POSTS_DB_USER")
+	dbPassword := os.Getenv("POSTS_DB_PASS")
+	dbName := os.Getenv("POSTS_DB_NAME")
+	dbPort := os.Getenv("POSTS_DB_PORT")
+	dbHost := os.Getenv("POSTS_DB_HOST")
+	return fmt.Sprintf(
+		"postgresql://%s:%s@%s:%s/%s?sslmode=disable",
+		dbUser, dbPassword, dbHost, dbPort, dbName,
+	)
+}
@@ -11,39 +11,25 @@ import (
 
 var (
 	// ErrIDMissing is self-described
-	ErrIDMissing = errors.New("id missing")
+	ErrIDMissing error = eventbus.NewMissingFieldError("id")
 	// ErrContentMissing is self-described
-	ErrContentMissing = errors.New("content missing")
+	ErrContentMissing error = eventbus.NewMissingFieldError("content")
 	// ErrCreatorMissing is self-described
-	ErrCreatorMissing = errors.New("creator missing")
+	ErrCreatorMissing error = eventbus.NewMissingFieldError("creator")
 	// ErrTitleMissing is self-described
-	ErrTitleMissing = errors.New("title missing")
+	ErrTitleMissing error = eventbus.NewMissingFieldError("title")
+	// ErrVersionMissing is self-described
+	ErrVersionMissing error = eventbus.NewMissingFieldError("version")
 )
 
 // ErrWrongType is an error thrown when a type assertion fails on a field
-type ErrWrongType struct {
-	field        string
-	expectedType string
-}
+type ErrWrongType = eventbus.WrongTypeError
 
 // NewErrWrongType is a constructor
 func NewErrWrongType(field, expType string) ErrWrongType {
-	return ErrWrongType{field, expType}
-}
-
-// Error implements the error interface
-func (e ErrWrongType) Error() string {
-	return fmt.Sprintf("incorrect data type for %s, should be %s", e.field, e.expectedType)
+	return eventbus.NewWrongTypeError(field, expType)
 }
 
-const (
-	creatorKey = "creator"
-	contentKey = "content"
-	titleKey   = "title"
-	idKey      = "id"
-	tagsKey    = "tags"
-)
-
 // NewCreatePost is a constructor
 func NewCreatePost(repo usecase.Repository) CreatePost {
 	return CreatePost{repo}
@@ -57,57 +43,55 @@ type CreatePost struct {
 	repo usecase.Repository
 }
 
+// AuthorPayload is an author of a post, as passed in the events' data
+type AuthorPayload struct {
+	Login string `json:"login" validate:"required"`
+	Role  string `json:"role" validate:"required"`
+}
+
+// CreatePostPayload is the data of a CreatePostEventNameV1 event
+// The creator is one of the authors, even if not listed
+type CreatePostPayload struct {
+	Creator string          `json:"creator" validate:"required"`
+	Title   string          `json:"title" validate:"required"`
+	Content string          `json:"content" validate:"required"`
+	Tags    []string        `json:"tags"`
+	Authors []AuthorPayload `json:"authors"`
+}
+
+var _ eventbus.TypedCommandHandler = CreatePost{}
+
 var errCreatePostHandler = "create post: %w"
 
 // Handle is CommandHandler's implementation
 func (c CreatePost) Handle(ctx context.Context, params eventbus.Params) error {
-	creatorParam, ok := params[creatorKey]
-	if !ok {
-		return fmt.Errorf(errCreatePostHandler, ErrCreatorMissing)
-	}
-	creator, ok := creatorParam.(string)
-	if !ok {
-		return fmt.Errorf(
-			errCreatePostHandler,
-			NewErrWrongType("creator", "string"),
-		)
-	}
-	contentParam, ok := params[contentKey]
-	if !ok {
-		return fmt.Errorf(errCreatePostHandler, ErrContentMissing)
-	}
-	content, ok := contentParam.(string)
-	if !ok {
-		return fmt.Errorf(
-			errCreatePostHandler,
-			NewErrWrongType("content", "string"),
-		)
-	}
-	titleParam, ok := params[titleKey]
-	if !ok {
-		return fmt.Errorf(errCreatePostHandler, ErrTitleMissing)
-	}
-	title, ok := titleParam.(string)
-	if !ok {
-		return fmt.Errorf(
-			errCreatePostHandler,
-			NewErrWrongType("title", "string"),
-		)
-	}
-	tags, err := extractTags(params)
+	err := eventbus.Typed(c).Handle(ctx, params)
 	if err != nil {
 		return fmt.Errorf(errCreatePostHandler, err)
 	}
+	return nil
+}
+
+// NewPayload is TypedCommandHandler's implementation
+func (c CreatePost) NewPayload() interface{} {
+	return &CreatePostPayload{}
+}
+
+// HandlePayload is TypedCommandHandler's implementation
+func (c CreatePost) HandlePayload(ctx context.Context, payload interface{}) error {
+	create := payload.(*CreatePostPayload)
 	createPost := &usecase.CreatePostDto{
-		Creator: creator,
-		Content: content,
-		Title:   title,
-		Tags:    tags,
+		Creator: create.Creator,
+		Content: create.Content,
+		Title:   create.Title,
+		Tags:    create.Tags,
+		Authors: toAuthors(create.Authors),
 	}
-	_, err = c.repo.CreatePost(ctx, createPost)
+	post, err := c.repo.CreatePost(ctx, createPost)
 	if err != nil {
-		return fmt.Errorf(errCreatePostHandler, err)
+		return err
 	}
+	recordPost(ctx, post)
 	return nil
 }
 
@@ -124,75 +108,229 @@ type UpdatePost struct {
 	repo usecase.Repository
 }
 
+// UpdatePostPayload is the data of an UpdatePostEventNameV1 event
+type UpdatePostPayload struct {
+	ID      string          `json:"id" validate:"required"`
+	Version int             `json:"version" validate:"required"`
+	Title   string          `json:"title" validate:"required"`
+	Content string          `json:"content" validate:"required"`
+	Tags    []string        `json:"tags"`
+	Authors []AuthorPayload `json:"authors"`
+}
+
+var _ eventbus.TypedCommandHandler = UpdatePost{}
+
 var errUpdatePostHandler = "update post: %w"
 
 // Handle is CommandHandler's implementation
 func (u UpdatePost) Handle(ctx context.Context, params eventbus.Params) error {
-	idParam, ok := params[idKey]
-	if !ok {
-		return fmt.Errorf(errUpdatePostHandler, ErrIDMissing)
-	}
-	id, ok := idParam.(string)
-	if !ok {
-		return fmt.Errorf(
-			errUpdatePostHandler,
-			NewErrWrongType("id", "string"),
-		)
+	err := eventbus.Typed(u).Handle(ctx, params)
+	if err != nil {
+		return fmt.Errorf(errUpdatePostHandler, err)
 	}
-	contentParam, ok := params[contentKey]
-	if !ok {
-		return fmt.Errorf(errUpdatePostHandler, ErrContentMissing)
+	return nil
+}
+
+// NewPayload is TypedCommandHandler's implementation
+func (u UpdatePost) NewPayload() interface{} {
+	return &UpdatePostPayload{}
+}
+
+// HandlePayload is TypedCommandHandler's implementation
+func (u UpdatePost) HandlePayload(ctx context.Context, payload interface{}) error {
+	update := payload.(*UpdatePostPayload)
+	updatePost := &usecase.UpdatePostDto{
+		Id:      update.ID,
+		Actor:   actor(ctx),
+		Version: update.Version,
+		Content: &update.Content,
+		Title:   &update.Title,
+		Tags:    update.Tags,
+		Authors: toAuthors(update.Authors),
 	}
-	content, ok := contentParam.(string)
-	if !ok {
-		return fmt.Errorf(
-			errUpdatePostHandler,
-			NewErrWrongType("content", "string"),
-		)
+	post, err := u.repo.UpdatePost(ctx, updatePost)
+	if err != nil {
+		return err
 	}
-	titleParam, ok := params[titleKey]
-	if !ok {
-		return fmt.Errorf(errUpdatePostHandler, ErrTitleMissing)
+	recordPost(ctx, post)
+	return nil
+}
+
+// NewPatchPost is a constructor
+func NewPatchPost(repo usecase.Repository) PatchPost {
+	return PatchPost{repo: repo}
+}
+
+// PatchPostEventNameV1 is self-described
+const PatchPostEventNameV1 = "posts.v1.patch"
+
+// PatchPost is a command handler that updates only the fields passed;
+// tags can be either replaced (tags) or added and removed (add_tags, remove_tags)
+// while authors can only be replaced
+type PatchPost struct {
+	repo usecase.Repository
+}
+
+// PatchPostPayload is the data of a PatchPostEventNameV1 event
+// Absent fields are nil
+type PatchPostPayload struct {
+	ID         string          `json:"id" validate:"required"`
+	Version    int             `json:"version" validate:"required"`
+	Title      *string         `json:"title"`
+	Content    *string         `json:"content"`
+	Tags       []string        `json:"tags"`
+	AddTags    []string        `json:"add_tags"`
+	RemoveTags []string        `json:"remove_tags"`
+	Authors    []AuthorPayload `json:"authors"`
+}
+
+var _ eventbus.TypedCommandHandler = PatchPost{}
+
+var errPatchPostHandler = "patch post: %w"
+
+// Handle is CommandHandler's implementation
+func (p PatchPost) Handle(ctx context.Context, params eventbus.Params) error {
+	err := eventbus.Typed(p).Handle(ctx, params)
+	if err != nil {
+		return fmt.Errorf(errPatchPostHandler, err)
 	}
-	title, ok := titleParam.(string)
-	if !ok {
-		return fmt.Errorf(
-			errUpdatePostHandler,
-			NewErrWrongType("title", "string"),
-		)
+	return nil
+}
+
+// NewPayload is TypedCommandHandler's implementation
+func (p PatchPost) NewPayload() interface{} {
+	return &PatchPostPayload{}
+}
+
+// HandlePayload is TypedCommandHandler's implementation
+func (p PatchPost) HandlePayload(ctx context.Context, payload interface{}) error {
+	patch := payload.(*PatchPostPayload)
+	patchPost := &usecase.UpdatePostDto{
+		Id:         patch.ID,
+		Actor:      actor(ctx),
+		Version:    patch.Version,
+		Content:    patch.Content,
+		Title:      patch.Title,
+		Tags:       patch.Tags,
+		AddTags:    patch.AddTags,
+		RemoveTags: patch.RemoveTags,
+		Authors:    toAuthors(patch.Authors),
 	}
-	tags, err := extractTags(params)
+	post, err := p.repo.UpdatePost(ctx, patchPost)
 	if err != nil {
-		return fmt.Errorf(errUpdatePostHandler, err)
+		return err
 	}
-	updatePost := &usecase.UpdatePostDto{
-		Id:      id,
-		Content: content,
-		Title:   title,
-		Tags:    tags,
+	recordPost(ctx, post)
+	return nil
+}
+
+// NewDeletePost is a constructor
+func NewDeletePost(repo usecase.Repository) DeletePost {
+	return DeletePost{repo: repo}
+}
+
+// DeletePostEventNameV1 is self-described
+const DeletePostEventNameV1 = "posts.v1.delete"
+
+// DeletePost is a command handler
+type DeletePost struct {
+	repo usecase.Repository
+}
+
+// DeletePostPayload is the data of a DeletePostEventNameV1 event
+type DeletePostPayload struct {
+	ID      string `json:"id" validate:"required"`
+	Version int    `json:"version" validate:"required"`
+}
+
+var _ eventbus.TypedCommandHandler = DeletePost{}
+
+var errDeletePostHandler = "delete post: %w"
+
+// Handle is CommandHandler's implementation
+func (d DeletePost) Handle(ctx context.Context, params eventbus.Params) error {
+	err := eventbus.Typed(d).Handle(ctx, params)
+	if err != nil {
+		return fmt.Errorf(errDeletePostHandler, err)
 	}
-	_, err = u.repo.UpdatePost(ctx, updatePost)
+	return nil
+}
+
+// NewPayload is TypedCommandHandler's implementation
+func (d DeletePost) NewPayload() interface{} {
+	return &DeletePostPayload{}
+}
+
+// HandlePayload is TypedCommandHandler's implementation
+func (d DeletePost) HandlePayload(ctx context.Context, payload interface{}) error {
+	deleted := payload.(*DeletePostPayload)
+	post, err := d.repo.DeletePost(ctx, &usecase.DeletePostDto{
+		Id:      deleted.ID,
+		Actor:   actor(ctx),
+		Version: deleted.Version,
+	})
 	if err != nil {
-		return fmt.Errorf(errUpdatePostHandler, err)
+		return err
 	}
+	recordPost(ctx, post)
 	return nil
 }
 
-func extractTags(params map[string]interface{}) ([]string, error) {
-	var tags []string
-	_, ok := params[tagsKey]
-	if ok {
-		tagValues, ok := params[tagsKey].([]interface{})
-		if !ok {
-			return nil, NewErrWrongType("tags", "array")
-		}
-		for i, rawTag := range tagValues {
-			tag, ok := rawTag.(string)
-			if !ok {
-				return nil, NewErrWrongType(fmt.Sprintf("tag at %d", i), "string")
-			}
-			tags = append(tags, tag)
-		}
+// toAuthors keeps nil as nil, meaning that no authors were passed
+func toAuthors(payloads []AuthorPayload) []usecase.Author {
+	if payloads == nil {
+		return nil
+	}
+	authors := make([]usecase.Author, 0, len(payloads))
+	for _, payload := range payloads {
+		authors = append(authors, usecase.Author{Login: payload.Login, Role: payload.Role})
+	}
+	return authors
+}
+
+// actor returns the authenticated user that sent the event being
+// handled, as carried by its envelope
+func actor(ctx context.Context) string {
+	envelope, _ := eventbus.EnvelopeFromContext(ctx)
+	return envelope.Actor
+}
+
+// recordPost reports the id and version of the post written,
+// for the sender of the event to learn them
+func recordPost(ctx context.Context, post *usecase.Post) {
+	if post == nil {
+		return
+	}
+	eventbus.RecordResult(ctx, ResultPostID, post.Id)
+	eventbus.RecordResult(ctx, ResultPostVersion, post.Version)
+}
+
+// Keys of the eventbus.Result recorded by the command handlers
+const (
+	ResultPostID      = "id"
+	ResultPostVersion = "version"
+)
+
+// IsTransient tells whether an error returned by the command handlers may not
+// happen again if retried. Besides eventbus.IsTransient's, the errors
+// refusing the data passed aren't
+func IsTransient(err error) bool {
+	switch {
+	case errors.Is(err, usecase.ErrPostNotFound),
+		errors.Is(err, usecase.ErrMissingID),
+		errors.Is(err, usecase.ErrUserNotFound),
+		errors.Is(err, usecase.ErrEmptyTags),
+		errors.Is(err, usecase.ErrMissingVersion),
+		errors.Is(err, usecase.ErrVersionConflict),
+		errors.Is(err, usecase.ErrNothingToUpdate),
+		errors.Is(err, usecase.ErrConflictingTagsUpdate),
+		errors.Is(err, usecase.ErrInvalidAuthorRole),
+		errors.Is(err, usecase.ErrDuplicatedAuthor),
+		errors.Is(err, usecase.ErrEmptyAuthors),
+		errors.Is(err, usecase.ErrForbidden),
+		errors.Is(err, usecase.ErrOperationCanceled):
+		return false
+	default:
+		return eventbus.IsTransient(err)
 	}
-	return tags, nil
 }
@@ -3,12 +3,13 @@ package command_test
 import (
 	"context"
 	"errors"
+	"fmt"
 	"testing"
 	"time"
 
 	"github.com/mountolive/back-blog-go/post/command"
 	"github.com/mountolive/back-blog-go/post/eventbus"
-	"github.com/mountolive/back-blog-go/post/pgstore"
+	"github.com/mountolive/back-blog-go/post/memstore"
 	"github.com/mountolive/back-blog-go/post/usecase"
 	"github.com/stretchr/testify/require"
 )
@@ -36,12 +37,11 @@ func TestCreatePost(t *testing.T) {
 		var _ eventbus.CommandHandler = command.CreatePost{}
 	})
 
-	require := require.New(t)
 	correctParams := eventbus.Params{
 		"creator": "some-creator",
 		"title":   "title",
 		"content": "some content",
-		"tags":    []string{"tag1", "tag2"},
+		"tags":    []interface{}{"tag1", "tag2"},
 	}
 	createErr := errors.New("create error")
 	testCases := []createTestCase{
@@ -51,7 +51,7 @@ func TestCreatePost(t *testing.T) {
 			params: eventbus.Params{
 				"creator": "some-creator",
 				"title":   "title",
-				"tags":    []string{"tag1", "tag2"},
+				"tags":    []interface{}{"tag1", "tag2"},
 			},
 			expectedErr: command.ErrContentMissing,
 		},
@@ -61,7 +61,7 @@ func TestCreatePost(t *testing.T) {
 			params: eventbus.Params{
 				"creator": "some-creator",
 				"content": "some content",
-				"tags":    []string{"tag1", "tag2"},
+				"tags":    []interface{}{"tag1", "tag2"},
 			},
 			expectedErr: command.ErrTitleMissing,
 		},
@@ -71,7 +71,7 @@ func TestCreatePost(t *testing.T) {
 			params: eventbus.Params{
 				"title":   "title",
 				"content": "some content",
-				"tags":    []string{"tag1", "tag2"},
+				"tags":    []interface{}{"tag1", "tag2"},
 			},
 			expectedErr: command.ErrCreatorMissing,
 		},
@@ -82,7 +82,7 @@ func TestCreatePost(t *testing.T) {
 				"creator": []string{},
 				"title":   "title",
 				"content": "content",
-				"tags":    []string{"tag1"},
+				"tags":    []interface{}{"tag1"},
 			},
 			expectedErr: command.NewErrWrongType("creator", "string"),
 		},
@@ -93,7 +93,7 @@ func TestCreatePost(t *testing.T) {
 				"creator": "creator",
 				"title":   "title",
 				"content": 1,
-				"tags":    []string{"tag1"},
+				"tags":    []interface{}{"tag1"},
 			},
 			expectedErr: command.NewErrWrongType("content", "string"),
 		},
@@ -104,7 +104,7 @@ func TestCreatePost(t *testing.T) {
 				"creator": "creator",
 				"title":   1,
 				"content": "content",
-				"tags":    []string{"tag1"},
+				"tags":    []interface{}{"tag1"},
 			},
 			expectedErr: command.NewErrWrongType("title", "string"),
 		},
@@ -117,7 +117,7 @@ func TestCreatePost(t *testing.T) {
 				"content": "some content",
 				"tags":    "tag1",
 			},
-			expectedErr: command.NewErrWrongType("tags", "[]string"),
+			expectedErr: command.NewErrWrongType("tags", "array"),
 		},
 		{
 			name:        "Creator checker error",
@@ -163,9 +163,35 @@ func TestCreatePost(t *testing.T) {
 			}
 			handler := command.NewCreatePost(repo)
 			err := handler.Handle(context.Background(), tc.params)
-			require.True(errors.Is(err, tc.expectedErr), "got %v, expected %v", err, tc.expectedErr)
+			require.True(t, errors.Is(err, tc.expectedErr), "got %v, expected %v", err, tc.expectedErr)
 		})
 	}
+
+	t.Run("All field errors at once", func(t *testing.T) {
+		t.Parallel()
+		handler := command.NewCreatePost(&usecase.PostRepository{})
+		err := handler.Handle(context.Background(), eventbus.Params{
+			"title": 1,
+			"tags":  []interface{}{"tag1", 2},
+		})
+		require.True(t, errors.Is(err, eventbus.ErrInvalidPayload))
+		for _, expectedErr := range []error{
+			command.ErrCreatorMissing,
+			command.ErrContentMissing,
+			command.NewErrWrongType("title", "string"),
+			command.NewErrWrongType("tags at 1", "string"),
+		} {
+			require.True(t, errors.Is(err, expectedErr), "got %v, expected %v", err, expectedErr)
+		}
+	})
+
+	t.Run("Schema", func(t *testing.T) {
+		t.Parallel()
+		bus := eventbus.NewEventBus()
+		bus.Register(command.CreatePostEventNameV1, command.NewCreatePost(&usecase.PostRepository{}))
+		schema := bus.Schemas()[command.CreatePostEventNameV1]
+		require.Equal(t, []string{"content", "creator", "title"}, schema["required"])
+	})
 }
 
 func TestUpdatePost(t *testing.T) {
@@ -176,12 +202,12 @@ func TestUpdatePost(t *testing.T) {
 
 	correctParams := eventbus.Params{
 		"id":      "some-id",
+		"version": float64(1),
 		"title":   "title",
 		"content": "some content",
-		"tags":    []string{"tag1", "tag2"},
+		"tags":    []interface{}{"tag1", "tag2"},
 	}
 	updateErr := errors.New("update error")
-	require := require.New(t)
 	testCases := []updateTestCase{
 		{
 			name:        "Missing id error",
@@ -190,7 +216,7 @@ func TestUpdatePost(t *testing.T) {
 			params: eventbus.Params{
 				"title":   "title",
 				"content": "some content",
-				"tags":    []string{"tag1", "tag2"},
+				"tags":    []interface{}{"tag1", "tag2"},
 			},
 			expectedErr: command.ErrIDMissing,
 		},
@@ -200,7 +226,7 @@ func TestUpdatePost(t *testing.T) {
 			params: eventbus.Params{
 				"id":    "some-id",
 				"title": "title",
-				"tags":  []string{"tag1", "tag2"},
+				"tags":  []interface{}{"tag1", "tag2"},
 			},
 			expectedErr: command.ErrContentMissing,
 		},
@@ -210,7 +236,7 @@ func TestUpdatePost(t *testing.T) {
 			params: eventbus.Params{
 				"id":      "some-id",
 				"content": "some content",
-				"tags":    []string{"tag1", "tag2"},
+				"tags":    []interface{}{"tag1", "tag2"},
 			},
 			expectedErr: command.ErrTitleMissing,
 		},
@@ -221,7 +247,7 @@ func TestUpdatePost(t *testing.T) {
 				"id":      []string{},
 				"title":   "title",
 				"content": "content",
-				"tags":    []string{"tag1"},
+				"tags":    []interface{}{"tag1"},
 			},
 			expectedErr: command.NewErrWrongType("id", "string"),
 		},
@@ -232,7 +258,7 @@ func TestUpdatePost(t *testing.T) {
 				"id":      "some-id",
 				"title":   "title",
 				"content": 1,
-				"tags":    []string{"tag1"},
+				"tags":    []interface{}{"tag1"},
 			},
 			expectedErr: command.NewErrWrongType("content", "string"),
 		},
@@ -243,20 +269,44 @@ func TestUpdatePost(t *testing.T) {
 				"id":      "some-id",
 				"title":   1,
 				"content": "content",
-				"tags":    []string{"tag1"},
+				"tags":    []interface{}{"tag1"},
 			},
 			expectedErr: command.NewErrWrongType("title", "string"),
 		},
+		{
+			name:        "Missing version error",
+			description: "Errored execution when payload is missing the version",
+			params: eventbus.Params{
+				"id":      "some-id",
+				"title":   "title",
+				"content": "some content",
+				"tags":    []interface{}{"tag1"},
+			},
+			expectedErr: command.ErrVersionMissing,
+		},
+		{
+			name:        "Wrong Version type error",
+			description: "Errored execution when payload has a version parameter that's not an integer",
+			params: eventbus.Params{
+				"id":      "some-id",
+				"version": 1.5,
+				"title":   "title",
+				"content": "some content",
+				"tags":    []interface{}{"tag1"},
+			},
+			expectedErr: command.NewErrWrongType("version", "integer"),
+		},
 		{
 			name:        "Wrong Tags type error",
 			description: "Errored execution when payload has a tags parameter that's not a slice",
 			params: eventbus.Params{
 				"id":      "some-id",
+				"version": float64(1),
 				"title":   "title",
 				"content": "some content",
 				"tags":    "tag1",
 			},
-			expectedErr: command.NewErrWrongType("tags", "[]string"),
+			expectedErr: command.NewErrWrongType("tags", "array"),
 		},
 		{
 			name:        "Store Update error",
@@ -283,40 +333,252 @@ func TestUpdatePost(t *testing.T) {
 				Sanitizer: &mockSanitizer{},
 			}
 			handler := command.NewUpdatePost(repo)
-			err := handler.Handle(context.Background(), tc.params)
-			require.True(errors.Is(err, tc.expectedErr), "got %v, expected %v", err, tc.expectedErr)
+			err := handler.Handle(actorCtx(testActor), tc.params)
+			require.True(t, errors.Is(err, tc.expectedErr), "got %v, expected %v", err, tc.expectedErr)
+		})
+	}
+}
+
+func TestPatchPost(t *testing.T) {
+	t.Run("Canary", func(t *testing.T) {
+		t.Parallel()
+		var _ eventbus.CommandHandler = command.PatchPost{}
+	})
+
+	updateErr := errors.New("update error")
+	testCases := []updateTestCase{
+		{
+			name:        "Missing id error",
+			description: "Errored execution when payload is missing the id",
+			params: eventbus.Params{
+				"version": float64(1),
+				"title":   "title",
+			},
+			expectedErr: command.ErrIDMissing,
+		},
+		{
+			name:        "Missing version error",
+			description: "Errored execution when payload is missing the version",
+			params: eventbus.Params{
+				"id":    "some-id",
+				"title": "title",
+			},
+			expectedErr: command.ErrVersionMissing,
+		},
+		{
+			name:        "Wrong Title type error",
+			description: "Errored execution when payload has a title parameter that's not a string",
+			params: eventbus.Params{
+				"id":      "some-id",
+				"version": float64(1),
+				"title":   1,
+			},
+			expectedErr: command.NewErrWrongType("title", "string"),
+		},
+		{
+			name:        "Wrong Add Tags type error",
+			description: "Errored execution when payload has an add_tags parameter that's not a slice",
+			params: eventbus.Params{
+				"id":       "some-id",
+				"version":  float64(1),
+				"add_tags": "tag1",
+			},
+			expectedErr: command.NewErrWrongType("add_tags", "array"),
+		},
+		{
+			name:        "Nothing to update error",
+			description: "Errored execution when payload has no field to update",
+			params: eventbus.Params{
+				"id":      "some-id",
+				"version": float64(1),
+			},
+			expectedErr: usecase.ErrNothingToUpdate,
+		},
+		{
+			name:        "Conflicting tags error",
+			description: "Errored execution when payload replaces and adds tags at the same time",
+			params: eventbus.Params{
+				"id":       "some-id",
+				"version":  float64(1),
+				"tags":     []interface{}{"tag1"},
+				"add_tags": []interface{}{"tag2"},
+			},
+			expectedErr: usecase.ErrConflictingTagsUpdate,
+		},
+		{
+			name:        "Store Update error",
+			description: "Errored execution when trying to excute store's Update",
+			store:       &mockStoreErrored{updateErr},
+			params: eventbus.Params{
+				"id":      "some-id",
+				"version": float64(1),
+				"title":   "title",
+			},
+			expectedErr: updateErr,
+		},
+		{
+			name:        "Correct",
+			description: "Not errored execution",
+			store:       &mockStore{},
+			params: eventbus.Params{
+				"id":          "some-id",
+				"version":     float64(1),
+				"content":     "some content",
+				"add_tags":    []interface{}{"tag3"},
+				"remove_tags": []interface{}{"tag1"},
+			},
+		},
+	}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			t.Log(tc.description)
+			repo := &usecase.PostRepository{
+				Store:     tc.store,
+				Checker:   &mockTrueChecker{},
+				Sanitizer: &mockSanitizer{},
+			}
+			handler := command.NewPatchPost(repo)
+			err := handler.Handle(actorCtx(testActor), tc.params)
+			require.True(t, errors.Is(err, tc.expectedErr), "got %v, expected %v", err, tc.expectedErr)
 		})
 	}
 }
 
 func TestStoreIntegration(t *testing.T) {
 	require := require.New(t)
-	store := pgstore.CreateTestContainer(t, "some-container")
+	store := memstore.NewPostMemStore()
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 	tag1 := "tag1"
 	correctParams := eventbus.Params{
-		"creator": "some-creator",
+		"creator": testActor,
 		"title":   "title",
 		"content": "some content",
-		"tags":    []string{tag1, "tag2"},
+		"tags":    []interface{}{tag1, "tag2"},
 	}
+	ctx = eventbus.ContextWithEnvelope(ctx, eventbus.Envelope{Actor: testActor})
+	publisher := &usecase.InMemoryPublisher{}
 	repo := &usecase.PostRepository{
 		Store:     store,
 		Checker:   &mockTrueChecker{},
 		Sanitizer: &mockSanitizer{},
+		Publisher: publisher,
 	}
 	createHandler := command.NewCreatePost(repo)
-	err := createHandler.Handle(ctx, correctParams)
+	resultCtx, result := eventbus.ContextWithResult(ctx)
+	err := createHandler.Handle(resultCtx, correctParams)
 	require.NoError(err)
 	filter := &usecase.GeneralFilter{PageSize: 1}
 	filter.Tag = tag1
 	createdPosts, err := store.Filter(ctx, filter)
 	require.NoError(err)
 	require.Len(createdPosts, 1)
+	require.Equal(map[string]interface{}{
+		command.ResultPostID:      createdPosts[0].Id,
+		command.ResultPostVersion: 1,
+	}, result.Values())
 	correctParams["id"] = createdPosts[0].Id
+	correctParams["version"] = float64(createdPosts[0].Version)
 	correctParams["title"] = "some-other-title"
 	updateHandler := command.NewUpdatePost(repo)
+	otherCtx := eventbus.ContextWithEnvelope(ctx, eventbus.Envelope{Actor: "someone-else"})
+	err = updateHandler.Handle(otherCtx, correctParams)
+	require.True(errors.Is(err, usecase.ErrForbidden), "got %v, expected %v", err, usecase.ErrForbidden)
 	err = updateHandler.Handle(ctx, correctParams)
 	require.NoError(err)
+	deleteHandler := command.NewDeletePost(repo)
+	err = deleteHandler.Handle(ctx, eventbus.Params{
+		"id":      createdPosts[0].Id,
+		"version": float64(createdPosts[0].Version + 1),
+	})
+	require.NoError(err)
+	_, err = store.ReadOne(ctx, createdPosts[0].Id)
+	require.True(errors.Is(err, usecase.ErrPostNotFound))
+
+	events := publisher.Events()
+	require.Len(events, 3)
+	expectedNames := []string{
+		usecase.PostCreatedEventNameV1,
+		usecase.PostUpdatedEventNameV1,
+		usecase.PostDeletedEventNameV1,
+	}
+	for i, event := range events {
+		require.Equal(expectedNames[i], event.Name)
+		require.Equal(createdPosts[0].Id, event.Post.Id)
+	}
+	require.Equal("some-other-title", events[1].Post.Title)
+	require.Equal(2, events[2].Post.Version)
+}
+
+func TestDeletePost(t *testing.T) {
+	t.Run("Canary", func(t *testing.T) {
+		t.Parallel()
+		var _ eventbus.CommandHandler = command.DeletePost{}
+	})
+
+	deleteErr := errors.New("delete error")
+	testCases := []updateTestCase{
+		{
+			name:        "Missing id and version error",
+			description: "Errored execution when payload is missing the id and version",
+			params:      eventbus.Params{},
+			expectedErr: command.ErrIDMissing,
+		},
+		{
+			name:        "Wrong version type error",
+			description: "Errored execution when payload has a version that's not an integer",
+			params:      eventbus.Params{"id": "some-id", "version": "1"},
+			expectedErr: command.NewErrWrongType("version", "integer"),
+		},
+		{
+			name:        "Store Delete error",
+			description: "Errored execution when trying to execute store's Delete",
+			store:       &mockStoreErrored{deleteErr},
+			params:      eventbus.Params{"id": "some-id", "version": float64(1)},
+			expectedErr: deleteErr,
+		},
+		{
+			name:        "Correct",
+			description: "Not errored execution",
+			store:       &mockStore{},
+			params:      eventbus.Params{"id": "some-id", "version": float64(1)},
+		},
+	}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			t.Log(tc.description)
+			repo := &usecase.PostRepository{Store: tc.store}
+			err := command.NewDeletePost(repo).Handle(actorCtx(testActor), tc.params)
+			require.True(t, errors.Is(err, tc.expectedErr), "got %v, expected %v", err, tc.expectedErr)
+		})
+	}
+}
+
+func TestIsTransient(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name     string
+		err      error
+		expected bool
+	}{
+		{"Missing field", command.ErrTitleMissing, false},
+		{"Version conflict", usecase.ErrVersionConflict, false},
+		{"Post not found", usecase.ErrPostNotFound, false},
+		{"Forbidden", usecase.ErrForbidden, false},
+		{"Handler panic", eventbus.ErrHandlerPanic, false},
+		{"User check", usecase.ErrUserCheck, true},
+		{"Handler timeout", eventbus.ErrHandlerTimeout, true},
+		{"Any other error", errors.New("connection reset"), true},
+	}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			require.Equal(t, tc.expected, command.IsTransient(fmt.Errorf("wrapped: %w", tc.err)))
+		})
+	}
 }
@@ -4,9 +4,18 @@ import (
 	"context"
 	"fmt"
 
+	"github.com/mountolive/back-blog-go/post/eventbus"
 	"github.com/mountolive/back-blog-go/post/usecase"
 )
 
+// testActor is the creator of the posts read from the mock stores
+const testActor = "some-creator"
+
+// actorCtx carries the envelope of an event sent by actor
+func actorCtx(actor string) context.Context {
+	return eventbus.ContextWithEnvelope(context.Background(), eventbus.Envelope{Actor: actor})
+}
+
 type mockStore struct{}
 
 func (*mockStore) Create(context.Context, *usecase.CreatePostDto) (*usecase.Post, error) {
@@ -17,14 +26,18 @@ func (*mockStore) Update(context.Context, *usecase.UpdatePostDto) (*usecase.Post
 	return nil, nil
 }
 
-func (*mockStore) Filter(context.Context, *usecase.GeneralFilter) ([]*usecase.Post, error) {
+func (*mockStore) Delete(context.Context, *usecase.DeletePostDto) (*usecase.Post, error) {
 	return nil, nil
 }
 
-func (*mockStore) ReadOne(context.Context, string) (*usecase.Post, error) {
+func (*mockStore) Filter(context.Context, *usecase.GeneralFilter) ([]*usecase.Post, error) {
 	return nil, nil
 }
 
+func (*mockStore) ReadOne(_ context.Context, id string) (*usecase.Post, error) {
+	return &usecase.Post{Id: id, Creator: testActor}, nil
+}
+
 type mockStoreErrored struct {
 	err error
 }
@@ -37,12 +50,16 @@ func (m *mockStoreErrored) Update(context.Context, *usecase.UpdatePostDto) (*use
 	return nil, m.err
 }
 
+func (m *mockStoreErrored) Delete(context.Context, *usecase.DeletePostDto) (*usecase.Post, error) {
+	return nil, m.err
+}
+
 func (*mockStoreErrored) Filter(context.Context, *usecase.GeneralFilter) ([]*usecase.Post, error) {
 	return nil, nil
 }
 
-func (*mockStoreErrored) ReadOne(context.Context, string) (*usecase.Post, error) {
-	return nil, nil
+func (*mockStoreErrored) ReadOne(_ context.Context, id string) (*usecase.Post, error) {
+	return &usecase.Post{Id: id, Creator: testActor}, nil
 }
 
 type mockTrueChecker struct{}
@@ -0,0 +1,184 @@
+package command
+
+import (
+	"errors"
+
+	"github.com/mountolive/back-blog-go/post/audit"
+	"github.com/mountolive/back-blog-go/post/eventbus"
+	"github.com/mountolive/back-blog-go/post/usecase"
+)
+
+// ErrNoCreation returned when rebuilding a post whose history lacks its creation
+var ErrNoCreation = errors.New("post's history has no creation")
+
+// RebuiltPost is the state of a post rebuilt from its history
+// Applied counts the commands replayed, Deleted tells whether the
+// post was deleted, Post being its state right before
+type RebuiltPost struct {
+	Post    *usecase.Post `json:"post"`
+	Deleted bool          `json:"deleted"`
+	Applied int           `json:"applied"`
+}
+
+// RebuildPost replays the succeeded commands of the history of a post,
+// oldest first, as returned by an audit.Store. The commands that don't
+// apply to the state rebuilt so far are skipped: repeats, and the ones
+// based on another version. Contents are sanitized with sanitizer,
+// if not nil, as usecase.PostRepository does
+// The creator and authors are identified by the logins the commands
+// carry, as the users service isn't queried for their IDs
+func RebuildPost(history []*audit.Entry,
+	sanitizer usecase.ContentSanitizer) (*RebuiltPost, error) {
+	rebuilt := &RebuiltPost{}
+	for _, entry := range history {
+		if !entry.Succeeded() || rebuilt.Deleted {
+			continue
+		}
+		applied, err := rebuilt.apply(entry, sanitizer)
+		if err != nil {
+			return nil, err
+		}
+		if applied {
+			rebuilt.Applied++
+		}
+	}
+	if rebuilt.Post == nil {
+		return nil, ErrNoCreation
+	}
+	return rebuilt, nil
+}
+
+func (r *RebuiltPost) apply(entry *audit.Entry,
+	sanitizer usecase.ContentSanitizer) (bool, error) {
+	sanitize := func(content string) string {
+		if sanitizer == nil {
+			return content
+		}
+		return sanitizer.SanitizeContent(content)
+	}
+	switch entry.Name {
+	case CreatePostEventNameV1:
+		if r.Post != nil {
+			return false, nil
+		}
+		create := &CreatePostPayload{}
+		if err := eventbus.DecodePayload(entry.Payload, create); err != nil {
+			return false, err
+		}
+		r.Post = &usecase.Post{
+			Id:        entry.AggregateID,
+			Creator:   create.Creator,
+			Title:     create.Title,
+			Content:   sanitize(create.Content),
+			CreatedAt: entry.OccurredAt,
+			Tags:      create.Tags,
+			Authors:   rebuiltAuthors(create.Creator, create.Authors),
+			Version:   1,
+		}
+	case UpdatePostEventNameV1:
+		update := &UpdatePostPayload{}
+		if err := eventbus.DecodePayload(entry.Payload, update); err != nil {
+			return false, err
+		}
+		if r.Post == nil || update.Version != r.Post.Version {
+			return false, nil
+		}
+		r.Post.Title = update.Title
+		r.Post.Content = sanitize(update.Content)
+		if update.Tags != nil {
+			r.Post.Tags = update.Tags
+		}
+		r.replaceAuthors(update.Authors)
+		r.bump(entry)
+	case PatchPostEventNameV1:
+		patch := &PatchPostPayload{}
+		if err := eventbus.DecodePayload(entry.Payload, patch); err != nil {
+			return false, err
+		}
+		if r.Post == nil || patch.Version != r.Post.Version {
+			return false, nil
+		}
+		if patch.Title != nil {
+			r.Post.Title = *patch.Title
+		}
+		if patch.Content != nil {
+			r.Post.Content = sanitize(*patch.Content)
+		}
+		if patch.Tags != nil {
+			r.Post.Tags = patch.Tags
+		}
+		r.Post.Tags = removeTags(addTags(r.Post.Tags, patch.AddTags), patch.RemoveTags)
+		r.replaceAuthors(patch.Authors)
+		r.bump(entry)
+	case DeletePostEventNameV1:
+		deleted := &DeletePostPayload{}
+		if err := eventbus.DecodePayload(entry.Payload, deleted); err != nil {
+			return false, err
+		}
+		if r.Post == nil || deleted.Version != r.Post.Version {
+			return false, nil
+		}
+		r.Deleted = true
+	default:
+		return false, nil
+	}
+	return true, nil
+}
+
+// bump records the update of the post by entry
+func (r *RebuiltPost) bump(entry *audit.Entry) {
+	r.Post.Version++
+	r.Post.UpdatedAt = entry.OccurredAt
+}
+
+// replaceAuthors replaces the authors of the post, when any are passed
+func (r *RebuiltPost) replaceAuthors(authors []AuthorPayload) {
+	if authors != nil {
+		r.Post.Authors = rebuiltAuthors(r.Post.Creator, authors)
+	}
+}
+
+// rebuiltAuthors returns the authors of a post created by creator,
+// identified by their logins
+func rebuiltAuthors(creator string, payloads []AuthorPayload) []usecase.Author {
+	authors := toAuthors(payloads)
+	for i := range authors {
+		authors[i].ID = authors[i].Login
+	}
+	authors = usecase.NormalizeAuthors(creator, authors)
+	for i := range authors {
+		authors[i].Login = authors[i].ID
+	}
+	return authors
+}
+
+func addTags(tags, added []string) []string {
+	for _, tag := range added {
+		if !containsTag(tags, tag) {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+func removeTags(tags, removed []string) []string {
+	if len(removed) == 0 {
+		return tags
+	}
+	kept := []string{}
+	for _, tag := range tags {
+		if !containsTag(removed, tag) {
+			kept = append(kept, tag)
+		}
+	}
+	return kept
+}
+
+func containsTag(tags []string, tag string) bool {
+	for _, t := range tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,121 @@
+package command_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/mountolive/back-blog-go/post/audit"
+	"github.com/mountolive/back-blog-go/post/command"
+	"github.com/mountolive/back-blog-go/post/eventbus"
+	"github.com/mountolive/back-blog-go/post/usecase"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRebuildPost(t *testing.T) {
+	createdAt := time.Date(2021, 3, 1, 10, 0, 0, 0, time.UTC)
+	entry := func(name string, minutes int, outcome string, payload eventbus.Params) *audit.Entry {
+		return &audit.Entry{
+			Name:        name,
+			AggregateID: "post-1",
+			Payload:     payload,
+			Outcome:     outcome,
+			OccurredAt:  createdAt.Add(time.Duration(minutes) * time.Minute),
+		}
+	}
+	create := entry(command.CreatePostEventNameV1, 0, eventbus.StatusSucceeded, eventbus.Params{
+		"creator": "creator",
+		"title":   "title",
+		"content": "content",
+		"tags":    []interface{}{"go"},
+	})
+
+	t.Run("Replay", func(t *testing.T) {
+		t.Parallel()
+		history := []*audit.Entry{
+			create,
+			entry(command.UpdatePostEventNameV1, 1, eventbus.StatusSucceeded, eventbus.Params{
+				"id": "post-1", "version": 1, "title": "updated", "content": "updated",
+			}),
+			entry(command.PatchPostEventNameV1, 2, eventbus.StatusFailed, eventbus.Params{
+				"id": "post-1", "version": 2, "title": "failed",
+			}),
+			entry(command.PatchPostEventNameV1, 3, eventbus.StatusSucceeded, eventbus.Params{
+				"id": "post-1", "version": 2, "title": "patched",
+				"add_tags": []interface{}{"blog"}, "remove_tags": []interface{}{"go"},
+			}),
+		}
+		rebuilt, err := command.RebuildPost(history, nil)
+		require.NoError(t, err)
+		require.Equal(t, 3, rebuilt.Applied)
+		require.False(t, rebuilt.Deleted)
+		require.Equal(t, "post-1", rebuilt.Post.Id)
+		require.Equal(t, "creator", rebuilt.Post.Creator)
+		require.Equal(t, "patched", rebuilt.Post.Title)
+		require.Equal(t, "updated", rebuilt.Post.Content)
+		require.Equal(t, []string{"blog"}, rebuilt.Post.Tags)
+		require.Equal(t, 3, rebuilt.Post.Version)
+		require.Equal(t, createdAt, rebuilt.Post.CreatedAt)
+		require.Equal(t, createdAt.Add(3*time.Minute), rebuilt.Post.UpdatedAt)
+	})
+
+	t.Run("Authors", func(t *testing.T) {
+		t.Parallel()
+		history := []*audit.Entry{
+			create,
+			entry(command.PatchPostEventNameV1, 1, eventbus.StatusSucceeded, eventbus.Params{
+				"id": "post-1", "version": 1,
+				"authors": []interface{}{
+					map[string]interface{}{"login": "coauthor", "role": usecase.AuthorRoleEditor},
+				},
+			}),
+		}
+		rebuilt, err := command.RebuildPost(history, nil)
+		require.NoError(t, err)
+		require.Equal(t, []usecase.Author{
+			{ID: "creator", Login: "creator", Role: usecase.AuthorRoleAuthor},
+			{ID: "coauthor", Login: "coauthor", Role: usecase.AuthorRoleEditor},
+		}, rebuilt.Post.Authors)
+		require.Equal(t, 2, rebuilt.Post.Version)
+	})
+
+	t.Run("Stale version skipped", func(t *testing.T) {
+		t.Parallel()
+		history := []*audit.Entry{
+			create,
+			entry(command.UpdatePostEventNameV1, 1, eventbus.StatusSucceeded, eventbus.Params{
+				"id": "post-1", "version": 4, "title": "stale", "content": "stale",
+			}),
+		}
+		rebuilt, err := command.RebuildPost(history, nil)
+		require.NoError(t, err)
+		require.Equal(t, 1, rebuilt.Applied)
+		require.Equal(t, "title", rebuilt.Post.Title)
+		require.Equal(t, 1, rebuilt.Post.Version)
+	})
+
+	t.Run("Deleted", func(t *testing.T) {
+		t.Parallel()
+		history := []*audit.Entry{
+			create,
+			entry(command.DeletePostEventNameV1, 1, eventbus.StatusSucceeded, eventbus.Params{
+				"id": "post-1", "version": 1,
+			}),
+		}
+		rebuilt, err := command.RebuildPost(history, nil)
+		require.NoError(t, err)
+		require.True(t, rebuilt.Deleted)
+		require.Equal(t, "title", rebuilt.Post.Title)
+	})
+
+	t.Run("No creation", func(t *testing.T) {
+		t.Parallel()
+		history := []*audit.Entry{
+			entry(command.DeletePostEventNameV1, 1, eventbus.StatusSucceeded, eventbus.Params{
+				"id": "post-1", "version": 1,
+			}),
+		}
+		_, err := command.RebuildPost(history, nil)
+		require.True(t, errors.Is(err, command.ErrNoCreation))
+	})
+}
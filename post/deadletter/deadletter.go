@@ -0,0 +1,197 @@
+// Keeps the messages that couldn't be processed, dead letters, for them to
+// be inspected, fixed and replayed, or discarded
+package deadletter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mountolive/back-blog-go/post/broker"
+	"github.com/mountolive/back-blog-go/post/eventbus"
+)
+
+var (
+	// ErrLetterNotFound is self-described
+	ErrLetterNotFound = errors.New("dead letter not found")
+	// ErrReplay returned when a replayed dead letter fails again
+	ErrReplay = errors.New("dead letter replay failed")
+	// ErrStore is self-described
+	ErrStore = errors.New("dead letter store error")
+)
+
+// DefaultLimit is the number of dead letters listed when no limit is passed
+const DefaultLimit = 50
+
+// Letter is a message that couldn't be processed, along with its failure
+// Header holds the message's original headers; Attempts counts its
+// deliveries, plus the replays failed
+type Letter struct {
+	ID       string              `json:"id"`
+	Subject  string              `json:"subject"`
+	Data     string              `json:"data"`
+	Header   map[string][]string `json:"header,omitempty"`
+	Reason   string              `json:"reason"`
+	Error    string              `json:"error"`
+	Attempts int                 `json:"attempts"`
+	FailedAt time.Time           `json:"failed_at"`
+}
+
+// Filter narrows the dead letters listed, empty fields match any
+type Filter struct {
+	Subject string
+	Reason  string
+	Limit   int
+	Offset  int
+}
+
+// Store keeps the dead letters
+type Store interface {
+	// Save records letter, assigning its ID
+	Save(ctx context.Context, letter *Letter) error
+	// List returns the letters matching filter, the most recent first
+	List(ctx context.Context, filter Filter) ([]*Letter, error)
+	// Get returns the letter with the passed id, ErrLetterNotFound if missing
+	Get(ctx context.Context, id string) (*Letter, error)
+	// Update replaces the stored letter with the same ID, ErrLetterNotFound if missing
+	Update(ctx context.Context, letter *Letter) error
+	// Delete removes the letter with the passed id, ErrLetterNotFound if missing
+	Delete(ctx context.Context, id string) error
+}
+
+// EventBus is the needed functionality for replaying dead letters
+type EventBus interface {
+	Resolve(context.Context, eventbus.Event) error
+}
+
+// Manager records the dead letters published by a broker.NATSBroker,
+// and lets them be edited, replayed or discarded
+type Manager struct {
+	store Store
+	bus   EventBus
+}
+
+// NewManager is a constructor
+func NewManager(store Store, bus EventBus) *Manager {
+	return &Manager{store: store, bus: bus}
+}
+
+// Record saves dead, received from a broker's ProcessDead
+func (m *Manager) Record(ctx context.Context, dead broker.DeadLetter) error {
+	letter := FromDeadLetter(dead)
+	if err := m.store.Save(ctx, letter); err != nil {
+		return wrapError(ErrStore, err.Error())
+	}
+	return nil
+}
+
+// FromDeadLetter builds a Letter out of a dead letter passed by a broker,
+// reading the failure from its Dead-Letter- headers
+func FromDeadLetter(msg broker.DeadLetter) *Letter {
+	letter := &Letter{
+		Subject:  msg.Header.Get(broker.DeadLetterSubjectHeader),
+		Data:     string(msg.Data),
+		Header:   map[string][]string{},
+		Reason:   msg.Header.Get(broker.DeadLetterReasonHeader),
+		Error:    msg.Header.Get(broker.DeadLetterErrorHeader),
+		Attempts: 1,
+		FailedAt: time.Now().UTC(),
+	}
+	if letter.Subject == "" {
+		letter.Subject = msg.Subject
+	}
+	deliveries, err := strconv.Atoi(msg.Header.Get(broker.DeadLetterDeliveriesHeader))
+	if err == nil && deliveries > 0 {
+		letter.Attempts = deliveries
+	}
+	failedAt, err := time.Parse(time.RFC3339, msg.Header.Get(broker.DeadLetterFailedAtHeader))
+	if err == nil {
+		letter.FailedAt = failedAt
+	}
+	for key, values := range msg.Header {
+		if !strings.HasPrefix(key, broker.DeadLetterHeaderPrefix) {
+			letter.Header[key] = values
+		}
+	}
+	return letter
+}
+
+// List returns the dead letters matching filter, the most recent first
+func (m *Manager) List(ctx context.Context, filter Filter) ([]*Letter, error) {
+	if filter.Limit <= 0 {
+		filter.Limit = DefaultLimit
+	}
+	letters, err := m.store.List(ctx, filter)
+	if err != nil {
+		return nil, wrapError(ErrStore, err.Error())
+	}
+	return letters, nil
+}
+
+// Get returns the dead letter with the passed id
+func (m *Manager) Get(ctx context.Context, id string) (*Letter, error) {
+	letter, err := m.store.Get(ctx, id)
+	if err != nil {
+		return nil, storeError(err)
+	}
+	return letter, nil
+}
+
+// Edit replaces the data of the dead letter with the passed id,
+// for fixing it before replaying it
+func (m *Manager) Edit(ctx context.Context, id, data string) (*Letter, error) {
+	letter, err := m.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	letter.Data = data
+	if err := m.store.Update(ctx, letter); err != nil {
+		return nil, storeError(err)
+	}
+	return letter, nil
+}
+
+// Replay resolves the dead letter with the passed id through the EventBus,
+// as if it was received again. It's discarded once resolved; otherwise
+// its failure is updated, and the error returned wraps ErrReplay
+func (m *Manager) Replay(ctx context.Context, id string) error {
+	letter, err := m.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+	replayErr := m.bus.Resolve(ctx, broker.NewMessage([]byte(letter.Data), letter.Header))
+	if replayErr == nil {
+		return m.Discard(ctx, id)
+	}
+	letter.Attempts++
+	letter.Reason = broker.DeadLetterReason(replayErr)
+	letter.Error = replayErr.Error()
+	letter.FailedAt = time.Now().UTC()
+	if err := m.store.Update(ctx, letter); err != nil {
+		return storeError(err)
+	}
+	return fmt.Errorf("%w: %v", ErrReplay, replayErr)
+}
+
+// Discard removes the dead letter with the passed id
+func (m *Manager) Discard(ctx context.Context, id string) error {
+	if err := m.store.Delete(ctx, id); err != nil {
+		return storeError(err)
+	}
+	return nil
+}
+
+// storeError wraps the errors of the store, but for ErrLetterNotFound
+func storeError(err error) error {
+	if errors.Is(err, ErrLetterNotFound) {
+		return err
+	}
+	return wrapError(ErrStore, err.Error())
+}
+
+func wrapError(err error, msg string) error {
+	return fmt.Errorf("%w: %s", err, msg)
+}
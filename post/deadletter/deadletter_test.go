@@ -0,0 +1,134 @@
+package deadletter_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/mountolive/back-blog-go/post/broker"
+	"github.com/mountolive/back-blog-go/post/deadletter"
+	"github.com/mountolive/back-blog-go/post/eventbus"
+	"github.com/mountolive/back-blog-go/post/memstore"
+	"github.com/stretchr/testify/require"
+)
+
+const genericErr = "\nGot: %v \n Expected: %v\n"
+
+type mockBus struct {
+	err      error
+	resolved []eventbus.Event
+}
+
+func (m *mockBus) Resolve(_ context.Context, event eventbus.Event) error {
+	m.resolved = append(m.resolved, event)
+	return m.err
+}
+
+func deadMsg() broker.DeadLetter {
+	return broker.DeadLetter{
+		Subject: "dead.posts",
+		Data:    []byte(`{"name":"create_post","data":{"title":"dead"}}`),
+		Header: broker.Header{
+			"Nats-Msg-Id":                     {"dead-letter"},
+			broker.DeadLetterReasonHeader:     {broker.ReasonHandlerError},
+			broker.DeadLetterErrorHeader:      {"boom"},
+			broker.DeadLetterSubjectHeader:    {"posts"},
+			broker.DeadLetterDeliveriesHeader: {"5"},
+			broker.DeadLetterFailedAtHeader:   {"2021-06-01T10:00:00Z"},
+		},
+	}
+}
+
+func recordLetter(t *testing.T, manager *deadletter.Manager) *deadletter.Letter {
+	t.Helper()
+	ctx := context.Background()
+	require.NoError(t, manager.Record(ctx, deadMsg()))
+	letters, err := manager.List(ctx, deadletter.Filter{})
+	require.NoError(t, err)
+	require.Len(t, letters, 1)
+	return letters[0]
+}
+
+func TestFromDeadLetter(t *testing.T) {
+	letter := deadletter.FromDeadLetter(deadMsg())
+	require.Equal(t, "posts", letter.Subject, genericErr, letter.Subject, "posts")
+	require.Equal(t, broker.ReasonHandlerError, letter.Reason, genericErr,
+		letter.Reason, broker.ReasonHandlerError)
+	require.Equal(t, "boom", letter.Error, genericErr, letter.Error, "boom")
+	require.Equal(t, 5, letter.Attempts, genericErr, letter.Attempts, 5)
+	expectedAt := time.Date(2021, 6, 1, 10, 0, 0, 0, time.UTC)
+	require.True(t, expectedAt.Equal(letter.FailedAt), genericErr,
+		letter.FailedAt, expectedAt)
+	expectedHeader := map[string][]string{"Nats-Msg-Id": {"dead-letter"}}
+	require.Equal(t, expectedHeader, letter.Header, genericErr,
+		letter.Header, expectedHeader)
+
+	t.Run("Without failure headers", func(t *testing.T) {
+		letter := deadletter.FromDeadLetter(broker.DeadLetter{
+			Subject: "dead.posts",
+			Data:    []byte("{}"),
+		})
+		require.Equal(t, "dead.posts", letter.Subject, genericErr,
+			letter.Subject, "dead.posts")
+		require.Equal(t, 1, letter.Attempts, genericErr, letter.Attempts, 1)
+		require.False(t, letter.FailedAt.IsZero(), "failed at should default to now")
+	})
+}
+
+func TestManager(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Edit", func(t *testing.T) {
+		manager := deadletter.NewManager(memstore.NewDeadLetterMemStore(), &mockBus{})
+		letter := recordLetter(t, manager)
+		data := `{"name":"create_post","data":{"title":"fixed"}}`
+
+		edited, err := manager.Edit(ctx, letter.ID, data)
+		require.NoError(t, err)
+		require.Equal(t, data, edited.Data, genericErr, edited.Data, data)
+		result, err := manager.Get(ctx, letter.ID)
+		require.NoError(t, err)
+		require.Equal(t, data, result.Data, genericErr, result.Data, data)
+	})
+
+	t.Run("Replay", func(t *testing.T) {
+		bus := &mockBus{}
+		manager := deadletter.NewManager(memstore.NewDeadLetterMemStore(), bus)
+		letter := recordLetter(t, manager)
+
+		require.NoError(t, manager.Replay(ctx, letter.ID))
+		require.Len(t, bus.resolved, 1)
+		require.Equal(t, []byte(letter.Data), bus.resolved[0].Data())
+		_, err := manager.Get(ctx, letter.ID)
+		require.True(t, errors.Is(err, deadletter.ErrLetterNotFound), genericErr,
+			err, deadletter.ErrLetterNotFound)
+	})
+
+	t.Run("Replay failed", func(t *testing.T) {
+		bus := &mockBus{err: eventbus.ErrEventNotRegistered}
+		manager := deadletter.NewManager(memstore.NewDeadLetterMemStore(), bus)
+		letter := recordLetter(t, manager)
+
+		err := manager.Replay(ctx, letter.ID)
+		require.True(t, errors.Is(err, deadletter.ErrReplay), genericErr,
+			err, deadletter.ErrReplay)
+		result, err := manager.Get(ctx, letter.ID)
+		require.NoError(t, err)
+		require.Equal(t, letter.Attempts+1, result.Attempts, genericErr,
+			result.Attempts, letter.Attempts+1)
+		require.Equal(t, broker.ReasonEventNotRegistered, result.Reason, genericErr,
+			result.Reason, broker.ReasonEventNotRegistered)
+		require.True(t, result.FailedAt.After(letter.FailedAt), "failed at should be updated")
+	})
+
+	t.Run("Discard", func(t *testing.T) {
+		manager := deadletter.NewManager(memstore.NewDeadLetterMemStore(), &mockBus{})
+		letter := recordLetter(t, manager)
+
+		require.NoError(t, manager.Discard(ctx, letter.ID))
+		err := manager.Discard(ctx, letter.ID)
+		require.True(t, errors.Is(err, deadletter.ErrLetterNotFound), genericErr,
+			err, deadletter.ErrLetterNotFound)
+	})
+}
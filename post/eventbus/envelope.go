@@ -0,0 +1,214 @@
+package eventbus
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// SpecVersion is the version of the CloudEvents specification
+// (https://cloudevents.io) the Envelope follows
+const SpecVersion = "1.0"
+
+// legacyNameKey is the key holding the name of an event in the legacy,
+// flat, format: {"event_name": "...", ...params}
+const legacyNameKey = "event_name"
+
+var (
+	// ErrInvalidEnvelope returned when an event's envelope is missing
+	// required attributes or has invalid ones
+	ErrInvalidEnvelope = errors.New("invalid event envelope")
+)
+
+// Envelope is the CloudEvents-compatible representation of an event
+// Actor, ActorSignature and CorrelationID are extension attributes; DataSchema
+// is expected to identify the version of the data's schema. ActorSignature is
+// set by the gateway, for the Actor to be trusted (see identity.Verifier)
+// ReceivedType and RawData keep the type and data the event arrived with,
+// as the EventBus upcasts them to the version handled
+type Envelope struct {
+	SpecVersion     string    `json:"specversion"`
+	ID              string    `json:"id"`
+	Source          string    `json:"source"`
+	Type            string    `json:"type"`
+	Time            time.Time `json:"time"`
+	Subject         string    `json:"subject,omitempty"`
+	DataContentType string    `json:"datacontenttype,omitempty"`
+	DataSchema      string    `json:"dataschema,omitempty"`
+	Actor           string    `json:"actor,omitempty"`
+	ActorSignature  string    `json:"actorsignature,omitempty"`
+	CorrelationID   string    `json:"correlationid,omitempty"`
+	Data            Params    `json:"data"`
+	ReceivedType    string    `json:"-"`
+	RawData         []byte    `json:"-"`
+}
+
+// Legacy tells whether the envelope comes from an event in the legacy
+// format, which only carries its type and data
+func (e Envelope) Legacy() bool {
+	return e.SpecVersion == ""
+}
+
+// AttributedEvent is an Event whose attributes travel apart from its data,
+// as in CloudEvents' binary content mode. Attributes are keyed by their
+// CloudEvents name (id, type, time...); an empty map means that the data
+// holds the whole event, either as a structured envelope or in the legacy format
+type AttributedEvent interface {
+	Event
+	Attributes() map[string]string
+}
+
+type envelopeKey struct{}
+
+// ContextWithEnvelope returns a copy of ctx carrying the passed envelope
+func ContextWithEnvelope(ctx context.Context, envelope Envelope) context.Context {
+	return context.WithValue(ctx, envelopeKey{}, envelope)
+}
+
+// EnvelopeFromContext returns the envelope of the event being handled,
+// CommandHandlers receive it through the context passed to Handle
+func EnvelopeFromContext(ctx context.Context) (Envelope, bool) {
+	envelope, ok := ctx.Value(envelopeKey{}).(Envelope)
+	return envelope, ok
+}
+
+// AggregateKey identifies the entity the passed event is about, for
+// ordering the events of the same entity: the envelope's subject, or else
+// the id in its data. It's empty when there's none, or the event is malformed
+func AggregateKey(event Event) string {
+	envelope, err := decodeEnvelope(event)
+	if err != nil {
+		return ""
+	}
+	if envelope.Subject != "" {
+		return envelope.Subject
+	}
+	id, _ := envelope.Data["id"].(string)
+	return id
+}
+
+// decodeEnvelope builds the envelope of the passed event, accepting the
+// binary and structured content modes, and the legacy format
+func decodeEnvelope(event Event) (Envelope, error) {
+	eventData := strings.ReplaceAll(string(event.Data()), string('\x00'), "")
+	if attributed, ok := event.(AttributedEvent); ok {
+		if attributes := attributed.Attributes(); len(attributes) > 0 {
+			return decodeBinary(attributes, []byte(eventData))
+		}
+	}
+	decodedEvent := make(map[string]interface{})
+	err := json.Unmarshal([]byte(eventData), &decodedEvent)
+	if err != nil {
+		return Envelope{}, fmt.Errorf("%w: %v", ErrUnmarshalingMessage, err)
+	}
+	if _, ok := decodedEvent["specversion"]; ok {
+		return decodeStructured([]byte(eventData))
+	}
+	return decodeLegacy(decodedEvent)
+}
+
+func decodeStructured(data []byte) (Envelope, error) {
+	var envelope Envelope
+	err := json.Unmarshal(data, &envelope)
+	if err != nil {
+		return Envelope{}, fmt.Errorf("%w: %v", ErrUnmarshalingMessage, err)
+	}
+	var raw struct {
+		Data json.RawMessage `json:"data"`
+	}
+	err = json.Unmarshal(data, &raw)
+	if err != nil {
+		return Envelope{}, fmt.Errorf("%w: %v", ErrUnmarshalingMessage, err)
+	}
+	envelope.ReceivedType, envelope.RawData = envelope.Type, raw.Data
+	return envelope, validateEnvelope(envelope)
+}
+
+func decodeBinary(attributes map[string]string, data []byte) (Envelope, error) {
+	envelope := Envelope{
+		SpecVersion:     attributes["specversion"],
+		ID:              attributes["id"],
+		Source:          attributes["source"],
+		Type:            attributes["type"],
+		Subject:         attributes["subject"],
+		DataContentType: attributes["datacontenttype"],
+		DataSchema:      attributes["dataschema"],
+		Actor:           attributes["actor"],
+		ActorSignature:  attributes["actorsignature"],
+		CorrelationID:   attributes["correlationid"],
+		ReceivedType:    attributes["type"],
+		RawData:         data,
+	}
+	if rawTime, ok := attributes["time"]; ok {
+		parsed, err := time.Parse(time.RFC3339Nano, rawTime)
+		if err != nil {
+			return Envelope{}, fmt.Errorf("%w: time: %v", ErrInvalidEnvelope, err)
+		}
+		envelope.Time = parsed
+	}
+	if err := validateEnvelope(envelope); err != nil {
+		return Envelope{}, err
+	}
+	if len(data) > 0 {
+		err := json.Unmarshal(data, &envelope.Data)
+		if err != nil {
+			return Envelope{}, fmt.Errorf("%w: %v", ErrUnmarshalingMessage, err)
+		}
+	}
+	return envelope, nil
+}
+
+func decodeLegacy(decodedEvent map[string]interface{}) (Envelope, error) {
+	nameResult, ok := decodedEvent[legacyNameKey]
+	if !ok {
+		return Envelope{}, ErrMissingNameParam
+	}
+	name, ok := nameResult.(string)
+	if !ok {
+		return Envelope{}, ErrWrongDataTypeName
+	}
+	delete(decodedEvent, legacyNameKey)
+	return Envelope{Type: name, Data: decodedEvent, ReceivedType: name}, nil
+}
+
+func validateEnvelope(envelope Envelope) error {
+	if envelope.SpecVersion != SpecVersion {
+		return fmt.Errorf(
+			"%w: unsupported specversion %q", ErrInvalidEnvelope, envelope.SpecVersion,
+		)
+	}
+	missing := []string{}
+	if envelope.ID == "" {
+		missing = append(missing, "id")
+	}
+	if envelope.Source == "" {
+		missing = append(missing, "source")
+	}
+	if envelope.Type == "" {
+		missing = append(missing, "type")
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf(
+			"%w: missing %s", ErrInvalidEnvelope, strings.Join(missing, ", "),
+		)
+	}
+	if !isJSON(envelope.DataContentType) {
+		return fmt.Errorf(
+			"%w: unsupported datacontenttype %q", ErrInvalidEnvelope, envelope.DataContentType,
+		)
+	}
+	return nil
+}
+
+// isJSON tells whether the content type passed is JSON, which is
+// assumed when it's empty
+func isJSON(contentType string) bool {
+	if contentType == "" {
+		return true
+	}
+	mediaType := strings.TrimSpace(strings.Split(contentType, ";")[0])
+	return mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")
+}
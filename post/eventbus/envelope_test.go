@@ -0,0 +1,172 @@
+package eventbus
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestEnvelope(t *testing.T) {
+	eventName := "heroes"
+
+	t.Run("Structured content mode", func(t *testing.T) {
+		t.Parallel()
+		bus := NewEventBus()
+		handler := &mockCapturingCommandHandler{}
+		bus.Register(eventName, handler)
+		event := testRawEvent(`{
+			"specversion": "1.0",
+			"id": "some-id",
+			"source": "/gateway",
+			"type": "heroes",
+			"time": "2021-09-01T10:00:00Z",
+			"subject": "some-post",
+			"datacontenttype": "application/json",
+			"dataschema": "/schemas/heroes/v1",
+			"actor": "bowie",
+			"actorsignature": "some-signature",
+			"correlationid": "some-correlation",
+			"data": {"title": "just for one day"}
+		}`)
+		err := bus.Resolve(context.Background(), event)
+		require.NoError(t, err)
+		require.True(t, handler.found, "envelope should be passed through the context")
+		require.Equal(t, "some-id", handler.envelope.ID)
+		require.Equal(t, "/gateway", handler.envelope.Source)
+		require.Equal(t, eventName, handler.envelope.Type)
+		require.Equal(t, "some-post", handler.envelope.Subject)
+		require.Equal(t, "/schemas/heroes/v1", handler.envelope.DataSchema)
+		require.Equal(t, "bowie", handler.envelope.Actor)
+		require.Equal(t, "some-signature", handler.envelope.ActorSignature)
+		require.Equal(t, "some-correlation", handler.envelope.CorrelationID)
+		require.True(t, handler.envelope.Time.Equal(time.Date(2021, 9, 1, 10, 0, 0, 0, time.UTC)))
+		require.False(t, handler.envelope.Legacy())
+		require.Equal(t, Params{"title": "just for one day"}, handler.params)
+	})
+
+	t.Run("Binary content mode", func(t *testing.T) {
+		t.Parallel()
+		bus := NewEventBus()
+		handler := &mockCapturingCommandHandler{}
+		bus.Register(eventName, handler)
+		event := testAttributedEvent{
+			attributes: map[string]string{
+				"specversion":    "1.0",
+				"id":             "some-id",
+				"source":         "/gateway",
+				"type":           eventName,
+				"time":           "2021-09-01T10:00:00.5Z",
+				"actor":          "bowie",
+				"actorsignature": "some-signature",
+				"correlationid":  "some-correlation",
+			},
+			data: `{"title": "just for one day"}`,
+		}
+		err := bus.Resolve(context.Background(), event)
+		require.NoError(t, err)
+		require.True(t, handler.found, "envelope should be passed through the context")
+		require.Equal(t, "some-id", handler.envelope.ID)
+		require.Equal(t, "some-correlation", handler.envelope.CorrelationID)
+		require.Equal(t, "some-signature", handler.envelope.ActorSignature)
+		require.Equal(t, 500*time.Millisecond, time.Duration(handler.envelope.Time.Nanosecond()))
+		require.Equal(t, Params{"title": "just for one day"}, handler.params)
+	})
+
+	t.Run("Legacy format", func(t *testing.T) {
+		t.Parallel()
+		bus := NewEventBus()
+		handler := &mockCapturingCommandHandler{}
+		bus.Register(eventName, handler)
+		err := bus.Resolve(context.Background(), &testEvent{name: eventName})
+		require.NoError(t, err)
+		require.True(t, handler.found, "envelope should be passed through the context")
+		require.True(t, handler.envelope.Legacy())
+		require.Equal(t, eventName, handler.envelope.Type)
+		require.Equal(t, Params{"data": "some-data"}, handler.params)
+	})
+
+	t.Run("Invalid envelopes", func(t *testing.T) {
+		t.Parallel()
+		bus := NewEventBus()
+		bus.Register(eventName, &mockCommandHandler{})
+		events := map[string]Event{
+			"Missing id": testRawEvent(
+				`{"specversion": "1.0", "source": "/gateway", "type": "heroes", "data": {}}`,
+			),
+			"Unsupported specversion": testRawEvent(
+				`{"specversion": "0.3", "id": "1", "source": "/gateway", "type": "heroes"}`,
+			),
+			"Unsupported datacontenttype": testRawEvent(
+				`{"specversion": "1.0", "id": "1", "source": "/gateway", "type": "heroes",
+				  "datacontenttype": "text/plain"}`,
+			),
+			"Wrong time in binary mode": testAttributedEvent{
+				attributes: map[string]string{
+					"specversion": "1.0",
+					"id":          "1",
+					"source":      "/gateway",
+					"type":        eventName,
+					"time":        "yesterday",
+				},
+				data: `{}`,
+			},
+		}
+		for name, event := range events {
+			err := bus.Resolve(context.Background(), event)
+			require.True(t, errors.Is(err, ErrInvalidEnvelope), "%s: got %v", name, err)
+		}
+	})
+
+	t.Run("Non-object data", func(t *testing.T) {
+		t.Parallel()
+		bus := NewEventBus()
+		bus.Register(eventName, &mockCommandHandler{})
+		event := testRawEvent(
+			`{"specversion": "1.0", "id": "1", "source": "/gateway", "type": "heroes", "data": "a"}`,
+		)
+		err := bus.Resolve(context.Background(), event)
+		require.True(t, errors.Is(err, ErrUnmarshalingMessage), "got %v", err)
+	})
+}
+
+func TestAggregateKey(t *testing.T) {
+	t.Parallel()
+	testCases := []struct {
+		name     string
+		event    Event
+		expected string
+	}{
+		{
+			"Subject",
+			testAttributedEvent{
+				attributes: map[string]string{
+					"specversion": "1.0",
+					"id":          "1",
+					"source":      "/gateway",
+					"type":        "posts.v1.update",
+					"subject":     "post-1",
+				},
+				data: `{"id": "post-2"}`,
+			},
+			"post-1",
+		},
+		{
+			"Data's id",
+			testRawEvent(`{"specversion": "1.0", "id": "1", "source": "/gateway",
+			  "type": "posts.v1.update", "data": {"id": "post-2"}}`),
+			"post-2",
+		},
+		{"Legacy", testRawEvent(`{"event_name": "posts.v1.patch", "id": "post-3"}`), "post-3"},
+		{"Without id", testRawEvent(`{"event_name": "posts.v1.create"}`), ""},
+		{"Malformed", testRawEvent(`{`), ""},
+	}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			require.Equal(t, tc.expected, AggregateKey(tc.event))
+		})
+	}
+}
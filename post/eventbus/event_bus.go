@@ -2,10 +2,8 @@ package eventbus
 
 import (
 	"context"
-	"encoding/json"
 	"errors"
 	"fmt"
-	"strings"
 )
 
 var (
@@ -15,7 +13,8 @@ var (
 	ErrCommandHandler = errors.New("command handler error")
 	// ErrUnmarshalingMessage is self-described
 	ErrUnmarshalingMessage = errors.New("unmarshaling message error")
-	// ErrMissingNameParam returned when the key "name" is missing from an Event
+	// ErrMissingNameParam returned when the key "event_name" is missing from
+	// an Event in the legacy format
 	ErrMissingNameParam = errors.New("missing `name` param from message")
 	// ErrWrongDataTypeName is self-described
 	ErrWrongDataTypeName = errors.New("wrong data type for param `name`")
@@ -35,44 +34,95 @@ type CommandHandler interface {
 }
 
 // EventBus has a registry of Events against CommandHandlers
+// Versioned events, such as "posts.v1.create", can be upcast to the
+// versions handled, see RegisterUpcaster
 type EventBus struct {
-	handlers map[string]CommandHandler
+	handlers    map[string]CommandHandler
+	schemas     map[string]Schema
+	upcasters   map[string]Upcaster
+	versions    *versionRegistry
+	middlewares []Middleware
 }
 
 // NewEventBus creates an EventHandler
-func NewEventBus() *EventBus {
-	return &EventBus{handlers: make(map[string]CommandHandler)}
+// middlewares passed to the bus will be applied to every handler
+// registered, before per-event middlewares
+func NewEventBus(middlewares ...Middleware) *EventBus {
+	return &EventBus{
+		handlers:    make(map[string]CommandHandler),
+		schemas:     make(map[string]Schema),
+		upcasters:   make(map[string]Upcaster),
+		versions:    newVersionRegistry(),
+		middlewares: middlewares,
+	}
 }
 
 // Resolve passes an event and executes its corresponding CommandHandler
+// The event's Envelope is passed to the handler through the context; it's
+// the one upcast, when the event's version isn't handled
 func (e EventBus) Resolve(ctx context.Context, event Event) error {
-	decodedEvent := make(map[string]interface{})
-	eventData := strings.ReplaceAll(string(event.Data()), string('\x00'), "")
-	err := json.Unmarshal([]byte(eventData), &decodedEvent)
+	envelope, err := decodeEnvelope(event)
 	if err != nil {
-		return fmt.Errorf("%w: %v", ErrUnmarshalingMessage, err)
-	}
-	nameResult, ok := decodedEvent["event_name"]
-	if !ok {
-		return ErrMissingNameParam
+		return err
 	}
-	name, ok := nameResult.(string)
-	if !ok {
-		return ErrWrongDataTypeName
-	}
-	handler, ok := e.handlers[name]
-	if !ok {
-		return ErrEventNotRegistered
+	e.versions.arrived(envelope.Type)
+	envelope, handler, err := e.upcast(envelope)
+	if err != nil {
+		return err
 	}
-	delete(decodedEvent, "event_name")
-	err = handler.Handle(ctx, decodedEvent)
+	err = handler.Handle(ContextWithEnvelope(ctx, envelope), envelope.Data)
 	if err != nil {
-		return fmt.Errorf("%w: %v", ErrCommandHandler, err)
+		return commandHandlerError{err}
 	}
 	return nil
 }
 
+// commandHandlerError is both an ErrCommandHandler and the error
+// returned by the CommandHandler, for callers to be able to inspect it
+type commandHandlerError struct {
+	err error
+}
+
+// Error implements the error interface
+func (c commandHandlerError) Error() string {
+	return fmt.Sprintf("%v: %v", ErrCommandHandler, c.err)
+}
+
+// Is makes errors.Is(err, ErrCommandHandler) hold
+func (c commandHandlerError) Is(target error) bool {
+	return target == ErrCommandHandler
+}
+
+// Unwrap returns the error returned by the CommandHandler
+func (c commandHandlerError) Unwrap() error {
+	return c.err
+}
+
 // Register associates an Event with a given CommandHandler
-func (e *EventBus) Register(eventName string, cmdHandler CommandHandler) {
-	e.handlers[eventName] = cmdHandler
+// middlewares' order matters: they'll be applied in insertion order, so the
+// last one passed is the first one called
+// The JSON schema of the handler's params is kept when the handler, or
+// the one it decorates, is a SchemaProvider or a TypedCommandHandler
+func (e *EventBus) Register(eventName string, cmdHandler CommandHandler,
+	mws ...Middleware) {
+	e.handlers[eventName] = chain(chain(cmdHandler, e.middlewares), mws)
+	if family, version, ok := ParseVersion(eventName); ok {
+		e.versions.seen(family, version)
+	}
+	schema, ok := schemaOf(cmdHandler)
+	if !ok {
+		delete(e.schemas, eventName)
+		return
+	}
+	schema["$id"] = eventName
+	e.schemas[eventName] = schema
+}
+
+// Schemas returns the JSON schemas of the registered events' data, by name
+func (e *EventBus) Schemas() map[string]Schema {
+	schemas := make(map[string]Schema, len(e.schemas))
+	for name, schema := range e.schemas {
+		schemas[name] = schema
+	}
+	return schemas
 }
@@ -26,6 +26,7 @@ func TestEventHandler(t *testing.T) {
 		ctx := context.Background()
 		err := bus.Resolve(ctx, event)
 		require.True(t, errors.Is(err, ErrCommandHandler))
+		require.True(t, errors.Is(err, errCommandHandlerMock))
 		cmdHandler = &mockCommandHandler{}
 		bus.Register(eventName, cmdHandler)
 		err = bus.Resolve(ctx, event)
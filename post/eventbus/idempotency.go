@@ -0,0 +1,183 @@
+package eventbus
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var (
+	// ErrEventInProgress returned when an event is received while
+	// a previous delivery of it is still being handled
+	ErrEventInProgress = errors.New("event is already being processed")
+	// ErrIdempotencyStore returned when the ProcessedEventStore fails
+	ErrIdempotencyStore = errors.New("idempotency store error")
+)
+
+// Statuses of a ProcessedEvent
+const (
+	StatusPending   = "pending"
+	StatusSucceeded = "succeeded"
+	StatusFailed    = "failed"
+)
+
+// DefaultIdempotencyTTL is the time a processed event's key is kept by default
+const DefaultIdempotencyTTL = 24 * time.Hour
+
+// DefaultIdempotencyLease is the time an event's key is claimed while it's
+// handled, when the event's context has no deadline
+const DefaultIdempotencyLease = time.Minute
+
+// leaseMargin is added to the time left until an event's deadline,
+// for the lease of its key not to end while the handler winds up
+const leaseMargin = 5 * time.Second
+
+// ProcessedEvent is the record of an event's key, along with the
+// outcome of its handling
+// Result holds the values recorded by the handlers, see RecordResult
+type ProcessedEvent struct {
+	Key       string
+	Status    string
+	Error     string
+	Result    map[string]interface{}
+	ExpiresAt time.Time
+}
+
+// ProcessedEventStore keeps the keys of the events handled
+// Implementations must make Claim atomic: a key can only be claimed once
+// while pending or succeeded, unless its record expired
+type ProcessedEventStore interface {
+	// Claim records key as pending, until lease passes. If the key couldn't be
+	// claimed, the existing record is returned, along with false
+	// Records of failed events can be claimed again
+	Claim(ctx context.Context, key string, lease time.Duration) (*ProcessedEvent, bool, error)
+	// Complete records the outcome (status, error and result) of a claimed
+	// key, kept until ttl passes
+	Complete(ctx context.Context, key, status, errMsg string,
+		result map[string]interface{}, ttl time.Duration) error
+	// PurgeExpired removes the records expired by now,
+	// returning how many of them were removed
+	PurgeExpired(ctx context.Context, now time.Time) (int64, error)
+}
+
+// idempotentHandler decorates a CommandHandler, skipping
+// the events already handled successfully
+type idempotentHandler struct {
+	handler CommandHandler
+	store   ProcessedEventStore
+	ttl     time.Duration
+}
+
+var _ CommandHandler = idempotentHandler{}
+
+// Idempotent decorates handler so that an event is handled successfully at most
+// once. The event's id (along with its source) is used as the idempotency key;
+// events in the legacy format have no id, and are always handled
+// Repeats of succeeded events are skipped, recording the result of the first
+// delivery again, repeats of pending ones return ErrEventInProgress, and
+// repeats of failed ones are handled again
+// The keys are kept for ttl, DefaultIdempotencyTTL being used if it's zero
+// While an event is handled, its key is only claimed until the event's
+// deadline, so a key left pending by a crash can be claimed again soon
+func Idempotent(handler CommandHandler, store ProcessedEventStore,
+	ttl time.Duration) CommandHandler {
+	if ttl <= 0 {
+		ttl = DefaultIdempotencyTTL
+	}
+	return idempotentHandler{handler: handler, store: store, ttl: ttl}
+}
+
+// Handle implements CommandHandler
+func (i idempotentHandler) Handle(ctx context.Context, params Params) error {
+	envelope, ok := EnvelopeFromContext(ctx)
+	if !ok || envelope.ID == "" {
+		return i.handler.Handle(ctx, params)
+	}
+	key := IdempotencyKey(envelope)
+	previous, claimed, err := i.store.Claim(ctx, key, i.lease(ctx))
+	if err != nil {
+		return fmt.Errorf("%w: claim %s: %v", ErrIdempotencyStore, key, err)
+	}
+	if !claimed {
+		if previous != nil && previous.Status == StatusSucceeded {
+			for resultKey, value := range previous.Result {
+				RecordResult(ctx, resultKey, value)
+			}
+			return nil
+		}
+		return fmt.Errorf("%w: %s", ErrEventInProgress, key)
+	}
+	defer func() {
+		// the key is released when the handler panics, for the event to be
+		// handled again without waiting for the lease to end
+		if p := recover(); p != nil {
+			_ = i.store.Complete(context.Background(), key, StatusFailed,
+				fmt.Sprintf("panic: %v", p), nil, i.ttl)
+			panic(p)
+		}
+	}()
+	// the result is recorded by the handler in a Result of its own,
+	// for it to be persisted even if nobody waits for it
+	handlerCtx, result := ContextWithResult(ctx)
+	handlerErr := i.handler.Handle(handlerCtx, params)
+	status, errMsg, values := StatusSucceeded, "", result.Values()
+	if handlerErr != nil {
+		status, errMsg, values = StatusFailed, handlerErr.Error(), nil
+	}
+	for resultKey, value := range values {
+		RecordResult(ctx, resultKey, value)
+	}
+	// the outcome is recorded even if the event's ctx is done
+	err = i.store.Complete(context.Background(), key, status, errMsg, values, i.ttl)
+	if handlerErr != nil {
+		return handlerErr
+	}
+	if err != nil {
+		return fmt.Errorf("%w: complete %s: %v", ErrIdempotencyStore, key, err)
+	}
+	return nil
+}
+
+// lease returns how long the key of the event handled with ctx is claimed:
+// the time left until its deadline, if any, never longer than the ttl
+func (i idempotentHandler) lease(ctx context.Context) time.Duration {
+	lease := DefaultIdempotencyLease
+	if deadline, ok := ctx.Deadline(); ok {
+		lease = time.Until(deadline) + leaseMargin
+	}
+	if lease > i.ttl {
+		lease = i.ttl
+	}
+	return lease
+}
+
+// Unwrap returns the decorated CommandHandler
+func (i idempotentHandler) Unwrap() CommandHandler {
+	return i.handler
+}
+
+// IdempotencyKey returns the key identifying the passed envelope's event
+// CloudEvents' ids are only unique within their source
+func IdempotencyKey(envelope Envelope) string {
+	return envelope.Source + " " + envelope.ID
+}
+
+// PurgeProcessedEvents removes the expired records of store every interval,
+// until ctx is done. The errors found are passed to onError, if not nil
+func PurgeProcessedEvents(ctx context.Context, store ProcessedEventStore,
+	interval time.Duration, onError func(error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			_, err := store.PurgeExpired(ctx, now)
+			if err != nil && onError != nil {
+				onError(fmt.Errorf("%w: purge: %v", ErrIdempotencyStore, err))
+			}
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package eventbus
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestIdempotent(t *testing.T) {
+	envelope := Envelope{
+		SpecVersion: SpecVersion,
+		ID:          "some-id",
+		Source:      "/gateway",
+		Type:        "posts.v1.create",
+	}
+	ctx := ContextWithEnvelope(context.Background(), envelope)
+	key := IdempotencyKey(envelope)
+
+	t.Run("Repeated succeeded event", func(t *testing.T) {
+		t.Parallel()
+		handler := &mockCountingCommandHandler{}
+		store := newMockProcessedEventStore()
+		idempotent := Idempotent(handler, store, 0)
+		require.NoError(t, idempotent.Handle(ctx, Params{}))
+		require.NoError(t, idempotent.Handle(ctx, Params{}))
+		require.Equal(t, 1, handler.calls)
+		require.Equal(t, StatusSucceeded, store.events[key].Status)
+	})
+
+	t.Run("Repeated failed event", func(t *testing.T) {
+		t.Parallel()
+		handler := &mockCountingCommandHandler{err: errCommandHandlerMock}
+		store := newMockProcessedEventStore()
+		idempotent := Idempotent(handler, store, 0)
+		err := idempotent.Handle(ctx, Params{})
+		require.True(t, errors.Is(err, errCommandHandlerMock))
+		require.Equal(t, StatusFailed, store.events[key].Status)
+		require.Equal(t, errCommandHandlerMock.Error(), store.events[key].Error)
+
+		handler.err = nil
+		require.NoError(t, idempotent.Handle(ctx, Params{}))
+		require.Equal(t, 2, handler.calls)
+		require.Equal(t, StatusSucceeded, store.events[key].Status)
+	})
+
+	t.Run("Pending event", func(t *testing.T) {
+		t.Parallel()
+		handler := &mockCountingCommandHandler{}
+		store := newMockProcessedEventStore()
+		store.events[key] = ProcessedEvent{Key: key, Status: StatusPending}
+		err := Idempotent(handler, store, 0).Handle(ctx, Params{})
+		require.True(t, errors.Is(err, ErrEventInProgress))
+		require.Zero(t, handler.calls)
+	})
+
+	t.Run("Repeated event's result", func(t *testing.T) {
+		t.Parallel()
+		handler := HandlerFunc(func(ctx context.Context, _ Params) error {
+			RecordResult(ctx, "id", "created-id")
+			return nil
+		})
+		idempotent := Idempotent(handler, newMockProcessedEventStore(), 0)
+		for i := 0; i < 2; i++ {
+			replyCtx, result := ContextWithResult(ctx)
+			require.NoError(t, idempotent.Handle(replyCtx, Params{}))
+			require.Equal(t, map[string]interface{}{"id": "created-id"}, result.Values(),
+				"the result should be the same on every delivery")
+		}
+	})
+
+	t.Run("Lease", func(t *testing.T) {
+		t.Parallel()
+		store := newMockProcessedEventStore()
+		idempotent := Idempotent(&mockCountingCommandHandler{}, store, 0)
+		require.NoError(t, idempotent.Handle(ctx, Params{}))
+		require.Equal(t, DefaultIdempotencyLease, store.lease)
+
+		timeoutCtx, cancel := context.WithTimeout(
+			ContextWithEnvelope(context.Background(), Envelope{ID: "other-id"}), time.Second)
+		defer cancel()
+		require.NoError(t, idempotent.Handle(timeoutCtx, Params{}))
+		require.True(t, store.lease <= time.Second+leaseMargin,
+			"the key should only be claimed until the event's deadline, got %v", store.lease)
+	})
+
+	t.Run("Panicking handler", func(t *testing.T) {
+		t.Parallel()
+		store := newMockProcessedEventStore()
+		handler := HandlerFunc(func(context.Context, Params) error {
+			panic("boom")
+		})
+		require.Panics(t, func() {
+			_ = Idempotent(handler, store, 0).Handle(ctx, Params{})
+		})
+		require.Equal(t, StatusFailed, store.events[key].Status,
+			"the key should be released for the event to be handled again")
+	})
+
+	t.Run("Event without id", func(t *testing.T) {
+		t.Parallel()
+		handler := &mockCountingCommandHandler{}
+		store := newMockProcessedEventStore()
+		idempotent := Idempotent(handler, store, 0)
+		legacyCtx := ContextWithEnvelope(
+			context.Background(), Envelope{Type: "posts.v1.create"},
+		)
+		require.NoError(t, idempotent.Handle(legacyCtx, Params{}))
+		require.NoError(t, idempotent.Handle(legacyCtx, Params{}))
+		require.Equal(t, 2, handler.calls)
+		require.Empty(t, store.events)
+	})
+
+	t.Run("Store error", func(t *testing.T) {
+		t.Parallel()
+		handler := &mockCountingCommandHandler{}
+		store := newMockProcessedEventStore()
+		store.claimErr = errors.New("store down")
+		err := Idempotent(handler, store, 0).Handle(ctx, Params{})
+		require.True(t, errors.Is(err, ErrIdempotencyStore))
+		require.Zero(t, handler.calls)
+	})
+
+	t.Run("Through the EventBus", func(t *testing.T) {
+		t.Parallel()
+		handler := &mockCountingCommandHandler{}
+		bus := NewEventBus()
+		bus.Register(envelope.Type, Idempotent(handler, newMockProcessedEventStore(), 0))
+		event := testRawEvent(
+			`{"specversion":"1.0","id":"some-id","source":"/gateway",` +
+				`"type":"posts.v1.create","data":{}}`,
+		)
+		require.NoError(t, bus.Resolve(context.Background(), event))
+		require.NoError(t, bus.Resolve(context.Background(), event))
+		require.Equal(t, 1, handler.calls)
+	})
+}
@@ -0,0 +1,205 @@
+package eventbus
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"fmt"
+	"log"
+	"runtime/debug"
+	"time"
+)
+
+var (
+	// ErrHandlerPanic returned when a CommandHandler panics
+	ErrHandlerPanic = errors.New("command handler panicked")
+	// ErrHandlerTimeout returned when a CommandHandler doesn't finish in time
+	ErrHandlerTimeout = errors.New("command handler timed out")
+)
+
+// Middleware decorates a CommandHandler
+type Middleware func(handler CommandHandler) CommandHandler
+
+// HandlerFunc adapts a function to a CommandHandler
+type HandlerFunc func(context.Context, Params) error
+
+// Handle implements CommandHandler
+func (f HandlerFunc) Handle(ctx context.Context, params Params) error {
+	return f(ctx, params)
+}
+
+// chain applies the middlewares to handler in insertion order:
+// the first one wraps the handler, and the last one is called first
+func chain(handler CommandHandler, middlewares []Middleware) CommandHandler {
+	for _, mw := range middlewares {
+		handler = mw(handler)
+	}
+	return handler
+}
+
+// eventType returns the type of the event being handled, if known
+func eventType(ctx context.Context) string {
+	envelope, ok := EnvelopeFromContext(ctx)
+	if !ok || envelope.Type == "" {
+		return "unknown"
+	}
+	return envelope.Type
+}
+
+// Recover turns the panics of the handler into errors wrapping ErrHandlerPanic
+func Recover() Middleware {
+	return func(handler CommandHandler) CommandHandler {
+		return HandlerFunc(func(ctx context.Context, params Params) (err error) {
+			defer func() {
+				if r := recover(); r != nil {
+					err = fmt.Errorf("%w: %v\n%s", ErrHandlerPanic, r, debug.Stack())
+				}
+			}()
+			return handler.Handle(ctx, params)
+		})
+	}
+}
+
+// Timeout cancels the handler's context after timeout
+// The error returned wraps ErrHandlerTimeout when the deadline was exceeded
+func Timeout(timeout time.Duration) Middleware {
+	return func(handler CommandHandler) CommandHandler {
+		return HandlerFunc(func(ctx context.Context, params Params) error {
+			timeoutCtx, cancel := context.WithTimeout(ctx, timeout)
+			defer cancel()
+			err := handler.Handle(timeoutCtx, params)
+			if err != nil && ctx.Err() == nil &&
+				errors.Is(timeoutCtx.Err(), context.DeadlineExceeded) {
+				return fmt.Errorf("%w after %s: %v", ErrHandlerTimeout, timeout, err)
+			}
+			return err
+		})
+	}
+}
+
+// RetryPolicy configures the Retry middleware
+type RetryPolicy struct {
+	// Attempts is the maximum number of calls to the handler
+	Attempts int
+	// InitialBackoff is the wait before the first retry, it doubles
+	// on each of the following ones, up to MaxBackoff
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	// Retryable tells whether an error is transient, IsTransient if nil
+	Retryable func(error) bool
+}
+
+// DefaultRetryPolicy is a sensible RetryPolicy for handlers relying on a DB
+var DefaultRetryPolicy = RetryPolicy{
+	Attempts:       3,
+	InitialBackoff: 100 * time.Millisecond,
+	MaxBackoff:     2 * time.Second,
+}
+
+// IsTransient tells whether a handler's error may not happen again if retried
+// Errors related to the event's data, panics, and the ones
+// from a canceled context aren't transient
+func IsTransient(err error) bool {
+	switch {
+	case err == nil,
+		errors.Is(err, ErrInvalidPayload),
+		errors.Is(err, ErrMissingField),
+		errors.Is(err, ErrWrongFieldType),
+		errors.Is(err, ErrHandlerPanic),
+		errors.Is(err, context.Canceled):
+		return false
+	default:
+		return true
+	}
+}
+
+// Retry calls the handler again, backing off, while its errors are transient
+// The last error is returned once the attempts are exhausted
+func Retry(policy RetryPolicy) Middleware {
+	retryable := policy.Retryable
+	if retryable == nil {
+		retryable = IsTransient
+	}
+	return func(handler CommandHandler) CommandHandler {
+		return HandlerFunc(func(ctx context.Context, params Params) error {
+			backoff := policy.InitialBackoff
+			var err error
+			for attempt := 1; ; attempt++ {
+				err = handler.Handle(ctx, params)
+				if err == nil || attempt >= policy.Attempts || !retryable(err) {
+					return err
+				}
+				timer := time.NewTimer(backoff)
+				select {
+				case <-ctx.Done():
+					timer.Stop()
+					return err
+				case <-timer.C:
+				}
+				backoff *= 2
+				if policy.MaxBackoff > 0 && backoff > policy.MaxBackoff {
+					backoff = policy.MaxBackoff
+				}
+			}
+		})
+	}
+}
+
+// Logging logs the outcome and duration of each event handled
+func Logging(logger *log.Logger) Middleware {
+	return func(handler CommandHandler) CommandHandler {
+		return HandlerFunc(func(ctx context.Context, params Params) error {
+			start := time.Now()
+			err := handler.Handle(ctx, params)
+			envelope, _ := EnvelopeFromContext(ctx)
+			if err != nil {
+				logger.Printf("event %s (id %q) failed after %s: %v",
+					eventType(ctx), envelope.ID, time.Since(start), err)
+				return err
+			}
+			logger.Printf("event %s (id %q) handled in %s",
+				eventType(ctx), envelope.ID, time.Since(start))
+			return nil
+		})
+	}
+}
+
+// Metrics keeps counters of the events handled, by event type,
+// published through expvar
+type Metrics struct {
+	counters *expvar.Map
+}
+
+// NewMetrics publishes the metrics under name, it panics if the
+// name is already in use, as expvar.Publish does
+func NewMetrics(name string) *Metrics {
+	return &Metrics{counters: expvar.NewMap(name)}
+}
+
+// Middleware counts the events handled, the failed ones, and
+// the total time spent handling them, in microseconds
+func (m *Metrics) Middleware() Middleware {
+	return func(handler CommandHandler) CommandHandler {
+		return HandlerFunc(func(ctx context.Context, params Params) error {
+			start := time.Now()
+			err := handler.Handle(ctx, params)
+			name := eventType(ctx)
+			m.counters.Add(name+".handled", 1)
+			m.counters.Add(name+".duration_us", time.Since(start).Microseconds())
+			if err != nil {
+				m.counters.Add(name+".failed", 1)
+			}
+			return err
+		})
+	}
+}
+
+// Get returns the value of the passed counter, for example
+// "posts.v1.create.failed"; zero if it doesn't exist
+func (m *Metrics) Get(counter string) int64 {
+	value, ok := m.counters.Get(counter).(*expvar.Int)
+	if !ok {
+		return 0
+	}
+	return value.Value()
+}
@@ -0,0 +1,132 @@
+package eventbus
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMiddleware(t *testing.T) {
+	ctx := ContextWithEnvelope(context.Background(), Envelope{
+		ID:   "some-id",
+		Type: "posts.v1.create",
+	})
+
+	t.Run("Order", func(t *testing.T) {
+		t.Parallel()
+		calls := []string{}
+		tracing := func(name string) Middleware {
+			return func(handler CommandHandler) CommandHandler {
+				return HandlerFunc(func(ctx context.Context, params Params) error {
+					calls = append(calls, name)
+					return handler.Handle(ctx, params)
+				})
+			}
+		}
+		bus := NewEventBus(tracing("global1"), tracing("global2"))
+		bus.Register("life on mars", &mockCommandHandler{}, tracing("event"))
+		err := bus.Resolve(context.Background(), &testEvent{name: "life on mars"})
+		require.NoError(t, err)
+		require.Equal(t, []string{"event", "global2", "global1"}, calls)
+	})
+
+	t.Run("Recover", func(t *testing.T) {
+		t.Parallel()
+		panicking := HandlerFunc(func(context.Context, Params) error {
+			panic("boom")
+		})
+		err := Recover()(panicking).Handle(ctx, Params{})
+		require.True(t, errors.Is(err, ErrHandlerPanic))
+		require.Contains(t, err.Error(), "boom")
+		require.False(t, IsTransient(err))
+	})
+
+	t.Run("Timeout", func(t *testing.T) {
+		t.Parallel()
+		blocking := HandlerFunc(func(ctx context.Context, _ Params) error {
+			<-ctx.Done()
+			return ctx.Err()
+		})
+		err := Timeout(10*time.Millisecond)(blocking).Handle(ctx, Params{})
+		require.True(t, errors.Is(err, ErrHandlerTimeout))
+		require.True(t, IsTransient(err))
+
+		canceledCtx, cancel := context.WithCancel(ctx)
+		cancel()
+		err = Timeout(time.Second)(blocking).Handle(canceledCtx, Params{})
+		require.False(t, errors.Is(err, ErrHandlerTimeout))
+		require.True(t, errors.Is(err, context.Canceled))
+	})
+
+	t.Run("Retry", func(t *testing.T) {
+		t.Parallel()
+		policy := RetryPolicy{Attempts: 3, InitialBackoff: time.Millisecond}
+		transient := errors.New("connection reset")
+
+		t.Run("Transient error", func(t *testing.T) {
+			handler := &mockCountingCommandHandler{err: transient}
+			err := Retry(policy)(handler).Handle(ctx, Params{})
+			require.True(t, errors.Is(err, transient))
+			require.Equal(t, 3, handler.calls)
+		})
+
+		t.Run("Eventual success", func(t *testing.T) {
+			handler := &mockCountingCommandHandler{err: transient}
+			flaky := HandlerFunc(func(ctx context.Context, params Params) error {
+				err := handler.Handle(ctx, params)
+				if handler.calls == 2 {
+					return nil
+				}
+				return err
+			})
+			require.NoError(t, Retry(policy)(flaky).Handle(ctx, Params{}))
+			require.Equal(t, 2, handler.calls)
+		})
+
+		t.Run("Validation error", func(t *testing.T) {
+			handler := &mockCountingCommandHandler{
+				err: FieldErrors{NewMissingFieldError("title")},
+			}
+			err := Retry(policy)(handler).Handle(ctx, Params{})
+			require.True(t, errors.Is(err, ErrMissingField))
+			require.Equal(t, 1, handler.calls)
+		})
+
+		t.Run("Custom Retryable", func(t *testing.T) {
+			handler := &mockCountingCommandHandler{err: transient}
+			custom := policy
+			custom.Retryable = func(err error) bool { return !errors.Is(err, transient) }
+			_ = Retry(custom)(handler).Handle(ctx, Params{})
+			require.Equal(t, 1, handler.calls)
+		})
+	})
+
+	t.Run("Logging", func(t *testing.T) {
+		t.Parallel()
+		var buf bytes.Buffer
+		logger := log.New(&buf, "", 0)
+		require.NoError(t, Logging(logger)(&mockCommandHandler{}).Handle(ctx, Params{}))
+		err := Logging(logger)(&mockErroredCommandHandler{}).Handle(ctx, Params{})
+		require.True(t, errors.Is(err, errCommandHandlerMock))
+		lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+		require.Len(t, lines, 2)
+		require.Contains(t, lines[0], `event posts.v1.create (id "some-id") handled`)
+		require.Contains(t, lines[1], `event posts.v1.create (id "some-id") failed`)
+	})
+
+	t.Run("Metrics", func(t *testing.T) {
+		t.Parallel()
+		metrics := NewMetrics("eventbus_test_metrics")
+		_ = metrics.Middleware()(&mockCommandHandler{}).Handle(ctx, Params{})
+		_ = metrics.Middleware()(&mockErroredCommandHandler{}).Handle(ctx, Params{})
+		require.Equal(t, int64(2), metrics.Get("posts.v1.create.handled"))
+		require.Equal(t, int64(1), metrics.Get("posts.v1.create.failed"))
+		require.Zero(t, metrics.Get("posts.v1.update.handled"))
+	})
+}
@@ -2,7 +2,9 @@ package eventbus
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"time"
 )
 
 var _ CommandHandler = &mockCommandHandler{}
@@ -15,10 +17,12 @@ func (*mockCommandHandler) Handle(_ context.Context, p Params) error {
 
 var _ CommandHandler = &mockErroredCommandHandler{}
 
+var errCommandHandlerMock = errors.New("an error occurred in CommandHandler")
+
 type mockErroredCommandHandler struct{}
 
 func (*mockErroredCommandHandler) Handle(_ context.Context, p Params) error {
-	return fmt.Errorf("an error occurred in CommandHandler")
+	return errCommandHandlerMock
 }
 
 var _ Event = &testEvent{}
@@ -32,3 +36,90 @@ func (e testEvent) Data() []byte {
 		fmt.Sprintf(`{"event_name": "%s", "data": "some-data"}`, e.name),
 	)
 }
+
+var _ CommandHandler = &mockCapturingCommandHandler{}
+
+// mockCapturingCommandHandler keeps the envelope and params it's called with
+type mockCapturingCommandHandler struct {
+	envelope Envelope
+	found    bool
+	params   Params
+}
+
+func (m *mockCapturingCommandHandler) Handle(ctx context.Context, p Params) error {
+	m.envelope, m.found = EnvelopeFromContext(ctx)
+	m.params = p
+	return nil
+}
+
+var _ AttributedEvent = &testAttributedEvent{}
+
+type testAttributedEvent struct {
+	attributes map[string]string
+	data       string
+}
+
+func (e testAttributedEvent) Data() []byte {
+	return []byte(e.data)
+}
+
+func (e testAttributedEvent) Attributes() map[string]string {
+	return e.attributes
+}
+
+type testRawEvent string
+
+func (e testRawEvent) Data() []byte {
+	return []byte(e)
+}
+
+var _ CommandHandler = &mockCountingCommandHandler{}
+
+// mockCountingCommandHandler counts its calls, returning err
+type mockCountingCommandHandler struct {
+	calls int
+	err   error
+}
+
+func (m *mockCountingCommandHandler) Handle(context.Context, Params) error {
+	m.calls++
+	return m.err
+}
+
+var _ ProcessedEventStore = &mockProcessedEventStore{}
+
+// mockProcessedEventStore keeps the events' records in a map, ignoring ttls,
+// claimErr is returned by Claim when set; the last lease claimed is kept
+type mockProcessedEventStore struct {
+	events   map[string]ProcessedEvent
+	claimErr error
+	lease    time.Duration
+}
+
+func newMockProcessedEventStore() *mockProcessedEventStore {
+	return &mockProcessedEventStore{events: map[string]ProcessedEvent{}}
+}
+
+func (m *mockProcessedEventStore) Claim(_ context.Context, key string,
+	lease time.Duration) (*ProcessedEvent, bool, error) {
+	m.lease = lease
+	if m.claimErr != nil {
+		return nil, false, m.claimErr
+	}
+	existing, ok := m.events[key]
+	if ok && existing.Status != StatusFailed {
+		return &existing, false, nil
+	}
+	m.events[key] = ProcessedEvent{Key: key, Status: StatusPending}
+	return nil, true, nil
+}
+
+func (m *mockProcessedEventStore) Complete(_ context.Context, key, status,
+	errMsg string, result map[string]interface{}, _ time.Duration) error {
+	m.events[key] = ProcessedEvent{Key: key, Status: status, Error: errMsg, Result: result}
+	return nil
+}
+
+func (m *mockProcessedEventStore) PurgeExpired(context.Context, time.Time) (int64, error) {
+	return 0, nil
+}
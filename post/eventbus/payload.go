@@ -0,0 +1,372 @@
+package eventbus
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+var (
+	// ErrInvalidPayload returned when an event's data can't be decoded
+	// into its handler's payload
+	ErrInvalidPayload = errors.New("invalid payload")
+	// ErrMissingField is self-described
+	ErrMissingField = errors.New("missing field")
+	// ErrWrongFieldType is self-described
+	ErrWrongFieldType = errors.New("wrong field type")
+)
+
+// JSONSchemaDraft is the version of JSON Schema the generated schemas follow
+const JSONSchemaDraft = "http://json-schema.org/draft-07/schema#"
+
+// MissingFieldError is returned when a required field of a payload is missing
+// It's comparable, errors.Is matches both equal values and ErrMissingField
+type MissingFieldError struct {
+	Field string
+}
+
+// NewMissingFieldError is a constructor
+func NewMissingFieldError(field string) MissingFieldError {
+	return MissingFieldError{field}
+}
+
+// Error implements the error interface
+func (e MissingFieldError) Error() string {
+	return fmt.Sprintf("%s missing", e.Field)
+}
+
+// Is makes errors.Is(err, ErrMissingField) hold
+func (e MissingFieldError) Is(target error) bool {
+	return target == ErrMissingField
+}
+
+// WrongTypeError is returned when a field of a payload has an unexpected type
+// It's comparable, errors.Is matches both equal values and ErrWrongFieldType
+type WrongTypeError struct {
+	Field        string
+	ExpectedType string
+}
+
+// NewWrongTypeError is a constructor
+func NewWrongTypeError(field, expectedType string) WrongTypeError {
+	return WrongTypeError{field, expectedType}
+}
+
+// Error implements the error interface
+func (e WrongTypeError) Error() string {
+	return fmt.Sprintf("incorrect data type for %s, should be %s", e.Field, e.ExpectedType)
+}
+
+// Is makes errors.Is(err, ErrWrongFieldType) hold
+func (e WrongTypeError) Is(target error) bool {
+	return target == ErrWrongFieldType
+}
+
+// FieldErrors are all the errors found when decoding a payload
+// errors.Is and errors.As match ErrInvalidPayload and each of the errors
+type FieldErrors []error
+
+// Error implements the error interface
+func (f FieldErrors) Error() string {
+	msgs := make([]string, 0, len(f))
+	for _, err := range f {
+		msgs = append(msgs, err.Error())
+	}
+	return fmt.Sprintf("%v: %s", ErrInvalidPayload, strings.Join(msgs, "; "))
+}
+
+// Is makes errors.Is hold for ErrInvalidPayload and any of the errors
+func (f FieldErrors) Is(target error) bool {
+	if target == ErrInvalidPayload {
+		return true
+	}
+	for _, err := range f {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// As makes errors.As find the first of the errors matching target
+func (f FieldErrors) As(target interface{}) bool {
+	for _, err := range f {
+		if errors.As(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// Schema is the JSON schema of a payload
+type Schema map[string]interface{}
+
+// TypedCommandHandler is a CommandHandler's counterpart which receives its
+// params decoded into a typed payload, a struct. Payloads' fields are
+// named by their json tag, and the ones tagged `validate:"required"` must
+// be present. Supported field types are string, int, bool, structs following
+// the same rules, nested as objects, slices of them, and pointers to them,
+// for optional fields distinguishing absence
+type TypedCommandHandler interface {
+	// NewPayload returns a pointer to the zero value of the payload
+	NewPayload() interface{}
+	// HandlePayload receives what NewPayload returned, decoded and validated
+	HandlePayload(ctx context.Context, payload interface{}) error
+}
+
+// Typed adapts a TypedCommandHandler to a CommandHandler, decoding and
+// validating the params before handing them. All the errors found are
+// returned at once, as FieldErrors
+func Typed(handler TypedCommandHandler) CommandHandler {
+	return typedHandler{handler}
+}
+
+type typedHandler struct {
+	handler TypedCommandHandler
+}
+
+// Handle implements CommandHandler
+func (t typedHandler) Handle(ctx context.Context, params Params) error {
+	payload := t.handler.NewPayload()
+	if err := DecodePayload(params, payload); err != nil {
+		return err
+	}
+	return t.handler.HandlePayload(ctx, payload)
+}
+
+// Schema returns the JSON schema of the handler's payload
+func (t typedHandler) Schema() Schema {
+	return SchemaOf(t.handler.NewPayload())
+}
+
+// SchemaProvider is implemented by CommandHandlers that can describe their params
+type SchemaProvider interface {
+	Schema() Schema
+}
+
+// Unwrapper is implemented by CommandHandlers decorating another one
+type Unwrapper interface {
+	Unwrap() CommandHandler
+}
+
+// schemaOf finds the schema of handler, looking through its decorators
+func schemaOf(handler CommandHandler) (Schema, bool) {
+	for handler != nil {
+		switch h := handler.(type) {
+		case SchemaProvider:
+			return h.Schema(), true
+		case TypedCommandHandler:
+			return SchemaOf(h.NewPayload()), true
+		case Unwrapper:
+			handler = h.Unwrap()
+		default:
+			return nil, false
+		}
+	}
+	return nil, false
+}
+
+// DecodePayload decodes params into payload, a pointer to a struct,
+// collecting every error found as FieldErrors
+func DecodePayload(params Params, payload interface{}) error {
+	value := reflect.ValueOf(payload)
+	if value.Kind() != reflect.Ptr || value.Elem().Kind() != reflect.Struct {
+		panic(fmt.Sprintf("payload should be a pointer to a struct, got %T", payload))
+	}
+	if fieldErrors := decodeFields("", params, value.Elem()); len(fieldErrors) > 0 {
+		return fieldErrors
+	}
+	return nil
+}
+
+// decodeFields decodes params into the fields of target, a struct, naming
+// the fields after prefix, the name of the object they're nested in
+func decodeFields(prefix string, params Params, target reflect.Value) FieldErrors {
+	fieldErrors := FieldErrors{}
+	for _, field := range payloadFields(target.Type()) {
+		name := prefix + field.name
+		raw, ok := params[field.name]
+		if !ok || raw == nil {
+			if field.required {
+				fieldErrors = append(fieldErrors, NewMissingFieldError(name))
+			}
+			continue
+		}
+		fieldValue := target.Field(field.index)
+		if fieldValue.Kind() == reflect.Ptr {
+			fieldValue.Set(reflect.New(fieldValue.Type().Elem()))
+			fieldValue = fieldValue.Elem()
+		}
+		fieldErrors = fieldErrors.add(decodeValue(name, raw, fieldValue))
+	}
+	return fieldErrors
+}
+
+// add appends err to f, flattening it if it's FieldErrors itself,
+// as returned for the elements of arrays and the fields of objects
+func (f FieldErrors) add(err error) FieldErrors {
+	if nested, ok := err.(FieldErrors); ok {
+		return append(f, nested...)
+	}
+	if err != nil {
+		return append(f, err)
+	}
+	return f
+}
+
+func decodeValue(name string, raw interface{}, target reflect.Value) error {
+	switch target.Kind() {
+	case reflect.String:
+		str, ok := raw.(string)
+		if !ok {
+			return NewWrongTypeError(name, "string")
+		}
+		target.SetString(str)
+	case reflect.Bool:
+		boolean, ok := raw.(bool)
+		if !ok {
+			return NewWrongTypeError(name, "boolean")
+		}
+		target.SetBool(boolean)
+	case reflect.Int:
+		integer, ok := toInt(raw)
+		if !ok {
+			return NewWrongTypeError(name, "integer")
+		}
+		target.SetInt(int64(integer))
+	case reflect.Slice:
+		rawValue := reflect.ValueOf(raw)
+		if rawValue.Kind() != reflect.Slice {
+			return NewWrongTypeError(name, "array")
+		}
+		slice := reflect.MakeSlice(target.Type(), rawValue.Len(), rawValue.Len())
+		fieldErrors := FieldErrors{}
+		for i := 0; i < rawValue.Len(); i++ {
+			elemName := fmt.Sprintf("%s at %d", name, i)
+			err := decodeValue(elemName, rawValue.Index(i).Interface(), slice.Index(i))
+			fieldErrors = fieldErrors.add(err)
+		}
+		if len(fieldErrors) > 0 {
+			return fieldErrors
+		}
+		target.Set(slice)
+	case reflect.Struct:
+		var object Params
+		switch raw := raw.(type) {
+		case Params:
+			object = raw
+		case map[string]interface{}:
+			object = raw
+		default:
+			return NewWrongTypeError(name, "object")
+		}
+		if fieldErrors := decodeFields(name+".", object, target); len(fieldErrors) > 0 {
+			return fieldErrors
+		}
+	default:
+		panic(fmt.Sprintf("unsupported payload field type %s", target.Type()))
+	}
+	return nil
+}
+
+// toInt accepts both JSON numbers (float64) and ints
+func toInt(raw interface{}) (int, bool) {
+	switch number := raw.(type) {
+	case int:
+		return number, true
+	case float64:
+		if number == float64(int(number)) {
+			return int(number), true
+		}
+	case json.Number:
+		integer, err := number.Int64()
+		return int(integer), err == nil
+	}
+	return 0, false
+}
+
+// SchemaOf generates the JSON schema of payload, a pointer to a struct
+func SchemaOf(payload interface{}) Schema {
+	payloadType := reflect.TypeOf(payload)
+	if payloadType.Kind() == reflect.Ptr {
+		payloadType = payloadType.Elem()
+	}
+	schema := Schema(objectSchema(payloadType))
+	schema["$schema"] = JSONSchemaDraft
+	return schema
+}
+
+func objectSchema(objectType reflect.Type) map[string]interface{} {
+	properties := map[string]interface{}{}
+	required := []string{}
+	for _, field := range payloadFields(objectType) {
+		properties[field.name] = schemaType(objectType.Field(field.index).Type)
+		if field.required {
+			required = append(required, field.name)
+		}
+	}
+	sort.Strings(required)
+	return map[string]interface{}{
+		"type":       "object",
+		"properties": properties,
+		"required":   required,
+	}
+}
+
+func schemaType(fieldType reflect.Type) map[string]interface{} {
+	switch fieldType.Kind() {
+	case reflect.Ptr:
+		return schemaType(fieldType.Elem())
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Slice:
+		return map[string]interface{}{
+			"type":  "array",
+			"items": schemaType(fieldType.Elem()),
+		}
+	case reflect.Struct:
+		return objectSchema(fieldType)
+	default:
+		panic(fmt.Sprintf("unsupported payload field type %s", fieldType))
+	}
+}
+
+type payloadField struct {
+	index    int
+	name     string
+	required bool
+}
+
+// payloadFields returns the exported fields of a payload, named by their json tag
+func payloadFields(payloadType reflect.Type) []payloadField {
+	fields := []payloadField{}
+	for i := 0; i < payloadType.NumField(); i++ {
+		field := payloadType.Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+		name := strings.Split(field.Tag.Get("json"), ",")[0]
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		required := false
+		for _, rule := range strings.Split(field.Tag.Get("validate"), ",") {
+			if rule == "required" {
+				required = true
+			}
+		}
+		fields = append(fields, payloadField{index: i, name: name, required: required})
+	}
+	return fields
+}
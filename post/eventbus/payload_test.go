@@ -0,0 +1,207 @@
+package eventbus
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type testPayload struct {
+	Name     string   `json:"name" validate:"required"`
+	Count    int      `json:"count" validate:"required"`
+	Labels   []string `json:"labels"`
+	Note     *string  `json:"note"`
+	Enabled  bool     `json:"enabled"`
+	internal string
+}
+
+type testOwner struct {
+	Login string `json:"login" validate:"required"`
+	Admin bool   `json:"admin"`
+}
+
+type testNestedPayload struct {
+	Owners []testOwner `json:"owners"`
+}
+
+var _ TypedCommandHandler = &mockTypedCommandHandler{}
+
+type mockTypedCommandHandler struct {
+	payload *testPayload
+}
+
+func (m *mockTypedCommandHandler) NewPayload() interface{} {
+	return &testPayload{}
+}
+
+func (m *mockTypedCommandHandler) HandlePayload(_ context.Context, p interface{}) error {
+	m.payload = p.(*testPayload)
+	return nil
+}
+
+func TestPayload(t *testing.T) {
+	t.Run("DecodePayload", func(t *testing.T) {
+		t.Parallel()
+		var payload testPayload
+		err := DecodePayload(Params{
+			"name":    "some-name",
+			"count":   float64(2),
+			"labels":  []interface{}{"a", "b"},
+			"enabled": true,
+			"other":   "ignored",
+		}, &payload)
+		require.NoError(t, err)
+		require.Equal(t, testPayload{
+			Name:    "some-name",
+			Count:   2,
+			Labels:  []string{"a", "b"},
+			Enabled: true,
+		}, payload)
+
+		note := "some note"
+		err = DecodePayload(Params{
+			"name": "some-name", "count": 1, "note": note,
+		}, &payload)
+		require.NoError(t, err)
+		require.Equal(t, &note, payload.Note)
+	})
+
+	t.Run("DecodePayload collects all errors", func(t *testing.T) {
+		t.Parallel()
+		var payload testPayload
+		err := DecodePayload(Params{
+			"count":  1.5,
+			"labels": []interface{}{"a", 1},
+			"note":   false,
+		}, &payload)
+		require.True(t, errors.Is(err, ErrInvalidPayload))
+		require.True(t, errors.Is(err, ErrMissingField))
+		require.True(t, errors.Is(err, NewMissingFieldError("name")))
+		require.True(t, errors.Is(err, NewWrongTypeError("count", "integer")))
+		require.True(t, errors.Is(err, NewWrongTypeError("labels at 1", "string")))
+		require.True(t, errors.Is(err, NewWrongTypeError("note", "string")))
+		var fieldErrors FieldErrors
+		require.True(t, errors.As(err, &fieldErrors))
+		require.Len(t, fieldErrors, 4)
+		var wrongType WrongTypeError
+		require.True(t, errors.As(err, &wrongType))
+		require.Equal(t, "count", wrongType.Field)
+	})
+
+	t.Run("DecodePayload collects all errors of arrays", func(t *testing.T) {
+		t.Parallel()
+		var payload testPayload
+		err := DecodePayload(Params{
+			"name":   "some-name",
+			"count":  1,
+			"labels": []interface{}{1, "b", true},
+		}, &payload)
+		require.True(t, errors.Is(err, NewWrongTypeError("labels at 0", "string")))
+		require.True(t, errors.Is(err, NewWrongTypeError("labels at 2", "string")))
+		var fieldErrors FieldErrors
+		require.True(t, errors.As(err, &fieldErrors))
+		require.Len(t, fieldErrors, 2)
+
+		var nested testNestedPayload
+		err = DecodePayload(Params{
+			"owners": []interface{}{Params{"admin": true}, "kim"},
+		}, &nested)
+		require.True(t, errors.Is(err, NewMissingFieldError("owners at 0.login")))
+		require.True(t, errors.Is(err, NewWrongTypeError("owners at 1", "object")))
+		require.True(t, errors.As(err, &fieldErrors))
+		require.Len(t, fieldErrors, 2)
+	})
+
+	t.Run("DecodePayload nested objects", func(t *testing.T) {
+		t.Parallel()
+		var payload testNestedPayload
+		err := DecodePayload(Params{
+			"owners": []interface{}{
+				map[string]interface{}{"login": "kim", "admin": true},
+				Params{"login": "thurston"},
+			},
+		}, &payload)
+		require.NoError(t, err)
+		require.Equal(t, []testOwner{{Login: "kim", Admin: true}, {Login: "thurston"}},
+			payload.Owners)
+
+		err = DecodePayload(Params{
+			"owners": []interface{}{map[string]interface{}{"admin": true}},
+		}, &payload)
+		require.True(t, errors.Is(err, NewMissingFieldError("owners at 0.login")))
+		err = DecodePayload(Params{"owners": []interface{}{"kim"}}, &payload)
+		require.True(t, errors.Is(err, NewWrongTypeError("owners at 0", "object")))
+	})
+
+	t.Run("SchemaOf nested objects", func(t *testing.T) {
+		t.Parallel()
+		require.Equal(t, Schema{
+			"$schema": JSONSchemaDraft,
+			"type":    "object",
+			"properties": map[string]interface{}{
+				"owners": map[string]interface{}{
+					"type": "array",
+					"items": map[string]interface{}{
+						"type": "object",
+						"properties": map[string]interface{}{
+							"login": map[string]interface{}{"type": "string"},
+							"admin": map[string]interface{}{"type": "boolean"},
+						},
+						"required": []string{"login"},
+					},
+				},
+			},
+			"required": []string{},
+		}, SchemaOf(&testNestedPayload{}))
+	})
+
+	t.Run("SchemaOf", func(t *testing.T) {
+		t.Parallel()
+		require.Equal(t, Schema{
+			"$schema": JSONSchemaDraft,
+			"type":    "object",
+			"properties": map[string]interface{}{
+				"name":  map[string]interface{}{"type": "string"},
+				"count": map[string]interface{}{"type": "integer"},
+				"labels": map[string]interface{}{
+					"type":  "array",
+					"items": map[string]interface{}{"type": "string"},
+				},
+				"note":    map[string]interface{}{"type": "string"},
+				"enabled": map[string]interface{}{"type": "boolean"},
+			},
+			"required": []string{"count", "name"},
+		}, SchemaOf(&testPayload{}))
+	})
+
+	t.Run("Typed", func(t *testing.T) {
+		t.Parallel()
+		handler := &mockTypedCommandHandler{}
+		err := Typed(handler).Handle(context.Background(), Params{})
+		require.True(t, errors.Is(err, ErrInvalidPayload))
+		require.Nil(t, handler.payload)
+
+		err = Typed(handler).Handle(
+			context.Background(), Params{"name": "some-name", "count": 1},
+		)
+		require.NoError(t, err)
+		require.Equal(t, "some-name", handler.payload.Name)
+	})
+
+	t.Run("Schemas", func(t *testing.T) {
+		t.Parallel()
+		bus := NewEventBus()
+		bus.Register("typed", Typed(&mockTypedCommandHandler{}))
+		bus.Register(
+			"decorated",
+			Idempotent(Typed(&mockTypedCommandHandler{}), newMockProcessedEventStore(), 0),
+		)
+		bus.Register("untyped", &mockCommandHandler{})
+		schemas := bus.Schemas()
+		require.Len(t, schemas, 2)
+		require.Equal(t, "typed", schemas["typed"]["$id"])
+		require.Equal(t, "decorated", schemas["decorated"]["$id"])
+	})
+}
@@ -0,0 +1,55 @@
+package eventbus
+
+import (
+	"context"
+	"sync"
+)
+
+// Result collects what CommandHandlers report about the outcome of an event,
+// such as the id of the entity created, for the event's sender to learn it
+// It's safe for concurrent use
+type Result struct {
+	mu     sync.Mutex
+	values map[string]interface{}
+}
+
+type resultKey struct{}
+
+// ContextWithResult returns a context carrying a new, empty, Result,
+// along with it, where the handlers of the event can record their outcome
+func ContextWithResult(ctx context.Context) (context.Context, *Result) {
+	result := &Result{values: map[string]interface{}{}}
+	return context.WithValue(ctx, resultKey{}, result), result
+}
+
+// ResultFromContext returns the Result carried by ctx, if any
+func ResultFromContext(ctx context.Context) (*Result, bool) {
+	result, ok := ctx.Value(resultKey{}).(*Result)
+	return result, ok
+}
+
+// RecordResult sets key to value in the Result carried by ctx,
+// it does nothing when there's none, as nobody waits for the outcome
+func RecordResult(ctx context.Context, key string, value interface{}) {
+	result, ok := ResultFromContext(ctx)
+	if !ok {
+		return
+	}
+	result.mu.Lock()
+	defer result.mu.Unlock()
+	result.values[key] = value
+}
+
+// Values returns a copy of the values recorded, nil if there are none
+func (r *Result) Values() map[string]interface{} {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.values) == 0 {
+		return nil
+	}
+	values := make(map[string]interface{}, len(r.values))
+	for key, value := range r.values {
+		values[key] = value
+	}
+	return values
+}
@@ -0,0 +1,34 @@
+package eventbus
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestResult(t *testing.T) {
+	t.Run("Recorded", func(t *testing.T) {
+		ctx, result := ContextWithResult(context.Background())
+		require.Nil(t, result.Values())
+		RecordResult(ctx, "id", "some-id")
+		RecordResult(ctx, "version", 2)
+		values := result.Values()
+		require.Equal(t, map[string]interface{}{"id": "some-id", "version": 2}, values)
+
+		values["id"] = "changed"
+		require.Equal(t, "some-id", result.Values()["id"], "values should be a copy")
+
+		fromCtx, ok := ResultFromContext(ctx)
+		require.True(t, ok)
+		require.Same(t, result, fromCtx)
+	})
+
+	t.Run("Without result", func(t *testing.T) {
+		require.NotPanics(t, func() {
+			RecordResult(context.Background(), "id", "some-id")
+		})
+		_, ok := ResultFromContext(context.Background())
+		require.False(t, ok)
+	})
+}
@@ -0,0 +1,186 @@
+package eventbus
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrUpcast returned when an Upcaster fails to transform an event's data
+var ErrUpcast = errors.New("event upcasting failed")
+
+// versionSegment matches the segment of an event's name holding
+// its version, as in "posts.v1.create"
+var versionSegment = regexp.MustCompile(`^v([0-9]+)$`)
+
+// Upcaster transforms the data of an event into the data of the
+// event's next version, "posts.v1.create" into "posts.v2.create"
+type Upcaster func(data Params) (Params, error)
+
+// ParseVersion splits a versioned event's name into its family, the
+// name without the version segment ("posts.create"), and its version
+// ok is false when the name has no version segment
+func ParseVersion(eventName string) (family string, version int, ok bool) {
+	segments := strings.Split(eventName, ".")
+	for i, segment := range segments {
+		match := versionSegment.FindStringSubmatch(segment)
+		if match == nil {
+			continue
+		}
+		version, err := strconv.Atoi(match[1])
+		if err != nil {
+			return "", 0, false
+		}
+		rest := append(append([]string{}, segments[:i]...), segments[i+1:]...)
+		return strings.Join(rest, "."), version, true
+	}
+	return "", 0, false
+}
+
+// WithVersion returns the name of the passed version of a versioned event,
+// WithVersion("posts.v1.create", 2) is "posts.v2.create"
+// It panics if the name has no version segment
+func WithVersion(eventName string, version int) string {
+	segments := strings.Split(eventName, ".")
+	for i, segment := range segments {
+		if versionSegment.MatchString(segment) {
+			segments[i] = fmt.Sprintf("v%d", version)
+			return strings.Join(segments, ".")
+		}
+	}
+	panic(fmt.Sprintf("event %q has no version", eventName))
+}
+
+// RegisterUpcaster adds an Upcaster from the passed version of an event to
+// the next one. Events are upcast, one version at a time, while there's no
+// handler registered for their version
+// It panics if the name has no version segment
+func (e *EventBus) RegisterUpcaster(eventName string, upcaster Upcaster) {
+	family, version := mustParseVersion(eventName)
+	e.upcasters[eventName] = upcaster
+	e.versions.seen(family, version+1)
+}
+
+// RegisterVersions associates the versions from to to, both included, of an
+// event with a given CommandHandler, as Register does for each of them
+// eventName can be the name of any version of the event
+// It panics if the name has no version segment
+func (e *EventBus) RegisterVersions(eventName string, from, to int,
+	cmdHandler CommandHandler, mws ...Middleware) {
+	mustParseVersion(eventName)
+	for version := from; version <= to; version++ {
+		e.Register(WithVersion(eventName, version), cmdHandler, mws...)
+	}
+}
+
+// upcast transforms the envelope's data, one version at a time, until
+// there's a handler for its version, returning the envelope upcast along
+// with it. ErrEventNotRegistered is returned when there's none
+func (e EventBus) upcast(envelope Envelope) (Envelope, CommandHandler, error) {
+	for {
+		if handler, ok := e.handlers[envelope.Type]; ok {
+			return envelope, handler, nil
+		}
+		upcaster, ok := e.upcasters[envelope.Type]
+		if !ok {
+			return Envelope{}, nil, ErrEventNotRegistered
+		}
+		_, version, _ := ParseVersion(envelope.Type)
+		next := WithVersion(envelope.Type, version+1)
+		data, err := upcaster(envelope.Data)
+		if err != nil {
+			return Envelope{}, nil, fmt.Errorf("%w: %s to %s: %v",
+				ErrUpcast, envelope.Type, next, err)
+		}
+		envelope.Type = next
+		envelope.Data = data
+	}
+}
+
+func mustParseVersion(eventName string) (string, int) {
+	family, version, ok := ParseVersion(eventName)
+	if !ok {
+		panic(fmt.Sprintf("event %q has no version", eventName))
+	}
+	return family, version
+}
+
+// VersionUsage counts the events of a version older than the latest
+// one of their family that are still arriving
+type VersionUsage struct {
+	Event    string    `json:"event"`
+	Latest   string    `json:"latest"`
+	Count    int64     `json:"count"`
+	LastSeen time.Time `json:"last_seen"`
+}
+
+// DeprecationReport returns the usage of the events' old versions,
+// by name; the latest version of a family is the highest one
+// registered, either handled or upcast to
+func (e *EventBus) DeprecationReport() []VersionUsage {
+	return e.versions.report()
+}
+
+// versionRegistry keeps the latest version of each family of events,
+// and the usage of the older ones; it's safe for concurrent use
+type versionRegistry struct {
+	mu     sync.Mutex
+	latest map[string]int
+	usage  map[string]*VersionUsage
+}
+
+func newVersionRegistry() *versionRegistry {
+	return &versionRegistry{
+		latest: map[string]int{},
+		usage:  map[string]*VersionUsage{},
+	}
+}
+
+// seen records that the passed version of family is registered
+func (v *versionRegistry) seen(family string, version int) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if version > v.latest[family] {
+		v.latest[family] = version
+	}
+}
+
+// arrived counts the event, when its version is older than the latest one
+func (v *versionRegistry) arrived(eventName string) {
+	family, version, ok := ParseVersion(eventName)
+	if !ok {
+		return
+	}
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	latest, ok := v.latest[family]
+	if !ok || version >= latest {
+		return
+	}
+	usage, ok := v.usage[eventName]
+	if !ok {
+		usage = &VersionUsage{Event: eventName}
+		v.usage[eventName] = usage
+	}
+	usage.Latest = WithVersion(eventName, latest)
+	usage.Count++
+	usage.LastSeen = time.Now()
+}
+
+func (v *versionRegistry) report() []VersionUsage {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	report := make([]VersionUsage, 0, len(v.usage))
+	for _, usage := range v.usage {
+		report = append(report, *usage)
+	}
+	sort.Slice(report, func(i, j int) bool {
+		return report[i].Event < report[j].Event
+	})
+	return report
+}
@@ -0,0 +1,122 @@
+package eventbus
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseVersion(t *testing.T) {
+	t.Parallel()
+
+	family, version, ok := ParseVersion("posts.v12.create")
+	require.True(t, ok)
+	require.Equal(t, "posts.create", family)
+	require.Equal(t, 12, version)
+
+	_, _, ok = ParseVersion("posts.create")
+	require.False(t, ok)
+
+	require.Equal(t, "posts.v2.create", WithVersion("posts.v1.create", 2))
+	require.Panics(t, func() { WithVersion("posts.create", 2) })
+}
+
+func TestUpcasting(t *testing.T) {
+	t.Parallel()
+
+	// v1 had a single "name", split in v2; v3 renamed "first" to "given"
+	splitName := func(data Params) (Params, error) {
+		name, ok := data["name"].(string)
+		if !ok {
+			return nil, errors.New("name missing")
+		}
+		return Params{"first": name, "last": "unknown"}, nil
+	}
+	renameFirst := func(data Params) (Params, error) {
+		data["given"] = data["first"]
+		delete(data, "first")
+		return data, nil
+	}
+	event := func(name string, data string) Event {
+		return testRawEvent(fmt.Sprintf(`{"event_name": %q, %s}`, name, data))
+	}
+
+	t.Run("Upcast to the version handled", func(t *testing.T) {
+		handler := &mockCapturingCommandHandler{}
+		bus := NewEventBus()
+		bus.RegisterUpcaster("users.v1.create", splitName)
+		bus.RegisterUpcaster("users.v2.create", renameFirst)
+		bus.Register("users.v3.create", handler)
+
+		err := bus.Resolve(context.Background(), event("users.v1.create", `"name": "Ada"`))
+		require.NoError(t, err)
+		require.Equal(t, Params{"given": "Ada", "last": "unknown"}, handler.params)
+		require.Equal(t, "users.v3.create", handler.envelope.Type)
+	})
+
+	t.Run("Handled versions aren't upcast", func(t *testing.T) {
+		handler := &mockCapturingCommandHandler{}
+		bus := NewEventBus()
+		bus.RegisterUpcaster("users.v1.create", splitName)
+		bus.RegisterUpcaster("users.v2.create", renameFirst)
+		bus.RegisterVersions("users.v2.create", 2, 3, handler)
+
+		err := bus.Resolve(context.Background(), event("users.v1.create", `"name": "Ada"`))
+		require.NoError(t, err)
+		require.Equal(t, "users.v2.create", handler.envelope.Type)
+		require.Equal(t, Params{"first": "Ada", "last": "unknown"}, handler.params)
+
+		err = bus.Resolve(context.Background(), event("users.v3.create", `"given": "Bob"`))
+		require.NoError(t, err)
+		require.Equal(t, "users.v3.create", handler.envelope.Type)
+	})
+
+	t.Run("Upcast failed", func(t *testing.T) {
+		bus := NewEventBus()
+		bus.RegisterUpcaster("users.v1.create", splitName)
+		bus.Register("users.v2.create", &mockCommandHandler{})
+
+		err := bus.Resolve(context.Background(), event("users.v1.create", `"other": 1`))
+		require.True(t, errors.Is(err, ErrUpcast), err)
+	})
+
+	t.Run("No handler nor upcaster", func(t *testing.T) {
+		bus := NewEventBus()
+		bus.Register("users.v2.create", &mockCommandHandler{})
+
+		err := bus.Resolve(context.Background(), event("users.v1.create", `"name": "Ada"`))
+		require.True(t, errors.Is(err, ErrEventNotRegistered), err)
+	})
+
+	t.Run("Unversioned", func(t *testing.T) {
+		bus := NewEventBus()
+		require.Panics(t, func() { bus.RegisterUpcaster("users.create", splitName) })
+		require.Panics(t, func() {
+			bus.RegisterVersions("users.create", 1, 2, &mockCommandHandler{})
+		})
+	})
+}
+
+func TestDeprecationReport(t *testing.T) {
+	t.Parallel()
+
+	bus := NewEventBus()
+	bus.RegisterVersions("users.v1.create", 1, 2, &mockCommandHandler{})
+	bus.Register("users.v1.delete", &mockCommandHandler{})
+	ctx := context.Background()
+	for _, name := range []string{
+		"users.v1.create", "users.v1.create", "users.v2.create", "users.v1.delete",
+	} {
+		require.NoError(t, bus.Resolve(ctx, testEvent{name: name}))
+	}
+
+	report := bus.DeprecationReport()
+	require.Len(t, report, 1, "only old versions should be reported")
+	require.Equal(t, "users.v1.create", report[0].Event)
+	require.Equal(t, "users.v2.create", report[0].Latest)
+	require.Equal(t, int64(2), report[0].Count)
+	require.False(t, report[0].LastSeen.IsZero())
+}
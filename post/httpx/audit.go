@@ -0,0 +1,142 @@
+package httpx
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/mountolive/back-blog-go/post/audit"
+	"github.com/mountolive/back-blog-go/post/command"
+	"github.com/mountolive/back-blog-go/post/usecase"
+)
+
+// AuditLog is the needed functionality for reading the audit log,
+// an audit.Store implements it
+type AuditLog interface {
+	History(ctx context.Context, aggregateID string) ([]*audit.Entry, error)
+	Query(ctx context.Context, filter audit.Filter) ([]*audit.Entry, error)
+}
+
+// AuditServer exposes the audit log: the history of each post,
+// the queries of the admins, and the rebuilding of posts out of it
+type AuditServer struct {
+	log       AuditLog
+	sanitizer usecase.ContentSanitizer
+}
+
+// NewAuditServer is a constructor, sanitizer is the one
+// of the repository, for rebuilding the posts as it writes them
+func NewAuditServer(log AuditLog, sanitizer usecase.ContentSanitizer) AuditServer {
+	return AuditServer{log, sanitizer}
+}
+
+// GetPostHistory returns the commands received for a post, oldest first,
+// from `/posts/{id}/history`
+func (s AuditServer) GetPostHistory(w http.ResponseWriter, r *http.Request) {
+	history, ok := s.history(w, r)
+	if !ok {
+		return
+	}
+	writeJSON(w, http.StatusOK, history)
+}
+
+// RebuildPost returns the state of a post rebuilt by replaying the
+// commands of its history, from `/admin/posts/{id}/rebuild`
+// Nothing is written, it's for comparing it with the stored one
+func (s AuditServer) RebuildPost(w http.ResponseWriter, r *http.Request) {
+	history, ok := s.history(w, r)
+	if !ok {
+		return
+	}
+	rebuilt, err := command.RebuildPost(history, s.sanitizer)
+	switch {
+	case errors.Is(err, command.ErrNoCreation):
+		writeError(w, newNotFoundError())
+		return
+	case err != nil:
+		writeError(w, newRepositoryError(err))
+		return
+	}
+	writeJSON(w, http.StatusOK, rebuilt)
+}
+
+// history reads the history of the post whose id is the path's second
+// segment, writing the error when there's none
+func (s AuditServer) history(w http.ResponseWriter, r *http.Request) ([]*audit.Entry, bool) {
+	splittedPath := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if splittedPath[0] == "admin" {
+		splittedPath = splittedPath[1:]
+	}
+	if len(splittedPath) < 2 || splittedPath[1] == "" {
+		writeError(w, newNotFoundError())
+		return nil, false
+	}
+	history, err := s.log.History(r.Context(), splittedPath[1])
+	if err != nil {
+		writeError(w, newRepositoryError(err))
+		return nil, false
+	}
+	if len(history) == 0 {
+		writeError(w, newNotFoundError())
+		return nil, false
+	}
+	return history, true
+}
+
+// QueryAudit returns the entries of the audit log, oldest first, from
+// `/admin/audit`. They can be filtered by the actor, from and to query
+// parameters, the latter being either RFC 3339 timestamps or dates, and
+// paginated as the posts are. A date passed as to includes the whole day
+func (s AuditServer) QueryAudit(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	from, err := parseAuditTime(query, "from", false)
+	if err != nil {
+		writeError(w, newTimeParsingError(err))
+		return
+	}
+	to, err := parseAuditTime(query, "to", true)
+	if err != nil {
+		writeError(w, newTimeParsingError(err))
+		return
+	}
+	if !from.IsZero() && !to.IsZero() && to.Before(from) {
+		writeError(w, newEndTimeBeforeStartTimeError())
+		return
+	}
+	page, pageSize := calculatePageAndPageSize(query)
+	entries, err := s.log.Query(r.Context(), audit.Filter{
+		Actor:  query.Get("actor"),
+		From:   from,
+		To:     to,
+		Limit:  pageSize,
+		Offset: page * pageSize,
+	})
+	if err != nil {
+		writeError(w, newRepositoryError(err))
+		return
+	}
+	writeJSON(w, http.StatusOK, entries)
+}
+
+// parseAuditTime parses the query's key, zero if missing. A date
+// is taken as its start, or as its end when endOfDay
+func parseAuditTime(query url.Values, key string, endOfDay bool) (time.Time, error) {
+	raw := query.Get(key)
+	if raw == "" {
+		return time.Time{}, nil
+	}
+	if parsed, err := time.Parse(time.RFC3339, raw); err == nil {
+		return parsed, nil
+	}
+	parsed, err := time.Parse(timeFormat, raw)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if endOfDay {
+		parsed = parsed.Add(24*time.Hour - time.Nanosecond)
+	}
+	return parsed, nil
+}
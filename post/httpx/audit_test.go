@@ -0,0 +1,131 @@
+package httpx_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/mountolive/back-blog-go/post/audit"
+	"github.com/mountolive/back-blog-go/post/command"
+	"github.com/mountolive/back-blog-go/post/eventbus"
+	"github.com/mountolive/back-blog-go/post/httpx"
+	"github.com/stretchr/testify/require"
+)
+
+type mockAuditLog struct {
+	entries []*audit.Entry
+	filter  audit.Filter
+}
+
+func (m *mockAuditLog) History(_ context.Context, aggregateID string) ([]*audit.Entry, error) {
+	history := []*audit.Entry{}
+	for _, entry := range m.entries {
+		if entry.AggregateID == aggregateID {
+			history = append(history, entry)
+		}
+	}
+	return history, nil
+}
+
+func (m *mockAuditLog) Query(_ context.Context, filter audit.Filter) ([]*audit.Entry, error) {
+	m.filter = filter
+	return m.entries, nil
+}
+
+func newMockAuditLog() *mockAuditLog {
+	occurredAt := time.Date(2021, 3, 1, 10, 0, 0, 0, time.UTC)
+	return &mockAuditLog{entries: []*audit.Entry{
+		{
+			Seq:         1,
+			Name:        command.CreatePostEventNameV1,
+			AggregateID: "post-id",
+			Payload: eventbus.Params{
+				"creator": "creator", "title": "title", "content": "content",
+			},
+			Actor:      "creator",
+			Outcome:    eventbus.StatusSucceeded,
+			OccurredAt: occurredAt,
+		},
+		{
+			Seq:         2,
+			Name:        command.DeletePostEventNameV1,
+			AggregateID: "post-id",
+			Payload:     eventbus.Params{"id": "post-id", "version": 1},
+			Actor:       "creator",
+			Outcome:     eventbus.StatusSucceeded,
+			OccurredAt:  occurredAt.Add(time.Minute),
+		},
+	}}
+}
+
+func TestAudit(t *testing.T) {
+	t.Parallel()
+
+	notFound, _ := json.Marshal(httpx.APIError{
+		Error: httpx.DetailError{
+			Code:    httpx.NotFoundErrorCode,
+			Message: httpx.NotFoundErrorMsg,
+		},
+	})
+
+	t.Run("GetPostHistory", func(t *testing.T) {
+		log := newMockAuditLog()
+		server := httpx.NewAuditServer(log, nil)
+		expected, _ := json.Marshal(log.entries)
+		checkHandler(t, "/posts/post-id/history", server.GetPostHistory, http.StatusOK, expected)
+	})
+
+	t.Run("GetPostHistory without entries, NotFound", func(t *testing.T) {
+		server := httpx.NewAuditServer(newMockAuditLog(), nil)
+		checkHandler(t, "/posts/missing/history", server.GetPostHistory, http.StatusNotFound, notFound)
+	})
+
+	t.Run("RebuildPost", func(t *testing.T) {
+		log := newMockAuditLog()
+		server := httpx.NewAuditServer(log, nil)
+		rebuilt, err := command.RebuildPost(log.entries, nil)
+		require.NoError(t, err)
+		require.True(t, rebuilt.Deleted)
+		expected, _ := json.Marshal(rebuilt)
+		checkHandler(t, "/admin/posts/post-id/rebuild", server.RebuildPost, http.StatusOK, expected)
+	})
+
+	t.Run("RebuildPost without entries, NotFound", func(t *testing.T) {
+		server := httpx.NewAuditServer(newMockAuditLog(), nil)
+		checkHandler(t, "/admin/posts/missing/rebuild", server.RebuildPost, http.StatusNotFound, notFound)
+	})
+
+	t.Run("QueryAudit", func(t *testing.T) {
+		log := newMockAuditLog()
+		server := httpx.NewAuditServer(log, nil)
+		expected, _ := json.Marshal(log.entries)
+		checkHandler(
+			t, "/admin/audit?actor=creator&from=2021-03-01T09:00:00Z&to=2021-03-02&page=1&page_size=5",
+			server.QueryAudit, http.StatusOK, expected,
+		)
+		expectedFilter := audit.Filter{
+			Actor:  "creator",
+			From:   time.Date(2021, 3, 1, 9, 0, 0, 0, time.UTC),
+			To:     time.Date(2021, 3, 2, 23, 59, 59, 999999999, time.UTC),
+			Limit:  5,
+			Offset: 5,
+		}
+		require.Equal(t, expectedFilter, log.filter)
+	})
+
+	t.Run("QueryAudit to before from, BadRequest", func(t *testing.T) {
+		server := httpx.NewAuditServer(newMockAuditLog(), nil)
+		expected, _ := json.Marshal(httpx.APIError{
+			Error: httpx.DetailError{
+				Code:    httpx.EndTimeBeforeStartTimeErrorCode,
+				Message: httpx.EndTimeBeforeStartTimeErrorMsg,
+			},
+		})
+		checkHandler(
+			t, "/admin/audit?from=2021-03-02&to=2021-03-01T00:00:00Z",
+			server.QueryAudit, http.StatusBadRequest, expected,
+		)
+	})
+}
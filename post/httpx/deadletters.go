@@ -0,0 +1,202 @@
+package httpx
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/mountolive/back-blog-go/post/deadletter"
+)
+
+const (
+	// error codes of the dead letters' administration
+	DeadLetterNotFoundErrorCode = 1200
+	ReplayFailedErrorCode       = 1300
+	UnauthorizedErrorCode       = 1400
+
+	// error messages of the dead letters' administration
+	DeadLetterNotFoundErrorMsg = "dead letter with passed id not found"
+	UnauthorizedErrorMsg       = "a valid admin bearer token is required"
+)
+
+// DeadLetterAdmin is the needed functionality for administering dead letters,
+// deadletter.Manager implements it
+type DeadLetterAdmin interface {
+	List(context.Context, deadletter.Filter) ([]*deadletter.Letter, error)
+	Get(ctx context.Context, id string) (*deadletter.Letter, error)
+	Edit(ctx context.Context, id, data string) (*deadletter.Letter, error)
+	Replay(ctx context.Context, id string) error
+	Discard(ctx context.Context, id string) error
+}
+
+// DeadLettersServer lets admins inspect, fix, replay or discard the
+// messages that couldn't be processed, under `/admin/dead-letters`
+type DeadLettersServer struct {
+	admin DeadLetterAdmin
+}
+
+// NewDeadLettersServer is a constructor
+func NewDeadLettersServer(admin DeadLetterAdmin) DeadLettersServer {
+	return DeadLettersServer{admin}
+}
+
+// EditDeadLetterRequest is the body expected by EditDeadLetter,
+// data replaces the message's
+type EditDeadLetterRequest struct {
+	Data string `json:"data"`
+}
+
+// AdminToken only lets through the requests bearing token
+// in their Authorization header
+func AdminToken(token string) Middleware {
+	return func(handler http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			bearer := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if token == "" || subtle.ConstantTimeCompare([]byte(bearer), []byte(token)) != 1 {
+				writeError(w, APIError{
+					HTTPCode: http.StatusUnauthorized,
+					Error: DetailError{
+						Code:    UnauthorizedErrorCode,
+						Message: UnauthorizedErrorMsg,
+					},
+				})
+				return
+			}
+			handler(w, r)
+		}
+	}
+}
+
+func newDeadLetterNotFoundError() APIError {
+	return APIError{
+		HTTPCode: http.StatusNotFound,
+		Error: DetailError{
+			Code:    DeadLetterNotFoundErrorCode,
+			Message: DeadLetterNotFoundErrorMsg,
+		},
+	}
+}
+
+func newDeadLetterError(err error) APIError {
+	if errors.Is(err, deadletter.ErrLetterNotFound) {
+		return newDeadLetterNotFoundError()
+	}
+	return newRepositoryError(err)
+}
+
+// ListDeadLetters lists the dead letters, the most recent first
+// They can be filtered by the subject and reason query parameters,
+// and paginated as the posts are
+func (s DeadLettersServer) ListDeadLetters(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	page, pageSize := calculatePageAndPageSize(query)
+	letters, err := s.admin.List(r.Context(), deadletter.Filter{
+		Subject: query.Get("subject"),
+		Reason:  query.Get("reason"),
+		Limit:   pageSize,
+		Offset:  page * pageSize,
+	})
+	if err != nil {
+		writeError(w, newRepositoryError(err))
+		return
+	}
+	writeJSON(w, http.StatusOK, letters)
+}
+
+// GetDeadLetter returns a single dead letter
+func (s DeadLettersServer) GetDeadLetter(w http.ResponseWriter, r *http.Request) {
+	id, ok := deadLetterID(r)
+	if !ok {
+		writeError(w, newDeadLetterNotFoundError())
+		return
+	}
+	letter, err := s.admin.Get(r.Context(), id)
+	if err != nil {
+		writeError(w, newDeadLetterError(err))
+		return
+	}
+	writeJSON(w, http.StatusOK, letter)
+}
+
+// EditDeadLetter replaces the data of a single dead letter,
+// for fixing it before replaying it
+func (s DeadLettersServer) EditDeadLetter(w http.ResponseWriter, r *http.Request) {
+	id, ok := deadLetterID(r)
+	if !ok {
+		writeError(w, newDeadLetterNotFoundError())
+		return
+	}
+	var request EditDeadLetterRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeError(w, newMalformedBodyError(err))
+		return
+	}
+	letter, err := s.admin.Edit(r.Context(), id, request.Data)
+	if err != nil {
+		writeError(w, newDeadLetterError(err))
+		return
+	}
+	writeJSON(w, http.StatusOK, letter)
+}
+
+// ReplayDeadLetter processes a single dead letter again, discarding it once
+// processed. When it fails again, it's kept, with its failure updated
+func (s DeadLettersServer) ReplayDeadLetter(w http.ResponseWriter, r *http.Request) {
+	id, ok := deadLetterID(r)
+	if !ok {
+		writeError(w, newDeadLetterNotFoundError())
+		return
+	}
+	err := s.admin.Replay(r.Context(), id)
+	switch {
+	case errors.Is(err, deadletter.ErrReplay):
+		writeError(w, APIError{
+			HTTPCode: http.StatusUnprocessableEntity,
+			Error: DetailError{
+				Code:    ReplayFailedErrorCode,
+				Message: err.Error(),
+			},
+		})
+		return
+	case err != nil:
+		writeError(w, newDeadLetterError(err))
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// DiscardDeadLetter removes a single dead letter
+func (s DeadLettersServer) DiscardDeadLetter(w http.ResponseWriter, r *http.Request) {
+	id, ok := deadLetterID(r)
+	if !ok {
+		writeError(w, newDeadLetterNotFoundError())
+		return
+	}
+	if err := s.admin.Discard(r.Context(), id); err != nil {
+		writeError(w, newDeadLetterError(err))
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// deadLetterID extracts the id of a dead letter from a path of the form
+// `/admin/dead-letters/{id}`, optionally followed by an action
+func deadLetterID(r *http.Request) (string, bool) {
+	splittedPath := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if len(splittedPath) < 3 || splittedPath[2] == "" {
+		return "", false
+	}
+	return splittedPath[2], true
+}
+
+func writeJSON(w http.ResponseWriter, httpCode int, value interface{}) {
+	body, err := json.Marshal(value)
+	if err != nil {
+		writeError(w, newMarshalingError(err))
+		return
+	}
+	writeResponse(w, httpCode, body)
+}
@@ -0,0 +1,203 @@
+package httpx_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/mountolive/back-blog-go/post/deadletter"
+	"github.com/mountolive/back-blog-go/post/httpx"
+	"github.com/stretchr/testify/require"
+)
+
+type mockDeadLetterAdmin struct {
+	letter    *deadletter.Letter
+	filter    deadletter.Filter
+	replayErr error
+}
+
+func (m *mockDeadLetterAdmin) List(_ context.Context,
+	filter deadletter.Filter) ([]*deadletter.Letter, error) {
+	m.filter = filter
+	return []*deadletter.Letter{m.letter}, nil
+}
+
+func (m *mockDeadLetterAdmin) Get(_ context.Context, id string) (*deadletter.Letter, error) {
+	if id != m.letter.ID {
+		return nil, deadletter.ErrLetterNotFound
+	}
+	return m.letter, nil
+}
+
+func (m *mockDeadLetterAdmin) Edit(ctx context.Context, id,
+	data string) (*deadletter.Letter, error) {
+	letter, err := m.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	letter.Data = data
+	return letter, nil
+}
+
+func (m *mockDeadLetterAdmin) Replay(ctx context.Context, id string) error {
+	if _, err := m.Get(ctx, id); err != nil {
+		return err
+	}
+	return m.replayErr
+}
+
+func (m *mockDeadLetterAdmin) Discard(ctx context.Context, id string) error {
+	_, err := m.Get(ctx, id)
+	return err
+}
+
+func newMockDeadLetterAdmin() *mockDeadLetterAdmin {
+	return &mockDeadLetterAdmin{letter: &deadletter.Letter{
+		ID:       "letter-id",
+		Subject:  "posts",
+		Data:     `{"name":"create_post"}`,
+		Reason:   "handler_error",
+		Error:    "boom",
+		Attempts: 5,
+	}}
+}
+
+func serveDeadLetter(handler http.HandlerFunc, method, route string,
+	body string) *http.Response {
+	req := httptest.NewRequest(method, route, strings.NewReader(body))
+	w := httptest.NewRecorder()
+	handler(w, req)
+	return w.Result()
+}
+
+func TestDeadLetters(t *testing.T) {
+	t.Parallel()
+
+	notFound, _ := json.Marshal(httpx.APIError{
+		Error: httpx.DetailError{
+			Code:    httpx.DeadLetterNotFoundErrorCode,
+			Message: httpx.DeadLetterNotFoundErrorMsg,
+		},
+	})
+
+	t.Run("ListDeadLetters", func(t *testing.T) {
+		admin := newMockDeadLetterAdmin()
+		server := httpx.NewDeadLettersServer(admin)
+		expected, _ := json.Marshal([]*deadletter.Letter{admin.letter})
+		checkHandler(
+			t, "/admin/dead-letters?subject=posts&page=2&page_size=5",
+			server.ListDeadLetters, http.StatusOK, expected,
+		)
+		expectedFilter := deadletter.Filter{Subject: "posts", Limit: 5, Offset: 10}
+		require.Equal(t, expectedFilter, admin.filter)
+	})
+
+	t.Run("GetDeadLetter", func(t *testing.T) {
+		admin := newMockDeadLetterAdmin()
+		server := httpx.NewDeadLettersServer(admin)
+		expected, _ := json.Marshal(admin.letter)
+		checkHandler(
+			t, "/admin/dead-letters/letter-id", server.GetDeadLetter, http.StatusOK, expected,
+		)
+	})
+
+	t.Run("GetDeadLetter not found, NotFound", func(t *testing.T) {
+		server := httpx.NewDeadLettersServer(newMockDeadLetterAdmin())
+		checkHandler(
+			t, "/admin/dead-letters/missing", server.GetDeadLetter, http.StatusNotFound, notFound,
+		)
+	})
+
+	t.Run("EditDeadLetter", func(t *testing.T) {
+		admin := newMockDeadLetterAdmin()
+		server := httpx.NewDeadLettersServer(admin)
+		resp := serveDeadLetter(
+			server.EditDeadLetter, http.MethodPatch, "/admin/dead-letters/letter-id",
+			`{"data": "{\"name\":\"create_post\",\"data\":{}}"}`,
+		)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		require.Equal(t, `{"name":"create_post","data":{}}`, admin.letter.Data)
+	})
+
+	t.Run("EditDeadLetter malformed body, BadRequest", func(t *testing.T) {
+		server := httpx.NewDeadLettersServer(newMockDeadLetterAdmin())
+		resp := serveDeadLetter(
+			server.EditDeadLetter, http.MethodPatch, "/admin/dead-letters/letter-id",
+			`{"data": 1}`,
+		)
+		require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	})
+
+	t.Run("ReplayDeadLetter", func(t *testing.T) {
+		server := httpx.NewDeadLettersServer(newMockDeadLetterAdmin())
+		resp := serveDeadLetter(
+			server.ReplayDeadLetter, http.MethodPost, "/admin/dead-letters/letter-id/replay", "",
+		)
+		require.Equal(t, http.StatusNoContent, resp.StatusCode)
+	})
+
+	t.Run("ReplayDeadLetter failed, UnprocessableEntity", func(t *testing.T) {
+		admin := newMockDeadLetterAdmin()
+		admin.replayErr = fmt.Errorf("%w: %v", deadletter.ErrReplay, errors.New("boom"))
+		server := httpx.NewDeadLettersServer(admin)
+		resp := serveDeadLetter(
+			server.ReplayDeadLetter, http.MethodPost, "/admin/dead-letters/letter-id/replay", "",
+		)
+		require.Equal(t, http.StatusUnprocessableEntity, resp.StatusCode)
+		body, err := ioutil.ReadAll(resp.Body)
+		require.NoError(t, err)
+		expected, _ := json.Marshal(httpx.APIError{
+			Error: httpx.DetailError{
+				Code:    httpx.ReplayFailedErrorCode,
+				Message: admin.replayErr.Error(),
+			},
+		})
+		require.Equal(t, expected, body)
+	})
+
+	t.Run("DiscardDeadLetter", func(t *testing.T) {
+		server := httpx.NewDeadLettersServer(newMockDeadLetterAdmin())
+		resp := serveDeadLetter(
+			server.DiscardDeadLetter, http.MethodDelete, "/admin/dead-letters/letter-id", "",
+		)
+		require.Equal(t, http.StatusNoContent, resp.StatusCode)
+		resp = serveDeadLetter(
+			server.DiscardDeadLetter, http.MethodDelete, "/admin/dead-letters/missing", "",
+		)
+		require.Equal(t, http.StatusNotFound, resp.StatusCode)
+	})
+}
+
+func TestAdminToken(t *testing.T) {
+	t.Parallel()
+
+	handler := httpx.AdminToken("secret")(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+	for _, tc := range []struct {
+		name          string
+		authorization string
+		expStatusCode int
+	}{
+		{"Valid token", "Bearer secret", http.StatusNoContent},
+		{"Wrong token, Unauthorized", "Bearer wrong", http.StatusUnauthorized},
+		{"Missing token, Unauthorized", "", http.StatusUnauthorized},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/admin/dead-letters", nil)
+			if tc.authorization != "" {
+				req.Header.Set("Authorization", tc.authorization)
+			}
+			w := httptest.NewRecorder()
+			handler(w, req)
+			require.Equal(t, tc.expStatusCode, w.Result().StatusCode)
+		})
+	}
+}
@@ -0,0 +1,30 @@
+package httpx
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/mountolive/back-blog-go/post/eventbus"
+)
+
+// DeprecationsServer reports the events of old versions still arriving,
+// for publishers to be moved to the latest ones before dropping them
+type DeprecationsServer struct {
+	report func() []eventbus.VersionUsage
+}
+
+// NewDeprecationsServer is a constructor, report is usually
+// an EventBus' DeprecationReport
+func NewDeprecationsServer(report func() []eventbus.VersionUsage) DeprecationsServer {
+	return DeprecationsServer{report}
+}
+
+// GetDeprecations returns the usage of the events' old versions
+func (d DeprecationsServer) GetDeprecations(w http.ResponseWriter, r *http.Request) {
+	body, err := json.Marshal(d.report())
+	if err != nil {
+		writeError(w, newMarshalingError(err))
+		return
+	}
+	writeResponse(w, http.StatusOK, body)
+}
@@ -0,0 +1,25 @@
+package httpx_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/mountolive/back-blog-go/post/eventbus"
+	"github.com/mountolive/back-blog-go/post/httpx"
+)
+
+func TestDeprecations(t *testing.T) {
+	t.Parallel()
+
+	report := []eventbus.VersionUsage{{
+		Event:    "posts.v1.create",
+		Latest:   "posts.v2.create",
+		Count:    3,
+		LastSeen: time.Date(2021, 6, 1, 10, 0, 0, 0, time.UTC),
+	}}
+	server := httpx.NewDeprecationsServer(func() []eventbus.VersionUsage { return report })
+	expected, _ := json.Marshal(report)
+	checkHandler(t, "/events/deprecations", server.GetDeprecations, http.StatusOK, expected)
+}
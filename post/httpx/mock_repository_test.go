@@ -23,6 +23,12 @@ var _ usecase.Repository = &RepositoryMock{}
 // 			CreatePostFunc: func(contextMoqParam context.Context, createPostDto *usecase.CreatePostDto) (*usecase.Post, error) {
 // 				panic("mock out the CreatePost method")
 // 			},
+// 			DeletePostFunc: func(contextMoqParam context.Context, deletePostDto *usecase.DeletePostDto) (*usecase.Post, error) {
+// 				panic("mock out the DeletePost method")
+// 			},
+// 			FilterByAuthorFunc: func(ctx context.Context, filter *usecase.ByAuthorDto, page int, pageSize int) ([]*usecase.Post, error) {
+// 				panic("mock out the FilterByAuthor method")
+// 			},
 // 			FilterByDateRangeFunc: func(ctx context.Context, filter *usecase.ByDateRangeDto, page int, pageSize int) ([]*usecase.Post, error) {
 // 				panic("mock out the FilterByDateRange method")
 // 			},
@@ -45,6 +51,12 @@ type RepositoryMock struct {
 	// CreatePostFunc mocks the CreatePost method.
 	CreatePostFunc func(contextMoqParam context.Context, createPostDto *usecase.CreatePostDto) (*usecase.Post, error)
 
+	// DeletePostFunc mocks the DeletePost method.
+	DeletePostFunc func(contextMoqParam context.Context, deletePostDto *usecase.DeletePostDto) (*usecase.Post, error)
+
+	// FilterByAuthorFunc mocks the FilterByAuthor method.
+	FilterByAuthorFunc func(ctx context.Context, filter *usecase.ByAuthorDto, page int, pageSize int) ([]*usecase.Post, error)
+
 	// FilterByDateRangeFunc mocks the FilterByDateRange method.
 	FilterByDateRangeFunc func(ctx context.Context, filter *usecase.ByDateRangeDto, page int, pageSize int) ([]*usecase.Post, error)
 
@@ -66,6 +78,24 @@ type RepositoryMock struct {
 			// CreatePostDto is the createPostDto argument value.
 			CreatePostDto *usecase.CreatePostDto
 		}
+		// DeletePost holds details about calls to the DeletePost method.
+		DeletePost []struct {
+			// ContextMoqParam is the contextMoqParam argument value.
+			ContextMoqParam context.Context
+			// DeletePostDto is the deletePostDto argument value.
+			DeletePostDto *usecase.DeletePostDto
+		}
+		// FilterByAuthor holds details about calls to the FilterByAuthor method.
+		FilterByAuthor []struct {
+			// Ctx is the ctx argument value.
+			Ctx context.Context
+			// Filter is the filter argument value.
+			Filter *usecase.ByAuthorDto
+			// Page is the page argument value.
+			Page int
+			// PageSize is the pageSize argument value.
+			PageSize int
+		}
 		// FilterByDateRange holds details about calls to the FilterByDateRange method.
 		FilterByDateRange []struct {
 			// Ctx is the ctx argument value.
@@ -104,6 +134,8 @@ type RepositoryMock struct {
 		}
 	}
 	lockCreatePost        sync.RWMutex
+	lockDeletePost        sync.RWMutex
+	lockFilterByAuthor    sync.RWMutex
 	lockFilterByDateRange sync.RWMutex
 	lockFilterByTag       sync.RWMutex
 	lockGetPost           sync.RWMutex
@@ -145,6 +177,84 @@ func (mock *RepositoryMock) CreatePostCalls() []struct {
 	return calls
 }
 
+// DeletePost calls DeletePostFunc.
+func (mock *RepositoryMock) DeletePost(contextMoqParam context.Context, deletePostDto *usecase.DeletePostDto) (*usecase.Post, error) {
+	if mock.DeletePostFunc == nil {
+		panic("RepositoryMock.DeletePostFunc: method is nil but Repository.DeletePost was just called")
+	}
+	callInfo := struct {
+		ContextMoqParam context.Context
+		DeletePostDto   *usecase.DeletePostDto
+	}{
+		ContextMoqParam: contextMoqParam,
+		DeletePostDto:   deletePostDto,
+	}
+	mock.lockDeletePost.Lock()
+	mock.calls.DeletePost = append(mock.calls.DeletePost, callInfo)
+	mock.lockDeletePost.Unlock()
+	return mock.DeletePostFunc(contextMoqParam, deletePostDto)
+}
+
+// DeletePostCalls gets all the calls that were made to DeletePost.
+// Check the length with:
+//     len(mockedRepository.DeletePostCalls())
+func (mock *RepositoryMock) DeletePostCalls() []struct {
+	ContextMoqParam context.Context
+	DeletePostDto   *usecase.DeletePostDto
+} {
+	var calls []struct {
+		ContextMoqParam context.Context
+		DeletePostDto   *usecase.DeletePostDto
+	}
+	mock.lockDeletePost.RLock()
+	calls = mock.calls.DeletePost
+	mock.lockDeletePost.RUnlock()
+	return calls
+}
+
+// FilterByAuthor calls FilterByAuthorFunc.
+func (mock *RepositoryMock) FilterByAuthor(ctx context.Context, filter *usecase.ByAuthorDto, page int, pageSize int) ([]*usecase.Post, error) {
+	if mock.FilterByAuthorFunc == nil {
+		panic("RepositoryMock.FilterByAuthorFunc: method is nil but Repository.FilterByAuthor was just called")
+	}
+	callInfo := struct {
+		Ctx      context.Context
+		Filter   *usecase.ByAuthorDto
+		Page     int
+		PageSize int
+	}{
+		Ctx:      ctx,
+		Filter:   filter,
+		Page:     page,
+		PageSize: pageSize,
+	}
+	mock.lockFilterByAuthor.Lock()
+	mock.calls.FilterByAuthor = append(mock.calls.FilterByAuthor, callInfo)
+	mock.lockFilterByAuthor.Unlock()
+	return mock.FilterByAuthorFunc(ctx, filter, page, pageSize)
+}
+
+// FilterByAuthorCalls gets all the calls that were made to FilterByAuthor.
+// Check the length with:
+//     len(mockedRepository.FilterByAuthorCalls())
+func (mock *RepositoryMock) FilterByAuthorCalls() []struct {
+	Ctx      context.Context
+	Filter   *usecase.ByAuthorDto
+	Page     int
+	PageSize int
+} {
+	var calls []struct {
+		Ctx      context.Context
+		Filter   *usecase.ByAuthorDto
+		Page     int
+		PageSize int
+	}
+	mock.lockFilterByAuthor.RLock()
+	calls = mock.calls.FilterByAuthor
+	mock.lockFilterByAuthor.RUnlock()
+	return calls
+}
+
 // FilterByDateRange calls FilterByDateRangeFunc.
 func (mock *RepositoryMock) FilterByDateRange(ctx context.Context, filter *usecase.ByDateRangeDto, page int, pageSize int) ([]*usecase.Post, error) {
 	if mock.FilterByDateRangeFunc == nil {
@@ -0,0 +1,56 @@
+package httpx
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/mountolive/back-blog-go/post/eventbus"
+)
+
+// SchemaNotFoundErrorMsg is self-described
+const SchemaNotFoundErrorMsg = "no event registered with passed name"
+
+// SchemasServer publishes the JSON schemas of the events' data,
+// for publishers to validate the events before sending them
+type SchemasServer struct {
+	schemas map[string]eventbus.Schema
+}
+
+// NewSchemasServer is a constructor
+func NewSchemasServer(schemas map[string]eventbus.Schema) SchemasServer {
+	return SchemasServer{schemas}
+}
+
+// ListSchemas returns the schemas of every event, by name
+func (s SchemasServer) ListSchemas(w http.ResponseWriter, r *http.Request) {
+	body, err := json.Marshal(s.schemas)
+	if err != nil {
+		writeError(w, newMarshalingError(err))
+		return
+	}
+	writeResponse(w, http.StatusOK, body)
+}
+
+// GetSchema returns the schema of the event named by the last segment of the path
+func (s SchemasServer) GetSchema(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimSuffix(r.URL.Path, "/")
+	name := path[strings.LastIndex(path, "/")+1:]
+	schema, ok := s.schemas[name]
+	if !ok {
+		writeError(w, APIError{
+			HTTPCode: http.StatusNotFound,
+			Error: DetailError{
+				Code:    NotFoundErrorCode,
+				Message: SchemaNotFoundErrorMsg,
+			},
+		})
+		return
+	}
+	body, err := json.Marshal(schema)
+	if err != nil {
+		writeError(w, newMarshalingError(err))
+		return
+	}
+	writeResponse(w, http.StatusOK, body)
+}
@@ -0,0 +1,44 @@
+package httpx_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/mountolive/back-blog-go/post/eventbus"
+	"github.com/mountolive/back-blog-go/post/httpx"
+)
+
+func TestSchemas(t *testing.T) {
+	schemas := map[string]eventbus.Schema{
+		"posts.v1.create": {"$id": "posts.v1.create", "type": "object"},
+	}
+	server := httpx.NewSchemasServer(schemas)
+
+	t.Run("ListSchemas", func(t *testing.T) {
+		t.Parallel()
+		expected, _ := json.Marshal(schemas)
+		checkHandler(t, "/events/schemas", server.ListSchemas, http.StatusOK, expected)
+	})
+
+	t.Run("GetSchema", func(t *testing.T) {
+		t.Parallel()
+		expected, _ := json.Marshal(schemas["posts.v1.create"])
+		checkHandler(
+			t, "/events/schemas/posts.v1.create", server.GetSchema, http.StatusOK, expected,
+		)
+	})
+
+	t.Run("GetSchema not found", func(t *testing.T) {
+		t.Parallel()
+		expected, _ := json.Marshal(httpx.APIError{
+			Error: httpx.DetailError{
+				Code:    httpx.NotFoundErrorCode,
+				Message: httpx.SchemaNotFoundErrorMsg,
+			},
+		})
+		checkHandler(
+			t, "/events/schemas/posts.v1.delete", server.GetSchema, http.StatusNotFound, expected,
+		)
+	})
+}
@@ -1,14 +1,18 @@
 package httpx
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io/ioutil"
 	"net/http"
 	"net/url"
 	"strconv"
 	"strings"
 	"time"
 
+	"github.com/mountolive/back-blog-go/post/identity"
 	"github.com/mountolive/back-blog-go/post/usecase"
 )
 
@@ -25,12 +29,33 @@ const (
 	MarshalingErrorCode             = 500
 	TimeParsingErrorCode            = 600
 	EndTimeBeforeStartTimeErrorCode = 700
+	VersionConflictErrorCode        = 800
+	MissingVersionErrorCode         = 900
+	MalformedBodyErrorCode          = 1000
+	InvalidUpdateErrorCode          = 1100
+	ForbiddenErrorCode              = 1500
+	UntrustedActorErrorCode         = 1600
 
 	// standard error messages
 	MissingTagErrorMsg             = "tag parameter missing from query"
 	NotFoundErrorMsg               = "post with passed id not found"
 	MissingDateParametersErrorMsg  = "start_date and end_date parameters missing from query"
 	EndTimeBeforeStartTimeErrorMsg = "end_date can't be before start_date"
+	VersionConflictErrorMsg        = "post was modified after the version passed in If-Match"
+	MissingVersionErrorMsg         = "If-Match header with the post's ETag is required"
+	ForbiddenErrorMsg              = "only the post's creator, authors, editors and admins can change it"
+	UntrustedActorErrorMsg         = "X-Actor must be signed by the gateway"
+
+	// ActorHeader holds the login of the user making the request,
+	// set by the gateway once it's authenticated. It's only trusted along
+	// with ActorSignatureHeader, see TrustedActor
+	ActorHeader = "X-Actor"
+	// ActorTimestampHeader holds the time the actor was signed at, in unix seconds
+	ActorTimestampHeader = "X-Actor-Timestamp"
+	// ActorSignatureHeader holds the signature of the actor, bound to the
+	// timestamp, and the request's method, path and body's digest
+	// (see identity.Sign and identity.Digest)
+	ActorSignatureHeader = "X-Actor-Signature"
 )
 
 // Server contains all http handlers
@@ -43,6 +68,40 @@ func NewServer(repo usecase.Repository) Server {
 	return Server{repo}
 }
 
+// TrustedActor only lets through the requests whose ActorHeader was
+// signed by the gateway, no longer than the verifier's max skew ago
+func TrustedActor(verifier *identity.Verifier) Middleware {
+	return func(handler http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			body, err := ioutil.ReadAll(r.Body)
+			if err != nil {
+				writeError(w, newMalformedBodyError(err))
+				return
+			}
+			r.Body = ioutil.NopCloser(bytes.NewReader(body))
+			err = verifier.VerifyTimestamped(
+				r.Header.Get(ActorHeader),
+				r.Header.Get(ActorSignatureHeader),
+				r.Header.Get(ActorTimestampHeader),
+				r.Method,
+				r.URL.Path,
+				identity.Digest(body),
+			)
+			if err != nil {
+				writeError(w, APIError{
+					HTTPCode: http.StatusUnauthorized,
+					Error: DetailError{
+						Code:    UntrustedActorErrorCode,
+						Message: UntrustedActorErrorMsg,
+					},
+				})
+				return
+			}
+			handler(w, r)
+		}
+	}
+}
+
 // APIError wraps the details of any error happened downstream to the http handler
 type APIError struct {
 	Error    DetailError `json:"error"`
@@ -75,6 +134,56 @@ func newEndTimeBeforeStartTimeError() APIError {
 	}
 }
 
+func newVersionConflictError() APIError {
+	return APIError{
+		HTTPCode: http.StatusConflict,
+		Error: DetailError{
+			Code:    VersionConflictErrorCode,
+			Message: VersionConflictErrorMsg,
+		},
+	}
+}
+
+func newMissingVersionError() APIError {
+	return APIError{
+		HTTPCode: http.StatusPreconditionRequired,
+		Error: DetailError{
+			Code:    MissingVersionErrorCode,
+			Message: MissingVersionErrorMsg,
+		},
+	}
+}
+
+func newForbiddenError() APIError {
+	return APIError{
+		HTTPCode: http.StatusForbidden,
+		Error: DetailError{
+			Code:    ForbiddenErrorCode,
+			Message: ForbiddenErrorMsg,
+		},
+	}
+}
+
+func newMalformedBodyError(err error) APIError {
+	return APIError{
+		HTTPCode: http.StatusBadRequest,
+		Error: DetailError{
+			Code:    MalformedBodyErrorCode,
+			Message: err.Error(),
+		},
+	}
+}
+
+func newInvalidUpdateError(err error) APIError {
+	return APIError{
+		HTTPCode: http.StatusBadRequest,
+		Error: DetailError{
+			Code:    InvalidUpdateErrorCode,
+			Message: err.Error(),
+		},
+	}
+}
+
 func newInternalServerError(code int, err error) APIError {
 	return APIError{
 		HTTPCode: http.StatusInternalServerError,
@@ -97,7 +206,7 @@ func newTimeParsingError(err error) APIError {
 	return newInternalServerError(TimeParsingErrorCode, err)
 }
 
-// Filter wraps both FilterByTag and FilterByDateRange
+// Filter wraps FilterByTag, FilterByAuthor and FilterByDateRange
 func (s Server) Filter(w http.ResponseWriter, r *http.Request) {
 	query := r.URL.Query()
 	tag := query.Get("tag")
@@ -105,9 +214,35 @@ func (s Server) Filter(w http.ResponseWriter, r *http.Request) {
 		s.FilterByTag(w, r)
 		return
 	}
+	if query.Get("author") != "" {
+		s.FilterByAuthor(w, r)
+		return
+	}
 	s.FilterByDateRange(w, r)
 }
 
+// FilterByAuthor filters posts by one of their authors' login
+func (s Server) FilterByAuthor(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	page, pageSize := calculatePageAndPageSize(query)
+	posts, err := s.repo.FilterByAuthor(
+		r.Context(),
+		&usecase.ByAuthorDto{Author: query.Get("author")},
+		page,
+		pageSize,
+	)
+	if err != nil {
+		writeError(w, newRepositoryError(err))
+		return
+	}
+	body, err := json.Marshal(posts)
+	if err != nil {
+		writeError(w, newMarshalingError(err))
+		return
+	}
+	writeResponse(w, http.StatusOK, body)
+}
+
 // FilterByTag filters posts by tag
 func (s Server) FilterByTag(w http.ResponseWriter, r *http.Request) {
 	query := r.URL.Query()
@@ -203,18 +338,18 @@ func calculatePageAndPageSize(query url.Values) (int, int) {
 }
 
 // Retrieves the details of a a single post
+// The ETag header of the response holds the version of the post
 func (s Server) GetPost(w http.ResponseWriter, r *http.Request) {
-	url := r.URL.RequestURI()
-	if len(url) > 0 && string(url[0]) == "/" {
-		url = url[1:]
-	}
-	splittedPath := strings.Split(url, "/")
-	if len(splittedPath) != 2 {
+	id, ok := postID(r)
+	if !ok {
 		writeError(w, newNotFoundError())
 		return
 	}
-	id := splittedPath[1]
 	post, err := s.repo.GetPost(r.Context(), id)
+	if errors.Is(err, usecase.ErrPostNotFound) {
+		writeError(w, newNotFoundError())
+		return
+	}
 	if err != nil {
 		writeError(w, newRepositoryError(err))
 		return
@@ -228,9 +363,211 @@ func (s Server) GetPost(w http.ResponseWriter, r *http.Request) {
 		writeError(w, newMarshalingError(err))
 		return
 	}
+	w.Header().Set("ETag", etag(post.Version))
+	writeResponse(w, http.StatusOK, body)
+}
+
+// AuthorRequest is an author of a post, as passed in the requests' body
+type AuthorRequest struct {
+	Login string `json:"login"`
+	Role  string `json:"role"`
+}
+
+// UpdatePostRequest is the body expected by UpdatePost
+type UpdatePostRequest struct {
+	Title   string          `json:"title"`
+	Content string          `json:"content"`
+	Tags    []string        `json:"tags"`
+	Authors []AuthorRequest `json:"authors"`
+}
+
+// Updates a single post, replacing all of its fields
+// The If-Match header should hold the ETag of the post the update is based on
+func (s Server) UpdatePost(w http.ResponseWriter, r *http.Request) {
+	s.updatePost(w, r, func(id string, version int) (*usecase.UpdatePostDto, error) {
+		var request UpdatePostRequest
+		err := json.NewDecoder(r.Body).Decode(&request)
+		if err != nil {
+			return nil, err
+		}
+		return &usecase.UpdatePostDto{
+			Id:      id,
+			Version: version,
+			Title:   &request.Title,
+			Content: &request.Content,
+			Tags:    request.Tags,
+			Authors: toAuthors(request.Authors),
+		}, nil
+	})
+}
+
+// PatchPostRequest is the body expected by PatchPost, absent fields are left untouched
+type PatchPostRequest struct {
+	Title      *string         `json:"title"`
+	Content    *string         `json:"content"`
+	Tags       []string        `json:"tags"`
+	AddTags    []string        `json:"add_tags"`
+	RemoveTags []string        `json:"remove_tags"`
+	Authors    []AuthorRequest `json:"authors"`
+}
+
+// Partially updates a single post
+// The If-Match header should hold the ETag of the post the update is based on
+func (s Server) PatchPost(w http.ResponseWriter, r *http.Request) {
+	s.updatePost(w, r, func(id string, version int) (*usecase.UpdatePostDto, error) {
+		var request PatchPostRequest
+		err := json.NewDecoder(r.Body).Decode(&request)
+		if err != nil {
+			return nil, err
+		}
+		return &usecase.UpdatePostDto{
+			Id:         id,
+			Version:    version,
+			Title:      request.Title,
+			Content:    request.Content,
+			Tags:       request.Tags,
+			AddTags:    request.AddTags,
+			RemoveTags: request.RemoveTags,
+			Authors:    toAuthors(request.Authors),
+		}, nil
+	})
+}
+
+// Deletes a single post, returning it as it was before deletion
+// The If-Match header should hold the ETag of the post the deletion is based on
+func (s Server) DeletePost(w http.ResponseWriter, r *http.Request) {
+	id, ok := postID(r)
+	if !ok {
+		writeError(w, newNotFoundError())
+		return
+	}
+	version, ok := parseETag(r.Header.Get("If-Match"))
+	if !ok {
+		writeError(w, newMissingVersionError())
+		return
+	}
+	post, err := s.repo.DeletePost(r.Context(), &usecase.DeletePostDto{
+		Id:      id,
+		Actor:   r.Header.Get(ActorHeader),
+		Version: version,
+	})
+	switch {
+	case errors.Is(err, usecase.ErrVersionConflict):
+		writeError(w, newVersionConflictError())
+		return
+	case errors.Is(err, usecase.ErrPostNotFound):
+		writeError(w, newNotFoundError())
+		return
+	case errors.Is(err, usecase.ErrForbidden):
+		writeError(w, newForbiddenError())
+		return
+	case err != nil:
+		writeError(w, newRepositoryError(err))
+		return
+	}
+	body, err := json.Marshal(post)
+	if err != nil {
+		writeError(w, newMarshalingError(err))
+		return
+	}
+	writeResponse(w, http.StatusOK, body)
+}
+
+// updatePost holds the logic shared by UpdatePost and PatchPost,
+// decode builds the update out of the request's body
+func (s Server) updatePost(
+	w http.ResponseWriter,
+	r *http.Request,
+	decode func(id string, version int) (*usecase.UpdatePostDto, error),
+) {
+	id, ok := postID(r)
+	if !ok {
+		writeError(w, newNotFoundError())
+		return
+	}
+	version, ok := parseETag(r.Header.Get("If-Match"))
+	if !ok {
+		writeError(w, newMissingVersionError())
+		return
+	}
+	update, err := decode(id, version)
+	if err != nil {
+		writeError(w, newMalformedBodyError(err))
+		return
+	}
+	update.Actor = r.Header.Get(ActorHeader)
+	post, err := s.repo.UpdatePost(r.Context(), update)
+	switch {
+	case errors.Is(err, usecase.ErrVersionConflict):
+		writeError(w, newVersionConflictError())
+		return
+	case errors.Is(err, usecase.ErrPostNotFound):
+		writeError(w, newNotFoundError())
+		return
+	case errors.Is(err, usecase.ErrForbidden):
+		writeError(w, newForbiddenError())
+		return
+	case errors.Is(err, usecase.ErrNothingToUpdate),
+		errors.Is(err, usecase.ErrConflictingTagsUpdate),
+		errors.Is(err, usecase.ErrEmptyTags),
+		errors.Is(err, usecase.ErrInvalidAuthorRole),
+		errors.Is(err, usecase.ErrDuplicatedAuthor),
+		errors.Is(err, usecase.ErrEmptyAuthors),
+		errors.Is(err, usecase.ErrUserNotFound):
+		writeError(w, newInvalidUpdateError(err))
+		return
+	case err != nil:
+		writeError(w, newRepositoryError(err))
+		return
+	}
+	body, err := json.Marshal(post)
+	if err != nil {
+		writeError(w, newMarshalingError(err))
+		return
+	}
+	w.Header().Set("ETag", etag(post.Version))
 	writeResponse(w, http.StatusOK, body)
 }
 
+// toAuthors keeps nil as nil, meaning that no authors were passed
+func toAuthors(requests []AuthorRequest) []usecase.Author {
+	if requests == nil {
+		return nil
+	}
+	authors := make([]usecase.Author, 0, len(requests))
+	for _, request := range requests {
+		authors = append(authors, usecase.Author{Login: request.Login, Role: request.Role})
+	}
+	return authors
+}
+
+// postID extracts the id of a post from a path of the form `/posts/{id}`
+func postID(r *http.Request) (string, bool) {
+	url := r.URL.RequestURI()
+	if len(url) > 0 && string(url[0]) == "/" {
+		url = url[1:]
+	}
+	splittedPath := strings.Split(url, "/")
+	if len(splittedPath) != 2 {
+		return "", false
+	}
+	return splittedPath[1], true
+}
+
+func etag(version int) string {
+	return fmt.Sprintf(`"%d"`, version)
+}
+
+// parseETag returns the version held by an ETag, weak or strong
+func parseETag(raw string) (int, bool) {
+	raw = strings.TrimPrefix(strings.TrimSpace(raw), "W/")
+	version, err := strconv.Atoi(strings.Trim(raw, `"`))
+	if err != nil || version <= 0 {
+		return 0, false
+	}
+	return version, true
+}
+
 func writeError(w http.ResponseWriter, apiError APIError) {
 	body, _ := json.Marshal(apiError)
 	writeResponse(w, apiError.HTTPCode, body)
@@ -4,12 +4,17 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/mountolive/back-blog-go/post/httpx"
+	"github.com/mountolive/back-blog-go/post/identity"
 	"github.com/mountolive/back-blog-go/post/usecase"
 	"github.com/stretchr/testify/require"
 )
@@ -209,6 +214,42 @@ func TestFilterByDateRange(t *testing.T) {
 	})
 }
 
+func TestFilterByAuthor(t *testing.T) {
+	t.Parallel()
+
+	expectedPosts := []*usecase.Post{
+		{
+			Id:      "some-id",
+			Creator: "some creator",
+			Authors: []usecase.Author{
+				{Login: "some creator", Role: usecase.AuthorRoleAuthor, DisplayName: "Some Creator"},
+				{Login: "coauthor", Role: usecase.AuthorRoleContributor},
+			},
+		},
+	}
+	serializedBody, err := json.Marshal(expectedPosts)
+	require.NoError(t, err)
+
+	t.Run("Correct, OK", func(t *testing.T) {
+		repo := &RepositoryMock{
+			FilterByAuthorFunc: func(_ context.Context, filter *usecase.ByAuthorDto, page, pageSize int) ([]*usecase.Post, error) {
+				require.Equal(t, "coauthor", filter.Author)
+				require.Equal(t, 1, page)
+				return expectedPosts, nil
+			},
+		}
+		server := httpx.NewServer(repo)
+		checkHandler(
+			t,
+			"/posts?author=coauthor&page=1",
+			server.Filter,
+			http.StatusOK,
+			serializedBody,
+		)
+		require.Len(t, repo.FilterByAuthorCalls(), 1)
+	})
+}
+
 func TestGetOne(t *testing.T) {
 	t.Parallel()
 
@@ -263,6 +304,31 @@ func TestGetOne(t *testing.T) {
 		)
 	})
 
+	t.Run("Store's Post Not Found, NotFound", func(t *testing.T) {
+		repo := &RepositoryMock{
+			GetPostFunc: func(context.Context, string) (*usecase.Post, error) {
+				return nil, fmt.Errorf("get post: %w", usecase.ErrPostNotFound)
+			},
+		}
+		server := httpx.NewServer(repo)
+		expectedErr := httpx.APIError{
+			HTTPCode: 404,
+			Error: httpx.DetailError{
+				Code:    300,
+				Message: "post with passed id not found",
+			},
+		}
+		serializedErr, err := json.Marshal(expectedErr)
+		require.NoError(t, err)
+		checkHandler(
+			t,
+			"/someroute/not-found-id",
+			server.GetPost,
+			http.StatusNotFound,
+			serializedErr,
+		)
+	})
+
 	t.Run("Correct, OK", func(t *testing.T) {
 		expectedPost := &usecase.Post{
 			Id:      "some-id",
@@ -286,3 +352,402 @@ func TestGetOne(t *testing.T) {
 		)
 	})
 }
+
+func TestUpdatePost(t *testing.T) {
+	t.Parallel()
+
+	checkUpdate := func(
+		t *testing.T,
+		server httpx.Server,
+		ifMatch string,
+		body string,
+		expStatusCode int,
+		expectedBody []byte,
+	) *http.Response {
+		req := httptest.NewRequest(
+			http.MethodPut, "/posts/some-id", strings.NewReader(body),
+		)
+		if ifMatch != "" {
+			req.Header.Set("If-Match", ifMatch)
+		}
+		req.Header.Set(httpx.ActorHeader, "some-actor")
+		w := httptest.NewRecorder()
+		server.UpdatePost(w, req)
+		resp := w.Result()
+		require.Equal(t, expStatusCode, resp.StatusCode)
+		respBody, err := ioutil.ReadAll(resp.Body)
+		require.NoError(t, err)
+		require.Equal(t, expectedBody, respBody)
+		return resp
+	}
+	correctBody := `{"title": "title", "content": "content", "tags": ["tag1"]}`
+
+	t.Run("Missing If-Match, PreconditionRequired", func(t *testing.T) {
+		server := httpx.NewServer(&RepositoryMock{})
+		expectedErr := httpx.APIError{
+			HTTPCode: 428,
+			Error: httpx.DetailError{
+				Code:    900,
+				Message: httpx.MissingVersionErrorMsg,
+			},
+		}
+		serializedErr, err := json.Marshal(expectedErr)
+		require.NoError(t, err)
+		checkUpdate(
+			t, server, "", correctBody,
+			http.StatusPreconditionRequired, serializedErr,
+		)
+	})
+
+	t.Run("Version conflict, Conflict", func(t *testing.T) {
+		repo := &RepositoryMock{
+			UpdatePostFunc: func(context.Context, *usecase.UpdatePostDto) (*usecase.Post, error) {
+				return nil, fmt.Errorf("update: %w", usecase.ErrVersionConflict)
+			},
+		}
+		server := httpx.NewServer(repo)
+		expectedErr := httpx.APIError{
+			HTTPCode: 409,
+			Error: httpx.DetailError{
+				Code:    800,
+				Message: httpx.VersionConflictErrorMsg,
+			},
+		}
+		serializedErr, err := json.Marshal(expectedErr)
+		require.NoError(t, err)
+		checkUpdate(
+			t, server, `"1"`, correctBody,
+			http.StatusConflict, serializedErr,
+		)
+	})
+
+	t.Run("Unexistent Post, NotFound", func(t *testing.T) {
+		repo := &RepositoryMock{
+			UpdatePostFunc: func(context.Context, *usecase.UpdatePostDto) (*usecase.Post, error) {
+				return nil, fmt.Errorf("update: %w", usecase.ErrPostNotFound)
+			},
+		}
+		server := httpx.NewServer(repo)
+		expectedErr := httpx.APIError{
+			HTTPCode: 404,
+			Error: httpx.DetailError{
+				Code:    300,
+				Message: httpx.NotFoundErrorMsg,
+			},
+		}
+		serializedErr, err := json.Marshal(expectedErr)
+		require.NoError(t, err)
+		checkUpdate(
+			t, server, `"1"`, correctBody,
+			http.StatusNotFound, serializedErr,
+		)
+	})
+
+	t.Run("Not allowed actor, Forbidden", func(t *testing.T) {
+		repo := &RepositoryMock{
+			UpdatePostFunc: func(context.Context, *usecase.UpdatePostDto) (*usecase.Post, error) {
+				return nil, fmt.Errorf("update: %w", usecase.ErrForbidden)
+			},
+		}
+		serializedErr, err := json.Marshal(httpx.APIError{
+			Error: httpx.DetailError{
+				Code:    httpx.ForbiddenErrorCode,
+				Message: httpx.ForbiddenErrorMsg,
+			},
+		})
+		require.NoError(t, err)
+		checkUpdate(
+			t, httpx.NewServer(repo), `"1"`, correctBody,
+			http.StatusForbidden, serializedErr,
+		)
+	})
+
+	t.Run("Correct, OK", func(t *testing.T) {
+		expectedPost := &usecase.Post{
+			Id:      "some-id",
+			Title:   "title",
+			Content: "content",
+			Tags:    []string{"tag1"},
+			Version: 3,
+		}
+		repo := &RepositoryMock{
+			UpdatePostFunc: func(_ context.Context, dto *usecase.UpdatePostDto) (*usecase.Post, error) {
+				require.Equal(t, "some-id", dto.Id)
+				require.Equal(t, "some-actor", dto.Actor)
+				require.Equal(t, 2, dto.Version)
+				require.Equal(t, expectedPost.Tags, dto.Tags)
+				return expectedPost, nil
+			},
+		}
+		server := httpx.NewServer(repo)
+		serializedBody, err := json.Marshal(expectedPost)
+		require.NoError(t, err)
+		resp := checkUpdate(
+			t, server, `W/"2"`, correctBody,
+			http.StatusOK, serializedBody,
+		)
+		require.Equal(t, `"3"`, resp.Header.Get("ETag"))
+	})
+}
+
+func TestPatchPost(t *testing.T) {
+	t.Parallel()
+
+	checkPatch := func(
+		t *testing.T,
+		server httpx.Server,
+		body string,
+		expStatusCode int,
+		expectedBody []byte,
+	) {
+		req := httptest.NewRequest(
+			http.MethodPatch, "/posts/some-id", strings.NewReader(body),
+		)
+		req.Header.Set("If-Match", `"2"`)
+		w := httptest.NewRecorder()
+		server.PatchPost(w, req)
+		resp := w.Result()
+		require.Equal(t, expStatusCode, resp.StatusCode)
+		respBody, err := ioutil.ReadAll(resp.Body)
+		require.NoError(t, err)
+		require.Equal(t, expectedBody, respBody)
+	}
+
+	t.Run("Malformed body, BadRequest", func(t *testing.T) {
+		server := httpx.NewServer(&RepositoryMock{})
+		req := httptest.NewRequest(
+			http.MethodPatch, "/posts/some-id", strings.NewReader(`{"title": 1}`),
+		)
+		req.Header.Set("If-Match", `"2"`)
+		w := httptest.NewRecorder()
+		server.PatchPost(w, req)
+		require.Equal(t, http.StatusBadRequest, w.Result().StatusCode)
+	})
+
+	t.Run("Nothing to update, BadRequest", func(t *testing.T) {
+		repo := &RepositoryMock{
+			UpdatePostFunc: func(context.Context, *usecase.UpdatePostDto) (*usecase.Post, error) {
+				return nil, fmt.Errorf("update: %w", usecase.ErrNothingToUpdate)
+			},
+		}
+		server := httpx.NewServer(repo)
+		expectedErr := httpx.APIError{
+			HTTPCode: 400,
+			Error: httpx.DetailError{
+				Code:    1100,
+				Message: fmt.Errorf("update: %w", usecase.ErrNothingToUpdate).Error(),
+			},
+		}
+		serializedErr, err := json.Marshal(expectedErr)
+		require.NoError(t, err)
+		checkPatch(t, server, `{}`, http.StatusBadRequest, serializedErr)
+	})
+
+	t.Run("Invalid author role, BadRequest", func(t *testing.T) {
+		repo := &RepositoryMock{
+			UpdatePostFunc: func(_ context.Context, dto *usecase.UpdatePostDto) (*usecase.Post, error) {
+				require.Equal(t, []usecase.Author{{Login: "kim", Role: "owner"}}, dto.Authors)
+				return nil, fmt.Errorf("update: %w", usecase.ErrInvalidAuthorRole)
+			},
+		}
+		server := httpx.NewServer(repo)
+		expectedErr := httpx.APIError{
+			HTTPCode: 400,
+			Error: httpx.DetailError{
+				Code:    1100,
+				Message: fmt.Errorf("update: %w", usecase.ErrInvalidAuthorRole).Error(),
+			},
+		}
+		serializedErr, err := json.Marshal(expectedErr)
+		require.NoError(t, err)
+		checkPatch(
+			t, server, `{"authors": [{"login": "kim", "role": "owner"}]}`,
+			http.StatusBadRequest, serializedErr,
+		)
+	})
+
+	t.Run("Correct, OK", func(t *testing.T) {
+		expectedPost := &usecase.Post{
+			Id:      "some-id",
+			Title:   "new title",
+			Content: "content",
+			Tags:    []string{"tag1", "tag2"},
+			Version: 3,
+		}
+		repo := &RepositoryMock{
+			UpdatePostFunc: func(_ context.Context, dto *usecase.UpdatePostDto) (*usecase.Post, error) {
+				require.Equal(t, "some-id", dto.Id)
+				require.Equal(t, 2, dto.Version)
+				require.Equal(t, "new title", *dto.Title)
+				require.Nil(t, dto.Content)
+				require.Nil(t, dto.Tags)
+				require.Equal(t, []string{"tag2"}, dto.AddTags)
+				return expectedPost, nil
+			},
+		}
+		server := httpx.NewServer(repo)
+		serializedBody, err := json.Marshal(expectedPost)
+		require.NoError(t, err)
+		checkPatch(
+			t, server, `{"title": "new title", "add_tags": ["tag2"]}`,
+			http.StatusOK, serializedBody,
+		)
+	})
+}
+
+func TestDeletePost(t *testing.T) {
+	t.Parallel()
+
+	checkDelete := func(
+		t *testing.T,
+		server httpx.Server,
+		ifMatch string,
+		expStatusCode int,
+		expectedBody []byte,
+	) {
+		req := httptest.NewRequest(http.MethodDelete, "/posts/some-id", nil)
+		if ifMatch != "" {
+			req.Header.Set("If-Match", ifMatch)
+		}
+		req.Header.Set(httpx.ActorHeader, "some-actor")
+		w := httptest.NewRecorder()
+		server.DeletePost(w, req)
+		resp := w.Result()
+		require.Equal(t, expStatusCode, resp.StatusCode)
+		respBody, err := ioutil.ReadAll(resp.Body)
+		require.NoError(t, err)
+		require.Equal(t, expectedBody, respBody)
+	}
+
+	t.Run("Missing If-Match, PreconditionRequired", func(t *testing.T) {
+		server := httpx.NewServer(&RepositoryMock{})
+		serializedErr, err := json.Marshal(httpx.APIError{
+			Error: httpx.DetailError{
+				Code:    httpx.MissingVersionErrorCode,
+				Message: httpx.MissingVersionErrorMsg,
+			},
+		})
+		require.NoError(t, err)
+		checkDelete(t, server, "", http.StatusPreconditionRequired, serializedErr)
+	})
+
+	t.Run("Version conflict, Conflict", func(t *testing.T) {
+		repo := &RepositoryMock{
+			DeletePostFunc: func(context.Context, *usecase.DeletePostDto) (*usecase.Post, error) {
+				return nil, fmt.Errorf("delete: %w", usecase.ErrVersionConflict)
+			},
+		}
+		serializedErr, err := json.Marshal(httpx.APIError{
+			Error: httpx.DetailError{
+				Code:    httpx.VersionConflictErrorCode,
+				Message: httpx.VersionConflictErrorMsg,
+			},
+		})
+		require.NoError(t, err)
+		checkDelete(t, httpx.NewServer(repo), `"1"`, http.StatusConflict, serializedErr)
+	})
+
+	t.Run("Unexistent Post, NotFound", func(t *testing.T) {
+		repo := &RepositoryMock{
+			DeletePostFunc: func(context.Context, *usecase.DeletePostDto) (*usecase.Post, error) {
+				return nil, fmt.Errorf("delete: %w", usecase.ErrPostNotFound)
+			},
+		}
+		serializedErr, err := json.Marshal(httpx.APIError{
+			Error: httpx.DetailError{
+				Code:    httpx.NotFoundErrorCode,
+				Message: httpx.NotFoundErrorMsg,
+			},
+		})
+		require.NoError(t, err)
+		checkDelete(t, httpx.NewServer(repo), `"1"`, http.StatusNotFound, serializedErr)
+	})
+
+	t.Run("Not allowed actor, Forbidden", func(t *testing.T) {
+		repo := &RepositoryMock{
+			DeletePostFunc: func(context.Context, *usecase.DeletePostDto) (*usecase.Post, error) {
+				return nil, fmt.Errorf("delete: %w", usecase.ErrForbidden)
+			},
+		}
+		serializedErr, err := json.Marshal(httpx.APIError{
+			Error: httpx.DetailError{
+				Code:    httpx.ForbiddenErrorCode,
+				Message: httpx.ForbiddenErrorMsg,
+			},
+		})
+		require.NoError(t, err)
+		checkDelete(t, httpx.NewServer(repo), `"1"`, http.StatusForbidden, serializedErr)
+	})
+
+	t.Run("Correct, OK", func(t *testing.T) {
+		deletedPost := &usecase.Post{
+			Id:      "some-id",
+			Title:   "title",
+			Content: "content",
+			Tags:    []string{"tag1"},
+			Version: 2,
+		}
+		repo := &RepositoryMock{
+			DeletePostFunc: func(_ context.Context, dto *usecase.DeletePostDto) (*usecase.Post, error) {
+				require.Equal(t, "some-id", dto.Id)
+				require.Equal(t, "some-actor", dto.Actor)
+				require.Equal(t, 2, dto.Version)
+				return deletedPost, nil
+			},
+		}
+		expectedBody, err := json.Marshal(deletedPost)
+		require.NoError(t, err)
+		checkDelete(t, httpx.NewServer(repo), `"2"`, http.StatusOK, expectedBody)
+	})
+}
+
+func TestTrustedActor(t *testing.T) {
+	t.Parallel()
+
+	secret := "gateway-secret"
+	body := `{"title":"heroes"}`
+	handler := httpx.TrustedActor(identity.NewVerifier(secret))(
+		func(w http.ResponseWriter, r *http.Request) {
+			read, err := ioutil.ReadAll(r.Body)
+			require.NoError(t, err)
+			require.Equal(t, body, string(read), "the body should still be readable")
+			w.WriteHeader(http.StatusNoContent)
+		},
+	)
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+	digest := identity.Digest([]byte(body))
+	for _, tc := range []struct {
+		name          string
+		actor         string
+		timestamp     string
+		signature     string
+		expStatusCode int
+	}{
+		{"Signed actor", "bowie", now,
+			identity.Sign(secret, "bowie", now, http.MethodPut, "/posts/1", digest),
+			http.StatusNoContent},
+		{"Another actor, Unauthorized", "jagger", now,
+			identity.Sign(secret, "bowie", now, http.MethodPut, "/posts/1", digest),
+			http.StatusUnauthorized},
+		{"Signed for another request, Unauthorized", "bowie", now,
+			identity.Sign(secret, "bowie", now, http.MethodDelete, "/posts/1", digest),
+			http.StatusUnauthorized},
+		{"Signed for another body, Unauthorized", "bowie", now,
+			identity.Sign(secret, "bowie", now, http.MethodPut, "/posts/1",
+				identity.Digest([]byte(`{"title":"changes"}`))),
+			http.StatusUnauthorized},
+		{"Missing signature, Unauthorized", "bowie", now, "", http.StatusUnauthorized},
+		{"Missing actor, Unauthorized", "", "", "", http.StatusUnauthorized},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPut, "/posts/1", strings.NewReader(body))
+			req.Header.Set(httpx.ActorHeader, tc.actor)
+			req.Header.Set(httpx.ActorTimestampHeader, tc.timestamp)
+			req.Header.Set(httpx.ActorSignatureHeader, tc.signature)
+			w := httptest.NewRecorder()
+			handler(w, req)
+			require.Equal(t, tc.expStatusCode, w.Result().StatusCode)
+		})
+	}
+}
@@ -0,0 +1,160 @@
+package identity_test
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/mountolive/back-blog-go/post/eventbus"
+	"github.com/mountolive/back-blog-go/post/identity"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerifier(t *testing.T) {
+	secret := "gateway-secret"
+	verifier := identity.NewVerifier(secret)
+
+	t.Run("Sign", func(t *testing.T) {
+		t.Parallel()
+		// the gateway's signature of the same actor and values
+		require.Equal(t,
+			"bf2f004a8f751ab58d83a0aa72718cb6577a6f809e6a581ed832a5c4a01212c2",
+			identity.Sign("un secreto", "noice", "some-id", "posts.v1.update"),
+		)
+		require.Equal(t,
+			"29dadc0e2d0b60a9874e58600ec882eedf3d0629464364855b611dbcb1f21b2a",
+			identity.Digest([]byte(`{"title":"heroes"}`)),
+		)
+	})
+
+	t.Run("Verify", func(t *testing.T) {
+		t.Parallel()
+		signature := identity.Sign(secret, "bowie", "some-id", "posts.v1.update")
+		for _, tc := range []struct {
+			name      string
+			verifier  *identity.Verifier
+			actor     string
+			signature string
+			bound     []string
+			valid     bool
+		}{
+			{"Valid signature", verifier, "bowie", signature,
+				[]string{"some-id", "posts.v1.update"}, true},
+			{"Another actor, Untrusted", verifier, "jagger", signature,
+				[]string{"some-id", "posts.v1.update"}, false},
+			{"Another event, Untrusted", verifier, "bowie", signature,
+				[]string{"another-id", "posts.v1.update"}, false},
+			{"Signed with another secret, Untrusted", verifier, "bowie",
+				identity.Sign("another-secret", "bowie", "some-id", "posts.v1.update"),
+				[]string{"some-id", "posts.v1.update"}, false},
+			{"Missing signature, Untrusted", verifier, "bowie", "",
+				[]string{"some-id", "posts.v1.update"}, false},
+			{"No secret set, Untrusted", identity.NewVerifier(""), "bowie",
+				identity.Sign("", "bowie", "some-id", "posts.v1.update"),
+				[]string{"some-id", "posts.v1.update"}, false},
+		} {
+			tc := tc
+			t.Run(tc.name, func(t *testing.T) {
+				err := tc.verifier.Verify(tc.actor, tc.signature, tc.bound...)
+				if tc.valid {
+					require.NoError(t, err)
+					return
+				}
+				require.True(t, errors.Is(err, identity.ErrUntrusted), "unexpected error: %v", err)
+			})
+		}
+	})
+
+	t.Run("Verify timestamped", func(t *testing.T) {
+		t.Parallel()
+		now := strconv.FormatInt(time.Now().Unix(), 10)
+		old := strconv.FormatInt(time.Now().Add(-2*identity.DefaultMaxSkew).Unix(), 10)
+		err := verifier.VerifyTimestamped("bowie",
+			identity.Sign(secret, "bowie", now, "PUT", "/posts/1"), now, "PUT", "/posts/1")
+		require.NoError(t, err)
+		err = verifier.VerifyTimestamped("bowie",
+			identity.Sign(secret, "bowie", old, "PUT", "/posts/1"), old, "PUT", "/posts/1")
+		require.True(t, errors.Is(err, identity.ErrUntrusted), "expired signatures are untrusted")
+		err = verifier.VerifyTimestamped("bowie",
+			identity.Sign(secret, "bowie", now, "PUT", "/posts/1"), now, "DELETE", "/posts/1")
+		require.True(t, errors.Is(err, identity.ErrUntrusted), "signatures are bound to the request")
+	})
+
+	t.Run("Middleware", func(t *testing.T) {
+		t.Parallel()
+		var actor string
+		handler := verifier.Middleware()(eventbus.HandlerFunc(
+			func(ctx context.Context, _ eventbus.Params) error {
+				envelope, _ := eventbus.EnvelopeFromContext(ctx)
+				actor = envelope.Actor
+				return nil
+			},
+		))
+		data := []byte(`{"title":"heroes"}`)
+		envelope := eventbus.Envelope{
+			SpecVersion:  eventbus.SpecVersion,
+			ID:           "some-id",
+			Type:         "posts.v1.update",
+			ReceivedType: "posts.v1.update",
+			RawData:      data,
+			Actor:        "bowie",
+			ActorSignature: identity.Sign(secret, "bowie", "some-id", "posts.v1.update",
+				identity.Digest(data)),
+		}
+		err := handler.Handle(eventbus.ContextWithEnvelope(context.Background(), envelope), nil)
+		require.NoError(t, err)
+		require.Equal(t, "bowie", actor, "signed actors should be kept")
+
+		swapped := envelope
+		swapped.RawData = []byte(`{"title":"changes"}`)
+		err = handler.Handle(eventbus.ContextWithEnvelope(context.Background(), swapped), nil)
+		require.NoError(t, err)
+		require.Empty(t, actor, "actors signed for other data should be dropped")
+
+		swapped = envelope
+		swapped.Actor = "jagger"
+		err = handler.Handle(eventbus.ContextWithEnvelope(context.Background(), swapped), nil)
+		require.NoError(t, err)
+		require.Empty(t, actor, "actors not signed should be dropped")
+
+		swapped = envelope
+		swapped.ActorSignature = ""
+		err = handler.Handle(eventbus.ContextWithEnvelope(context.Background(), swapped), nil)
+		require.NoError(t, err)
+		require.Empty(t, actor, "actors not signed should be dropped")
+	})
+
+	t.Run("Upcast events", func(t *testing.T) {
+		t.Parallel()
+		var actor string
+		bus := eventbus.NewEventBus(verifier.Middleware())
+		bus.RegisterUpcaster("posts.v1.update", func(data eventbus.Params) (eventbus.Params, error) {
+			data["summary"] = ""
+			return data, nil
+		})
+		bus.Register("posts.v2.update", eventbus.HandlerFunc(
+			func(ctx context.Context, _ eventbus.Params) error {
+				envelope, _ := eventbus.EnvelopeFromContext(ctx)
+				actor = envelope.Actor
+				return nil
+			},
+		))
+		data := `{"id":"some-post","title":"heroes"}`
+		signature := identity.Sign(secret, "bowie", "some-id", "posts.v1.update",
+			identity.Digest([]byte(data)))
+		event := rawEvent(`{"specversion":"1.0","id":"some-id","source":"/gateway",` +
+			`"type":"posts.v1.update","actor":"bowie","actorsignature":"` + signature +
+			`","data":` + data + `}`)
+		err := bus.Resolve(context.Background(), event)
+		require.NoError(t, err)
+		require.Equal(t, "bowie", actor, "actors should be verified against the event received")
+	})
+}
+
+type rawEvent string
+
+func (e rawEvent) Data() []byte {
+	return []byte(e)
+}
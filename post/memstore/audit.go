@@ -0,0 +1,85 @@
+package memstore
+
+import (
+	"context"
+	"sync"
+
+	"github.com/mountolive/back-blog-go/post/audit"
+)
+
+// AuditMemStore keeps the audit log in memory,
+// it's safe for concurrent use
+type AuditMemStore struct {
+	mu      sync.Mutex
+	entries []audit.Entry
+}
+
+var _ audit.Store = &AuditMemStore{}
+
+// Creates an empty in-memory audit log
+func NewAuditMemStore() *AuditMemStore {
+	return &AuditMemStore{}
+}
+
+// Append records entry, assigning its Seq
+func (m *AuditMemStore) Append(ctx context.Context, entry *audit.Entry) error {
+	if err := ctx.Err(); err != nil {
+		return wrapErrorInfo(err, "append audit entry")
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	entry.Seq = int64(len(m.entries) + 1)
+	m.entries = append(m.entries, *entry)
+	return nil
+}
+
+// History returns the entries of the passed aggregate, oldest first
+func (m *AuditMemStore) History(ctx context.Context,
+	aggregateID string) ([]*audit.Entry, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, wrapErrorInfo(err, "audit history")
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	entries := []*audit.Entry{}
+	for _, entry := range m.entries {
+		if entry.AggregateID == aggregateID {
+			entry := entry
+			entries = append(entries, &entry)
+		}
+	}
+	return entries, nil
+}
+
+// Query returns the entries matching filter, oldest first
+func (m *AuditMemStore) Query(ctx context.Context,
+	filter audit.Filter) ([]*audit.Entry, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, wrapErrorInfo(err, "audit query")
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	entries := []*audit.Entry{}
+	skipped := 0
+	for _, entry := range m.entries {
+		if filter.Actor != "" && entry.Actor != filter.Actor {
+			continue
+		}
+		if !filter.From.IsZero() && entry.OccurredAt.Before(filter.From) {
+			continue
+		}
+		if !filter.To.IsZero() && entry.OccurredAt.After(filter.To) {
+			continue
+		}
+		if skipped < filter.Offset {
+			skipped++
+			continue
+		}
+		if filter.Limit > 0 && len(entries) == filter.Limit {
+			break
+		}
+		entry := entry
+		entries = append(entries, &entry)
+	}
+	return entries, nil
+}
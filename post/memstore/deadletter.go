@@ -0,0 +1,128 @@
+package memstore
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"github.com/mountolive/back-blog-go/post/deadletter"
+)
+
+// DeadLetterMemStore keeps the dead letters in memory,
+// it's safe for concurrent use
+type DeadLetterMemStore struct {
+	mu      sync.Mutex
+	letters map[string]deadletter.Letter
+}
+
+var _ deadletter.Store = &DeadLetterMemStore{}
+
+// Creates an empty in-memory store for dead letters
+func NewDeadLetterMemStore() *DeadLetterMemStore {
+	return &DeadLetterMemStore{letters: map[string]deadletter.Letter{}}
+}
+
+// Save records letter, assigning its ID
+func (m *DeadLetterMemStore) Save(ctx context.Context, letter *deadletter.Letter) error {
+	if err := ctx.Err(); err != nil {
+		return wrapErrorInfo(err, "save dead letter")
+	}
+	id, err := newID()
+	if err != nil {
+		return wrapErrorInfo(err, "save dead letter")
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	letter.ID = id
+	m.letters[letter.ID] = copyLetter(letter)
+	return nil
+}
+
+// List returns the letters matching filter, the most recent first
+func (m *DeadLetterMemStore) List(ctx context.Context,
+	filter deadletter.Filter) ([]*deadletter.Letter, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, wrapErrorInfo(err, "list dead letters")
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	letters := []*deadletter.Letter{}
+	for _, letter := range m.letters {
+		if filter.Subject != "" && letter.Subject != filter.Subject {
+			continue
+		}
+		if filter.Reason != "" && letter.Reason != filter.Reason {
+			continue
+		}
+		letter := copyLetter(&letter)
+		letters = append(letters, &letter)
+	}
+	sort.Slice(letters, func(i, j int) bool {
+		if letters[i].FailedAt.Equal(letters[j].FailedAt) {
+			return letters[i].ID < letters[j].ID
+		}
+		return letters[i].FailedAt.After(letters[j].FailedAt)
+	})
+	if filter.Offset >= len(letters) {
+		return []*deadletter.Letter{}, nil
+	}
+	letters = letters[filter.Offset:]
+	if filter.Limit > 0 && filter.Limit < len(letters) {
+		letters = letters[:filter.Limit]
+	}
+	return letters, nil
+}
+
+// Get returns the letter with the passed id
+func (m *DeadLetterMemStore) Get(ctx context.Context, id string) (*deadletter.Letter, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, wrapErrorInfo(err, "get dead letter")
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	letter, ok := m.letters[id]
+	if !ok {
+		return nil, deadletter.ErrLetterNotFound
+	}
+	letter = copyLetter(&letter)
+	return &letter, nil
+}
+
+// Update replaces the stored letter with the same ID
+func (m *DeadLetterMemStore) Update(ctx context.Context, letter *deadletter.Letter) error {
+	if err := ctx.Err(); err != nil {
+		return wrapErrorInfo(err, "update dead letter")
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.letters[letter.ID]; !ok {
+		return deadletter.ErrLetterNotFound
+	}
+	m.letters[letter.ID] = copyLetter(letter)
+	return nil
+}
+
+// Delete removes the letter with the passed id
+func (m *DeadLetterMemStore) Delete(ctx context.Context, id string) error {
+	if err := ctx.Err(); err != nil {
+		return wrapErrorInfo(err, "delete dead letter")
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.letters[id]; !ok {
+		return deadletter.ErrLetterNotFound
+	}
+	delete(m.letters, id)
+	return nil
+}
+
+// copyLetter copies letter, along with its header, so the stored
+// letters aren't modified through the ones passed or returned
+func copyLetter(letter *deadletter.Letter) deadletter.Letter {
+	copied := *letter
+	copied.Header = make(map[string][]string, len(letter.Header))
+	for key, values := range letter.Header {
+		copied.Header[key] = append([]string(nil), values...)
+	}
+	return copied
+}
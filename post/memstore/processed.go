@@ -0,0 +1,81 @@
+package memstore
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/mountolive/back-blog-go/post/eventbus"
+)
+
+// ProcessedEventMemStore keeps the keys of the events handled in memory,
+// it's safe for concurrent use
+type ProcessedEventMemStore struct {
+	mu     sync.Mutex
+	events map[string]eventbus.ProcessedEvent
+}
+
+var _ eventbus.ProcessedEventStore = &ProcessedEventMemStore{}
+
+// Creates an empty in-memory store for processed events
+func NewProcessedEventMemStore() *ProcessedEventMemStore {
+	return &ProcessedEventMemStore{events: map[string]eventbus.ProcessedEvent{}}
+}
+
+// Claim records key as pending, until lease passes, unless it's already
+// recorded as pending or succeeded, and not expired
+func (m *ProcessedEventMemStore) Claim(ctx context.Context, key string,
+	lease time.Duration) (*eventbus.ProcessedEvent, bool, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, false, wrapErrorInfo(err, "claim")
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now()
+	existing, ok := m.events[key]
+	if ok && existing.Status != eventbus.StatusFailed && existing.ExpiresAt.After(now) {
+		return &existing, false, nil
+	}
+	m.events[key] = eventbus.ProcessedEvent{
+		Key:       key,
+		Status:    eventbus.StatusPending,
+		ExpiresAt: now.Add(lease),
+	}
+	return nil, true, nil
+}
+
+// Complete records the outcome of a claimed key
+func (m *ProcessedEventMemStore) Complete(ctx context.Context, key, status,
+	errMsg string, result map[string]interface{}, ttl time.Duration) error {
+	if err := ctx.Err(); err != nil {
+		return wrapErrorInfo(err, "complete")
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.events[key] = eventbus.ProcessedEvent{
+		Key:       key,
+		Status:    status,
+		Error:     errMsg,
+		Result:    result,
+		ExpiresAt: time.Now().Add(ttl),
+	}
+	return nil
+}
+
+// PurgeExpired removes the records expired by now
+func (m *ProcessedEventMemStore) PurgeExpired(ctx context.Context,
+	now time.Time) (int64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, wrapErrorInfo(err, "purge expired")
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var purged int64
+	for key, event := range m.events {
+		if !event.ExpiresAt.After(now) {
+			delete(m.events, key)
+			purged++
+		}
+	}
+	return purged, nil
+}
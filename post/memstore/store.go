@@ -0,0 +1,343 @@
+// Defines an in-memory store associated to posts, meant for tests and local runs
+package memstore
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mountolive/back-blog-go/post/usecase"
+)
+
+var (
+	// ErrEmptyField returned when a post is left without creator, title,
+	// content or tags, which the Postgres store refuses as well
+	ErrEmptyField = errors.New("post's creator, title, content and tags can't be empty")
+)
+
+// MemStore keeps posts in memory, it's safe for concurrent use
+// Its semantics mirror PgStore's: tags are case insensitive, and the last
+// spelling written for a tag is the one returned for every post
+type MemStore struct {
+	mu sync.RWMutex
+	// posts by id
+	posts map[string]*post
+	// tags' spelling by their lowercased name
+	tags map[string]string
+	// sequence keeps the order of insertion, for ties on created_at
+	sequence int
+}
+
+type post struct {
+	usecase.Post
+	// tagKeys are the lowercased tags of the post
+	tagKeys  []string
+	sequence int
+}
+
+var (
+	_ usecase.PostStore    = &MemStore{}
+	_ usecase.UserRefStore = &MemStore{}
+)
+
+// Creates an empty in-memory store for posts
+func NewPostMemStore() *MemStore {
+	return &MemStore{
+		posts: map[string]*post{},
+		tags:  map[string]string{},
+	}
+}
+
+// Creates a Post with data with corresponding CreatePostDto
+func (m *MemStore) Create(ctx context.Context,
+	create *usecase.CreatePostDto) (*usecase.Post, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, wrapErrorInfo(err, "create")
+	}
+	if create.Creator == "" || create.Title == "" || create.Content == "" ||
+		!validTags(create.Tags) {
+		return nil, wrapErrorInfo(ErrEmptyField, "create")
+	}
+	id, err := newID()
+	if err != nil {
+		return nil, wrapErrorInfo(err, "create")
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now()
+	m.sequence++
+	created := &post{
+		Post: usecase.Post{
+			Id:        id,
+			Creator:   create.Creator,
+			Title:     create.Title,
+			Content:   create.Content,
+			CreatedAt: now,
+			UpdatedAt: now,
+			Authors:   copyAuthors(usecase.NormalizeAuthors(create.Creator, create.Authors)),
+			Version:   1,
+		},
+		sequence: m.sequence,
+	}
+	created.tagKeys = m.appendTags(nil, create.Tags)
+	m.posts[id] = created
+	return m.toPost(created), nil
+}
+
+// Updates the corresponding post with the Id from the UpdatePostDto passed,
+// as long as its stored version matches the passed one
+// Only the fields present in the UpdatePostDto are touched
+func (m *MemStore) Update(ctx context.Context,
+	update *usecase.UpdatePostDto) (*usecase.Post, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, wrapErrorInfo(err, "update")
+	}
+	if (update.Title != nil && *update.Title == "") ||
+		(update.Content != nil && *update.Content == "") ||
+		(update.Tags != nil && !validTags(update.Tags)) ||
+		(len(update.AddTags) > 0 && !validTags(update.AddTags)) {
+		return nil, wrapErrorInfo(ErrEmptyField, "update")
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	stored, ok := m.posts[update.Id]
+	if !ok {
+		return nil, wrapErrorInfo(usecase.ErrPostNotFound, update.Id)
+	}
+	if stored.Version != update.Version {
+		return nil, wrapErrorInfo(
+			usecase.ErrVersionConflict,
+			fmt.Sprintf("expected %d, found %d", update.Version, stored.Version),
+		)
+	}
+	if update.Title != nil {
+		stored.Title = *update.Title
+	}
+	if update.Content != nil {
+		stored.Content = *update.Content
+	}
+	if update.Tags != nil {
+		stored.tagKeys = m.appendTags(nil, update.Tags)
+	}
+	stored.tagKeys = m.appendTags(stored.tagKeys, update.AddTags)
+	stored.tagKeys = removeTags(stored.tagKeys, update.RemoveTags)
+	if update.Authors != nil {
+		stored.Authors = copyAuthors(usecase.NormalizeAuthors(stored.Creator, update.Authors))
+	}
+	stored.Version++
+	stored.UpdatedAt = time.Now()
+	return m.toPost(stored), nil
+}
+
+// Deletes the post with the passed Id, as long as its stored version
+// matches the passed one, and returns it
+func (m *MemStore) Delete(ctx context.Context,
+	deleted *usecase.DeletePostDto) (*usecase.Post, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, wrapErrorInfo(err, "delete")
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	stored, ok := m.posts[deleted.Id]
+	if !ok {
+		return nil, wrapErrorInfo(usecase.ErrPostNotFound, deleted.Id)
+	}
+	if stored.Version != deleted.Version {
+		return nil, wrapErrorInfo(
+			usecase.ErrVersionConflict,
+			fmt.Sprintf("expected %d, found %d", deleted.Version, stored.Version),
+		)
+	}
+	delete(m.posts, deleted.Id)
+	return m.toPost(stored), nil
+}
+
+// Reads from the store the post with the passed Id
+func (m *MemStore) ReadOne(ctx context.Context, id string) (*usecase.Post, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, wrapErrorInfo(err, "read one")
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	stored, ok := m.posts[id]
+	if !ok {
+		return nil, wrapErrorInfo(usecase.ErrPostNotFound, id)
+	}
+	return m.toPost(stored), nil
+}
+
+// Filters either by tags, authors and/or creation date, newest first
+func (m *MemStore) Filter(ctx context.Context,
+	filter *usecase.GeneralFilter) ([]*usecase.Post, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, wrapErrorInfo(err, "filter")
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	matched := []*post{}
+	for _, stored := range m.posts {
+		if filter.Tag != "" && !hasTag(stored.tagKeys, filter.Tag) {
+			continue
+		}
+		if filter.Author != "" && !stored.HasAuthor(filter.Author) {
+			continue
+		}
+		if !filter.From.IsZero() && stored.CreatedAt.Before(filter.From) {
+			continue
+		}
+		if !filter.To.IsZero() && stored.CreatedAt.After(filter.To) {
+			continue
+		}
+		matched = append(matched, stored)
+	}
+	sort.Slice(matched, func(i, j int) bool {
+		if matched[i].CreatedAt.Equal(matched[j].CreatedAt) {
+			return matched[i].sequence > matched[j].sequence
+		}
+		return matched[i].CreatedAt.After(matched[j].CreatedAt)
+	})
+	posts := []*usecase.Post{}
+	for i := filter.Page; i < len(matched) && len(posts) < filter.PageSize; i++ {
+		posts = append(posts, m.toPost(matched[i]))
+	}
+	return posts, nil
+}
+
+// UserRefs returns the distinct creators and authors of the posts
+func (m *MemStore) UserRefs(ctx context.Context) ([]string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, wrapErrorInfo(err, "user refs")
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	refs := []string{}
+	seen := map[string]bool{}
+	for _, stored := range m.posts {
+		for _, author := range stored.Authors {
+			if !seen[author.ID] {
+				seen[author.ID] = true
+				refs = append(refs, author.ID)
+			}
+		}
+		if !seen[stored.Creator] {
+			seen[stored.Creator] = true
+			refs = append(refs, stored.Creator)
+		}
+	}
+	return refs, nil
+}
+
+// ReplaceUserRef identifies the creator and authors identified as from
+// as to instead, in every post; versions aren't bumped. Authors already
+// identified as to are kept as they are
+func (m *MemStore) ReplaceUserRef(ctx context.Context, from, to string) error {
+	if err := ctx.Err(); err != nil {
+		return wrapErrorInfo(err, "replace user ref")
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, stored := range m.posts {
+		if stored.Creator == from {
+			stored.Creator = to
+		}
+		replaced := stored.HasAuthor(to)
+		authors := make([]usecase.Author, 0, len(stored.Authors))
+		for _, author := range stored.Authors {
+			if author.ID == from {
+				if replaced {
+					continue
+				}
+				author.ID = to
+				replaced = true
+			}
+			authors = append(authors, author)
+		}
+		stored.Authors = authors
+	}
+	return nil
+}
+
+// appendTags registers the passed tags, with their latest spelling,
+// and appends to keys the ones not already present
+func (m *MemStore) appendTags(keys []string, tags []string) []string {
+	for _, tag := range tags {
+		key := strings.ToLower(tag)
+		m.tags[key] = tag
+		if !hasTag(keys, key) {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// toPost copies the stored post, so that callers can't modify it
+func (m *MemStore) toPost(stored *post) *usecase.Post {
+	copied := stored.Post
+	copied.Tags = make([]string, 0, len(stored.tagKeys))
+	for _, key := range stored.tagKeys {
+		copied.Tags = append(copied.Tags, m.tags[key])
+	}
+	copied.Authors = copyAuthors(stored.Authors)
+	return &copied
+}
+
+// copyAuthors keeps only the persisted fields of the authors,
+// as the Postgres store does
+func copyAuthors(authors []usecase.Author) []usecase.Author {
+	copied := make([]usecase.Author, 0, len(authors))
+	for _, author := range authors {
+		copied = append(copied, usecase.Author{ID: author.ID, Role: author.Role})
+	}
+	return copied
+}
+
+func removeTags(keys []string, tags []string) []string {
+	kept := []string{}
+	for _, key := range keys {
+		if !hasTag(tags, key) {
+			kept = append(kept, key)
+		}
+	}
+	return kept
+}
+
+func hasTag(tags []string, tag string) bool {
+	for _, current := range tags {
+		if strings.EqualFold(current, tag) {
+			return true
+		}
+	}
+	return false
+}
+
+func validTags(tags []string) bool {
+	if len(tags) == 0 {
+		return false
+	}
+	for _, tag := range tags {
+		if tag == "" {
+			return false
+		}
+	}
+	return true
+}
+
+// newID returns a random (version 4) UUID
+func newID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:]), nil
+}
+
+func wrapErrorInfo(err error, msg string) error {
+	return fmt.Errorf("POST MEMSTORE: %w - %s\n", err, msg)
+}
@@ -0,0 +1,28 @@
+package memstore
+
+import (
+	"testing"
+
+	"github.com/mountolive/back-blog-go/post/storetest"
+	"github.com/mountolive/back-blog-go/post/usecase"
+)
+
+func TestMemStore(t *testing.T) {
+	t.Run("Canary", func(t *testing.T) {
+		var _ usecase.PostStore = &MemStore{}
+	})
+
+	storetest.Run(t, NewPostMemStore())
+}
+
+func TestProcessedEventMemStore(t *testing.T) {
+	storetest.RunProcessedEvents(t, NewProcessedEventMemStore())
+}
+
+func TestDeadLetterMemStore(t *testing.T) {
+	storetest.RunDeadLetters(t, NewDeadLetterMemStore())
+}
+
+func TestAuditMemStore(t *testing.T) {
+	storetest.RunAudit(t, NewAuditMemStore())
+}
@@ -0,0 +1,185 @@
+// Relays the domain events written to a store's outbox, in the same
+// transaction as the changes they announce, to a usecase.Publisher
+package outbox
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/mountolive/back-blog-go/post/eventbus"
+	"github.com/mountolive/back-blog-go/post/usecase"
+)
+
+var (
+	// ErrOutboxStore is self-described
+	ErrOutboxStore = errors.New("outbox store error")
+	// ErrRelayPublish is self-described
+	ErrRelayPublish = errors.New("outbox message publish failed")
+)
+
+// Message is a domain event waiting in the outbox to be published
+// Actor and CorrelationID come from the event handled when it was written
+type Message struct {
+	// Seq orders the messages, as they were written
+	Seq           int64
+	AggregateID   string
+	Event         usecase.DomainEvent
+	Actor         string
+	CorrelationID string
+}
+
+// Store is the outbox of the domain events written along with the changes
+type Store interface {
+	// Pending returns up to limit undelivered messages, ordered by Seq
+	Pending(ctx context.Context, limit int) ([]Message, error)
+	// MarkDelivered records the message with the passed seq as delivered
+	MarkDelivered(ctx context.Context, seq int64) error
+	// PurgeDelivered removes the messages delivered before the passed time
+	PurgeDelivered(ctx context.Context, before time.Time) (int64, error)
+}
+
+// Locker is implemented by the stores whose outbox is shared by several
+// processes, electing one Relay at a time to publish its messages
+type Locker interface {
+	// WithRelayLock runs relay holding the outbox's lock, until it returns
+	// ok is false, and relay isn't run, when another Relay holds it
+	WithRelayLock(ctx context.Context, relay func(context.Context) error) (ok bool, err error)
+}
+
+// RelayConfig configures a Relay
+type RelayConfig struct {
+	// BatchSize is the maximum number of messages read on each round
+	BatchSize int
+	// Interval is the wait between rounds, when there's nothing left to relay
+	Interval time.Duration
+	// Retention is how long delivered messages are kept before purging them
+	Retention time.Duration
+}
+
+// DefaultRelayConfig is a sensible RelayConfig
+var DefaultRelayConfig = RelayConfig{
+	BatchSize: 100,
+	Interval:  time.Second,
+	Retention: 24 * time.Hour,
+}
+
+// Relay publishes the pending messages of an outbox
+// Delivery is at-least-once: a message is marked as delivered after being
+// published, so it's published again if that fails. Messages of the same
+// aggregate are published in order: when one fails, the following ones of
+// its aggregate wait for the next round. If the store is a Locker, a Relay
+// can run on every process sharing the outbox: each round is only relayed by
+// the one holding the lock, the rest skip it
+type Relay struct {
+	store     Store
+	publisher usecase.Publisher
+	conf      RelayConfig
+}
+
+// NewRelay is a constructor
+func NewRelay(store Store, publisher usecase.Publisher, conf RelayConfig) *Relay {
+	if conf.BatchSize <= 0 {
+		conf.BatchSize = DefaultRelayConfig.BatchSize
+	}
+	if conf.Interval <= 0 {
+		conf.Interval = DefaultRelayConfig.Interval
+	}
+	return &Relay{store: store, publisher: publisher, conf: conf}
+}
+
+// RelayOnce publishes a batch of pending messages, returning how many were
+// delivered. Failures of single messages don't stop the batch, the first
+// one is returned along with the count
+// Nothing is relayed when another Relay holds the lock of the outbox
+func (r *Relay) RelayOnce(ctx context.Context) (int, error) {
+	locker, ok := r.store.(Locker)
+	if !ok {
+		return r.relayBatch(ctx)
+	}
+	var delivered int
+	var relayErr error
+	_, err := locker.WithRelayLock(ctx, func(ctx context.Context) error {
+		delivered, relayErr = r.relayBatch(ctx)
+		return nil
+	})
+	if err != nil {
+		return delivered, wrapError(ErrOutboxStore, err.Error())
+	}
+	return delivered, relayErr
+}
+
+func (r *Relay) relayBatch(ctx context.Context) (int, error) {
+	messages, err := r.store.Pending(ctx, r.conf.BatchSize)
+	if err != nil {
+		return 0, wrapError(ErrOutboxStore, err.Error())
+	}
+	var firstErr error
+	delivered := 0
+	blocked := map[string]bool{}
+	for _, msg := range messages {
+		if blocked[msg.AggregateID] {
+			continue
+		}
+		err := r.publish(ctx, msg)
+		if err != nil {
+			blocked[msg.AggregateID] = true
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		delivered++
+	}
+	return delivered, firstErr
+}
+
+func (r *Relay) publish(ctx context.Context, msg Message) error {
+	publishCtx := eventbus.ContextWithEnvelope(ctx, eventbus.Envelope{
+		Actor:         msg.Actor,
+		CorrelationID: msg.CorrelationID,
+	})
+	err := r.publisher.Publish(publishCtx, msg.Event)
+	if err != nil {
+		return wrapError(ErrRelayPublish, fmt.Sprintf("seq %d: %v", msg.Seq, err))
+	}
+	err = r.store.MarkDelivered(ctx, msg.Seq)
+	if err != nil {
+		return wrapError(ErrOutboxStore, fmt.Sprintf("seq %d: %v", msg.Seq, err))
+	}
+	return nil
+}
+
+// Run relays the outbox until ctx is canceled, purging the delivered
+// messages older than the configured retention on every interval
+// Errors are passed to onError, they don't stop the relay
+func (r *Relay) Run(ctx context.Context, onError func(error)) {
+	ticker := time.NewTicker(r.conf.Interval)
+	defer ticker.Stop()
+	for {
+		delivered, err := r.RelayOnce(ctx)
+		if err != nil {
+			onError(err)
+		}
+		if delivered == r.conf.BatchSize && err == nil {
+			// there may be more pending messages
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if r.conf.Retention > 0 {
+			_, err = r.store.PurgeDelivered(ctx, time.Now().Add(-r.conf.Retention))
+			if err != nil {
+				onError(wrapError(ErrOutboxStore, err.Error()))
+			}
+		}
+	}
+}
+
+func wrapError(err error, msg string) error {
+	return fmt.Errorf("%w: %s", err, msg)
+}
@@ -0,0 +1,229 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mountolive/back-blog-go/post/eventbus"
+	"github.com/mountolive/back-blog-go/post/usecase"
+	"github.com/stretchr/testify/require"
+)
+
+type mockStore struct {
+	mu         sync.Mutex
+	messages   []Message
+	delivered  map[int64]bool
+	markErr    error
+	pendingErr error
+	purges     int
+}
+
+func newMockStore(messages ...Message) *mockStore {
+	return &mockStore{messages: messages, delivered: map[int64]bool{}}
+}
+
+func (m *mockStore) Pending(_ context.Context, limit int) ([]Message, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.pendingErr != nil {
+		return nil, m.pendingErr
+	}
+	pending := []Message{}
+	for _, msg := range m.messages {
+		if !m.delivered[msg.Seq] && len(pending) < limit {
+			pending = append(pending, msg)
+		}
+	}
+	return pending, nil
+}
+
+func (m *mockStore) MarkDelivered(_ context.Context, seq int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.markErr != nil {
+		return m.markErr
+	}
+	m.delivered[seq] = true
+	return nil
+}
+
+func (m *mockStore) PurgeDelivered(context.Context, time.Time) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.purges++
+	return int64(len(m.delivered)), nil
+}
+
+// lockingStore is a mockStore shared by relays, holding its lock while one
+// of them relays
+type lockingStore struct {
+	*mockStore
+	lockMu  sync.Mutex
+	held    bool
+	lockErr error
+}
+
+func (l *lockingStore) tryLock() bool {
+	l.lockMu.Lock()
+	defer l.lockMu.Unlock()
+	if l.held {
+		return false
+	}
+	l.held = true
+	return true
+}
+
+func (l *lockingStore) unlock() {
+	l.lockMu.Lock()
+	defer l.lockMu.Unlock()
+	l.held = false
+}
+
+func (l *lockingStore) WithRelayLock(ctx context.Context,
+	relay func(context.Context) error) (bool, error) {
+	if l.lockErr != nil {
+		return false, l.lockErr
+	}
+	if !l.tryLock() {
+		return false, nil
+	}
+	defer l.unlock()
+	return true, relay(ctx)
+}
+
+// mockPublisher fails the events whose ID is in failing
+type mockPublisher struct {
+	usecase.InMemoryPublisher
+	failing map[string]bool
+	actors  []string
+}
+
+func (m *mockPublisher) Publish(ctx context.Context, event usecase.DomainEvent) error {
+	if m.failing[event.ID] {
+		return errors.New("publish failed")
+	}
+	envelope, _ := eventbus.EnvelopeFromContext(ctx)
+	m.actors = append(m.actors, envelope.Actor)
+	return m.InMemoryPublisher.Publish(ctx, event)
+}
+
+func message(seq int64, aggregate string) Message {
+	return Message{
+		Seq:         seq,
+		AggregateID: aggregate,
+		Event: usecase.DomainEvent{
+			ID:   fmt.Sprintf("%s-%d", aggregate, seq),
+			Name: usecase.PostUpdatedEventNameV1,
+			Post: usecase.Post{Id: aggregate},
+		},
+		Actor: "someone",
+	}
+}
+
+func eventIDs(events []usecase.DomainEvent) []string {
+	ids := []string{}
+	for _, event := range events {
+		ids = append(ids, event.ID)
+	}
+	return ids
+}
+
+func TestRelay(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Publishes in order", func(t *testing.T) {
+		store := newMockStore(message(1, "a"), message(2, "b"), message(3, "a"))
+		publisher := &mockPublisher{}
+		relay := NewRelay(store, publisher, DefaultRelayConfig)
+		delivered, err := relay.RelayOnce(ctx)
+		require.NoError(t, err)
+		require.Equal(t, 3, delivered)
+		require.Equal(t, []string{"a-1", "b-2", "a-3"}, eventIDs(publisher.Events()))
+		require.Equal(t, []string{"someone", "someone", "someone"}, publisher.actors)
+
+		delivered, err = relay.RelayOnce(ctx)
+		require.NoError(t, err)
+		require.Zero(t, delivered)
+	})
+
+	t.Run("Failure holds its aggregate back", func(t *testing.T) {
+		store := newMockStore(message(1, "a"), message(2, "b"), message(3, "a"))
+		publisher := &mockPublisher{failing: map[string]bool{"a-1": true}}
+		relay := NewRelay(store, publisher, DefaultRelayConfig)
+		delivered, err := relay.RelayOnce(ctx)
+		require.True(t, errors.Is(err, ErrRelayPublish))
+		require.Equal(t, 1, delivered)
+		require.Equal(t, []string{"b-2"}, eventIDs(publisher.Events()))
+
+		publisher.failing = nil
+		delivered, err = relay.RelayOnce(ctx)
+		require.NoError(t, err)
+		require.Equal(t, 2, delivered)
+		require.Equal(t, []string{"b-2", "a-1", "a-3"}, eventIDs(publisher.Events()))
+	})
+
+	t.Run("At least once", func(t *testing.T) {
+		store := newMockStore(message(1, "a"))
+		store.markErr = errors.New("store down")
+		publisher := &mockPublisher{}
+		relay := NewRelay(store, publisher, DefaultRelayConfig)
+		_, err := relay.RelayOnce(ctx)
+		require.True(t, errors.Is(err, ErrOutboxStore))
+
+		store.markErr = nil
+		delivered, err := relay.RelayOnce(ctx)
+		require.NoError(t, err)
+		require.Equal(t, 1, delivered)
+		require.Equal(t, []string{"a-1", "a-1"}, eventIDs(publisher.Events()))
+	})
+
+	t.Run("Store error", func(t *testing.T) {
+		store := newMockStore()
+		store.pendingErr = errors.New("store down")
+		_, err := NewRelay(store, &mockPublisher{}, DefaultRelayConfig).RelayOnce(ctx)
+		require.True(t, errors.Is(err, ErrOutboxStore))
+	})
+
+	t.Run("Lock held by another relay", func(t *testing.T) {
+		store := &lockingStore{mockStore: newMockStore(message(1, "a"), message(2, "b"))}
+		publisher := &mockPublisher{}
+		relay := NewRelay(store, publisher, DefaultRelayConfig)
+
+		require.True(t, store.tryLock())
+		delivered, err := relay.RelayOnce(ctx)
+		require.NoError(t, err)
+		require.Zero(t, delivered)
+		require.Empty(t, publisher.Events(), "only the relay holding the lock should publish")
+
+		store.unlock()
+		delivered, err = relay.RelayOnce(ctx)
+		require.NoError(t, err)
+		require.Equal(t, 2, delivered)
+		require.Equal(t, []string{"a-1", "b-2"}, eventIDs(publisher.Events()))
+
+		store.lockErr = errors.New("store down")
+		_, err = relay.RelayOnce(ctx)
+		require.True(t, errors.Is(err, ErrOutboxStore))
+	})
+
+	t.Run("Run", func(t *testing.T) {
+		store := newMockStore(message(1, "a"), message(2, "a"), message(3, "b"))
+		publisher := &mockPublisher{}
+		relay := NewRelay(store, publisher, RelayConfig{
+			BatchSize: 2,
+			Interval:  10 * time.Millisecond,
+			Retention: time.Hour,
+		})
+		runCtx, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+		defer cancel()
+		relay.Run(runCtx, func(err error) {
+			t.Errorf("unexpected error: %v", err)
+		})
+		require.Equal(t, []string{"a-1", "a-2", "b-3"}, eventIDs(publisher.Events()))
+		require.Greater(t, store.purges, 0)
+	})
+}
@@ -0,0 +1,176 @@
+package pgstore
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/mountolive/back-blog-go/post/audit"
+)
+
+var (
+	// AuditAppendError is self-described
+	AuditAppendError = errors.New("error occurred when trying to append an audit entry")
+	// AuditReadError is self-described
+	AuditReadError = errors.New("error occurred when trying to read the audit log")
+)
+
+const (
+	appendAuditEntry = `
+         INSERT INTO audit_log (event_id, name, aggregate_id, payload, actor,
+                                correlation_id, outcome, error, duration_ns, occurred_at)
+         VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+         RETURNING seq
+  `
+	selectAuditColumns = `
+         SELECT seq, event_id, name, aggregate_id, payload, actor,
+                correlation_id, outcome, error, duration_ns, occurred_at
+         FROM audit_log
+  `
+	selectAuditHistory = selectAuditColumns + `
+         WHERE aggregate_id = $1
+         ORDER BY seq
+  `
+	// an empty filter matches any value
+	selectAuditEntries = selectAuditColumns + `
+         WHERE ($1 = '' OR actor = $1)
+           AND ($2::timestamptz IS NULL OR occurred_at >= $2)
+           AND ($3::timestamptz IS NULL OR occurred_at <= $3)
+         ORDER BY seq
+         LIMIT $4 OFFSET $5
+  `
+)
+
+// AuditPgStore keeps the audit log in the audit_log table,
+// updates and deletions of its rows are rejected
+type AuditPgStore struct {
+	db *pgxpool.Pool
+}
+
+var _ audit.Store = &AuditPgStore{}
+
+// Creates a store for the audit log
+func NewAuditPgStore(ctx context.Context, url string) (*AuditPgStore, error) {
+	db, err := pgxpool.Connect(ctx, url)
+	if err != nil {
+		return nil, wrapErrorInfo(ConnectionError, err.Error())
+	}
+	_, err = db.Exec(ctx, `
+         CREATE TABLE IF NOT EXISTS audit_log (
+           seq            BIGSERIAL NOT NULL PRIMARY KEY,
+           event_id       TEXT NOT NULL DEFAULT '',
+           name           TEXT NOT NULL,
+           aggregate_id   TEXT NOT NULL DEFAULT '',
+           payload        JSONB NOT NULL,
+           actor          TEXT NOT NULL DEFAULT '',
+           correlation_id TEXT NOT NULL DEFAULT '',
+           outcome        TEXT NOT NULL,
+           error          TEXT NOT NULL DEFAULT '',
+           duration_ns    BIGINT NOT NULL,
+           occurred_at    TIMESTAMP WITH TIME ZONE NOT NULL
+         );
+
+         CREATE INDEX IF NOT EXISTS audit_log_aggregate_id_idx
+         ON audit_log (aggregate_id);
+
+         CREATE INDEX IF NOT EXISTS audit_log_actor_occurred_at_idx
+         ON audit_log (actor, occurred_at);
+
+         CREATE OR REPLACE FUNCTION reject_audit_log_change()
+         RETURNS TRIGGER AS $$
+         BEGIN
+           RAISE EXCEPTION 'audit_log is append-only';
+         END;
+         $$ LANGUAGE plpgsql;
+
+         DROP TRIGGER IF EXISTS audit_log_append_only ON audit_log;
+
+         CREATE TRIGGER audit_log_append_only
+         BEFORE UPDATE OR DELETE ON audit_log
+         FOR EACH ROW
+         EXECUTE PROCEDURE reject_audit_log_change();
+  `)
+	if err != nil {
+		return nil, wrapErrorInfo(TableCreationError, err.Error())
+	}
+	return &AuditPgStore{db}, nil
+}
+
+// Append records entry, assigning its Seq
+func (p *AuditPgStore) Append(ctx context.Context, entry *audit.Entry) error {
+	payload, err := json.Marshal(entry.Payload)
+	if err != nil {
+		return wrapErrorInfo(AuditAppendError, err.Error())
+	}
+	err = p.db.QueryRow(ctx, appendAuditEntry,
+		entry.EventID, entry.Name, entry.AggregateID, payload, entry.Actor,
+		entry.CorrelationID, entry.Outcome, entry.Error,
+		entry.Duration.Nanoseconds(), entry.OccurredAt,
+	).Scan(&entry.Seq)
+	if err != nil {
+		return wrapErrorInfo(AuditAppendError, err.Error())
+	}
+	return nil
+}
+
+// History returns the entries of the passed aggregate, oldest first
+func (p *AuditPgStore) History(ctx context.Context,
+	aggregateID string) ([]*audit.Entry, error) {
+	rows, err := p.db.Query(ctx, selectAuditHistory, aggregateID)
+	if err != nil {
+		return nil, wrapErrorInfo(AuditReadError, err.Error())
+	}
+	return scanAuditEntries(rows)
+}
+
+// Query returns the entries matching filter, oldest first
+func (p *AuditPgStore) Query(ctx context.Context,
+	filter audit.Filter) ([]*audit.Entry, error) {
+	var from, to, limit interface{}
+	if !filter.From.IsZero() {
+		from = filter.From
+	}
+	if !filter.To.IsZero() {
+		to = filter.To
+	}
+	if filter.Limit > 0 {
+		limit = filter.Limit
+	}
+	rows, err := p.db.Query(ctx, selectAuditEntries,
+		filter.Actor, from, to, limit, filter.Offset,
+	)
+	if err != nil {
+		return nil, wrapErrorInfo(AuditReadError, err.Error())
+	}
+	return scanAuditEntries(rows)
+}
+
+func scanAuditEntries(rows pgx.Rows) ([]*audit.Entry, error) {
+	defer rows.Close()
+	entries := []*audit.Entry{}
+	for rows.Next() {
+		entry := &audit.Entry{}
+		var payload []byte
+		var duration int64
+		err := rows.Scan(
+			&entry.Seq, &entry.EventID, &entry.Name, &entry.AggregateID, &payload,
+			&entry.Actor, &entry.CorrelationID, &entry.Outcome, &entry.Error,
+			&duration, &entry.OccurredAt,
+		)
+		if err != nil {
+			return nil, wrapErrorInfo(AuditReadError, err.Error())
+		}
+		if err := json.Unmarshal(payload, &entry.Payload); err != nil {
+			return nil, wrapErrorInfo(AuditReadError, err.Error())
+		}
+		entry.Duration = time.Duration(duration)
+		entries = append(entries, entry)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, wrapErrorInfo(AuditReadError, err.Error())
+	}
+	return entries, nil
+}
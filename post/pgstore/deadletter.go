@@ -0,0 +1,187 @@
+package pgstore
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/mountolive/back-blog-go/post/deadletter"
+)
+
+var (
+	// DeadLetterWriteError is self-described
+	DeadLetterWriteError = errors.New("error occurred when trying to write a dead letter")
+	// DeadLetterReadError is self-described
+	DeadLetterReadError = errors.New("error occurred when trying to read dead letters")
+	// DeadLetterDeleteError is self-described
+	DeadLetterDeleteError = errors.New("error occurred when trying to delete a dead letter")
+)
+
+const (
+	insertDeadLetter = `
+         INSERT INTO dead_letters (subject, data, header, reason, error, attempts, failed_at)
+         VALUES ($1, $2, $3, $4, $5, $6, $7)
+         RETURNING id
+  `
+	// an empty filter matches any value
+	selectDeadLetters = `
+         SELECT id, subject, data, header, reason, error, attempts, failed_at
+         FROM dead_letters
+         WHERE ($1 = '' OR subject = $1) AND ($2 = '' OR reason = $2)
+         ORDER BY failed_at DESC, id
+         LIMIT $3 OFFSET $4
+  `
+	selectDeadLetter = `
+         SELECT id, subject, data, header, reason, error, attempts, failed_at
+         FROM dead_letters WHERE id = $1
+  `
+	updateDeadLetter = `
+         UPDATE dead_letters
+         SET subject = $2, data = $3, header = $4, reason = $5, error = $6,
+             attempts = $7, failed_at = $8
+         WHERE id = $1
+  `
+	deleteDeadLetter = "DELETE FROM dead_letters WHERE id = $1"
+)
+
+// DeadLetterPgStore keeps the dead letters in the dead_letters table
+type DeadLetterPgStore struct {
+	db *pgxpool.Pool
+}
+
+var _ deadletter.Store = &DeadLetterPgStore{}
+
+// Creates a store for the dead letters
+func NewDeadLetterPgStore(ctx context.Context,
+	url string) (*DeadLetterPgStore, error) {
+	db, err := pgxpool.Connect(ctx, url)
+	if err != nil {
+		return nil, wrapErrorInfo(ConnectionError, err.Error())
+	}
+	_, err = db.Exec(ctx, `
+         CREATE EXTENSION IF NOT EXISTS "uuid-ossp";
+
+         CREATE TABLE IF NOT EXISTS dead_letters (
+           id         UUID NOT NULL PRIMARY KEY DEFAULT uuid_generate_v4(),
+           subject    TEXT NOT NULL,
+           data       TEXT NOT NULL,
+           header     JSONB NOT NULL DEFAULT '{}',
+           reason     TEXT NOT NULL DEFAULT '',
+           error      TEXT NOT NULL DEFAULT '',
+           attempts   INTEGER NOT NULL DEFAULT 1,
+           failed_at  TIMESTAMP WITH TIME ZONE NOT NULL
+         );
+
+         CREATE INDEX IF NOT EXISTS dead_letters_failed_at_idx
+         ON dead_letters (failed_at);
+  `)
+	if err != nil {
+		return nil, wrapErrorInfo(TableCreationError, err.Error())
+	}
+	return &DeadLetterPgStore{db}, nil
+}
+
+// Save records letter, assigning its ID
+func (p *DeadLetterPgStore) Save(ctx context.Context, letter *deadletter.Letter) error {
+	header, err := json.Marshal(letter.Header)
+	if err != nil {
+		return wrapErrorInfo(DeadLetterWriteError, err.Error())
+	}
+	err = p.db.QueryRow(ctx, insertDeadLetter,
+		letter.Subject, letter.Data, header, letter.Reason, letter.Error,
+		letter.Attempts, letter.FailedAt,
+	).Scan(&letter.ID)
+	if err != nil {
+		return wrapErrorInfo(DeadLetterWriteError, err.Error())
+	}
+	return nil
+}
+
+// List returns the letters matching filter, the most recent first
+func (p *DeadLetterPgStore) List(ctx context.Context,
+	filter deadletter.Filter) ([]*deadletter.Letter, error) {
+	var limit interface{}
+	if filter.Limit > 0 {
+		limit = filter.Limit
+	}
+	rows, err := p.db.Query(ctx, selectDeadLetters,
+		filter.Subject, filter.Reason, limit, filter.Offset,
+	)
+	if err != nil {
+		return nil, wrapErrorInfo(DeadLetterReadError, err.Error())
+	}
+	defer rows.Close()
+	letters := []*deadletter.Letter{}
+	for rows.Next() {
+		letter, err := scanDeadLetter(rows)
+		if err != nil {
+			return nil, wrapErrorInfo(DeadLetterReadError, err.Error())
+		}
+		letters = append(letters, letter)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, wrapErrorInfo(DeadLetterReadError, err.Error())
+	}
+	return letters, nil
+}
+
+// Get returns the letter with the passed id
+func (p *DeadLetterPgStore) Get(ctx context.Context, id string) (*deadletter.Letter, error) {
+	letter, err := scanDeadLetter(p.db.QueryRow(ctx, selectDeadLetter, id))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, deadletter.ErrLetterNotFound
+		}
+		return nil, wrapErrorInfo(DeadLetterReadError, err.Error())
+	}
+	return letter, nil
+}
+
+// Update replaces the stored letter with the same ID
+func (p *DeadLetterPgStore) Update(ctx context.Context, letter *deadletter.Letter) error {
+	header, err := json.Marshal(letter.Header)
+	if err != nil {
+		return wrapErrorInfo(DeadLetterWriteError, err.Error())
+	}
+	tag, err := p.db.Exec(ctx, updateDeadLetter,
+		letter.ID, letter.Subject, letter.Data, header, letter.Reason,
+		letter.Error, letter.Attempts, letter.FailedAt,
+	)
+	if err != nil {
+		return wrapErrorInfo(DeadLetterWriteError, err.Error())
+	}
+	if tag.RowsAffected() == 0 {
+		return deadletter.ErrLetterNotFound
+	}
+	return nil
+}
+
+// Delete removes the letter with the passed id
+func (p *DeadLetterPgStore) Delete(ctx context.Context, id string) error {
+	tag, err := p.db.Exec(ctx, deleteDeadLetter, id)
+	if err != nil {
+		return wrapErrorInfo(DeadLetterDeleteError, err.Error())
+	}
+	if tag.RowsAffected() == 0 {
+		return deadletter.ErrLetterNotFound
+	}
+	return nil
+}
+
+func scanDeadLetter(row pgx.Row) (*deadletter.Letter, error) {
+	letter := &deadletter.Letter{}
+	var header []byte
+	err := row.Scan(
+		&letter.ID, &letter.Subject, &letter.Data, &header, &letter.Reason,
+		&letter.Error, &letter.Attempts, &letter.FailedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(header, &letter.Header); err != nil {
+		return nil, err
+	}
+	return letter, nil
+}
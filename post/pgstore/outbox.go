@@ -0,0 +1,159 @@
+package pgstore
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/mountolive/back-blog-go/post/eventbus"
+	"github.com/mountolive/back-blog-go/post/outbox"
+	"github.com/mountolive/back-blog-go/post/usecase"
+)
+
+var (
+	// OutboxWriteError is self-described
+	OutboxWriteError = errors.New("error occurred when trying to write to the outbox")
+	// OutboxReadError is self-described
+	OutboxReadError = errors.New("error occurred when trying to read the outbox")
+	// OutboxDeliveredError is self-described
+	OutboxDeliveredError = errors.New("error occurred when trying to mark an outbox message delivered")
+	// OutboxPurgeError is self-described
+	OutboxPurgeError = errors.New("error occurred when trying to purge the outbox")
+	// OutboxLockError is self-described
+	OutboxLockError = errors.New("error occurred when trying to lock the outbox")
+)
+
+const (
+	createOutboxTable = `
+         CREATE TABLE IF NOT EXISTS outbox (
+           seq            BIGSERIAL NOT NULL PRIMARY KEY,
+           event_id       UUID NOT NULL DEFAULT uuid_generate_v4(),
+           aggregate_id   TEXT NOT NULL,
+           event_name     TEXT NOT NULL,
+           payload        JSONB NOT NULL,
+           actor          TEXT NOT NULL DEFAULT '',
+           correlation_id TEXT NOT NULL DEFAULT '',
+           occurred_at    TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+           delivered_at   TIMESTAMP WITH TIME ZONE
+         );
+
+         CREATE INDEX IF NOT EXISTS outbox_pending_idx
+         ON outbox (seq) WHERE delivered_at IS NULL;
+         CREATE INDEX IF NOT EXISTS outbox_delivered_at_idx
+         ON outbox (delivered_at) WHERE delivered_at IS NOT NULL;
+  `
+	insertOutbox = `
+         INSERT INTO outbox (aggregate_id, event_name, payload, actor, correlation_id)
+         VALUES ($1, $2, $3, $4, $5)
+  `
+	selectPendingOutbox = `
+         SELECT seq, event_id::text, aggregate_id, event_name, payload,
+           actor, correlation_id, occurred_at
+         FROM outbox WHERE delivered_at IS NULL
+         ORDER BY seq LIMIT $1
+  `
+	markOutboxDelivered = "UPDATE outbox SET delivered_at = NOW() WHERE seq = $1"
+	purgeOutbox         = "DELETE FROM outbox WHERE delivered_at < $1"
+	// the lock is released when the transaction holding it ends
+	tryLockOutbox = "SELECT pg_try_advisory_xact_lock(hashtext('outbox_relay'))"
+)
+
+var (
+	_ outbox.Store  = &PgStore{}
+	_ outbox.Locker = &PgStore{}
+)
+
+// writeOutbox records the domain event announcing the change on post,
+// within the transaction making the change
+func writeOutbox(ctx context.Context, tx pgx.Tx, name string, post *usecase.Post) error {
+	payload, err := json.Marshal(post)
+	if err != nil {
+		return wrapErrorInfo(OutboxWriteError, err.Error())
+	}
+	envelope, _ := eventbus.EnvelopeFromContext(ctx)
+	correlationID := envelope.CorrelationID
+	if correlationID == "" {
+		correlationID = envelope.ID
+	}
+	_, err = tx.Exec(ctx, insertOutbox,
+		post.Id, name, payload, envelope.Actor, correlationID,
+	)
+	if err != nil {
+		return wrapErrorInfo(OutboxWriteError, err.Error())
+	}
+	return nil
+}
+
+// Pending returns up to limit messages of the outbox not delivered yet,
+// in the order they were written
+func (p *PgStore) Pending(ctx context.Context, limit int) ([]outbox.Message, error) {
+	rows, err := p.db.Query(ctx, selectPendingOutbox, limit)
+	if err != nil {
+		return nil, wrapErrorInfo(OutboxReadError, err.Error())
+	}
+	defer rows.Close()
+	messages := []outbox.Message{}
+	for rows.Next() {
+		msg := outbox.Message{}
+		var payload []byte
+		err = rows.Scan(
+			&msg.Seq, &msg.Event.ID, &msg.AggregateID, &msg.Event.Name, &payload,
+			&msg.Actor, &msg.CorrelationID, &msg.Event.OccurredAt,
+		)
+		if err != nil {
+			return nil, wrapErrorInfo(OutboxReadError, err.Error())
+		}
+		err = json.Unmarshal(payload, &msg.Event.Post)
+		if err != nil {
+			return nil, wrapErrorInfo(OutboxReadError, err.Error())
+		}
+		messages = append(messages, msg)
+	}
+	if rows.Err() != nil {
+		return nil, wrapErrorInfo(OutboxReadError, rows.Err().Error())
+	}
+	return messages, nil
+}
+
+// MarkDelivered records the outbox message with the passed seq as delivered
+func (p *PgStore) MarkDelivered(ctx context.Context, seq int64) error {
+	_, err := p.db.Exec(ctx, markOutboxDelivered, seq)
+	if err != nil {
+		return wrapErrorInfo(OutboxDeliveredError, err.Error())
+	}
+	return nil
+}
+
+// PurgeDelivered removes the outbox messages delivered before the passed time
+func (p *PgStore) PurgeDelivered(ctx context.Context, before time.Time) (int64, error) {
+	tag, err := p.db.Exec(ctx, purgeOutbox, before)
+	if err != nil {
+		return 0, wrapErrorInfo(OutboxPurgeError, err.Error())
+	}
+	return tag.RowsAffected(), nil
+}
+
+// WithRelayLock runs relay holding an advisory lock of the outbox, so only
+// one of the processes sharing the database relays it at a time
+// The lock is held by a transaction, kept open until relay returns
+func (p *PgStore) WithRelayLock(ctx context.Context,
+	relay func(context.Context) error) (bool, error) {
+	tx, err := p.db.Begin(ctx)
+	if err != nil {
+		return false, wrapErrorInfo(OutboxLockError, err.Error())
+	}
+	defer func() {
+		_ = tx.Rollback(ctx)
+	}()
+	var locked bool
+	err = tx.QueryRow(ctx, tryLockOutbox).Scan(&locked)
+	if err != nil {
+		return false, wrapErrorInfo(OutboxLockError, err.Error())
+	}
+	if !locked {
+		return false, nil
+	}
+	return true, relay(ctx)
+}
@@ -0,0 +1,145 @@
+package pgstore
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/mountolive/back-blog-go/post/eventbus"
+)
+
+var (
+	// ClaimEventError is self-described
+	ClaimEventError = errors.New("error occurred when trying to claim an event")
+	// CompleteEventError is self-described
+	CompleteEventError = errors.New("error occurred when trying to complete an event")
+	// PurgeEventsError is self-described
+	PurgeEventsError = errors.New("error occurred when trying to purge expired events")
+)
+
+const (
+	// claimEvent only overwrites a record when it's failed or expired;
+	// no row is returned otherwise
+	claimEvent = `
+         INSERT INTO processed_events (key, status, error, expires_at)
+         VALUES ($1, $2, '', $3)
+         ON CONFLICT (key) DO UPDATE
+         SET status = EXCLUDED.status, error = '', result = NULL,
+           expires_at = EXCLUDED.expires_at
+         WHERE processed_events.status = $4 OR processed_events.expires_at <= $5
+         RETURNING key
+  `
+	selectEvent = `
+         SELECT key, status, error, result, expires_at FROM processed_events WHERE key = $1
+  `
+	completeEvent = `
+         INSERT INTO processed_events (key, status, error, result, expires_at)
+         VALUES ($1, $2, $3, $4, $5)
+         ON CONFLICT (key) DO UPDATE
+         SET status = EXCLUDED.status, error = EXCLUDED.error,
+           result = EXCLUDED.result, expires_at = EXCLUDED.expires_at
+  `
+	purgeEvents = "DELETE FROM processed_events WHERE expires_at <= $1"
+)
+
+// ProcessedEventPgStore keeps the keys of the events handled,
+// in the processed_events table
+type ProcessedEventPgStore struct {
+	db *pgxpool.Pool
+}
+
+var _ eventbus.ProcessedEventStore = &ProcessedEventPgStore{}
+
+// Creates a store for the keys of the events handled
+func NewProcessedEventPgStore(ctx context.Context,
+	url string) (*ProcessedEventPgStore, error) {
+	db, err := pgxpool.Connect(ctx, url)
+	if err != nil {
+		return nil, wrapErrorInfo(ConnectionError, err.Error())
+	}
+	_, err = db.Exec(ctx, `
+         CREATE TABLE IF NOT EXISTS processed_events (
+           key        TEXT NOT NULL PRIMARY KEY,
+           status     TEXT NOT NULL,
+           error      TEXT NOT NULL DEFAULT '',
+           expires_at TIMESTAMP WITH TIME ZONE NOT NULL
+         );
+
+         ALTER TABLE processed_events ADD COLUMN IF NOT EXISTS result JSONB;
+
+         CREATE INDEX IF NOT EXISTS processed_events_expires_at_idx
+         ON processed_events (expires_at);
+  `)
+	if err != nil {
+		return nil, wrapErrorInfo(TableCreationError, err.Error())
+	}
+	return &ProcessedEventPgStore{db}, nil
+}
+
+// Claim records key as pending, until lease passes, unless it's already
+// recorded as pending or succeeded, and not expired
+func (p *ProcessedEventPgStore) Claim(ctx context.Context, key string,
+	lease time.Duration) (*eventbus.ProcessedEvent, bool, error) {
+	now := time.Now()
+	var claimedKey string
+	err := p.db.QueryRow(ctx, claimEvent,
+		key, eventbus.StatusPending, now.Add(lease), eventbus.StatusFailed, now,
+	).Scan(&claimedKey)
+	if err == nil {
+		return nil, true, nil
+	}
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return nil, false, wrapErrorInfo(ClaimEventError, err.Error())
+	}
+	existing := &eventbus.ProcessedEvent{}
+	var result []byte
+	err = p.db.QueryRow(ctx, selectEvent, key).Scan(
+		&existing.Key, &existing.Status, &existing.Error, &result, &existing.ExpiresAt,
+	)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			// purged in between, reported as not claimed for the event to be retried
+			return nil, false, nil
+		}
+		return nil, false, wrapErrorInfo(ClaimEventError, err.Error())
+	}
+	if result != nil {
+		err = json.Unmarshal(result, &existing.Result)
+		if err != nil {
+			return nil, false, wrapErrorInfo(ClaimEventError, err.Error())
+		}
+	}
+	return existing, false, nil
+}
+
+// Complete records the outcome of a claimed key
+// The result is kept as JSON, so its numbers are read back as float64
+func (p *ProcessedEventPgStore) Complete(ctx context.Context, key, status,
+	errMsg string, result map[string]interface{}, ttl time.Duration) error {
+	var encoded []byte
+	if result != nil {
+		var err error
+		encoded, err = json.Marshal(result)
+		if err != nil {
+			return wrapErrorInfo(CompleteEventError, err.Error())
+		}
+	}
+	_, err := p.db.Exec(ctx, completeEvent, key, status, errMsg, encoded, time.Now().Add(ttl))
+	if err != nil {
+		return wrapErrorInfo(CompleteEventError, err.Error())
+	}
+	return nil
+}
+
+// PurgeExpired removes the records expired by now
+func (p *ProcessedEventPgStore) PurgeExpired(ctx context.Context,
+	now time.Time) (int64, error) {
+	tag, err := p.db.Exec(ctx, purgeEvents, now)
+	if err != nil {
+		return 0, wrapErrorInfo(PurgeEventsError, err.Error())
+	}
+	return tag.RowsAffected(), nil
+}
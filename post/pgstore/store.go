@@ -22,6 +22,16 @@ type PgStore struct {
 	db *pgxpool.Pool
 }
 
+var (
+	_ usecase.PostStore    = &PgStore{}
+	_ usecase.UserRefStore = &PgStore{}
+)
+
+// querier is satisfied by both *pgxpool.Pool and pgx.Tx
+type querier interface {
+	Query(context.Context, string, ...interface{}) (pgx.Rows, error)
+}
+
 var (
 	// TODO Add documentation and rename post's store errors
 	ConnectionError        = errors.New("error occurred when connecting to the DB")
@@ -32,14 +42,83 @@ var (
 	ReadOneError           = errors.New("error occurred when trying to exec Read query")
 )
 
+const (
+	selectVersion = "SELECT version FROM posts WHERE id = $1"
+	selectTags    = `
+         SELECT array_agg(tg.tag_name)::text[]
+         FROM posts_tags pt
+         JOIN tags tg ON tg.id = pt.tag_id
+         WHERE pt.post_id = $1
+  `
+	deleteTags = "DELETE FROM posts_tags WHERE post_id = $1"
+	// deletePost reads the tags of the post from the snapshot
+	// previous to the delete, whose links are cascaded
+	deletePost = `
+         WITH tagnames AS (
+           SELECT array_agg(tg.tag_name)::text[] AS tag_array
+           FROM posts_tags pt
+           JOIN tags tg ON tg.id = pt.tag_id
+           WHERE pt.post_id = $1
+         ),
+         postids AS (
+           DELETE FROM posts WHERE id = $1 AND version = $2
+           RETURNING id, creator, title, content, created_at, updated_at, version
+         )
+         SELECT
+           p.id, p.creator, p.title, p.content, p.created_at, p.updated_at, p.version,
+           (SELECT t.tag_array FROM tagnames t)
+         FROM postids p;
+  `
+	unlinkTags = `
+         DELETE FROM posts_tags pt USING tags tg
+         WHERE pt.tag_id = tg.id AND pt.post_id = $1 AND tg.tag_name = ANY($2::text[]::citext[])
+  `
+	selectAuthors = `
+         SELECT pa.post_id::text, pa.user_id, pa.role
+         FROM posts_authors pa
+         WHERE pa.post_id = ANY($1::uuid[])
+         ORDER BY pa.post_id, pa.position
+  `
+	deleteAuthors = "DELETE FROM posts_authors WHERE post_id = $1"
+	// linkAuthorsStatement keeps the order in which the authors are passed
+	linkAuthorsStatement = `
+         INSERT INTO posts_authors (post_id, user_id, role, position)
+         SELECT $1::uuid, a.user_id, a.role, a.position - 1
+         FROM unnest($2::text[], $3::text[]) WITH ORDINALITY AS a(user_id, role, position)
+  `
+	selectUserRefs = `
+         SELECT creator FROM posts WHERE creator IS NOT NULL
+         UNION
+         SELECT user_id FROM posts_authors
+  `
+	replaceCreator = "UPDATE posts SET creator = $2 WHERE creator = $1"
+	copyAuthorRef  = `
+         INSERT INTO posts_authors (post_id, user_id, role, position)
+         SELECT post_id, $2, role, position FROM posts_authors WHERE user_id = $1
+         ON CONFLICT (post_id, user_id) DO NOTHING
+  `
+	deleteAuthorRef = "DELETE FROM posts_authors WHERE user_id = $1"
+	// keepUpdatedAt makes the set_timestamp trigger leave updated_at
+	// as it is, until the transaction ends
+	keepUpdatedAt     = "SET LOCAL posts.keep_updated_at = 'on'"
+	linkTagsStatement = `
+         WITH tagids AS (
+           %s
+         )
+         INSERT INTO posts_tags (post_id, tag_id)
+         SELECT $1::uuid, t.id FROM tagids t
+         ON CONFLICT (post_id, tag_id) DO NOTHING
+  `
+)
+
 const (
 	insertTag = `
          INSERT INTO tags (tag_name) VALUES %s
-         ON CONFLICT (tag_name) DO UPDATE SET tag_name = EXCLUDED.tag_name RETURNING id
+         ON CONFLICT (tag_name) DO UPDATE SET tag_name = EXCLUDED.tag_name RETURNING id, tag_name
   `
 	selectPost = `
          SELECT
-           id, p.creator, p.title, p.content, p.created_at, p.updated_at, t.tag_array
+           id, p.creator, p.title, p.content, p.created_at, p.updated_at, p.version, t.tag_array
          FROM posts p LEFT OUTER JOIN (
            SELECT pt.post_id AS id, array_agg(tg.tag_name)::text[] AS tag_array
            FROM posts_tags pt
@@ -52,7 +131,18 @@ const (
          INSERT INTO posts_tags (post_id, tag_id)
          SELECT p.id, t.id FROM tagids t CROSS JOIN postids p
          ON CONFLICT (post_id, tag_id)
-         DO UPDATE SET post_id=EXCLUDED.post_id, tag_id=EXCLUDED.tag_id;
+         DO UPDATE SET post_id=EXCLUDED.post_id, tag_id=EXCLUDED.tag_id
+  `
+	// returningColumns are the columns of posts needed for building a Post,
+	// tags excluded
+	returningColumns = "RETURNING id, creator, title, content, created_at, updated_at, version"
+	// selectWritten reads the written post, along with its tags, from the
+	// RETURNING clauses of the postids and tagids CTEs
+	selectWritten = `
+         SELECT
+           p.id, p.creator, p.title, p.content, p.created_at, p.updated_at, p.version,
+           (SELECT array_agg(t.tag_name)::text[] FROM tagids t)
+         FROM postids p;
   `
 )
 
@@ -71,7 +161,9 @@ func NewPostPgStore(ctx context.Context, url string) (*PgStore, error) {
 }
 
 // Creates a Post with data with corresponding CreatePostDto
-// TODO Remove Post from return tuple, Create, pgstore
+// The returned Post is the one written by the insert itself, its
+// authors being linked right after
+// The posts.v1.created event is written to the outbox in the same transaction
 func (p *PgStore) Create(ctx context.Context,
 	create *usecase.CreatePostDto) (*usecase.Post, error) {
 	tx, err := p.db.Begin(ctx)
@@ -81,7 +173,8 @@ func (p *PgStore) Create(ctx context.Context,
 	defer func() {
 		_ = tx.Rollback(ctx)
 	}()
-	postStatement := "INSERT INTO posts (creator, title, content) VALUES ($1, $2, $3) RETURNING id"
+	postStatement := "INSERT INTO posts (creator, title, content) VALUES ($1, $2, $3) " +
+		returningColumns
 	insertTagStatement := fmt.Sprintf(insertTag, insertParamsString(create.Tags, 4))
 	joinUpsert := `
          WITH postids AS (
@@ -89,13 +182,16 @@ func (p *PgStore) Create(ctx context.Context,
          ),
          tagids AS (
            %s
+         ),
+         posttags AS (
+           %s
          )
 
          %s
   `
 	statement := fmt.Sprintf(
 		joinUpsert,
-		postStatement, insertTagStatement, insertPostTag,
+		postStatement, insertTagStatement, insertPostTag, selectWritten,
 	)
 	params := make([]interface{}, 0)
 	params = append(params, create.Creator)
@@ -104,21 +200,35 @@ func (p *PgStore) Create(ctx context.Context,
 	for _, tag := range create.Tags {
 		params = append(params, tag)
 	}
-	_, err = tx.Exec(ctx, statement, params...)
+	post := &usecase.Post{}
+	err = rowToPost(tx.QueryRow(ctx, statement, params...), post)
+	if err != nil {
+		return nil, wrapErrorInfo(ExecTransactionError, err.Error())
+	}
+	err = linkAuthors(ctx, tx, post.Id, usecase.NormalizeAuthors(create.Creator, create.Authors))
 	if err != nil {
 		return nil, wrapErrorInfo(ExecTransactionError, err.Error())
 	}
+	err = attachAuthors(ctx, tx, post)
+	if err != nil {
+		return nil, wrapErrorInfo(ExecTransactionError, err.Error())
+	}
+	err = writeOutbox(ctx, tx, usecase.PostCreatedEventNameV1, post)
+	if err != nil {
+		return nil, err
+	}
 	err = tx.Commit(ctx)
 	if err != nil {
 		return nil, wrapErrorInfo(ExecTransactionError, err.Error())
 	}
-
-	// TODO Post's read by Creator in Create's return is an open door for inconsistent results (write skew)
-	return p.getNewestByCreator(ctx, create.Creator), nil
+	return post, nil
 }
 
-// Updates the corresponding post with the Id from the UpdatePostDto passed
-// TODO Remove Post from return tuple, Update, pgstore
+// Updates the corresponding post with the Id from the UpdatePostDto passed,
+// as long as its stored version matches the passed one
+// Only the fields present in the UpdatePostDto are touched
+// The returned Post is the one written by the update itself
+// The posts.v1.updated event is written to the outbox in the same transaction
 func (p *PgStore) Update(ctx context.Context,
 	update *usecase.UpdatePostDto) (*usecase.Post, error) {
 	tx, err := p.db.Begin(ctx)
@@ -128,21 +238,105 @@ func (p *PgStore) Update(ctx context.Context,
 	defer func() {
 		_ = tx.Rollback(ctx)
 	}()
-	statement := buildUpdateStatement(update)
-	params := buildUpdateParams(update)
-	_, err = tx.Exec(ctx, statement, params...)
+	statement, params := buildUpdatePostStatement(update)
+	post := &usecase.Post{}
+	err = rowToPostColumns(tx.QueryRow(ctx, statement, params...), post)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, p.missedUpdateError(ctx, tx, update.Id, update.Version)
+		}
+		return nil, wrapErrorInfo(ExecTransactionError, err.Error())
+	}
+	if update.Tags != nil {
+		_, err = tx.Exec(ctx, deleteTags, post.Id)
+		if err != nil {
+			return nil, wrapErrorInfo(ExecTransactionError, err.Error())
+		}
+		err = linkTags(ctx, tx, post.Id, update.Tags)
+		if err != nil {
+			return nil, wrapErrorInfo(ExecTransactionError, err.Error())
+		}
+	}
+	if len(update.AddTags) > 0 {
+		err = linkTags(ctx, tx, post.Id, update.AddTags)
+		if err != nil {
+			return nil, wrapErrorInfo(ExecTransactionError, err.Error())
+		}
+	}
+	if len(update.RemoveTags) > 0 {
+		_, err = tx.Exec(ctx, unlinkTags, post.Id, update.RemoveTags)
+		if err != nil {
+			return nil, wrapErrorInfo(ExecTransactionError, err.Error())
+		}
+	}
+	if update.Authors != nil {
+		_, err = tx.Exec(ctx, deleteAuthors, post.Id)
+		if err != nil {
+			return nil, wrapErrorInfo(ExecTransactionError, err.Error())
+		}
+		err = linkAuthors(ctx, tx, post.Id, usecase.NormalizeAuthors(post.Creator, update.Authors))
+		if err != nil {
+			return nil, wrapErrorInfo(ExecTransactionError, err.Error())
+		}
+	}
+	err = tx.QueryRow(ctx, selectTags, post.Id).Scan(&post.Tags)
+	if err != nil {
+		return nil, wrapErrorInfo(ExecTransactionError, err.Error())
+	}
+	err = attachAuthors(ctx, tx, post)
+	if err != nil {
+		return nil, wrapErrorInfo(ExecTransactionError, err.Error())
+	}
+	err = writeOutbox(ctx, tx, usecase.PostUpdatedEventNameV1, post)
+	if err != nil {
+		return nil, err
+	}
+	err = tx.Commit(ctx)
+	if err != nil {
+		return nil, wrapErrorInfo(ExecTransactionError, err.Error())
+	}
+	return post, nil
+}
+
+// Deletes the post with the passed Id, as long as its stored version
+// matches the passed one, and returns it as it was before deletion
+// The posts.v1.deleted event is written to the outbox in the same transaction
+func (p *PgStore) Delete(ctx context.Context,
+	deleted *usecase.DeletePostDto) (*usecase.Post, error) {
+	tx, err := p.db.Begin(ctx)
+	if err != nil {
+		return nil, wrapErrorInfo(CreateTransactionError, err.Error())
+	}
+	defer func() {
+		_ = tx.Rollback(ctx)
+	}()
+	// the authors' links are cascaded as well
+	authors, err := selectAuthorsOf(ctx, tx, deleted.Id)
 	if err != nil {
 		return nil, wrapErrorInfo(ExecTransactionError, err.Error())
 	}
+	post := &usecase.Post{}
+	err = rowToPost(tx.QueryRow(ctx, deletePost, deleted.Id, deleted.Version), post)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, p.missedUpdateError(ctx, tx, deleted.Id, deleted.Version)
+		}
+		return nil, wrapErrorInfo(ExecTransactionError, err.Error())
+	}
+	post.Authors = authors[post.Id]
+	err = writeOutbox(ctx, tx, usecase.PostDeletedEventNameV1, post)
+	if err != nil {
+		return nil, err
+	}
 	err = tx.Commit(ctx)
 	if err != nil {
 		return nil, wrapErrorInfo(ExecTransactionError, err.Error())
 	}
-	// TODO Post's ReadOne in Update's return is an open door for inconsistent results (write skew)
-	return p.ReadOne(ctx, update.Id)
+	return post, nil
 }
 
 // Reads from the store the post with the passed Id
+// ErrPostNotFound is returned when there's no post with such Id
 func (p *PgStore) ReadOne(ctx context.Context, id string) (*usecase.Post, error) {
 	post := &usecase.Post{}
 	row := p.db.QueryRow(
@@ -151,13 +345,20 @@ func (p *PgStore) ReadOne(ctx context.Context, id string) (*usecase.Post, error)
 		id,
 	)
 	err := rowToPost(row, post)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, wrapErrorInfo(usecase.ErrPostNotFound, id)
+		}
+		return nil, wrapErrorInfo(ReadOneError, err.Error())
+	}
+	err = attachAuthors(ctx, p.db, post)
 	if err != nil {
 		return nil, wrapErrorInfo(ReadOneError, err.Error())
 	}
 	return post, nil
 }
 
-// Filters either by tags and/or creation date
+// Filters either by tags, authors and/or creation date
 func (p *PgStore) Filter(ctx context.Context,
 	filter *usecase.GeneralFilter) ([]*usecase.Post, error) {
 	params := make([]interface{}, 0)
@@ -179,9 +380,65 @@ func (p *PgStore) Filter(ctx context.Context,
 	if rows.Err() != nil {
 		return nil, wrapErrorInfo(FilterError, err.Error())
 	}
+	err = attachAuthors(ctx, p.db, posts...)
+	if err != nil {
+		return nil, wrapErrorInfo(FilterError, err.Error())
+	}
 	return posts, nil
 }
 
+// UserRefs returns the distinct creators and authors of the posts
+func (p *PgStore) UserRefs(ctx context.Context) ([]string, error) {
+	rows, err := p.db.Query(ctx, selectUserRefs)
+	if err != nil {
+		return nil, wrapErrorInfo(ReadOneError, err.Error())
+	}
+	defer rows.Close()
+	refs := []string{}
+	for rows.Next() {
+		var ref string
+		if err := rows.Scan(&ref); err != nil {
+			return nil, wrapErrorInfo(ReadOneError, err.Error())
+		}
+		refs = append(refs, ref)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, wrapErrorInfo(ReadOneError, err.Error())
+	}
+	return refs, nil
+}
+
+// ReplaceUserRef identifies the creator and authors identified as from
+// as to instead, in every post. updated_at is kept, as the posts' contents
+// don't change; authors already identified as to are kept as they are
+func (p *PgStore) ReplaceUserRef(ctx context.Context, from, to string) error {
+	tx, err := p.db.Begin(ctx)
+	if err != nil {
+		return wrapErrorInfo(CreateTransactionError, err.Error())
+	}
+	defer func() {
+		_ = tx.Rollback(ctx)
+	}()
+	statements := []struct {
+		sql    string
+		params []interface{}
+	}{
+		{keepUpdatedAt, nil},
+		{replaceCreator, []interface{}{from, to}},
+		{copyAuthorRef, []interface{}{from, to}},
+		{deleteAuthorRef, []interface{}{from}},
+	}
+	for _, statement := range statements {
+		if _, err := tx.Exec(ctx, statement.sql, statement.params...); err != nil {
+			return wrapErrorInfo(ExecTransactionError, err.Error())
+		}
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return wrapErrorInfo(ExecTransactionError, err.Error())
+	}
+	return nil
+}
+
 // CreateTestContainer creates a DB container for integration tests
 func CreateTestContainer(t *testing.T, containerName string) *PgStore {
 	err := godotenv.Load("../.env.test")
@@ -267,6 +524,10 @@ func (p *PgStore) createPostAndTagTable(ctx context.Context) error {
          CREATE OR REPLACE FUNCTION trigger_set_timestamp()
          RETURNS TRIGGER AS $$
          BEGIN
+           -- set by ReplaceUserRef, which doesn't change the posts' contents
+           IF current_setting('posts.keep_updated_at', true) = 'on' THEN
+             RETURN NEW;
+           END IF;
            NEW.updated_at = NOW();
            RETURN NEW;
          END;
@@ -281,6 +542,8 @@ func (p *PgStore) createPostAndTagTable(ctx context.Context) error {
            updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
          );
 
+         ALTER TABLE posts ADD COLUMN IF NOT EXISTS version INTEGER NOT NULL DEFAULT 1;
+
          CREATE INDEX IF NOT EXISTS idx_creator ON posts (creator);
 
          CREATE TABLE IF NOT EXISTS tags (
@@ -301,6 +564,25 @@ func (p *PgStore) createPostAndTagTable(ctx context.Context) error {
          CREATE INDEX IF NOT EXISTS idx_post_id ON posts_tags (post_id);
          CREATE INDEX IF NOT EXISTS idx_tag_id ON posts_tags (tag_id);
 
+         CREATE TABLE IF NOT EXISTS posts_authors (
+           post_id    UUID NOT NULL,
+           user_id    TEXT NOT NULL CHECK (user_id <> ''),
+           role       TEXT NOT NULL CHECK (role IN ('author', 'editor', 'contributor')),
+           position   INTEGER NOT NULL,
+           CONSTRAINT fk_author_post FOREIGN KEY (post_id) REFERENCES posts (id) ON DELETE CASCADE,
+           CONSTRAINT post_author_user_id PRIMARY KEY (post_id, user_id)
+         );
+
+         CREATE INDEX IF NOT EXISTS idx_author_user_id ON posts_authors (user_id);
+
+         -- the creators of the posts written before authors existed
+         -- are their only authors
+         INSERT INTO posts_authors (post_id, user_id, role, position)
+         SELECT p.id, p.creator, 'author', 0 FROM posts p
+         WHERE p.creator IS NOT NULL AND NOT EXISTS (
+           SELECT 1 FROM posts_authors pa WHERE pa.post_id = p.id
+         );
+
          DROP TRIGGER IF EXISTS set_timestamp ON posts;
          CREATE TRIGGER set_timestamp
          BEFORE UPDATE ON posts
@@ -310,22 +592,29 @@ func (p *PgStore) createPostAndTagTable(ctx context.Context) error {
 	if err != nil {
 		return err
 	}
+	_, err = tx.Exec(ctx, createOutboxTable)
+	if err != nil {
+		return err
+	}
 	return tx.Commit(ctx)
 }
 
-func (p *PgStore) getNewestByCreator(ctx context.Context,
-	creator string) *usecase.Post {
-	post := &usecase.Post{}
-	row := p.db.QueryRow(
-		ctx,
-		fmt.Sprintf(selectPost, "WHERE p.creator = $1 ORDER BY updated_at DESC LIMIT 1"),
-		creator,
-	)
-	err := rowToPost(row, post)
+// missedUpdateError tells apart a post that doesn't exist from one
+// whose version changed, for an update that didn't affect any row
+func (p *PgStore) missedUpdateError(ctx context.Context, tx pgx.Tx,
+	id string, expectedVersion int) error {
+	var version int
+	err := tx.QueryRow(ctx, selectVersion, id).Scan(&version)
 	if err != nil {
-		return nil
+		if errors.Is(err, pgx.ErrNoRows) {
+			return wrapErrorInfo(usecase.ErrPostNotFound, id)
+		}
+		return wrapErrorInfo(ExecTransactionError, err.Error())
 	}
-	return post
+	return wrapErrorInfo(
+		usecase.ErrVersionConflict,
+		fmt.Sprintf("expected %d, found %d", expectedVersion, version),
+	)
 }
 
 func buildFilterStatement(
@@ -349,6 +638,17 @@ func buildFilterStatement(
 		*params = append(*params, filter.Tag)
 		statementIdx += 1
 	}
+	if filter.Author != "" {
+		whereClauseSegments = append(
+			whereClauseSegments,
+			fmt.Sprintf(
+				"id IN (SELECT pa.post_id FROM posts_authors pa WHERE pa.user_id = $%d)",
+				statementIdx,
+			),
+		)
+		*params = append(*params, filter.Author)
+		statementIdx += 1
+	}
 	if !filter.From.IsZero() {
 		whereClauseSegments = append(
 			whereClauseSegments,
@@ -376,81 +676,41 @@ func buildFilterStatement(
 	return fmt.Sprintf(selectPost, whereClause)
 }
 
-func buildUpdateStatement(update *usecase.UpdatePostDto) string {
+// buildUpdatePostStatement builds the update of the post's own columns,
+// only assigning the fields present in the UpdatePostDto
+func buildUpdatePostStatement(update *usecase.UpdatePostDto) (string, []interface{}) {
 	separated := []string{}
+	params := make([]interface{}, 0)
 	preparedIndex := 1
-	deleteAndJoinUpsert := `
-         WITH deleted AS (
-           %s
-         ),
-         postids AS (
-           %s
-         ),
-         tagids AS (
-           %s
-         )
-
-         %s
-  `
-	deleteStatement := deleteOldTagsStatement(&preparedIndex)
 	checkAndAppendAssignment(
-		update.Content, "content", &separated, &preparedIndex,
+		update.Content, "content", &separated, &params, &preparedIndex,
 	)
 	checkAndAppendAssignment(
-		update.Title, "title", &separated, &preparedIndex,
+		update.Title, "title", &separated, &params, &preparedIndex,
 	)
-	updateStatement := fmt.Sprintf(
-		"UPDATE posts SET %s WHERE id = $%d RETURNING id",
+	separated = append(separated, "version = version + 1")
+	statement := fmt.Sprintf(
+		"UPDATE posts SET %s WHERE id = $%d AND version = $%d %s",
 		strings.Join(separated, ","),
 		preparedIndex,
+		preparedIndex+1,
+		returningColumns,
 	)
-	insertTagStatement := fmt.Sprintf(
-		insertTag,
-		insertParamsString(update.Tags, preparedIndex+1),
-	)
-	tagPostStatement := fmt.Sprintf(
-		deleteAndJoinUpsert,
-		deleteStatement, updateStatement,
-		insertTagStatement, insertPostTag,
-	)
-	return tagPostStatement
-}
-
-func buildUpdateParams(update *usecase.UpdatePostDto) []interface{} {
-	params := make([]interface{}, 0)
-	id := update.Id
-	params = append(params, id)
-	content := update.Content
-	if content != "" {
-		params = append(params, content)
-	}
-	title := update.Title
-	if title != "" {
-		params = append(params, title)
-	}
-	params = append(params, id)
-	for _, tag := range update.Tags {
-		params = append(params, tag)
-	}
-	return params
+	params = append(params, update.Id, update.Version)
+	return statement, params
 }
 
-func checkAndAppendAssignment(param, paramName string,
-	separated *[]string, index *int) {
-	if param != "" {
+func checkAndAppendAssignment(param *string, paramName string,
+	separated *[]string, params *[]interface{}, index *int) {
+	if param != nil {
 		*separated = append(
 			*separated, fmt.Sprintf("%s = $%d", paramName, *index),
 		)
+		*params = append(*params, *param)
 		*index += 1
 	}
 }
 
-func deleteOldTagsStatement(index *int) string {
-	statement := fmt.Sprintf(`DELETE FROM posts_tags WHERE post_id = $%d`, *index)
-	*index += 1
-	return statement
-}
-
 func insertParamsString(tags []string, position int) string {
 	statements := []string{}
 	for i := 0; i < len(tags); i++ {
@@ -461,12 +721,90 @@ func insertParamsString(tags []string, position int) string {
 	return strings.Join(statements, ",")
 }
 
+// linkTags associates the passed tags to the post, creating the tags
+// that don't exist yet
+func linkTags(ctx context.Context, tx pgx.Tx, id string, tags []string) error {
+	statement := fmt.Sprintf(
+		linkTagsStatement,
+		fmt.Sprintf(insertTag, insertParamsString(tags, 2)),
+	)
+	params := make([]interface{}, 0)
+	params = append(params, id)
+	for _, tag := range tags {
+		params = append(params, tag)
+	}
+	_, err := tx.Exec(ctx, statement, params...)
+	return err
+}
+
+// linkAuthors associates the passed authors to the post, in order
+func linkAuthors(ctx context.Context, tx pgx.Tx, id string, authors []usecase.Author) error {
+	userIDs := make([]string, 0, len(authors))
+	roles := make([]string, 0, len(authors))
+	for _, author := range authors {
+		userIDs = append(userIDs, author.ID)
+		roles = append(roles, author.Role)
+	}
+	_, err := tx.Exec(ctx, linkAuthorsStatement, id, userIDs, roles)
+	return err
+}
+
+// selectAuthorsOf reads the authors of the posts with the passed ids,
+// by post's id
+func selectAuthorsOf(ctx context.Context, q querier,
+	ids ...string) (map[string][]usecase.Author, error) {
+	rows, err := q.Query(ctx, selectAuthors, ids)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	authors := map[string][]usecase.Author{}
+	for rows.Next() {
+		var id string
+		var author usecase.Author
+		if err := rows.Scan(&id, &author.ID, &author.Role); err != nil {
+			return nil, err
+		}
+		authors[id] = append(authors[id], author)
+	}
+	return authors, rows.Err()
+}
+
+// attachAuthors reads the authors of all of the posts at once
+func attachAuthors(ctx context.Context, q querier, posts ...*usecase.Post) error {
+	if len(posts) == 0 {
+		return nil
+	}
+	ids := make([]string, 0, len(posts))
+	for _, post := range posts {
+		ids = append(ids, post.Id)
+	}
+	authors, err := selectAuthorsOf(ctx, q, ids...)
+	if err != nil {
+		return err
+	}
+	for _, post := range posts {
+		post.Authors = authors[post.Id]
+	}
+	return nil
+}
+
+// rowToPostColumns scans the post's own columns, tags excluded
+func rowToPostColumns(rawPost pgx.Row, post *usecase.Post) error {
+	return rawPost.Scan(
+		&post.Id, &post.Creator,
+		&post.Title, &post.Content,
+		&post.CreatedAt, &post.UpdatedAt,
+		&post.Version,
+	)
+}
+
 func rowToPost(rawPost pgx.Row, post *usecase.Post) error {
 	return rawPost.Scan(
 		&post.Id, &post.Creator,
 		&post.Title, &post.Content,
 		&post.CreatedAt, &post.UpdatedAt,
-		&post.Tags,
+		&post.Version, &post.Tags,
 	)
 }
 
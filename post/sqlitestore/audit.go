@@ -0,0 +1,140 @@
+package sqlitestore
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/mountolive/back-blog-go/post/audit"
+)
+
+var (
+	// ErrAuditAppend is self-described
+	ErrAuditAppend = errors.New("error occurred when trying to append an audit entry")
+	// ErrAuditRead is self-described
+	ErrAuditRead = errors.New("error occurred when trying to read the audit log")
+)
+
+const (
+	appendAuditEntry = `
+         INSERT INTO audit_log (event_id, name, aggregate_id, payload, actor,
+                                correlation_id, outcome, error, duration_ns, occurred_at)
+         VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+         RETURNING seq
+  `
+	selectAuditColumns = `
+         SELECT seq, event_id, name, aggregate_id, payload, actor,
+                correlation_id, outcome, error, duration_ns, occurred_at
+         FROM audit_log
+  `
+	selectAuditHistory = selectAuditColumns + `
+         WHERE aggregate_id = ?
+         ORDER BY seq
+  `
+	// an empty filter matches any value, a negative limit lists them all
+	selectAuditEntries = selectAuditColumns + `
+         WHERE (?1 = '' OR actor = ?1)
+           AND (?2 IS NULL OR occurred_at >= ?2)
+           AND (?3 IS NULL OR occurred_at <= ?3)
+         ORDER BY seq
+         LIMIT ?4 OFFSET ?5
+  `
+)
+
+// AuditSQLiteStore keeps the audit log in the audit_log table,
+// updates and deletions of its rows are rejected by triggers
+type AuditSQLiteStore struct {
+	db *sql.DB
+}
+
+var _ audit.Store = &AuditSQLiteStore{}
+
+// Creates a store for the audit log, in the SQLite DB at path,
+// applying the pending migrations
+func NewAuditSQLiteStore(ctx context.Context, path string) (*AuditSQLiteStore, error) {
+	db, err := open(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	return &AuditSQLiteStore{db}, nil
+}
+
+// Append records entry, assigning its Seq
+func (s *AuditSQLiteStore) Append(ctx context.Context, entry *audit.Entry) error {
+	payload, err := json.Marshal(entry.Payload)
+	if err != nil {
+		return wrapErrorInfo(ErrAuditAppend, err.Error())
+	}
+	err = s.db.QueryRowContext(ctx, appendAuditEntry,
+		entry.EventID, entry.Name, entry.AggregateID, string(payload), entry.Actor,
+		entry.CorrelationID, entry.Outcome, entry.Error,
+		entry.Duration.Nanoseconds(), entry.OccurredAt.UnixNano(),
+	).Scan(&entry.Seq)
+	if err != nil {
+		return wrapErrorInfo(ErrAuditAppend, err.Error())
+	}
+	return nil
+}
+
+// History returns the entries of the passed aggregate, oldest first
+func (s *AuditSQLiteStore) History(ctx context.Context,
+	aggregateID string) ([]*audit.Entry, error) {
+	rows, err := s.db.QueryContext(ctx, selectAuditHistory, aggregateID)
+	if err != nil {
+		return nil, wrapErrorInfo(ErrAuditRead, err.Error())
+	}
+	return scanAuditEntries(rows)
+}
+
+// Query returns the entries matching filter, oldest first
+func (s *AuditSQLiteStore) Query(ctx context.Context,
+	filter audit.Filter) ([]*audit.Entry, error) {
+	var from, to interface{}
+	if !filter.From.IsZero() {
+		from = filter.From.UnixNano()
+	}
+	if !filter.To.IsZero() {
+		to = filter.To.UnixNano()
+	}
+	limit := -1
+	if filter.Limit > 0 {
+		limit = filter.Limit
+	}
+	rows, err := s.db.QueryContext(ctx, selectAuditEntries,
+		filter.Actor, from, to, limit, filter.Offset,
+	)
+	if err != nil {
+		return nil, wrapErrorInfo(ErrAuditRead, err.Error())
+	}
+	return scanAuditEntries(rows)
+}
+
+func scanAuditEntries(rows *sql.Rows) ([]*audit.Entry, error) {
+	defer rows.Close()
+	entries := []*audit.Entry{}
+	for rows.Next() {
+		entry := &audit.Entry{}
+		var payload string
+		var duration, occurredAt int64
+		err := rows.Scan(
+			&entry.Seq, &entry.EventID, &entry.Name, &entry.AggregateID, &payload,
+			&entry.Actor, &entry.CorrelationID, &entry.Outcome, &entry.Error,
+			&duration, &occurredAt,
+		)
+		if err != nil {
+			return nil, wrapErrorInfo(ErrAuditRead, err.Error())
+		}
+		if err := json.Unmarshal([]byte(payload), &entry.Payload); err != nil {
+			return nil, wrapErrorInfo(ErrAuditRead, err.Error())
+		}
+		entry.Duration = time.Duration(duration)
+		entry.OccurredAt = time.Unix(0, occurredAt)
+		entries = append(entries, entry)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, wrapErrorInfo(ErrAuditRead, err.Error())
+	}
+	return entries, nil
+}
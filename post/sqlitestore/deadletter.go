@@ -0,0 +1,188 @@
+package sqlitestore
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/mountolive/back-blog-go/post/deadletter"
+)
+
+var (
+	// ErrDeadLetterWrite is self-described
+	ErrDeadLetterWrite = errors.New("error occurred when trying to write a dead letter")
+	// ErrDeadLetterRead is self-described
+	ErrDeadLetterRead = errors.New("error occurred when trying to read dead letters")
+	// ErrDeadLetterDelete is self-described
+	ErrDeadLetterDelete = errors.New("error occurred when trying to delete a dead letter")
+)
+
+const (
+	insertDeadLetter = `
+         INSERT INTO dead_letters (id, subject, data, header, reason, error, attempts, failed_at)
+         VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+  `
+	// an empty filter matches any value, a negative limit lists them all
+	selectDeadLetters = `
+         SELECT id, subject, data, header, reason, error, attempts, failed_at
+         FROM dead_letters
+         WHERE (?1 = '' OR subject = ?1) AND (?2 = '' OR reason = ?2)
+         ORDER BY failed_at DESC, id
+         LIMIT ?3 OFFSET ?4
+  `
+	selectDeadLetter = `
+         SELECT id, subject, data, header, reason, error, attempts, failed_at
+         FROM dead_letters WHERE id = ?
+  `
+	updateDeadLetter = `
+         UPDATE dead_letters
+         SET subject = ?, data = ?, header = ?, reason = ?, error = ?,
+             attempts = ?, failed_at = ?
+         WHERE id = ?
+  `
+	deleteDeadLetter = "DELETE FROM dead_letters WHERE id = ?"
+)
+
+// DeadLetterSQLiteStore keeps the dead letters in the dead_letters table
+type DeadLetterSQLiteStore struct {
+	db *sql.DB
+}
+
+var _ deadletter.Store = &DeadLetterSQLiteStore{}
+
+// Creates a store for the dead letters, in the SQLite DB at path,
+// applying the pending migrations
+func NewDeadLetterSQLiteStore(ctx context.Context,
+	path string) (*DeadLetterSQLiteStore, error) {
+	db, err := open(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	return &DeadLetterSQLiteStore{db}, nil
+}
+
+// Save records letter, assigning its ID
+func (s *DeadLetterSQLiteStore) Save(ctx context.Context, letter *deadletter.Letter) error {
+	header, err := json.Marshal(letter.Header)
+	if err != nil {
+		return wrapErrorInfo(ErrDeadLetterWrite, err.Error())
+	}
+	id, err := newID()
+	if err != nil {
+		return wrapErrorInfo(ErrDeadLetterWrite, err.Error())
+	}
+	_, err = s.db.ExecContext(ctx, insertDeadLetter,
+		id, letter.Subject, letter.Data, string(header), letter.Reason, letter.Error,
+		letter.Attempts, letter.FailedAt.UnixNano(),
+	)
+	if err != nil {
+		return wrapErrorInfo(ErrDeadLetterWrite, err.Error())
+	}
+	letter.ID = id
+	return nil
+}
+
+// List returns the letters matching filter, the most recent first
+func (s *DeadLetterSQLiteStore) List(ctx context.Context,
+	filter deadletter.Filter) ([]*deadletter.Letter, error) {
+	limit := -1
+	if filter.Limit > 0 {
+		limit = filter.Limit
+	}
+	rows, err := s.db.QueryContext(ctx, selectDeadLetters,
+		filter.Subject, filter.Reason, limit, filter.Offset,
+	)
+	if err != nil {
+		return nil, wrapErrorInfo(ErrDeadLetterRead, err.Error())
+	}
+	defer rows.Close()
+	letters := []*deadletter.Letter{}
+	for rows.Next() {
+		letter, err := scanDeadLetter(rows)
+		if err != nil {
+			return nil, wrapErrorInfo(ErrDeadLetterRead, err.Error())
+		}
+		letters = append(letters, letter)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, wrapErrorInfo(ErrDeadLetterRead, err.Error())
+	}
+	return letters, nil
+}
+
+// Get returns the letter with the passed id
+func (s *DeadLetterSQLiteStore) Get(ctx context.Context,
+	id string) (*deadletter.Letter, error) {
+	letter, err := scanDeadLetter(s.db.QueryRowContext(ctx, selectDeadLetter, id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, deadletter.ErrLetterNotFound
+		}
+		return nil, wrapErrorInfo(ErrDeadLetterRead, err.Error())
+	}
+	return letter, nil
+}
+
+// Update replaces the stored letter with the same ID
+func (s *DeadLetterSQLiteStore) Update(ctx context.Context, letter *deadletter.Letter) error {
+	header, err := json.Marshal(letter.Header)
+	if err != nil {
+		return wrapErrorInfo(ErrDeadLetterWrite, err.Error())
+	}
+	res, err := s.db.ExecContext(ctx, updateDeadLetter,
+		letter.Subject, letter.Data, string(header), letter.Reason, letter.Error,
+		letter.Attempts, letter.FailedAt.UnixNano(), letter.ID,
+	)
+	if err != nil {
+		return wrapErrorInfo(ErrDeadLetterWrite, err.Error())
+	}
+	updated, err := res.RowsAffected()
+	if err != nil {
+		return wrapErrorInfo(ErrDeadLetterWrite, err.Error())
+	}
+	if updated == 0 {
+		return deadletter.ErrLetterNotFound
+	}
+	return nil
+}
+
+// Delete removes the letter with the passed id
+func (s *DeadLetterSQLiteStore) Delete(ctx context.Context, id string) error {
+	res, err := s.db.ExecContext(ctx, deleteDeadLetter, id)
+	if err != nil {
+		return wrapErrorInfo(ErrDeadLetterDelete, err.Error())
+	}
+	deleted, err := res.RowsAffected()
+	if err != nil {
+		return wrapErrorInfo(ErrDeadLetterDelete, err.Error())
+	}
+	if deleted == 0 {
+		return deadletter.ErrLetterNotFound
+	}
+	return nil
+}
+
+// scanner is satisfied by both *sql.Row and *sql.Rows
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanDeadLetter(row scanner) (*deadletter.Letter, error) {
+	letter := &deadletter.Letter{}
+	var header string
+	var failedAt int64
+	err := row.Scan(
+		&letter.ID, &letter.Subject, &letter.Data, &header, &letter.Reason,
+		&letter.Error, &letter.Attempts, &failedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(header), &letter.Header); err != nil {
+		return nil, err
+	}
+	letter.FailedAt = time.Unix(0, failedAt)
+	return letter, nil
+}
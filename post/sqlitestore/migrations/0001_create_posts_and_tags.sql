@@ -0,0 +1,26 @@
+CREATE TABLE IF NOT EXISTS posts (
+  id         TEXT NOT NULL PRIMARY KEY,
+  creator    TEXT NOT NULL CHECK (creator <> ''),
+  title      TEXT NOT NULL CHECK (title <> ''),
+  content    TEXT NOT NULL CHECK (content <> ''),
+  -- timestamps are stored as unix nanoseconds
+  created_at INTEGER NOT NULL,
+  updated_at INTEGER NOT NULL,
+  version    INTEGER NOT NULL DEFAULT 1
+);
+
+CREATE INDEX IF NOT EXISTS idx_creator ON posts (creator);
+CREATE INDEX IF NOT EXISTS idx_created_at ON posts (created_at);
+
+CREATE TABLE IF NOT EXISTS tags (
+  id       INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+  tag_name TEXT NOT NULL UNIQUE COLLATE NOCASE CHECK (tag_name <> '')
+);
+
+CREATE TABLE IF NOT EXISTS posts_tags (
+  post_id TEXT NOT NULL REFERENCES posts (id) ON DELETE CASCADE,
+  tag_id  INTEGER NOT NULL REFERENCES tags (id) ON DELETE CASCADE,
+  PRIMARY KEY (post_id, tag_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_tag_id ON posts_tags (tag_id);
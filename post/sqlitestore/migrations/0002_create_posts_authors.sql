@@ -0,0 +1,17 @@
+-- creators and authors are identified by the IDs of their users, which
+-- don't change when they rename themselves; the logins stored by the posts
+-- written before are replaced by usecase.MigrateUserIDs
+CREATE TABLE IF NOT EXISTS posts_authors (
+  post_id  TEXT NOT NULL REFERENCES posts (id) ON DELETE CASCADE,
+  user_id  TEXT NOT NULL CHECK (user_id <> ''),
+  role     TEXT NOT NULL CHECK (role IN ('author', 'editor', 'contributor')),
+  -- position keeps the order in which the authors are listed
+  position INTEGER NOT NULL,
+  PRIMARY KEY (post_id, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_author_user_id ON posts_authors (user_id);
+
+-- the creators of the posts written so far are their only authors
+INSERT OR IGNORE INTO posts_authors (post_id, user_id, role, position)
+SELECT id, creator, 'author', 0 FROM posts;
@@ -0,0 +1,12 @@
+-- keys of the events handled, for them to be handled only once
+CREATE TABLE IF NOT EXISTS processed_events (
+  key        TEXT NOT NULL PRIMARY KEY,
+  status     TEXT NOT NULL,
+  error      TEXT NOT NULL DEFAULT '',
+  -- JSON encoded
+  result     TEXT,
+  -- unix nanoseconds
+  expires_at INTEGER NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_processed_events_expires_at ON processed_events (expires_at);
@@ -0,0 +1,15 @@
+-- messages that couldn't be processed, for them to be inspected and replayed
+CREATE TABLE IF NOT EXISTS dead_letters (
+  id        TEXT NOT NULL PRIMARY KEY,
+  subject   TEXT NOT NULL,
+  data      TEXT NOT NULL,
+  -- JSON encoded
+  header    TEXT NOT NULL DEFAULT '{}',
+  reason    TEXT NOT NULL DEFAULT '',
+  error     TEXT NOT NULL DEFAULT '',
+  attempts  INTEGER NOT NULL DEFAULT 1,
+  -- unix nanoseconds
+  failed_at INTEGER NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_dead_letters_failed_at ON dead_letters (failed_at);
@@ -0,0 +1,32 @@
+-- commands handled, along with their outcome; rows are never updated nor deleted
+CREATE TABLE IF NOT EXISTS audit_log (
+  seq            INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+  event_id       TEXT NOT NULL DEFAULT '',
+  name           TEXT NOT NULL,
+  aggregate_id   TEXT NOT NULL DEFAULT '',
+  -- JSON encoded
+  payload        TEXT NOT NULL,
+  actor          TEXT NOT NULL DEFAULT '',
+  correlation_id TEXT NOT NULL DEFAULT '',
+  outcome        TEXT NOT NULL,
+  error          TEXT NOT NULL DEFAULT '',
+  duration_ns    INTEGER NOT NULL,
+  -- unix nanoseconds
+  occurred_at    INTEGER NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_audit_log_aggregate_id ON audit_log (aggregate_id);
+
+CREATE INDEX IF NOT EXISTS idx_audit_log_actor_occurred_at ON audit_log (actor, occurred_at);
+
+CREATE TRIGGER IF NOT EXISTS audit_log_reject_update
+BEFORE UPDATE ON audit_log
+BEGIN
+  SELECT RAISE(ABORT, 'audit_log is append-only');
+END;
+
+CREATE TRIGGER IF NOT EXISTS audit_log_reject_delete
+BEFORE DELETE ON audit_log
+BEGIN
+  SELECT RAISE(ABORT, 'audit_log is append-only');
+END;
@@ -0,0 +1,138 @@
+package sqlitestore
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/mountolive/back-blog-go/post/eventbus"
+)
+
+var (
+	// ErrClaimEvent is self-described
+	ErrClaimEvent = errors.New("error occurred when trying to claim an event")
+	// ErrCompleteEvent is self-described
+	ErrCompleteEvent = errors.New("error occurred when trying to complete an event")
+	// ErrPurgeEvents is self-described
+	ErrPurgeEvents = errors.New("error occurred when trying to purge expired events")
+)
+
+const (
+	// claimEvent only overwrites a record when it's failed or expired;
+	// no row is returned otherwise
+	claimEvent = `
+         INSERT INTO processed_events (key, status, error, expires_at)
+         VALUES (?, ?, '', ?)
+         ON CONFLICT (key) DO UPDATE
+         SET status = excluded.status, error = '', result = NULL,
+           expires_at = excluded.expires_at
+         WHERE processed_events.status = ? OR processed_events.expires_at <= ?
+         RETURNING key
+  `
+	selectEvent = `
+         SELECT key, status, error, result, expires_at FROM processed_events WHERE key = ?
+  `
+	completeEvent = `
+         INSERT INTO processed_events (key, status, error, result, expires_at)
+         VALUES (?, ?, ?, ?, ?)
+         ON CONFLICT (key) DO UPDATE
+         SET status = excluded.status, error = excluded.error,
+           result = excluded.result, expires_at = excluded.expires_at
+  `
+	purgeEvents = "DELETE FROM processed_events WHERE expires_at <= ?"
+)
+
+// ProcessedEventSQLiteStore keeps the keys of the events handled,
+// in the processed_events table
+type ProcessedEventSQLiteStore struct {
+	db *sql.DB
+}
+
+var _ eventbus.ProcessedEventStore = &ProcessedEventSQLiteStore{}
+
+// Creates a store for the keys of the events handled, in the SQLite DB
+// at path, applying the pending migrations
+func NewProcessedEventSQLiteStore(ctx context.Context,
+	path string) (*ProcessedEventSQLiteStore, error) {
+	db, err := open(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	return &ProcessedEventSQLiteStore{db}, nil
+}
+
+// Claim records key as pending, until lease passes, unless it's already
+// recorded as pending or succeeded, and not expired
+func (s *ProcessedEventSQLiteStore) Claim(ctx context.Context, key string,
+	lease time.Duration) (*eventbus.ProcessedEvent, bool, error) {
+	now := time.Now()
+	var claimedKey string
+	err := s.db.QueryRowContext(ctx, claimEvent,
+		key, eventbus.StatusPending, now.Add(lease).UnixNano(),
+		eventbus.StatusFailed, now.UnixNano(),
+	).Scan(&claimedKey)
+	if err == nil {
+		return nil, true, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return nil, false, wrapErrorInfo(ErrClaimEvent, err.Error())
+	}
+	existing := &eventbus.ProcessedEvent{}
+	var result sql.NullString
+	var expiresAt int64
+	err = s.db.QueryRowContext(ctx, selectEvent, key).Scan(
+		&existing.Key, &existing.Status, &existing.Error, &result, &expiresAt,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			// purged in between, reported as not claimed for the event to be retried
+			return nil, false, nil
+		}
+		return nil, false, wrapErrorInfo(ErrClaimEvent, err.Error())
+	}
+	existing.ExpiresAt = time.Unix(0, expiresAt)
+	if result.Valid {
+		err = json.Unmarshal([]byte(result.String), &existing.Result)
+		if err != nil {
+			return nil, false, wrapErrorInfo(ErrClaimEvent, err.Error())
+		}
+	}
+	return existing, false, nil
+}
+
+// Complete records the outcome of a claimed key
+// The result is kept as JSON, so its numbers are read back as float64
+func (s *ProcessedEventSQLiteStore) Complete(ctx context.Context, key, status,
+	errMsg string, result map[string]interface{}, ttl time.Duration) error {
+	var encoded sql.NullString
+	if result != nil {
+		raw, err := json.Marshal(result)
+		if err != nil {
+			return wrapErrorInfo(ErrCompleteEvent, err.Error())
+		}
+		encoded = sql.NullString{String: string(raw), Valid: true}
+	}
+	_, err := s.db.ExecContext(ctx, completeEvent,
+		key, status, errMsg, encoded, time.Now().Add(ttl).UnixNano(),
+	)
+	if err != nil {
+		return wrapErrorInfo(ErrCompleteEvent, err.Error())
+	}
+	return nil
+}
+
+// PurgeExpired removes the records expired by now
+func (s *ProcessedEventSQLiteStore) PurgeExpired(ctx context.Context,
+	now time.Time) (int64, error) {
+	res, err := s.db.ExecContext(ctx, purgeEvents, now.UnixNano())
+	if err != nil {
+		return 0, wrapErrorInfo(ErrPurgeEvents, err.Error())
+	}
+	purged, err := res.RowsAffected()
+	if err != nil {
+		return 0, wrapErrorInfo(ErrPurgeEvents, err.Error())
+	}
+	return purged, nil
+}
@@ -0,0 +1,579 @@
+// Defines the corresponding store associated to posts, with SQLite
+// It's meant for single-node deployments, where running Postgres is too heavy
+package sqlitestore
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/mountolive/back-blog-go/post/usecase"
+	_ "modernc.org/sqlite"
+)
+
+// Store wrapper, all operations go through a single connection,
+// as SQLite allows only one writer at a time
+type SQLiteStore struct {
+	db *sql.DB
+}
+
+var (
+	// ErrConnection is self-described
+	ErrConnection = errors.New("error occurred when opening the SQLite DB")
+	// ErrMigration is self-described
+	ErrMigration = errors.New("error occurred when migrating the SQLite DB")
+	// ErrTransaction is self-described
+	ErrTransaction = errors.New("error occurred when executing the transaction")
+	// ErrFilter is self-described
+	ErrFilter = errors.New("error occurred when trying to exec Filter query")
+	// ErrReadOne is self-described
+	ErrReadOne = errors.New("error occurred when trying to exec Read query")
+)
+
+// connectionPragmas are set on the connection when it's opened
+const connectionPragmas = "_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)"
+
+const (
+	selectPost = `
+         SELECT id, creator, title, content, created_at, updated_at, version
+         FROM posts p
+         %s
+  `
+	selectTags = `
+         SELECT pt.post_id, tg.tag_name
+         FROM posts_tags pt
+         JOIN tags tg ON tg.id = pt.tag_id
+         WHERE pt.post_id IN (%s)
+         ORDER BY pt.rowid
+  `
+	upsertTag = `
+         INSERT INTO tags (tag_name) VALUES (?)
+         ON CONFLICT (tag_name) DO UPDATE SET tag_name = excluded.tag_name
+         RETURNING id
+  `
+	selectAuthors = `
+         SELECT post_id, user_id, role
+         FROM posts_authors
+         WHERE post_id IN (%s)
+         ORDER BY post_id, position
+  `
+	insertAuthor = `
+         INSERT INTO posts_authors (post_id, user_id, role, position)
+         VALUES (?, ?, ?, ?)
+  `
+	deleteAuthors = "DELETE FROM posts_authors WHERE post_id = ?"
+	linkTag       = "INSERT OR IGNORE INTO posts_tags (post_id, tag_id) VALUES (?, ?)"
+	deleteTags    = "DELETE FROM posts_tags WHERE post_id = ?"
+	unlinkTags    = `
+         DELETE FROM posts_tags
+         WHERE post_id = ? AND tag_id IN (SELECT id FROM tags WHERE tag_name IN (%s))
+  `
+	selectVersion  = "SELECT version FROM posts WHERE id = ?"
+	selectCreator  = "SELECT creator FROM posts WHERE id = ?"
+	deletePost     = "DELETE FROM posts WHERE id = ? AND version = ?"
+	selectUserRefs = `
+         SELECT creator FROM posts
+         UNION
+         SELECT user_id FROM posts_authors
+  `
+	replaceCreator = "UPDATE posts SET creator = ? WHERE creator = ?"
+	copyAuthorRef  = `
+         INSERT OR IGNORE INTO posts_authors (post_id, user_id, role, position)
+         SELECT post_id, ?, role, position FROM posts_authors WHERE user_id = ?
+  `
+	deleteAuthorRef = "DELETE FROM posts_authors WHERE user_id = ?"
+)
+
+// querier is satisfied by both *sql.DB and *sql.Tx
+type querier interface {
+	ExecContext(context.Context, string, ...interface{}) (sql.Result, error)
+	QueryContext(context.Context, string, ...interface{}) (*sql.Rows, error)
+	QueryRowContext(context.Context, string, ...interface{}) *sql.Row
+}
+
+var (
+	_ usecase.PostStore    = &SQLiteStore{}
+	_ usecase.UserRefStore = &SQLiteStore{}
+)
+
+// Creates a store for persistence of posts, in the SQLite DB at path,
+// applying the pending migrations. ":memory:" can be used for a transient DB
+func NewPostSQLiteStore(ctx context.Context, path string) (*SQLiteStore, error) {
+	db, err := open(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	return &SQLiteStore{db}, nil
+}
+
+// open connects to the SQLite DB at path, applying the pending migrations
+func open(ctx context.Context, path string) (*sql.DB, error) {
+	separator := "?"
+	if strings.Contains(path, "?") {
+		separator = "&"
+	}
+	db, err := sql.Open("sqlite", path+separator+connectionPragmas)
+	if err != nil {
+		return nil, wrapErrorInfo(ErrConnection, err.Error())
+	}
+	// a single connection avoids SQLITE_BUSY errors between writers,
+	// and keeps in-memory DBs alive
+	db.SetMaxOpenConns(1)
+	db.SetConnMaxLifetime(0)
+	if err := db.PingContext(ctx); err != nil {
+		return nil, wrapErrorInfo(ErrConnection, err.Error())
+	}
+	if err := migrate(ctx, db); err != nil {
+		return nil, wrapErrorInfo(ErrMigration, err.Error())
+	}
+	return db, nil
+}
+
+// Creates a Post with data with corresponding CreatePostDto
+func (s *SQLiteStore) Create(ctx context.Context,
+	create *usecase.CreatePostDto) (*usecase.Post, error) {
+	if err := checkTags(create.Tags); err != nil {
+		return nil, wrapErrorInfo(ErrTransaction, err.Error())
+	}
+	id, err := newID()
+	if err != nil {
+		return nil, wrapErrorInfo(ErrTransaction, err.Error())
+	}
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, wrapErrorInfo(ErrTransaction, err.Error())
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+	now := time.Now().UnixNano()
+	_, err = tx.ExecContext(ctx, `
+         INSERT INTO posts (id, creator, title, content, created_at, updated_at)
+         VALUES (?, ?, ?, ?, ?, ?)
+  `, id, create.Creator, create.Title, create.Content, now, now)
+	if err != nil {
+		return nil, wrapErrorInfo(ErrTransaction, err.Error())
+	}
+	if err := linkTags(ctx, tx, id, create.Tags); err != nil {
+		return nil, wrapErrorInfo(ErrTransaction, err.Error())
+	}
+	authors := usecase.NormalizeAuthors(create.Creator, create.Authors)
+	if err := linkAuthors(ctx, tx, id, authors); err != nil {
+		return nil, wrapErrorInfo(ErrTransaction, err.Error())
+	}
+	post, err := readOne(ctx, tx, id)
+	if err != nil {
+		return nil, wrapErrorInfo(ErrTransaction, err.Error())
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, wrapErrorInfo(ErrTransaction, err.Error())
+	}
+	return post, nil
+}
+
+// Updates the corresponding post with the Id from the UpdatePostDto passed,
+// as long as its stored version matches the passed one
+// Only the fields present in the UpdatePostDto are touched
+func (s *SQLiteStore) Update(ctx context.Context,
+	update *usecase.UpdatePostDto) (*usecase.Post, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, wrapErrorInfo(ErrTransaction, err.Error())
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+	statement, params := buildUpdatePostStatement(update)
+	result, err := tx.ExecContext(ctx, statement, params...)
+	if err != nil {
+		return nil, wrapErrorInfo(ErrTransaction, err.Error())
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return nil, wrapErrorInfo(ErrTransaction, err.Error())
+	}
+	if affected == 0 {
+		return nil, missedUpdateError(ctx, tx, update.Id, update.Version)
+	}
+	if update.Tags != nil {
+		if err := checkTags(update.Tags); err != nil {
+			return nil, wrapErrorInfo(ErrTransaction, err.Error())
+		}
+		_, err = tx.ExecContext(ctx, deleteTags, update.Id)
+		if err != nil {
+			return nil, wrapErrorInfo(ErrTransaction, err.Error())
+		}
+	}
+	if err := linkTags(ctx, tx, update.Id, update.Tags); err != nil {
+		return nil, wrapErrorInfo(ErrTransaction, err.Error())
+	}
+	if err := linkTags(ctx, tx, update.Id, update.AddTags); err != nil {
+		return nil, wrapErrorInfo(ErrTransaction, err.Error())
+	}
+	if len(update.RemoveTags) > 0 {
+		params := []interface{}{update.Id}
+		for _, tag := range update.RemoveTags {
+			params = append(params, tag)
+		}
+		_, err = tx.ExecContext(ctx,
+			fmt.Sprintf(unlinkTags, placeholders(len(update.RemoveTags))),
+			params...,
+		)
+		if err != nil {
+			return nil, wrapErrorInfo(ErrTransaction, err.Error())
+		}
+	}
+	if update.Authors != nil {
+		if err := relinkAuthors(ctx, tx, update.Id, update.Authors); err != nil {
+			return nil, wrapErrorInfo(ErrTransaction, err.Error())
+		}
+	}
+	post, err := readOne(ctx, tx, update.Id)
+	if err != nil {
+		return nil, wrapErrorInfo(ErrTransaction, err.Error())
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, wrapErrorInfo(ErrTransaction, err.Error())
+	}
+	return post, nil
+}
+
+// Deletes the post with the passed Id, as long as its stored version
+// matches the passed one, and returns it. Its tags' links are cascaded
+func (s *SQLiteStore) Delete(ctx context.Context,
+	deleted *usecase.DeletePostDto) (*usecase.Post, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, wrapErrorInfo(ErrTransaction, err.Error())
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+	post, err := readOne(ctx, tx, deleted.Id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, wrapErrorInfo(usecase.ErrPostNotFound, deleted.Id)
+		}
+		return nil, wrapErrorInfo(ErrTransaction, err.Error())
+	}
+	result, err := tx.ExecContext(ctx, deletePost, deleted.Id, deleted.Version)
+	if err != nil {
+		return nil, wrapErrorInfo(ErrTransaction, err.Error())
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return nil, wrapErrorInfo(ErrTransaction, err.Error())
+	}
+	if affected == 0 {
+		return nil, missedUpdateError(ctx, tx, deleted.Id, deleted.Version)
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, wrapErrorInfo(ErrTransaction, err.Error())
+	}
+	return post, nil
+}
+
+// Reads from the store the post with the passed Id
+// ErrPostNotFound is returned when there's no post with such Id
+func (s *SQLiteStore) ReadOne(ctx context.Context, id string) (*usecase.Post, error) {
+	post, err := readOne(ctx, s.db, id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, wrapErrorInfo(usecase.ErrPostNotFound, id)
+		}
+		return nil, wrapErrorInfo(ErrReadOne, err.Error())
+	}
+	return post, nil
+}
+
+// Filters either by tags, authors and/or creation date, newest first
+func (s *SQLiteStore) Filter(ctx context.Context,
+	filter *usecase.GeneralFilter) ([]*usecase.Post, error) {
+	statement, params := buildFilterStatement(filter)
+	posts, err := queryPosts(ctx, s.db, statement, params...)
+	if err != nil {
+		return nil, wrapErrorInfo(ErrFilter, err.Error())
+	}
+	return posts, nil
+}
+
+// UserRefs returns the distinct creators and authors of the posts
+func (s *SQLiteStore) UserRefs(ctx context.Context) ([]string, error) {
+	rows, err := s.db.QueryContext(ctx, selectUserRefs)
+	if err != nil {
+		return nil, wrapErrorInfo(ErrReadOne, err.Error())
+	}
+	defer rows.Close()
+	refs := []string{}
+	for rows.Next() {
+		var ref string
+		if err := rows.Scan(&ref); err != nil {
+			return nil, wrapErrorInfo(ErrReadOne, err.Error())
+		}
+		refs = append(refs, ref)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, wrapErrorInfo(ErrReadOne, err.Error())
+	}
+	return refs, nil
+}
+
+// ReplaceUserRef identifies the creator and authors identified as from
+// as to instead, in every post; versions and updated_at aren't touched.
+// Authors already identified as to are kept as they are
+func (s *SQLiteStore) ReplaceUserRef(ctx context.Context, from, to string) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return wrapErrorInfo(ErrTransaction, err.Error())
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+	if _, err := tx.ExecContext(ctx, replaceCreator, to, from); err != nil {
+		return wrapErrorInfo(ErrTransaction, err.Error())
+	}
+	if _, err := tx.ExecContext(ctx, copyAuthorRef, to, from); err != nil {
+		return wrapErrorInfo(ErrTransaction, err.Error())
+	}
+	if _, err := tx.ExecContext(ctx, deleteAuthorRef, from); err != nil {
+		return wrapErrorInfo(ErrTransaction, err.Error())
+	}
+	if err := tx.Commit(); err != nil {
+		return wrapErrorInfo(ErrTransaction, err.Error())
+	}
+	return nil
+}
+
+// missedUpdateError tells apart a post that doesn't exist from one
+// whose version changed, for an update that didn't affect any row
+func missedUpdateError(ctx context.Context, q querier,
+	id string, expectedVersion int) error {
+	var version int
+	err := q.QueryRowContext(ctx, selectVersion, id).Scan(&version)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return wrapErrorInfo(usecase.ErrPostNotFound, id)
+		}
+		return wrapErrorInfo(ErrTransaction, err.Error())
+	}
+	return wrapErrorInfo(
+		usecase.ErrVersionConflict,
+		fmt.Sprintf("expected %d, found %d", expectedVersion, version),
+	)
+}
+
+func readOne(ctx context.Context, q querier, id string) (*usecase.Post, error) {
+	posts, err := queryPosts(ctx, q, fmt.Sprintf(selectPost, "WHERE id = ?"), id)
+	if err != nil {
+		return nil, err
+	}
+	if len(posts) == 0 {
+		return nil, sql.ErrNoRows
+	}
+	return posts[0], nil
+}
+
+// queryPosts runs the passed select of posts and attaches their tags
+// and authors
+func queryPosts(ctx context.Context, q querier,
+	statement string, params ...interface{}) ([]*usecase.Post, error) {
+	rows, err := q.QueryContext(ctx, statement, params...)
+	if err != nil {
+		return nil, err
+	}
+	posts := []*usecase.Post{}
+	byID := map[string]*usecase.Post{}
+	for rows.Next() {
+		post := &usecase.Post{}
+		var createdAt, updatedAt int64
+		err := rows.Scan(
+			&post.Id, &post.Creator,
+			&post.Title, &post.Content,
+			&createdAt, &updatedAt,
+			&post.Version,
+		)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		post.CreatedAt = time.Unix(0, createdAt)
+		post.UpdatedAt = time.Unix(0, updatedAt)
+		posts = append(posts, post)
+		byID[post.Id] = post
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(posts) == 0 {
+		return posts, nil
+	}
+	ids := make([]interface{}, 0, len(posts))
+	for _, post := range posts {
+		ids = append(ids, post.Id)
+	}
+	tagRows, err := q.QueryContext(ctx,
+		fmt.Sprintf(selectTags, placeholders(len(ids))), ids...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer tagRows.Close()
+	for tagRows.Next() {
+		var id, tag string
+		if err := tagRows.Scan(&id, &tag); err != nil {
+			return nil, err
+		}
+		byID[id].Tags = append(byID[id].Tags, tag)
+	}
+	if err := tagRows.Err(); err != nil {
+		return nil, err
+	}
+	authorRows, err := q.QueryContext(ctx,
+		fmt.Sprintf(selectAuthors, placeholders(len(ids))), ids...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer authorRows.Close()
+	for authorRows.Next() {
+		var id string
+		var author usecase.Author
+		if err := authorRows.Scan(&id, &author.ID, &author.Role); err != nil {
+			return nil, err
+		}
+		byID[id].Authors = append(byID[id].Authors, author)
+	}
+	return posts, authorRows.Err()
+}
+
+// linkTags associates the passed tags to the post, creating the tags
+// that don't exist yet
+func linkTags(ctx context.Context, q querier, id string, tags []string) error {
+	for _, tag := range tags {
+		var tagID int64
+		err := q.QueryRowContext(ctx, upsertTag, tag).Scan(&tagID)
+		if err != nil {
+			return err
+		}
+		_, err = q.ExecContext(ctx, linkTag, id, tagID)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// linkAuthors associates the passed authors to the post, in order
+func linkAuthors(ctx context.Context, q querier, id string, authors []usecase.Author) error {
+	for position, author := range authors {
+		_, err := q.ExecContext(ctx, insertAuthor, id, author.ID, author.Role, position)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// relinkAuthors replaces the authors of the post, keeping its creator
+// as one of them
+func relinkAuthors(ctx context.Context, q querier, id string, authors []usecase.Author) error {
+	var creator string
+	err := q.QueryRowContext(ctx, selectCreator, id).Scan(&creator)
+	if err != nil {
+		return err
+	}
+	_, err = q.ExecContext(ctx, deleteAuthors, id)
+	if err != nil {
+		return err
+	}
+	return linkAuthors(ctx, q, id, usecase.NormalizeAuthors(creator, authors))
+}
+
+// checkTags refuses an empty set of tags, same as PgStore does
+func checkTags(tags []string) error {
+	if len(tags) == 0 {
+		return usecase.ErrEmptyTags
+	}
+	return nil
+}
+
+func buildFilterStatement(filter *usecase.GeneralFilter) (string, []interface{}) {
+	whereClauseSegments := []string{}
+	params := make([]interface{}, 0)
+	if filter.Tag != "" {
+		whereClauseSegments = append(whereClauseSegments, `
+         id IN (
+           SELECT pt.post_id FROM posts_tags pt
+           JOIN tags t ON t.id = pt.tag_id
+           WHERE t.tag_name = ?
+         )
+    `)
+		params = append(params, filter.Tag)
+	}
+	if filter.Author != "" {
+		whereClauseSegments = append(whereClauseSegments,
+			"id IN (SELECT pa.post_id FROM posts_authors pa WHERE pa.user_id = ?)")
+		params = append(params, filter.Author)
+	}
+	if !filter.From.IsZero() {
+		whereClauseSegments = append(whereClauseSegments, "p.created_at >= ?")
+		params = append(params, filter.From.UnixNano())
+	}
+	if !filter.To.IsZero() {
+		whereClauseSegments = append(whereClauseSegments, "p.created_at <= ?")
+		params = append(params, filter.To.UnixNano())
+	}
+	var whereClause string
+	if len(whereClauseSegments) > 0 {
+		whereClause = "WHERE " + strings.Join(whereClauseSegments, " AND ")
+	}
+	whereClause += " ORDER BY p.created_at DESC, p.rowid DESC LIMIT ? OFFSET ?"
+	params = append(params, filter.PageSize, filter.Page)
+	return fmt.Sprintf(selectPost, whereClause), params
+}
+
+// buildUpdatePostStatement builds the update of the post's own columns,
+// only assigning the fields present in the UpdatePostDto
+func buildUpdatePostStatement(update *usecase.UpdatePostDto) (string, []interface{}) {
+	assignments := []string{}
+	params := make([]interface{}, 0)
+	if update.Content != nil {
+		assignments = append(assignments, "content = ?")
+		params = append(params, *update.Content)
+	}
+	if update.Title != nil {
+		assignments = append(assignments, "title = ?")
+		params = append(params, *update.Title)
+	}
+	assignments = append(assignments, "version = version + 1", "updated_at = ?")
+	params = append(params, time.Now().UnixNano(), update.Id, update.Version)
+	statement := fmt.Sprintf(
+		"UPDATE posts SET %s WHERE id = ? AND version = ?",
+		strings.Join(assignments, ", "),
+	)
+	return statement, params
+}
+
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", n), ", ")
+}
+
+// newID returns a random (version 4) UUID
+func newID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:]), nil
+}
+
+func wrapErrorInfo(err error, msg string) error {
+	return fmt.Errorf("POST SQLITE STORE: %w - %s\n", err, msg)
+}
@@ -0,0 +1,80 @@
+package sqlitestore
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/mountolive/back-blog-go/post/storetest"
+	"github.com/mountolive/back-blog-go/post/usecase"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSQLiteStore(t *testing.T) {
+	t.Run("Canary", func(t *testing.T) {
+		var _ usecase.PostStore = &SQLiteStore{}
+	})
+
+	path := filepath.Join(t.TempDir(), "posts.db")
+	store, err := NewPostSQLiteStore(context.Background(), path)
+	require.NoError(t, err, "Error opening the store %s", err)
+
+	storetest.Run(t, store)
+
+	t.Run("Reopen", func(t *testing.T) {
+		created, err := store.Create(context.Background(), &usecase.CreatePostDto{
+			Creator: "shellac",
+			Title:   "At Action Park",
+			Content: "Crow",
+			Tags:    []string{"reopen"},
+		})
+		require.NoError(t, err, "Error was returned. Create %s", err)
+
+		reopened, err := NewPostSQLiteStore(context.Background(), path)
+		require.NoError(t, err, "Migrations should be applied only once %s", err)
+		found, err := reopened.ReadOne(context.Background(), created.Id)
+		require.NoError(t, err, "An error occurred in ReadOne: %s", err)
+		require.Equal(t, created.Tags, found.Tags)
+	})
+}
+
+func TestSQLiteStoreInMemory(t *testing.T) {
+	store, err := NewPostSQLiteStore(context.Background(), ":memory:")
+	require.NoError(t, err, "Error opening the store %s", err)
+
+	storetest.Run(t, store)
+}
+
+func TestProcessedEventSQLiteStore(t *testing.T) {
+	store, err := NewProcessedEventSQLiteStore(context.Background(),
+		filepath.Join(t.TempDir(), "posts.db"))
+	require.NoError(t, err, "Error opening the store %s", err)
+
+	storetest.RunProcessedEvents(t, store)
+}
+
+func TestDeadLetterSQLiteStore(t *testing.T) {
+	store, err := NewDeadLetterSQLiteStore(context.Background(),
+		filepath.Join(t.TempDir(), "posts.db"))
+	require.NoError(t, err, "Error opening the store %s", err)
+
+	storetest.RunDeadLetters(t, store)
+}
+
+func TestAuditSQLiteStore(t *testing.T) {
+	store, err := NewAuditSQLiteStore(context.Background(),
+		filepath.Join(t.TempDir(), "posts.db"))
+	require.NoError(t, err, "Error opening the store %s", err)
+
+	storetest.RunAudit(t, store)
+
+	t.Run("Append-only", func(t *testing.T) {
+		ctx := context.Background()
+		_, err := store.db.ExecContext(ctx, "UPDATE audit_log SET actor = 'forger'")
+		require.Error(t, err, "audit entries shouldn't be updated")
+		require.Contains(t, err.Error(), "append-only")
+		_, err = store.db.ExecContext(ctx, "DELETE FROM audit_log")
+		require.Error(t, err, "audit entries shouldn't be deleted")
+		require.Contains(t, err.Error(), "append-only")
+	})
+}
@@ -0,0 +1,87 @@
+package storetest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/mountolive/back-blog-go/post/audit"
+	"github.com/mountolive/back-blog-go/post/eventbus"
+	"github.com/stretchr/testify/require"
+)
+
+// RunAudit executes the contract's suite of an audit.Store
+// against the passed store
+func RunAudit(t *testing.T, store audit.Store) {
+	ctx := context.Background()
+	base := time.Now().UTC().Truncate(time.Second)
+
+	t.Run("Append and History", func(t *testing.T) {
+		aggregate := "audit-history"
+		created := appendEntry(t, store, aggregate, "historian", base)
+		updated := appendEntry(t, store, aggregate, "historian", base.Add(time.Minute))
+		appendEntry(t, store, "audit-other", "historian", base)
+		require.Greater(t, updated.Seq, created.Seq, "seqs should grow")
+
+		entries, err := store.History(ctx, aggregate)
+		require.NoError(t, err)
+		require.Len(t, entries, 2)
+		require.Equal(t, created.Seq, entries[0].Seq, "the oldest should come first")
+		require.Equal(t, updated.Seq, entries[1].Seq, genericErr, entries[1].Seq, updated.Seq)
+		entry := entries[0]
+		require.Equal(t, created.Name, entry.Name, genericErr, entry.Name, created.Name)
+		require.Equal(t, created.Payload, entry.Payload, genericErr,
+			entry.Payload, created.Payload)
+		require.Equal(t, created.Actor, entry.Actor, genericErr, entry.Actor, created.Actor)
+		require.Equal(t, created.Outcome, entry.Outcome, genericErr,
+			entry.Outcome, created.Outcome)
+		require.Equal(t, created.Duration, entry.Duration, genericErr,
+			entry.Duration, created.Duration)
+		require.True(t, created.OccurredAt.Equal(entry.OccurredAt), genericErr,
+			entry.OccurredAt, created.OccurredAt)
+	})
+
+	t.Run("Query", func(t *testing.T) {
+		actor := "audit-querier"
+		early := appendEntry(t, store, "audit-query", actor, base.Add(-time.Hour))
+		late := appendEntry(t, store, "audit-query", actor, base.Add(time.Hour))
+		appendEntry(t, store, "audit-query", "someone else", base)
+
+		entries, err := store.Query(ctx, audit.Filter{Actor: actor})
+		require.NoError(t, err)
+		require.Len(t, entries, 2)
+		require.Equal(t, early.Seq, entries[0].Seq, genericErr, entries[0].Seq, early.Seq)
+
+		entries, err = store.Query(ctx, audit.Filter{
+			Actor: actor,
+			From:  base,
+			To:    base.Add(2 * time.Hour),
+		})
+		require.NoError(t, err)
+		require.Len(t, entries, 1)
+		require.Equal(t, late.Seq, entries[0].Seq, genericErr, entries[0].Seq, late.Seq)
+
+		entries, err = store.Query(ctx, audit.Filter{Actor: actor, Limit: 1, Offset: 1})
+		require.NoError(t, err)
+		require.Len(t, entries, 1)
+		require.Equal(t, late.Seq, entries[0].Seq, genericErr, entries[0].Seq, late.Seq)
+	})
+}
+
+func appendEntry(t *testing.T, store audit.Store, aggregate, actor string,
+	occurredAt time.Time) *audit.Entry {
+	t.Helper()
+	entry := &audit.Entry{
+		EventID:     "audit-event",
+		Name:        "posts.v1.update",
+		AggregateID: aggregate,
+		Payload:     eventbus.Params{"id": aggregate, "title": "audited"},
+		Actor:       actor,
+		Outcome:     eventbus.StatusSucceeded,
+		Duration:    time.Millisecond,
+		OccurredAt:  occurredAt,
+	}
+	require.NoError(t, store.Append(context.Background(), entry))
+	require.NotZero(t, entry.Seq)
+	return entry
+}
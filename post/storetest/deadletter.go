@@ -0,0 +1,118 @@
+package storetest
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/mountolive/back-blog-go/post/deadletter"
+	"github.com/stretchr/testify/require"
+)
+
+// missingLetterID is a well-formed id of no dead letter
+const missingLetterID = "3f1d1e0c-5e4a-4f4e-9d7a-0a6c2f0e9b11"
+
+// RunDeadLetters executes the contract's suite of a deadletter.Store
+// against the passed store
+func RunDeadLetters(t *testing.T, store deadletter.Store) {
+	ctx := context.Background()
+	failedAt := time.Now().UTC().Truncate(time.Second)
+
+	t.Run("Save and Get", func(t *testing.T) {
+		letter := saveLetter(t, store, "dead.save", "handler_error", failedAt)
+
+		result, err := store.Get(ctx, letter.ID)
+		require.NoError(t, err)
+		require.Equal(t, letter.Subject, result.Subject, genericErr,
+			result.Subject, letter.Subject)
+		require.Equal(t, letter.Data, result.Data, genericErr, result.Data, letter.Data)
+		require.Equal(t, letter.Header, result.Header, genericErr,
+			result.Header, letter.Header)
+		require.Equal(t, letter.Reason, result.Reason, genericErr,
+			result.Reason, letter.Reason)
+		require.Equal(t, letter.Attempts, result.Attempts, genericErr,
+			result.Attempts, letter.Attempts)
+		require.True(t, letter.FailedAt.Equal(result.FailedAt), genericErr,
+			result.FailedAt, letter.FailedAt)
+	})
+
+	t.Run("Get missing", func(t *testing.T) {
+		_, err := store.Get(ctx, missingLetterID)
+		require.True(t, errors.Is(err, deadletter.ErrLetterNotFound), genericErr,
+			err, deadletter.ErrLetterNotFound)
+	})
+
+	t.Run("List", func(t *testing.T) {
+		subject := "dead.list"
+		older := saveLetter(t, store, subject, "malformed_message", failedAt.Add(-time.Minute))
+		newer := saveLetter(t, store, subject, "handler_error", failedAt)
+
+		letters, err := store.List(ctx, deadletter.Filter{Subject: subject, Limit: 10})
+		require.NoError(t, err)
+		require.Len(t, letters, 2)
+		require.Equal(t, newer.ID, letters[0].ID, "the most recent should come first")
+		require.Equal(t, older.ID, letters[1].ID, genericErr, letters[1].ID, older.ID)
+
+		letters, err = store.List(ctx, deadletter.Filter{
+			Subject: subject,
+			Reason:  "malformed_message",
+			Limit:   10,
+		})
+		require.NoError(t, err)
+		require.Len(t, letters, 1)
+		require.Equal(t, older.ID, letters[0].ID, genericErr, letters[0].ID, older.ID)
+
+		letters, err = store.List(ctx, deadletter.Filter{Subject: subject, Limit: 1, Offset: 1})
+		require.NoError(t, err)
+		require.Len(t, letters, 1)
+		require.Equal(t, older.ID, letters[0].ID, genericErr, letters[0].ID, older.ID)
+	})
+
+	t.Run("Update", func(t *testing.T) {
+		letter := saveLetter(t, store, "dead.update", "handler_error", failedAt)
+		letter.Data = `{"fixed":true}`
+		letter.Attempts++
+		require.NoError(t, store.Update(ctx, letter))
+
+		result, err := store.Get(ctx, letter.ID)
+		require.NoError(t, err)
+		require.Equal(t, letter.Data, result.Data, genericErr, result.Data, letter.Data)
+		require.Equal(t, letter.Attempts, result.Attempts, genericErr,
+			result.Attempts, letter.Attempts)
+
+		letter.ID = missingLetterID
+		err = store.Update(ctx, letter)
+		require.True(t, errors.Is(err, deadletter.ErrLetterNotFound), genericErr,
+			err, deadletter.ErrLetterNotFound)
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		letter := saveLetter(t, store, "dead.delete", "handler_error", failedAt)
+		require.NoError(t, store.Delete(ctx, letter.ID))
+
+		_, err := store.Get(ctx, letter.ID)
+		require.True(t, errors.Is(err, deadletter.ErrLetterNotFound), genericErr,
+			err, deadletter.ErrLetterNotFound)
+		err = store.Delete(ctx, letter.ID)
+		require.True(t, errors.Is(err, deadletter.ErrLetterNotFound), genericErr,
+			err, deadletter.ErrLetterNotFound)
+	})
+}
+
+func saveLetter(t *testing.T, store deadletter.Store, subject, reason string,
+	failedAt time.Time) *deadletter.Letter {
+	t.Helper()
+	letter := &deadletter.Letter{
+		Subject:  subject,
+		Data:     `{"name":"create_post","data":{"title":"dead"}}`,
+		Header:   map[string][]string{"Nats-Msg-Id": {"dead-letter"}},
+		Reason:   reason,
+		Error:    "boom",
+		Attempts: 3,
+		FailedAt: failedAt,
+	}
+	require.NoError(t, store.Save(context.Background(), letter))
+	require.NotEmpty(t, letter.ID)
+	return letter
+}
@@ -0,0 +1,132 @@
+package storetest
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/mountolive/back-blog-go/post/outbox"
+	"github.com/mountolive/back-blog-go/post/usecase"
+	"github.com/stretchr/testify/require"
+)
+
+// RunOutbox executes the contract's suite of a usecase.PostStore writing
+// its domain events to an outbox.Store, box, against the passed ones
+func RunOutbox(t *testing.T, store usecase.PostStore, box outbox.Store) {
+	ctx := context.Background()
+	drainOutbox(t, box)
+
+	t.Run("Written along with changes", func(t *testing.T) {
+		created := createPost(t, store, &usecase.CreatePostDto{
+			Creator: "outboxer",
+			Title:   "outbox",
+			Content: "written",
+			Tags:    []string{"tag30"},
+		})
+		updated, err := store.Update(ctx, &usecase.UpdatePostDto{
+			Id:      created.Id,
+			Version: created.Version,
+			Title:   strPtr("outbox updated"),
+		})
+		require.NoError(t, err)
+		_, err = store.Update(ctx, &usecase.UpdatePostDto{
+			Id:      created.Id,
+			Version: created.Version,
+			Title:   strPtr("stale"),
+		})
+		require.True(t, errors.Is(err, usecase.ErrVersionConflict), genericErr,
+			err, usecase.ErrVersionConflict)
+		deleted, err := store.Delete(ctx, &usecase.DeletePostDto{
+			Id:      created.Id,
+			Version: updated.Version,
+		})
+		require.NoError(t, err)
+
+		messages, err := box.Pending(ctx, 10)
+		require.NoError(t, err)
+		expected := []struct {
+			name string
+			post *usecase.Post
+		}{
+			{usecase.PostCreatedEventNameV1, created},
+			{usecase.PostUpdatedEventNameV1, updated},
+			{usecase.PostDeletedEventNameV1, deleted},
+		}
+		require.Len(t, messages, len(expected), "failed changes shouldn't be written")
+		for i, exp := range expected {
+			msg := messages[i]
+			require.Equal(t, exp.name, msg.Event.Name, genericErr, msg.Event.Name, exp.name)
+			require.Equal(t, created.Id, msg.AggregateID, genericErr,
+				msg.AggregateID, created.Id)
+			require.NotEmpty(t, msg.Event.ID)
+			require.False(t, msg.Event.OccurredAt.IsZero())
+			require.Equal(t, exp.post.Title, msg.Event.Post.Title, genericErr,
+				msg.Event.Post.Title, exp.post.Title)
+			require.Equal(t, exp.post.Version, msg.Event.Post.Version, genericErr,
+				msg.Event.Post.Version, exp.post.Version)
+			if i > 0 {
+				require.Greater(t, msg.Seq, messages[i-1].Seq)
+			}
+		}
+	})
+
+	t.Run("MarkDelivered", func(t *testing.T) {
+		createPost(t, store, &usecase.CreatePostDto{
+			Creator: "outboxer",
+			Title:   "delivered",
+			Content: "written",
+			Tags:    []string{"tag31"},
+		})
+		drainOutbox(t, box)
+		messages, err := box.Pending(ctx, 10)
+		require.NoError(t, err)
+		require.Empty(t, messages)
+	})
+
+	t.Run("PurgeDelivered", func(t *testing.T) {
+		purged, err := box.PurgeDelivered(ctx, time.Now().Add(time.Hour))
+		require.NoError(t, err)
+		require.GreaterOrEqual(t, purged, int64(1))
+		purged, err = box.PurgeDelivered(ctx, time.Now().Add(time.Hour))
+		require.NoError(t, err)
+		require.Zero(t, purged)
+	})
+
+	locker, ok := box.(outbox.Locker)
+	if !ok {
+		return
+	}
+	t.Run("Relay Lock", func(t *testing.T) {
+		ok, err := locker.WithRelayLock(ctx, func(ctx context.Context) error {
+			held, err := locker.WithRelayLock(ctx, func(context.Context) error {
+				t.Error("the lock shouldn't be taken twice")
+				return nil
+			})
+			require.NoError(t, err)
+			require.False(t, held)
+			return nil
+		})
+		require.NoError(t, err)
+		require.True(t, ok)
+
+		ok, err = locker.WithRelayLock(ctx, func(context.Context) error { return nil })
+		require.NoError(t, err)
+		require.True(t, ok, "the lock should be released once relayed")
+	})
+}
+
+// drainOutbox marks every pending message of box as delivered
+func drainOutbox(t *testing.T, box outbox.Store) {
+	t.Helper()
+	for {
+		messages, err := box.Pending(context.Background(), 100)
+		require.NoError(t, err)
+		if len(messages) == 0 {
+			return
+		}
+		for _, msg := range messages {
+			require.NoError(t, box.MarkDelivered(context.Background(), msg.Seq))
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package storetest
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mountolive/back-blog-go/post/eventbus"
+	"github.com/stretchr/testify/require"
+)
+
+// RunProcessedEvents executes the contract's suite of an
+// eventbus.ProcessedEventStore against the passed store
+func RunProcessedEvents(t *testing.T, store eventbus.ProcessedEventStore) {
+	ctx := context.Background()
+	ttl := time.Hour
+
+	t.Run("Claim", func(t *testing.T) {
+		key := "test claim"
+		claimEvent(t, store, key, ttl)
+
+		previous, claimed, err := store.Claim(ctx, key, ttl)
+		require.NoError(t, err)
+		require.False(t, claimed, "a pending key shouldn't be claimed again")
+		require.Equal(t, eventbus.StatusPending, previous.Status, genericErr,
+			previous.Status, eventbus.StatusPending)
+	})
+
+	t.Run("Claim succeeded", func(t *testing.T) {
+		key := "test succeeded"
+		claimEvent(t, store, key, ttl)
+		require.NoError(t, store.Complete(ctx, key, eventbus.StatusSucceeded, "", nil, ttl))
+
+		previous, claimed, err := store.Claim(ctx, key, ttl)
+		require.NoError(t, err)
+		require.False(t, claimed, "a succeeded key shouldn't be claimed again")
+		require.Equal(t, key, previous.Key, genericErr, previous.Key, key)
+		require.Equal(t, eventbus.StatusSucceeded, previous.Status, genericErr,
+			previous.Status, eventbus.StatusSucceeded)
+	})
+
+	t.Run("Claim succeeded with result", func(t *testing.T) {
+		key := "test result"
+		claimEvent(t, store, key, ttl)
+		result := map[string]interface{}{"id": "some-id"}
+		require.NoError(t, store.Complete(ctx, key, eventbus.StatusSucceeded, "", result, ttl))
+
+		previous, claimed, err := store.Claim(ctx, key, ttl)
+		require.NoError(t, err)
+		require.False(t, claimed)
+		require.Equal(t, result, previous.Result, genericErr, previous.Result, result)
+	})
+
+	t.Run("Claim failed", func(t *testing.T) {
+		key := "test failed"
+		claimEvent(t, store, key, ttl)
+		require.NoError(t, store.Complete(ctx, key, eventbus.StatusFailed, "boom", nil, ttl))
+		claimEvent(t, store, key, ttl)
+	})
+
+	t.Run("Claim expired", func(t *testing.T) {
+		key := "test expired"
+		claimEvent(t, store, key, time.Millisecond)
+		time.Sleep(10 * time.Millisecond)
+		claimEvent(t, store, key, ttl)
+	})
+
+	t.Run("Concurrent Claim", func(t *testing.T) {
+		key := "test concurrent"
+		attempts := 5
+		claims := make([]bool, attempts)
+		errs := make([]error, attempts)
+		var wg sync.WaitGroup
+		for i := 0; i < attempts; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				_, claims[i], errs[i] = store.Claim(ctx, key, ttl)
+			}(i)
+		}
+		wg.Wait()
+		totalClaimed := 0
+		for i := range claims {
+			require.NoError(t, errs[i])
+			if claims[i] {
+				totalClaimed++
+			}
+		}
+		require.Equal(t, 1, totalClaimed, genericErr, totalClaimed, 1)
+	})
+
+	t.Run("PurgeExpired", func(t *testing.T) {
+		key := "test purged"
+		claimEvent(t, store, key, ttl)
+		require.NoError(t, store.Complete(ctx, key, eventbus.StatusSucceeded, "", nil, ttl))
+
+		purged, err := store.PurgeExpired(ctx, time.Now().Add(2*ttl))
+		require.NoError(t, err)
+		require.GreaterOrEqual(t, purged, int64(1))
+		claimEvent(t, store, key, ttl)
+	})
+}
+
+func claimEvent(t *testing.T, store eventbus.ProcessedEventStore,
+	key string, ttl time.Duration) {
+	t.Helper()
+	previous, claimed, err := store.Claim(context.Background(), key, ttl)
+	require.NoError(t, err)
+	require.True(t, claimed, "key %q should have been claimed", key)
+	require.Nil(t, previous)
+}
@@ -0,0 +1,524 @@
+// Defines the contract every usecase.PostStore implementation should honor,
+// as a test suite to be run against each of them
+package storetest
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/mountolive/back-blog-go/post/usecase"
+	"github.com/stretchr/testify/require"
+)
+
+const genericErr = "\nGot: %v \n Expected: %v\n"
+
+// Run executes the contract's suite against the passed store
+// The store should be empty, as the suite relies on the tags it creates
+func Run(t *testing.T, store usecase.PostStore) {
+	t.Run("Create", func(t *testing.T) {
+		post := &usecase.CreatePostDto{
+			Creator: "theUser",
+			Title:   "knows all",
+			Content: "anything",
+			Tags:    []string{"tag1", "tag2"},
+		}
+		result := createPost(t, store, post)
+		require.Equal(t, post.Title, result.Title, genericErr,
+			result.Title, post.Title)
+		require.Equal(t, post.Tags, result.Tags, genericErr,
+			result.Tags, post.Tags)
+		require.Equal(t, 1, result.Version, genericErr, result.Version, 1)
+		require.False(t, result.CreatedAt.IsZero(), "CreatedAt should have been set")
+		creatorOnly := []usecase.Author{{ID: post.Creator, Role: usecase.AuthorRoleAuthor}}
+		require.Equal(t, creatorOnly, result.Authors, genericErr,
+			result.Authors, creatorOnly)
+	})
+
+	t.Run("Concurrent Create same creator", func(t *testing.T) {
+		creator := "pixies"
+		posts := []*usecase.CreatePostDto{
+			{
+				Creator: creator,
+				Title:   "Where is my mind",
+				Content: "With your feet in the air",
+				Tags:    []string{"tag7"},
+			},
+			{
+				Creator: creator,
+				Title:   "Debaser",
+				Content: "Got me a movie",
+				Tags:    []string{"tag8"},
+			},
+		}
+		results := make([]*usecase.Post, len(posts))
+		errs := make([]error, len(posts))
+		var wg sync.WaitGroup
+		for i, post := range posts {
+			wg.Add(1)
+			go func(i int, post *usecase.CreatePostDto) {
+				defer wg.Done()
+				results[i], errs[i] = store.Create(context.Background(), post)
+			}(i, post)
+		}
+		wg.Wait()
+		for i, post := range posts {
+			require.NoError(t, errs[i], "Error was returned. Concurrent Create")
+			require.NotNil(t, results[i], "No entity returned, Concurrent Create")
+			require.Equal(t, post.Title, results[i].Title, genericErr,
+				results[i].Title, post.Title)
+			require.Equal(t, post.Content, results[i].Content, genericErr,
+				results[i].Content, post.Content)
+			require.Equal(t, post.Tags, results[i].Tags, genericErr,
+				results[i].Tags, post.Tags)
+		}
+		require.NotEqual(t, results[0].Id, results[1].Id, "Ids should be different")
+	})
+
+	t.Run("Update", func(t *testing.T) {
+		post := &usecase.CreatePostDto{
+			Creator: "sonic",
+			Title:   "youth",
+			Content: "Incinerate",
+			Tags:    []string{"tag3", "tag4"},
+		}
+		result := createPost(t, store, post)
+
+		updatedPost := &usecase.UpdatePostDto{
+			Id:      result.Id,
+			Version: result.Version,
+			Content: strPtr("Bull in the heather"),
+			Title:   strPtr("Playing bass like Kim Gordon"),
+			Tags:    []string{"tag4"},
+		}
+		updated, err := store.Update(context.Background(),
+			updatedPost)
+		require.NoError(t, err, "Error was returned. Update %s", err)
+		require.NotNil(t, updated, "No entity returned, Update")
+		require.True(t, updated.Id == result.Id, "Ids not matching after update")
+		require.True(t, updated.Content == *updatedPost.Content, "Content not updated")
+		require.True(t, updated.Title == *updatedPost.Title, "Title not updated")
+		require.Equal(t, updatedPost.Tags, updated.Tags, genericErr,
+			updated.Tags, updatedPost.Tags)
+		require.Equal(t, result.Version+1, updated.Version, genericErr,
+			updated.Version, result.Version+1)
+		for _, tag := range updatedPost.Tags {
+			checkPostsByTag(t, store, result, tag, 1)
+		}
+		checkPostsByTag(t, store, nil, "tag3", 1)
+	})
+
+	t.Run("Partial Update", func(t *testing.T) {
+		post := &usecase.CreatePostDto{
+			Creator: "fugazi",
+			Title:   "Repeater",
+			Content: "Waiting room",
+			Tags:    []string{"tag11", "tag12"},
+		}
+		result := createPost(t, store, post)
+
+		titleOnly := &usecase.UpdatePostDto{
+			Id:      result.Id,
+			Version: result.Version,
+			Title:   strPtr("13 Songs"),
+		}
+		updated, err := store.Update(context.Background(), titleOnly)
+		require.NoError(t, err, "Error was returned. Update %s", err)
+		require.Equal(t, *titleOnly.Title, updated.Title, genericErr,
+			updated.Title, *titleOnly.Title)
+		require.Equal(t, post.Content, updated.Content, genericErr,
+			updated.Content, post.Content)
+		require.ElementsMatch(t, post.Tags, updated.Tags, genericErr,
+			updated.Tags, post.Tags)
+
+		tagsOnly := &usecase.UpdatePostDto{
+			Id:         result.Id,
+			Version:    updated.Version,
+			AddTags:    []string{"tag13"},
+			RemoveTags: []string{"tag11"},
+		}
+		updated, err = store.Update(context.Background(), tagsOnly)
+		require.NoError(t, err, "Error was returned. Update %s", err)
+		require.Equal(t, *titleOnly.Title, updated.Title, genericErr,
+			updated.Title, *titleOnly.Title)
+		require.ElementsMatch(t, []string{"tag12", "tag13"}, updated.Tags, genericErr,
+			updated.Tags, []string{"tag12", "tag13"})
+		require.Equal(t, result.Version+2, updated.Version, genericErr,
+			updated.Version, result.Version+2)
+		checkPostsByTag(t, store, result, "tag13", 1)
+	})
+
+	t.Run("Update not found", func(t *testing.T) {
+		updatedPost := &usecase.UpdatePostDto{
+			Id:      "3bd5e1f4-8a3d-4b5e-9a57-0f0c7b0f1d2a",
+			Version: 1,
+			Content: strPtr("Nowhere"),
+			Title:   strPtr("Man"),
+			Tags:    []string{"tag4"},
+		}
+		updated, err := store.Update(context.Background(), updatedPost)
+		require.Error(t, err, "Update of a non-existent post should error")
+		require.True(t, errors.Is(err, usecase.ErrPostNotFound), genericErr,
+			err, usecase.ErrPostNotFound)
+		require.Nil(t, updated, "No entity should be returned, Update")
+	})
+
+	t.Run("Update version conflict", func(t *testing.T) {
+		post := &usecase.CreatePostDto{
+			Creator: "slint",
+			Title:   "Spiderland",
+			Content: "Breadcrumb Trail",
+			Tags:    []string{"tag9"},
+		}
+		result := createPost(t, store, post)
+
+		firstEditor := &usecase.UpdatePostDto{
+			Id:      result.Id,
+			Version: result.Version,
+			Content: strPtr("Nosferatu Man"),
+			Title:   strPtr("Spiderland"),
+			Tags:    []string{"tag9"},
+		}
+		_, err := store.Update(context.Background(), firstEditor)
+		require.NoError(t, err, "Error was returned. Update %s", err)
+
+		secondEditor := &usecase.UpdatePostDto{
+			Id:      result.Id,
+			Version: result.Version,
+			Content: strPtr("Good Morning, Captain"),
+			Title:   strPtr("Spiderland"),
+			Tags:    []string{"tag10"},
+		}
+		updated, err := store.Update(context.Background(), secondEditor)
+		require.True(t, errors.Is(err, usecase.ErrVersionConflict), genericErr,
+			err, usecase.ErrVersionConflict)
+		require.Nil(t, updated, "No entity should be returned, Update")
+
+		found, err := store.ReadOne(context.Background(), result.Id)
+		require.NoError(t, err, "An error occurred in ReadOne: %s", err)
+		require.Equal(t, *firstEditor.Content, found.Content, genericErr,
+			found.Content, *firstEditor.Content)
+		require.Equal(t, firstEditor.Tags, found.Tags, genericErr,
+			found.Tags, firstEditor.Tags)
+	})
+
+	t.Run("Filter", func(t *testing.T) {
+		posts := []*usecase.CreatePostDto{
+			{
+				Creator: "first",
+				Title:   "firstT",
+				Content: "hello",
+				Tags:    []string{"tag5"},
+			},
+			{
+				Creator: "second",
+				Title:   "secondT",
+				Content: "there",
+				Tags:    []string{"tag6"},
+			},
+			{
+				Creator: "third",
+				Title:   "thirdT",
+				Content: "nope",
+				Tags:    []string{"tag5"},
+			},
+		}
+		createdPosts := []*usecase.Post{}
+		for _, newPost := range posts {
+			createdPosts = append(createdPosts, createPost(t, store, newPost))
+		}
+
+		applyAndCheckFilter := func(filter *usecase.GeneralFilter, expectedLen int) []*usecase.Post {
+			list, err := store.Filter(context.Background(), filter)
+			require.True(t, err == nil, "Error while filtering posts %s", err)
+			require.True(t, list != nil, "Nil pointer for filtered posts slice")
+			actualLen := len(list)
+			require.True(t, actualLen == expectedLen, genericErr,
+				actualLen, expectedLen)
+			for i := 0; i < actualLen-1; i++ {
+				require.True(t, list[i].Creator != list[i+1].Creator,
+					"Creators should be different")
+				require.True(t, list[i].Content != list[i+1].Content,
+					"Content should be different")
+				require.False(t, list[i].CreatedAt.Before(list[i+1].CreatedAt),
+					"Posts should be sorted by creation date, newest first")
+			}
+			return list
+		}
+
+		postLength := len(posts)
+		tagFilter := &usecase.GeneralFilter{PageSize: postLength}
+		tagFilter.Tag = "tag5"
+		applyAndCheckFilter(tagFilter, 2)
+
+		caseFilter := &usecase.GeneralFilter{PageSize: postLength}
+		caseFilter.Tag = "TAG5"
+		applyAndCheckFilter(caseFilter, 2)
+
+		dateFilter := &usecase.GeneralFilter{PageSize: postLength}
+		dateFilter.From = createdPosts[0].CreatedAt
+		dateFilter.To = createdPosts[1].CreatedAt
+		applyAndCheckFilter(dateFilter, 2)
+
+		pageFilter := &usecase.GeneralFilter{Page: 1, PageSize: 1}
+		pageFilter.Tag = "tag5"
+		paged := applyAndCheckFilter(pageFilter, 1)
+		require.Equal(t, createdPosts[0].Id, paged[0].Id, genericErr,
+			paged[0].Id, createdPosts[0].Id)
+
+		mixFilter := tagFilter
+		mixFilter.From = createdPosts[0].CreatedAt
+		mixFilter.To = createdPosts[1].CreatedAt
+		applyAndCheckFilter(mixFilter, 1)
+	})
+
+	t.Run("Authors", func(t *testing.T) {
+		post := &usecase.CreatePostDto{
+			Creator: "kim",
+			Title:   "Daydream Nation",
+			Content: "Teen Age Riot",
+			Tags:    []string{"tag30"},
+			Authors: []usecase.Author{
+				{ID: "thurston", Role: usecase.AuthorRoleEditor},
+				{ID: "lee", Role: usecase.AuthorRoleContributor},
+			},
+		}
+		result := createPost(t, store, post)
+		expected := []usecase.Author{
+			{ID: "kim", Role: usecase.AuthorRoleAuthor},
+			{ID: "thurston", Role: usecase.AuthorRoleEditor},
+			{ID: "lee", Role: usecase.AuthorRoleContributor},
+		}
+		require.Equal(t, expected, result.Authors, genericErr, result.Authors, expected)
+
+		found, err := store.ReadOne(context.Background(), result.Id)
+		require.NoError(t, err, "An error occurred in ReadOne: %s", err)
+		require.Equal(t, expected, found.Authors, genericErr, found.Authors, expected)
+
+		authorFilter := &usecase.GeneralFilter{PageSize: 10}
+		authorFilter.Author = "lee"
+		filtered, err := store.Filter(context.Background(), authorFilter)
+		require.NoError(t, err, "Error while filtering posts %s", err)
+		require.Len(t, filtered, 1, genericErr, len(filtered), 1)
+		require.Equal(t, result.Id, filtered[0].Id, genericErr, filtered[0].Id, result.Id)
+		require.Equal(t, expected, filtered[0].Authors, genericErr,
+			filtered[0].Authors, expected)
+
+		// the creator is kept as author when the authors are replaced
+		updated, err := store.Update(context.Background(), &usecase.UpdatePostDto{
+			Id:      result.Id,
+			Version: result.Version,
+			Authors: []usecase.Author{{ID: "steve", Role: usecase.AuthorRoleAuthor}},
+		})
+		require.NoError(t, err, "Error was returned. Update %s", err)
+		expected = []usecase.Author{
+			{ID: "kim", Role: usecase.AuthorRoleAuthor},
+			{ID: "steve", Role: usecase.AuthorRoleAuthor},
+		}
+		require.Equal(t, expected, updated.Authors, genericErr, updated.Authors, expected)
+		require.Equal(t, post.Tags, updated.Tags, genericErr, updated.Tags, post.Tags)
+
+		filtered, err = store.Filter(context.Background(), authorFilter)
+		require.NoError(t, err, "Error while filtering posts %s", err)
+		require.Empty(t, filtered, "Replaced authors shouldn't match")
+
+		deleted, err := store.Delete(context.Background(), &usecase.DeletePostDto{
+			Id:      result.Id,
+			Version: updated.Version,
+		})
+		require.NoError(t, err, "Error was returned. Delete %s", err)
+		require.Equal(t, expected, deleted.Authors, genericErr, deleted.Authors, expected)
+
+		authorFilter.Author = "steve"
+		filtered, err = store.Filter(context.Background(), authorFilter)
+		require.NoError(t, err, "Error while filtering posts %s", err)
+		require.Empty(t, filtered, "Deleted posts shouldn't match")
+	})
+
+	t.Run("ReplaceUserRef", func(t *testing.T) {
+		refStore, ok := store.(usecase.UserRefStore)
+		if !ok {
+			t.Skip("the store doesn't keep posts identified by login")
+		}
+		post := createPost(t, store, &usecase.CreatePostDto{
+			Creator: "mark",
+			Title:   "Everything Must Go",
+			Content: "A Design for Life",
+			Tags:    []string{"tag40"},
+			Authors: []usecase.Author{{ID: "nicky", Role: usecase.AuthorRoleEditor}},
+		})
+		refs, err := refStore.UserRefs(context.Background())
+		require.NoError(t, err, "Error was returned. UserRefs %s", err)
+		require.Contains(t, refs, "mark")
+		require.Contains(t, refs, "nicky")
+
+		const id = "5d7b8c1e-2f3a-4b5c-9d6e-7f8a9b0c1d2e"
+		err = refStore.ReplaceUserRef(context.Background(), "mark", id)
+		require.NoError(t, err, "Error was returned. ReplaceUserRef %s", err)
+		found, err := store.ReadOne(context.Background(), post.Id)
+		require.NoError(t, err, "An error occurred in ReadOne: %s", err)
+		require.Equal(t, id, found.Creator, genericErr, found.Creator, id)
+		expected := []usecase.Author{
+			{ID: id, Role: usecase.AuthorRoleAuthor},
+			{ID: "nicky", Role: usecase.AuthorRoleEditor},
+		}
+		require.Equal(t, expected, found.Authors, genericErr, found.Authors, expected)
+		require.Equal(t, post.Version, found.Version, "Versions shouldn't be bumped")
+		require.True(t, post.UpdatedAt.Equal(found.UpdatedAt), genericErr,
+			found.UpdatedAt, post.UpdatedAt)
+
+		refs, err = refStore.UserRefs(context.Background())
+		require.NoError(t, err, "Error was returned. UserRefs %s", err)
+		require.NotContains(t, refs, "mark")
+		require.Contains(t, refs, id)
+
+		// authors added by ID while their login was still stored
+		const richeyID = "9a8b7c6d-5e4f-4a3b-8c2d-1e0f9a8b7c6d"
+		post = createPost(t, store, &usecase.CreatePostDto{
+			Creator: id,
+			Title:   "Motorcycle Emptiness",
+			Content: "Generation Terrorists",
+			Tags:    []string{"tag41"},
+			Authors: []usecase.Author{
+				{ID: "richey", Role: usecase.AuthorRoleAuthor},
+				{ID: richeyID, Role: usecase.AuthorRoleEditor},
+			},
+		})
+		err = refStore.ReplaceUserRef(context.Background(), "richey", richeyID)
+		require.NoError(t, err, "Error was returned. ReplaceUserRef %s", err)
+		found, err = store.ReadOne(context.Background(), post.Id)
+		require.NoError(t, err, "An error occurred in ReadOne: %s", err)
+		expected = []usecase.Author{
+			{ID: id, Role: usecase.AuthorRoleAuthor},
+			{ID: richeyID, Role: usecase.AuthorRoleEditor},
+		}
+		require.Equal(t, expected, found.Authors, genericErr, found.Authors, expected)
+	})
+
+	t.Run("ReadOne", func(t *testing.T) {
+		post := &usecase.CreatePostDto{
+			Creator: "melvins",
+			Title:   "Buzzo",
+			Content: "the bit",
+			Tags:    []string{"stag"},
+		}
+		result := createPost(t, store, post)
+
+		found, err := store.ReadOne(context.Background(), result.Id)
+		require.NoError(t, err, "An error occurred in ReadOne: %s", err)
+		require.NotNil(t, found, "Post not found by the passed Id. ReadOne")
+		require.True(t, found.Content == post.Content, genericErr,
+			found.Content, post.Content)
+		require.True(t, found.Creator == post.Creator, genericErr,
+			found.Creator, post.Creator)
+		require.Equal(t, result.Version, found.Version, genericErr,
+			found.Version, result.Version)
+		for _, tag := range post.Tags {
+			checkPostsByTag(t, store, result, tag, 1)
+		}
+	})
+
+	t.Run("ReadOne not found", func(t *testing.T) {
+		found, err := store.ReadOne(
+			context.Background(), "0b8f4bd6-5d55-4d5c-8f0c-3c0f2a1e9b7d",
+		)
+		require.True(t, errors.Is(err, usecase.ErrPostNotFound), genericErr,
+			err, usecase.ErrPostNotFound)
+		require.Nil(t, found, "No entity should be returned, ReadOne")
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		post := &usecase.CreatePostDto{
+			Creator: "low",
+			Title:   "Things We Lost in the Fire",
+			Content: "Sunflower",
+			Tags:    []string{"tag20", "TAG21"},
+		}
+		result := createPost(t, store, post)
+
+		deleted, err := store.Delete(context.Background(), &usecase.DeletePostDto{
+			Id:      result.Id,
+			Version: result.Version,
+		})
+		require.NoError(t, err, "Error was returned. Delete %s", err)
+		require.Equal(t, result.Id, deleted.Id, genericErr, deleted.Id, result.Id)
+		require.Equal(t, post.Tags, deleted.Tags, genericErr, deleted.Tags, post.Tags)
+
+		found, err := store.ReadOne(context.Background(), result.Id)
+		require.True(t, errors.Is(err, usecase.ErrPostNotFound), genericErr,
+			err, usecase.ErrPostNotFound)
+		require.Nil(t, found, "No entity should be returned, ReadOne")
+		for _, tag := range post.Tags {
+			checkPostsByTag(t, store, nil, tag, 10)
+		}
+	})
+
+	t.Run("Delete not found", func(t *testing.T) {
+		deleted, err := store.Delete(context.Background(), &usecase.DeletePostDto{
+			Id:      "6f1c2d3e-4b5a-4c6d-8e7f-9a0b1c2d3e4f",
+			Version: 1,
+		})
+		require.True(t, errors.Is(err, usecase.ErrPostNotFound), genericErr,
+			err, usecase.ErrPostNotFound)
+		require.Nil(t, deleted, "No entity should be returned, Delete")
+	})
+
+	t.Run("Delete version conflict", func(t *testing.T) {
+		post := &usecase.CreatePostDto{
+			Creator: "low",
+			Title:   "The Great Destroyer",
+			Content: "Monkey",
+			Tags:    []string{"tag22"},
+		}
+		result := createPost(t, store, post)
+
+		deleted, err := store.Delete(context.Background(), &usecase.DeletePostDto{
+			Id:      result.Id,
+			Version: result.Version + 1,
+		})
+		require.True(t, errors.Is(err, usecase.ErrVersionConflict), genericErr,
+			err, usecase.ErrVersionConflict)
+		require.Nil(t, deleted, "No entity should be returned, Delete")
+
+		found, err := store.ReadOne(context.Background(), result.Id)
+		require.NoError(t, err, "An error occurred in ReadOne: %s", err)
+		require.Equal(t, result.Id, found.Id, genericErr, found.Id, result.Id)
+	})
+}
+
+func createPost(t *testing.T, store usecase.PostStore,
+	post *usecase.CreatePostDto) *usecase.Post {
+	result, err := store.Create(context.Background(), post)
+	require.True(t, err == nil, "An error was returned. Not expected: %s, Create", err)
+	require.NotNil(t, result, "No entity was returned from Create")
+	require.True(t, result.Id != "", "Id was empty, error creating the Post")
+	require.True(t, result.Creator == post.Creator, genericErr,
+		result.Creator, post.Creator)
+	require.True(t, result.Content == post.Content, genericErr,
+		result.Content, post.Content)
+	return result
+}
+
+func strPtr(s string) *string {
+	return &s
+}
+
+// checkPostsByTag checks that the only post tagged with tag is result,
+// a nil result means that no post should be tagged with it
+func checkPostsByTag(t *testing.T, store usecase.PostStore,
+	result *usecase.Post, tag string, pageSize int) {
+	filter := &usecase.GeneralFilter{PageSize: pageSize}
+	filter.Tag = tag
+	filteredPosts, err := store.Filter(context.Background(), filter)
+	require.True(t, err == nil,
+		"An error was returned. Not expected, Create's Filter %s", err)
+	found := len(filteredPosts)
+	if result == nil {
+		require.True(t, found == 0, genericErr, found, 0)
+		return
+	}
+	require.True(t, found == 1, genericErr, found, 1)
+	require.True(t, filteredPosts[0].Id == result.Id,
+		"Created post doesn't match with found post")
+}
@@ -0,0 +1,272 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+)
+
+// Roles of the authors of a post
+// Authors and editors can change the post, as its creator does,
+// while contributors are only credited
+const (
+	AuthorRoleAuthor      = "author"
+	AuthorRoleEditor      = "editor"
+	AuthorRoleContributor = "contributor"
+)
+
+// Author of a post, along with their role on it
+// Authors are persisted by the ID of their users, which doesn't change
+// when they rename themselves; Login, DisplayName and AvatarURL aren't,
+// they're resolved from the users service when the post is read.
+// Authors are passed by Login, the ID is set once they're checked
+type Author struct {
+	ID          string `json:"id"`
+	Login       string `json:"login"`
+	Role        string `json:"role"`
+	DisplayName string `json:"display_name,omitempty"`
+	AvatarURL   string `json:"avatar_url,omitempty"`
+}
+
+// Dto for handling filtering by author, by their login
+type ByAuthorDto struct {
+	Author string
+}
+
+// UserProfile is the public data of a user, as exposed by the users service
+type UserProfile struct {
+	ID          string
+	Username    string
+	DisplayName string
+	AvatarURL   string
+}
+
+// Defines the needed methods for fetching, in bulk, the profiles of
+// the users with the passed logins, or IDs, keyed by them. The ones
+// that don't exist are left out of the returned map
+type AuthorResolver interface {
+	ResolveUsers(context.Context, []string) (map[string]UserProfile, error)
+	ResolveUserIDs(context.Context, []string) (map[string]UserProfile, error)
+}
+
+var (
+	// ErrInvalidAuthorRole returned when an author has an unknown role
+	ErrInvalidAuthorRole = errors.New("author's role should be author, editor or contributor")
+	// ErrDuplicatedAuthor returned when a user is listed more than once as author
+	ErrDuplicatedAuthor = errors.New("user listed more than once as author")
+	// ErrEmptyAuthors returned when authors passed is empty, on replacement
+	ErrEmptyAuthors = errors.New("authors can't be empty")
+)
+
+// NormalizeAuthors returns the authors of a post created by creator,
+// both identified by ID: the creator is always one of them, as the first
+// author, when not listed explicitly. Nil authors means the creator alone
+func NormalizeAuthors(creator string, authors []Author) []Author {
+	for _, author := range authors {
+		if author.ID == creator {
+			return authors
+		}
+	}
+	normalized := make([]Author, 0, len(authors)+1)
+	normalized = append(normalized, Author{ID: creator, Role: AuthorRoleAuthor})
+	return append(normalized, authors...)
+}
+
+// Logins returns the logins of the passed authors, in order
+func Logins(authors []Author) []string {
+	logins := make([]string, 0, len(authors))
+	for _, author := range authors {
+		logins = append(logins, author.Login)
+	}
+	return logins
+}
+
+// HasAuthor tells whether the user with the passed ID is an author
+// of the post, with one of roles when any is passed
+func (p *Post) HasAuthor(id string, roles ...string) bool {
+	for _, author := range p.Authors {
+		if author.ID != id {
+			continue
+		}
+		if len(roles) == 0 {
+			return true
+		}
+		for _, role := range roles {
+			if author.Role == role {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// checkRoles validates the roles of the passed authors
+func checkRoles(authors []Author) error {
+	for _, author := range authors {
+		switch author.Role {
+		case AuthorRoleAuthor, AuthorRoleEditor, AuthorRoleContributor:
+		default:
+			return fmt.Errorf("%s as %q: %w", author.Login, author.Role, ErrInvalidAuthorRole)
+		}
+	}
+	return nil
+}
+
+// identifyAuthors sets the IDs of the authors of a post created by creator,
+// out of the profiles of their logins, checking that none of them is
+// repeated; see NormalizeAuthors
+func identifyAuthors(
+	creator string,
+	authors []Author,
+	profiles map[string]UserProfile,
+) ([]Author, error) {
+	identified := make([]Author, 0, len(authors))
+	seen := map[string]bool{}
+	for _, author := range authors {
+		author.ID = profiles[author.Login].ID
+		if seen[author.ID] {
+			return nil, fmt.Errorf("%s: %w", author.Login, ErrDuplicatedAuthor)
+		}
+		seen[author.ID] = true
+		identified = append(identified, author)
+	}
+	return NormalizeAuthors(creator, identified), nil
+}
+
+// identify returns the profiles of the users with the passed logins, keyed
+// by them, checking that all of them exist, in a single call to the users
+// service when there's a Resolver. Otherwise they're checked one by one
+// through Checker, and identified by their logins
+func (r *PostRepository) identify(
+	ctx context.Context,
+	logins []string,
+) (map[string]UserProfile, error) {
+	if r.Resolver == nil {
+		profiles := make(map[string]UserProfile, len(logins))
+		for _, login := range logins {
+			exists, err := r.Checker.CheckExistence(ctx, login)
+			if err != nil {
+				return nil, logErrorAndWrap(ErrUserCheck, err.Error())
+			}
+			if !exists {
+				return nil, logErrorAndWrap(ErrUserNotFound,
+					fmt.Sprintf("User %s not found", login))
+			}
+			profiles[login] = UserProfile{ID: login, Username: login}
+		}
+		return profiles, nil
+	}
+	profiles, err := r.Resolver.ResolveUsers(ctx, logins)
+	if err != nil {
+		return nil, logErrorAndWrap(ErrUserCheck, err.Error())
+	}
+	missing := []string{}
+	seen := map[string]bool{}
+	for _, login := range logins {
+		if _, ok := profiles[login]; !ok && !seen[login] {
+			missing = append(missing, login)
+		}
+		seen[login] = true
+	}
+	if len(missing) > 0 {
+		return nil, logErrorAndWrap(ErrUserNotFound,
+			fmt.Sprintf("Users %s not found", strings.Join(missing, ", ")))
+	}
+	return profiles, nil
+}
+
+// userID returns the ID of the user with the passed login, empty
+// when there's no such user. Without a Resolver, it's the login itself
+func (r *PostRepository) userID(ctx context.Context, login string) (string, error) {
+	if r.Resolver == nil {
+		return login, nil
+	}
+	profiles, err := r.Resolver.ResolveUsers(ctx, []string{login})
+	if err != nil {
+		return "", logErrorAndWrap(ErrUserCheck, err.Error())
+	}
+	return profiles[login].ID, nil
+}
+
+// isLegacyRef tells whether login, as stored by the posts not migrated yet,
+// identifies the user whose ID is id: the user has to be known, and
+// login can't be the ID of another user
+func (r *PostRepository) isLegacyRef(ctx context.Context, login, id string) (bool, error) {
+	if r.Resolver == nil || id == "" {
+		return false, nil
+	}
+	profiles, err := r.Resolver.ResolveUserIDs(ctx, []string{login})
+	if err != nil {
+		return false, logErrorAndWrap(ErrUserCheck, err.Error())
+	}
+	profile, ok := profiles[login]
+	return !ok || profile.ID == id, nil
+}
+
+// byID keys the passed profiles by the IDs of their users
+func byID(profiles map[string]UserProfile) map[string]UserProfile {
+	keyed := make(map[string]UserProfile, len(profiles))
+	for _, profile := range profiles {
+		keyed[profile.ID] = profile
+	}
+	return keyed
+}
+
+// resolveUsers fills in the current usernames and display names of the
+// creators and authors of posts, and the authors' avatars, out of the
+// profiles passed, keyed by ID. The ones missing are fetched at once.
+// The posts are readable without them, so a failure is only logged
+func (r *PostRepository) resolveUsers(
+	ctx context.Context,
+	profiles map[string]UserProfile,
+	posts ...*Post,
+) {
+	if r.Resolver == nil {
+		return
+	}
+	ids := []string{}
+	seen := map[string]bool{}
+	addID := func(id string) {
+		if _, ok := profiles[id]; !ok && !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	for _, post := range posts {
+		addID(post.Creator)
+		for _, author := range post.Authors {
+			addID(author.ID)
+		}
+	}
+	if len(ids) > 0 {
+		fetched, err := r.Resolver.ResolveUserIDs(ctx, ids)
+		if err != nil {
+			log.Printf("resolve users %s: %v", strings.Join(ids, ", "), err)
+		}
+		merged := make(map[string]UserProfile, len(profiles)+len(fetched))
+		for id, profile := range profiles {
+			merged[id] = profile
+		}
+		for id, profile := range fetched {
+			merged[id] = profile
+		}
+		profiles = merged
+	}
+	for _, post := range posts {
+		if profile, ok := profiles[post.Creator]; ok {
+			post.CreatorUsername = profile.Username
+			post.CreatorDisplayName = profile.DisplayName
+		}
+		for i, author := range post.Authors {
+			profile, ok := profiles[author.ID]
+			if !ok {
+				continue
+			}
+			post.Authors[i].Login = profile.Username
+			post.Authors[i].DisplayName = profile.DisplayName
+			post.Authors[i].AvatarURL = profile.AvatarURL
+		}
+	}
+}
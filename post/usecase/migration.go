@@ -0,0 +1,69 @@
+package usecase
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"regexp"
+	"sort"
+)
+
+// uuidPattern matches the IDs of the users service's users, telling
+// them apart from the logins persisted before posts stored IDs
+var uuidPattern = regexp.MustCompile(
+	`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+// Contract for the stores that may keep posts persisted when their
+// creators and authors were identified by login, instead of by ID
+type UserRefStore interface {
+	// UserRefs returns the distinct creators and authors of the posts
+	UserRefs(context.Context) ([]string, error)
+	// ReplaceUserRef identifies the creator and authors identified as
+	// from as to instead, in every post, without bumping their versions
+	ReplaceUserRef(ctx context.Context, from, to string) error
+}
+
+// UserIDMigration reports the logins replaced by the IDs of their users,
+// and the ones left as they are, as they couldn't be resolved
+type UserIDMigration struct {
+	Migrated   map[string]string
+	Unresolved []string
+}
+
+// MigrateUserIDs replaces the logins still identifying the creators and
+// authors of the posts in store by the IDs of their users, one at a time.
+// The ones of users that don't exist anymore, or that fail to be resolved,
+// are left as they are, so the migration can be run again
+func MigrateUserIDs(
+	ctx context.Context,
+	store UserRefStore,
+	resolver AuthorResolver,
+) (*UserIDMigration, error) {
+	refs, err := store.UserRefs(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("migrate user ids: %w", err)
+	}
+	sort.Strings(refs)
+	migration := &UserIDMigration{Migrated: map[string]string{}}
+	for _, login := range refs {
+		if login == "" || uuidPattern.MatchString(login) {
+			continue
+		}
+		profiles, err := resolver.ResolveUsers(ctx, []string{login})
+		if err != nil {
+			log.Printf("migrate user ids, resolve %s: %v", login, err)
+			migration.Unresolved = append(migration.Unresolved, login)
+			continue
+		}
+		profile, ok := profiles[login]
+		if !ok || profile.ID == "" {
+			migration.Unresolved = append(migration.Unresolved, login)
+			continue
+		}
+		if err := store.ReplaceUserRef(ctx, login, profile.ID); err != nil {
+			return migration, fmt.Errorf("migrate user ids, replace %s: %w", login, err)
+		}
+		migration.Migrated[login] = profile.ID
+	}
+	return migration, nil
+}
@@ -0,0 +1,62 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type mockUserRefStore struct {
+	refs     []string
+	replaced map[string]string
+	err      error
+}
+
+func (m *mockUserRefStore) UserRefs(ctx context.Context) ([]string, error) {
+	return m.refs, nil
+}
+
+func (m *mockUserRefStore) ReplaceUserRef(ctx context.Context, from, to string) error {
+	if m.err != nil {
+		return m.err
+	}
+	m.replaced[from] = to
+	return nil
+}
+
+func TestMigrateUserIDs(t *testing.T) {
+	const migratedID = "3f2c1b0a-9e8d-4c7b-a6f5-e4d3c2b1a090"
+	resolver := &mockResolver{profiles: map[string]UserProfile{
+		"kim": {ID: "0a1b2c3d-4e5f-4a6b-8c7d-9e0f1a2b3c4d", Username: "kim"},
+	}}
+
+	t.Run("Logins", func(t *testing.T) {
+		store := &mockUserRefStore{
+			refs:     []string{"kim", migratedID, "ghost"},
+			replaced: map[string]string{},
+		}
+		migration, err := MigrateUserIDs(context.Background(), store, resolver)
+		require.NoError(t, err)
+		expected := map[string]string{"kim": "0a1b2c3d-4e5f-4a6b-8c7d-9e0f1a2b3c4d"}
+		require.Equal(t, expected, migration.Migrated)
+		require.Equal(t, expected, store.replaced, "IDs shouldn't be resolved again")
+		require.Equal(t, []string{"ghost"}, migration.Unresolved)
+	})
+
+	t.Run("Resolver Error", func(t *testing.T) {
+		store := &mockUserRefStore{refs: []string{"kim"}, replaced: map[string]string{}}
+		failing := &mockResolver{err: errors.New("unavailable")}
+		migration, err := MigrateUserIDs(context.Background(), store, failing)
+		require.NoError(t, err, "logins failing to be resolved should be left as they are")
+		require.Equal(t, []string{"kim"}, migration.Unresolved)
+		require.Empty(t, store.replaced)
+	})
+
+	t.Run("Store Error", func(t *testing.T) {
+		store := &mockUserRefStore{refs: []string{"kim"}, err: errors.New("closed")}
+		_, err := MigrateUserIDs(context.Background(), store, resolver)
+		require.Error(t, err)
+	})
+}
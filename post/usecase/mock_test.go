@@ -8,11 +8,19 @@ import (
 type mockStoreNotEmpty struct{}
 
 func (m *mockStoreNotEmpty) Create(ctx context.Context, p *CreatePostDto) (*Post, error) {
-	return &Post{Creator: p.Creator, Content: p.Content}, nil
+	return &Post{Creator: p.Creator, Content: p.Content, Authors: p.Authors}, nil
 }
 
 func (m *mockStoreNotEmpty) Update(ctx context.Context, p *UpdatePostDto) (*Post, error) {
-	return &Post{Id: p.Id, Creator: "test", Content: p.Content}, nil
+	post := &Post{Id: p.Id, Creator: "test", Content: "hello"}
+	if p.Content != nil {
+		post.Content = *p.Content
+	}
+	return post, nil
+}
+
+func (m *mockStoreNotEmpty) Delete(ctx context.Context, p *DeletePostDto) (*Post, error) {
+	return &Post{Id: p.Id, Creator: "test", Content: "hello", Version: p.Version}, nil
 }
 
 func (m *mockStoreNotEmpty) Filter(ctx context.Context, p *GeneralFilter) ([]*Post, error) {
@@ -20,7 +28,11 @@ func (m *mockStoreNotEmpty) Filter(ctx context.Context, p *GeneralFilter) ([]*Po
 }
 
 func (m *mockStoreNotEmpty) ReadOne(ctx context.Context, id string) (*Post, error) {
-	return &Post{Id: id, Creator: "bla", Content: "hello"}, nil
+	return &Post{Id: id, Creator: "bla", Content: "hello", Tags: []string{"tag1", "tag2"}, Authors: []Author{
+		{ID: "bla", Role: AuthorRoleAuthor},
+		{ID: "coeditor", Role: AuthorRoleEditor},
+		{ID: "helper", Role: AuthorRoleContributor},
+	}}, nil
 }
 
 type mockStoreEmpty struct{}
@@ -33,6 +45,10 @@ func (m *mockStoreEmpty) Update(ctx context.Context, p *UpdatePostDto) (*Post, e
 	return nil, errors.New("Any error occurred")
 }
 
+func (m *mockStoreEmpty) Delete(ctx context.Context, p *DeletePostDto) (*Post, error) {
+	return nil, errors.New("Any error occurred")
+}
+
 func (m *mockStoreEmpty) Filter(ctx context.Context, p *GeneralFilter) ([]*Post, error) {
 	return nil, nil
 }
@@ -51,6 +67,10 @@ func (m *mockStoreReadErrored) Update(ctx context.Context, p *UpdatePostDto) (*P
 	return nil, errors.New("Any error occurred")
 }
 
+func (m *mockStoreReadErrored) Delete(ctx context.Context, p *DeletePostDto) (*Post, error) {
+	return nil, errors.New("Any error occurred")
+}
+
 func (m *mockStoreReadErrored) Filter(ctx context.Context, p *GeneralFilter) ([]*Post, error) {
 	return nil, nil
 }
@@ -65,6 +85,52 @@ func (m *mockSanitizer) SanitizeContent(content string) string {
 	return content
 }
 
+type mockRoleChecker struct {
+	roles []string
+	err   error
+}
+
+func (m *mockRoleChecker) Roles(ctx context.Context, login string) ([]string, error) {
+	return m.roles, m.err
+}
+
+// mockResolver keeps profiles by login
+type mockResolver struct {
+	profiles map[string]UserProfile
+	err      error
+	calls    int
+}
+
+func (m *mockResolver) ResolveUsers(ctx context.Context, logins []string) (map[string]UserProfile, error) {
+	m.calls++
+	if m.err != nil {
+		return nil, m.err
+	}
+	profiles := map[string]UserProfile{}
+	for _, login := range logins {
+		if profile, ok := m.profiles[login]; ok {
+			profiles[login] = profile
+		}
+	}
+	return profiles, nil
+}
+
+func (m *mockResolver) ResolveUserIDs(ctx context.Context, ids []string) (map[string]UserProfile, error) {
+	m.calls++
+	if m.err != nil {
+		return nil, m.err
+	}
+	profiles := map[string]UserProfile{}
+	for _, profile := range m.profiles {
+		for _, id := range ids {
+			if profile.ID == id {
+				profiles[id] = profile
+			}
+		}
+	}
+	return profiles, nil
+}
+
 type mockFalseChecker struct{}
 
 func (m *mockFalseChecker) CheckExistence(ctx context.Context, c string) (bool, error) {
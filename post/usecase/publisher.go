@@ -0,0 +1,67 @@
+package usecase
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Names of the domain events announcing changes on posts
+const (
+	PostCreatedEventNameV1 = "posts.v1.created"
+	PostUpdatedEventNameV1 = "posts.v1.updated"
+	PostDeletedEventNameV1 = "posts.v1.deleted"
+)
+
+// DomainEvent announces a change on a post, carrying its full state
+// For deletions, the post is the one deleted
+// ID identifies the event across redeliveries, the Publisher assigns
+// one when it's empty
+type DomainEvent struct {
+	ID         string
+	Name       string
+	Post       Post
+	OccurredAt time.Time
+}
+
+// Publisher announces domain events to other services
+// The context is the one of the operation which caused the event
+type Publisher interface {
+	Publish(context.Context, DomainEvent) error
+}
+
+// NoopPublisher discards every event
+type NoopPublisher struct{}
+
+var _ Publisher = NoopPublisher{}
+
+// Publish implements Publisher
+func (NoopPublisher) Publish(context.Context, DomainEvent) error {
+	return nil
+}
+
+// InMemoryPublisher keeps the events published, it's meant for tests
+// It's safe for concurrent use
+type InMemoryPublisher struct {
+	mu     sync.Mutex
+	events []DomainEvent
+}
+
+var _ Publisher = &InMemoryPublisher{}
+
+// Publish implements Publisher
+func (i *InMemoryPublisher) Publish(_ context.Context, event DomainEvent) error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.events = append(i.events, event)
+	return nil
+}
+
+// Events returns the events published so far, in order
+func (i *InMemoryPublisher) Events() []DomainEvent {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	events := make([]DomainEvent, len(i.events))
+	copy(events, i.events)
+	return events
+}
@@ -5,34 +5,68 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"log"
 	"time"
 )
 
 // Post entity representation
+//    Creator is the ID of the user that created the post, which doesn't
+//    change when they rename themselves. CreatorUsername and
+//    CreatorDisplayName aren't persisted, they're resolved from the
+//    users service when the post is read
 type Post struct {
-	Id        string    `json:"id"`
-	Creator   string    `json:"creator"`
-	Title     string    `json:"title"`
-	Content   string    `json:"content"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at,omitempty"`
-	Tags      []string  `json:"tags"`
+	Id                 string    `json:"id"`
+	Creator            string    `json:"creator"`
+	CreatorUsername    string    `json:"creator_username,omitempty"`
+	CreatorDisplayName string    `json:"creator_display_name,omitempty"`
+	Title              string    `json:"title"`
+	Content            string    `json:"content"`
+	CreatedAt          time.Time `json:"created_at"`
+	UpdatedAt          time.Time `json:"updated_at,omitempty"`
+	Tags               []string  `json:"tags"`
+	Authors            []Author  `json:"authors"`
+	Version            int       `json:"version"`
 }
 
 // Dto for handling creation of Posts
+//    Creator is passed by login, as are the Authors, and persisted by ID
+//    The creator is always one of the Authors, see NormalizeAuthors
 type CreatePostDto struct {
 	Title   string
 	Creator string
 	Content string
 	Tags    []string
+	Authors []Author
 }
 
 // Dto for handling update of Posts
+//    Only the fields present (non-nil) are updated. Tags replaces the whole
+//    set of tags of the post, while AddTags and RemoveTags add and remove
+//    single tags; the latter can't be used along with the former.
+//    Version is the version of the post the update was based on, it's
+//    used for detecting concurrent modifications
+//    Actor is the login of the user requesting the update
+//    Authors replaces the whole list of authors of the post, the
+//    creator is kept as one of them
 type UpdatePostDto struct {
+	Id         string
+	Actor      string
+	Version    int
+	Title      *string
+	Content    *string
+	Tags       []string
+	AddTags    []string
+	RemoveTags []string
+	Authors    []Author
+}
+
+// Dto for handling deletion of Posts
+//    Version is the version of the post the deletion was based on
+//    Actor is the login of the user requesting the deletion
+type DeletePostDto struct {
 	Id      string
-	Title   string
-	Content string
-	Tags    []string
+	Actor   string
+	Version int
 }
 
 // Dto for handling filtering by tag
@@ -50,15 +84,20 @@ type ByDateRangeDto struct {
 type GeneralFilter struct {
 	ByTagDto
 	ByDateRangeDto
+	ByAuthorDto
 	Page     int
 	PageSize int
 }
 
 // Contract for the needs of a post's repo in terms of persistence
-//    The Update method should return the updated version of the post
+//    The Update method should return the updated version of the post,
+//    or ErrVersionConflict if the stored version differs from the passed one
+//    The Delete method should return the deleted post, following the
+//    same rules on versions as Update
 type PostStore interface {
 	Create(context.Context, *CreatePostDto) (*Post, error)
 	Update(context.Context, *UpdatePostDto) (*Post, error)
+	Delete(context.Context, *DeletePostDto) (*Post, error)
 	Filter(context.Context, *GeneralFilter) ([]*Post, error)
 	ReadOne(context.Context, string) (*Post, error)
 }
@@ -75,21 +114,48 @@ type CreatorChecker interface {
 	CheckExistence(context.Context, string) (bool, error)
 }
 
+// Defines the needed method for fetching the roles granted
+//    to a given user
+type RoleChecker interface {
+	Roles(context.Context, string) ([]string, error)
+}
+
+// Roles allowing to update and delete any post, not only
+// the ones created by the user
+const (
+	RoleEditor = "editor"
+	RoleAdmin  = "admin"
+)
+
 // Repository defines the basic contract for Post's usecases
 type Repository interface {
 	CreatePost(context.Context, *CreatePostDto) (*Post, error)
 	UpdatePost(context.Context, *UpdatePostDto) (*Post, error)
+	DeletePost(context.Context, *DeletePostDto) (*Post, error)
 	GetPost(context.Context, string) (*Post, error)
 	FilterByTag(ctx context.Context, filter *ByTagDto, page, pageSize int) ([]*Post, error)
 	FilterByDateRange(ctx context.Context, filter *ByDateRangeDto, page, pageSize int) ([]*Post, error)
+	FilterByAuthor(ctx context.Context, filter *ByAuthorDto, page, pageSize int) ([]*Post, error)
 }
 
 var _ Repository = &PostRepository{}
 
+// PostRepository announces the changes through Publisher,
+// nothing is published when it's nil, as with stores writing
+// their domain events to an outbox
+// Posts are only updated or deleted by their creators, their authors
+// with an author or editor role, or by the users with an editor or
+// admin role; with no Roles, only by their creators and authors
+// Creators and authors are identified and resolved through Resolver,
+// in bulk, or else checked one by one through Checker and identified
+// by their logins
 type PostRepository struct {
 	Store     PostStore
 	Checker   CreatorChecker
+	Roles     RoleChecker
+	Resolver  AuthorResolver
 	Sanitizer ContentSanitizer
+	Publisher Publisher
 }
 
 // Common sentinel errors
@@ -104,8 +170,21 @@ var (
 	ErrUserNotFound = errors.New("creator user does not exist")
 	// ErrUserCheck returned when there's an error in the upstream auth service
 	ErrUserCheck = errors.New("check for user's existence")
-	// ErrEmptyTags returned when tags passed is empty, on creation
+	// ErrEmptyTags returned when tags passed is empty, on creation or replacement,
+	// or when an update would remove every tag of the post
 	ErrEmptyTags = errors.New("tags can't be empty")
+	// ErrMissingVersion returned when no expected version was passed on update
+	ErrMissingVersion = errors.New("missing expected version from the post to be updated")
+	// ErrVersionConflict returned when the post was modified by someone else
+	// since the expected version was read
+	ErrVersionConflict = errors.New("post was modified concurrently, version conflict")
+	// ErrNothingToUpdate returned when an update doesn't carry any field
+	ErrNothingToUpdate = errors.New("no fields passed for updating the post")
+	// ErrConflictingTagsUpdate returned when an update both replaces and
+	// adds or removes tags
+	ErrConflictingTagsUpdate = errors.New("tags can't be replaced and added or removed at once")
+	// ErrForbidden returned when the actor isn't allowed to change the post
+	ErrForbidden = errors.New("actor is not allowed to change the post")
 )
 
 // Persists and return a PostDto with the data passed
@@ -113,19 +192,29 @@ func (r *PostRepository) CreatePost(
 	ctx context.Context,
 	post *CreatePostDto,
 ) (*Post, error) {
-	exists, err := r.Checker.CheckExistence(ctx, post.Creator)
+	if err := checkRoles(post.Authors); err != nil {
+		return nil, err
+	}
+	profiles, err := r.identify(ctx, append([]string{post.Creator}, Logins(post.Authors)...))
 	if err != nil {
-		return nil, logErrorAndWrap(ErrUserCheck, err.Error())
+		return nil, err
 	}
-	if !exists {
-		return nil, logErrorAndWrap(ErrUserNotFound,
-			fmt.Sprintf("User %s not found", post.Creator))
+	post.Creator = profiles[post.Creator].ID
+	post.Authors, err = identifyAuthors(post.Creator, post.Authors, profiles)
+	if err != nil {
+		return nil, err
 	}
 	if len(post.Tags) == 0 {
 		return nil, fmt.Errorf("create post: %w", ErrEmptyTags)
 	}
 	post.Content = r.Sanitizer.SanitizeContent(post.Content)
-	return r.Store.Create(ctx, post)
+	created, err := r.Store.Create(ctx, post)
+	if err != nil {
+		return nil, err
+	}
+	r.publish(ctx, PostCreatedEventNameV1, created)
+	r.resolveUsers(ctx, byID(profiles), created)
+	return created, nil
 }
 
 // Updates and return a PostDto with the data passed,
@@ -137,8 +226,167 @@ func (r *PostRepository) UpdatePost(
 	if updated.Id == "" {
 		return nil, logErrorAndWrap(ErrMissingID, "UpdatePost")
 	}
-	updated.Content = r.Sanitizer.SanitizeContent(updated.Content)
-	return r.Store.Update(ctx, updated)
+	if updated.Version <= 0 {
+		return nil, logErrorAndWrap(ErrMissingVersion, "UpdatePost")
+	}
+	patchesTags := len(updated.AddTags) > 0 || len(updated.RemoveTags) > 0
+	if updated.Tags != nil {
+		if patchesTags {
+			return nil, logErrorAndWrap(ErrConflictingTagsUpdate, "UpdatePost")
+		}
+		if len(updated.Tags) == 0 {
+			return nil, logErrorAndWrap(ErrEmptyTags, "UpdatePost")
+		}
+	}
+	if updated.Authors != nil && len(updated.Authors) == 0 {
+		return nil, logErrorAndWrap(ErrEmptyAuthors, "UpdatePost")
+	}
+	if updated.Title == nil && updated.Content == nil &&
+		updated.Tags == nil && !patchesTags && updated.Authors == nil {
+		return nil, logErrorAndWrap(ErrNothingToUpdate, "UpdatePost")
+	}
+	stored, err := r.authorize(ctx, updated.Actor, updated.Id)
+	if err != nil {
+		return nil, logErrorAndWrap(err, "UpdatePost")
+	}
+	if patchesTags && !keepsTags(stored.Tags, updated.AddTags, updated.RemoveTags) {
+		return nil, logErrorAndWrap(ErrEmptyTags, "UpdatePost")
+	}
+	var profiles map[string]UserProfile
+	if updated.Authors != nil {
+		if err := checkRoles(updated.Authors); err != nil {
+			return nil, err
+		}
+		profiles, err = r.identify(ctx, Logins(updated.Authors))
+		if err != nil {
+			return nil, err
+		}
+		updated.Authors, err = identifyAuthors(stored.Creator, updated.Authors, profiles)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if updated.Content != nil {
+		content := r.Sanitizer.SanitizeContent(*updated.Content)
+		updated.Content = &content
+	}
+	post, err := r.Store.Update(ctx, updated)
+	if err != nil {
+		return nil, err
+	}
+	r.publish(ctx, PostUpdatedEventNameV1, post)
+	r.resolveUsers(ctx, byID(profiles), post)
+	return post, nil
+}
+
+// Deletes a post and returns it, as it was before deletion
+func (r *PostRepository) DeletePost(
+	ctx context.Context,
+	deleted *DeletePostDto,
+) (*Post, error) {
+	if deleted.Id == "" {
+		return nil, logErrorAndWrap(ErrMissingID, "DeletePost")
+	}
+	if deleted.Version <= 0 {
+		return nil, logErrorAndWrap(ErrMissingVersion, "DeletePost")
+	}
+	if _, err := r.authorize(ctx, deleted.Actor, deleted.Id); err != nil {
+		return nil, logErrorAndWrap(err, "DeletePost")
+	}
+	post, err := r.Store.Delete(ctx, deleted)
+	if err != nil {
+		return nil, err
+	}
+	r.publish(ctx, PostDeletedEventNameV1, post)
+	return post, nil
+}
+
+// authorize checks that actor may change the post with the passed id,
+// returning it: it has to be the post's creator, one of its authors with
+// an author or editor role, or have an editor or admin role
+// actor is a login, which is identified for comparing it with the post's
+// creator and authors
+func (r *PostRepository) authorize(ctx context.Context, actor, id string) (*Post, error) {
+	if actor == "" {
+		return nil, fmt.Errorf("missing actor: %w", ErrForbidden)
+	}
+	post, err := r.Store.ReadOne(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if post == nil || post.Id == "" {
+		return nil, fmt.Errorf("ID: %s: %w", id, ErrPostNotFound)
+	}
+	actorID, err := r.userID(ctx, actor)
+	if err != nil {
+		return nil, err
+	}
+	if actorID != "" && canChange(post, actorID) {
+		return post, nil
+	}
+	// posts not migrated yet by MigrateUserIDs still identify their users by login
+	if actorID != actor && canChange(post, actor) {
+		legacy, err := r.isLegacyRef(ctx, actor, actorID)
+		if err != nil {
+			return nil, err
+		}
+		if legacy {
+			return post, nil
+		}
+	}
+	if r.Roles == nil {
+		return nil, fmt.Errorf("%s on post %s: %w", actor, id, ErrForbidden)
+	}
+	roles, err := r.Roles.Roles(ctx, actor)
+	if err != nil {
+		return nil, logErrorAndWrap(ErrUserCheck, err.Error())
+	}
+	for _, role := range roles {
+		if role == RoleEditor || role == RoleAdmin {
+			return post, nil
+		}
+	}
+	return nil, fmt.Errorf("%s on post %s: %w", actor, id, ErrForbidden)
+}
+
+// canChange tells whether the user identified as ref is the creator,
+// an author or an editor of post
+func canChange(post *Post, ref string) bool {
+	return post.Creator == ref || post.HasAuthor(ref, AuthorRoleAuthor, AuthorRoleEditor)
+}
+
+// keepsTags tells whether any of tags is left once added and removed
+// are applied, as the stores do: adding first, then removing
+func keepsTags(tags, added, removed []string) bool {
+	removing := make(map[string]bool, len(removed))
+	for _, tag := range removed {
+		removing[tag] = true
+	}
+	for _, kept := range [][]string{tags, added} {
+		for _, tag := range kept {
+			if !removing[tag] {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// publish announces the change on post. The change is already persisted,
+// so a failure is only logged: failing the operation would make callers
+// retry a change that succeeded
+func (r *PostRepository) publish(ctx context.Context, name string, post *Post) {
+	if r.Publisher == nil || post == nil {
+		return
+	}
+	err := r.Publisher.Publish(ctx, DomainEvent{
+		Name:       name,
+		Post:       *post,
+		OccurredAt: time.Now(),
+	})
+	if err != nil {
+		log.Printf("publish %s of post %s: %v", name, post.Id, err)
+	}
 }
 
 // Retrieves a post by its identifier (id)
@@ -150,6 +398,7 @@ func (r *PostRepository) GetPost(ctx context.Context, id string) (*Post, error)
 	if post.Id == "" {
 		return nil, logErrorAndWrap(ErrPostNotFound, fmt.Sprintf("ID: %s.", id))
 	}
+	r.resolveUsers(ctx, nil, post)
 	return post, nil
 }
 
@@ -161,7 +410,7 @@ func (r *PostRepository) FilterByTag(
 ) ([]*Post, error) {
 	generalFilter := &GeneralFilter{Page: page, PageSize: pageSize}
 	generalFilter.Tag = filter.Tag
-	return r.Store.Filter(ctx, generalFilter)
+	return r.filter(ctx, generalFilter)
 }
 
 // Filters persisted posts by date range
@@ -173,7 +422,34 @@ func (r *PostRepository) FilterByDateRange(
 	generalFilter := &GeneralFilter{Page: page, PageSize: pageSize}
 	generalFilter.From = filter.From
 	generalFilter.To = filter.To
-	return r.Store.Filter(ctx, generalFilter)
+	return r.filter(ctx, generalFilter)
+}
+
+// Filters persisted posts by one of their authors, by login
+func (r *PostRepository) FilterByAuthor(
+	ctx context.Context,
+	filter *ByAuthorDto,
+	page, pageSize int,
+) ([]*Post, error) {
+	id, err := r.userID(ctx, filter.Author)
+	if err != nil {
+		return nil, err
+	}
+	if id == "" {
+		return []*Post{}, nil
+	}
+	generalFilter := &GeneralFilter{Page: page, PageSize: pageSize}
+	generalFilter.Author = id
+	return r.filter(ctx, generalFilter)
+}
+
+func (r *PostRepository) filter(ctx context.Context, filter *GeneralFilter) ([]*Post, error) {
+	posts, err := r.Store.Filter(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	r.resolveUsers(ctx, nil, posts...)
+	return posts, nil
 }
 
 // TODO Remove logErrorAndWrap function as it's unnecessary, posts
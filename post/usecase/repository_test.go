@@ -25,6 +25,13 @@ type updatePostTestCase struct {
 	Repo        *PostRepository
 }
 
+type deletePostTestCase struct {
+	Name        string
+	Description string
+	Dto         *DeletePostDto
+	ExpErr      error
+}
+
 type filterTestCase struct {
 	Name        string
 	Description string
@@ -152,8 +159,10 @@ func TestPostRepository(t *testing.T) {
 	t.Run("UpdatePost", func(t *testing.T) {
 		testDto := &UpdatePostDto{
 			Id:      "id",
-			Title:   "title",
-			Content: "content",
+			Actor:   "bla",
+			Version: 1,
+			Title:   strPtr("title"),
+			Content: strPtr("content"),
 			Tags:    []string{"tag1", "tag2"},
 		}
 		testCases := []updatePostTestCase{
@@ -167,13 +176,204 @@ func TestPostRepository(t *testing.T) {
 				Name:        "Missing Id",
 				Description: "It should return a MissingIdError",
 				Dto: &UpdatePostDto{
-					Title:   "some title",
-					Content: "some content",
+					Title:   strPtr("some title"),
+					Content: strPtr("some content"),
 					Tags:    []string{"many tags... (sic)"},
 				},
 				ExpErr: ErrMissingID,
 				Repo:   repo,
 			},
+			{
+				Name:        "Missing Version",
+				Description: "It should return a MissingVersionError",
+				Dto: &UpdatePostDto{
+					Id:      "id",
+					Title:   strPtr("some title"),
+					Content: strPtr("some content"),
+					Tags:    []string{"tag1"},
+				},
+				ExpErr: ErrMissingVersion,
+				Repo:   repo,
+			},
+			{
+				Name:        "Proper Partial Update Post",
+				Description: "It should return a *Post and no error, leaving out absent fields",
+				Dto: &UpdatePostDto{
+					Id:      "id",
+					Actor:   "bla",
+					Version: 1,
+					AddTags: []string{"tag3"},
+				},
+				Repo: repo,
+			},
+			{
+				Name:        "Missing Actor",
+				Description: "It should return a ForbiddenError",
+				Dto: &UpdatePostDto{
+					Id:      "id",
+					Version: 1,
+					Title:   strPtr("some title"),
+				},
+				ExpErr: ErrForbidden,
+				Repo:   repo,
+			},
+			{
+				Name:        "Not The Creator",
+				Description: "It should return a ForbiddenError, as the actor has no role",
+				Dto: &UpdatePostDto{
+					Id:      "id",
+					Actor:   "other",
+					Version: 1,
+					Title:   strPtr("some title"),
+				},
+				ExpErr: ErrForbidden,
+				Repo: &PostRepository{
+					Store:     &mockStoreNotEmpty{},
+					Sanitizer: &mockSanitizer{},
+					Roles:     &mockRoleChecker{roles: []string{"reader"}},
+				},
+			},
+			{
+				Name:        "Editor",
+				Description: "It should return a *Post and no error, as editors update any post",
+				Dto: &UpdatePostDto{
+					Id:      "id",
+					Actor:   "other",
+					Version: 1,
+					Title:   strPtr("some title"),
+				},
+				Repo: &PostRepository{
+					Store:     &mockStoreNotEmpty{},
+					Sanitizer: &mockSanitizer{},
+					Roles:     &mockRoleChecker{roles: []string{RoleEditor}},
+				},
+			},
+			{
+				Name:        "Co-Author",
+				Description: "It should return a *Post and no error, as editor authors update the post",
+				Dto: &UpdatePostDto{
+					Id:      "id",
+					Actor:   "coeditor",
+					Version: 1,
+					Title:   strPtr("some title"),
+				},
+				Repo: repo,
+			},
+			{
+				Name:        "Contributor",
+				Description: "It should return a ForbiddenError, as contributors are only credited",
+				Dto: &UpdatePostDto{
+					Id:      "id",
+					Actor:   "helper",
+					Version: 1,
+					Title:   strPtr("some title"),
+				},
+				ExpErr: ErrForbidden,
+				Repo:   repo,
+			},
+			{
+				Name:        "Empty Authors Replacement",
+				Description: "It should return an EmptyAuthorsError",
+				Dto: &UpdatePostDto{
+					Id:      "id",
+					Actor:   "bla",
+					Version: 1,
+					Authors: []Author{},
+				},
+				ExpErr: ErrEmptyAuthors,
+				Repo:   repo,
+			},
+			{
+				Name:        "Unknown Author",
+				Description: "It should return an UserNotFoundError",
+				Dto: &UpdatePostDto{
+					Id:      "id",
+					Actor:   "bla",
+					Version: 1,
+					Authors: []Author{{Login: "ghost", Role: AuthorRoleContributor}},
+				},
+				ExpErr: ErrUserNotFound,
+				Repo: &PostRepository{
+					Store:     &mockStoreNotEmpty{},
+					Sanitizer: &mockSanitizer{},
+					Resolver: &mockResolver{profiles: map[string]UserProfile{
+						"bla": {ID: "bla", Username: "bla"},
+					}},
+				},
+			},
+			{
+				Name:        "Roles Check Error",
+				Description: "It should return an UserCheckError",
+				Dto: &UpdatePostDto{
+					Id:      "id",
+					Actor:   "other",
+					Version: 1,
+					Title:   strPtr("some title"),
+				},
+				ExpErr: ErrUserCheck,
+				Repo: &PostRepository{
+					Store:     &mockStoreNotEmpty{},
+					Sanitizer: &mockSanitizer{},
+					Roles:     &mockRoleChecker{err: errors.New("unavailable")},
+				},
+			},
+			{
+				Name:        "Nothing To Update",
+				Description: "It should return a NothingToUpdateError",
+				Dto: &UpdatePostDto{
+					Id:      "id",
+					Version: 1,
+				},
+				ExpErr: ErrNothingToUpdate,
+				Repo:   repo,
+			},
+			{
+				Name:        "Conflicting Tags Update",
+				Description: "It should return a ConflictingTagsUpdateError",
+				Dto: &UpdatePostDto{
+					Id:         "id",
+					Version:    1,
+					Tags:       []string{"tag1"},
+					RemoveTags: []string{"tag2"},
+				},
+				ExpErr: ErrConflictingTagsUpdate,
+				Repo:   repo,
+			},
+			{
+				Name:        "Empty Tags Replacement",
+				Description: "It should return an EmptyTagsError",
+				Dto: &UpdatePostDto{
+					Id:      "id",
+					Version: 1,
+					Tags:    []string{},
+				},
+				ExpErr: ErrEmptyTags,
+				Repo:   repo,
+			},
+			{
+				Name:        "Removing Every Tag",
+				Description: "It should return an EmptyTagsError",
+				Dto: &UpdatePostDto{
+					Id:         "id",
+					Actor:      "bla",
+					Version:    1,
+					AddTags:    []string{"tag3"},
+					RemoveTags: []string{"tag1", "tag2", "tag3"},
+				},
+				ExpErr: ErrEmptyTags,
+				Repo:   repo,
+			},
+			{
+				Name:        "Removing Some Tags",
+				Description: "It should return a *Post and no error",
+				Dto: &UpdatePostDto{
+					Id:         "id",
+					Actor:      "bla",
+					Version:    1,
+					RemoveTags: []string{"tag1"},
+				},
+				Repo: repo,
+			},
 		}
 		for _, tc := range testCases {
 			t.Run(tc.Name, func(t *testing.T) {
@@ -187,13 +387,214 @@ func TestPostRepository(t *testing.T) {
 				} else {
 					id := tc.Dto.Id
 					require.Equal(t, id, post.Id, genericError, post.Id, id)
-					content := tc.Dto.Content
-					require.Equal(t, content, post.Content, genericError, post.Content, content)
+					if tc.Dto.Content != nil {
+						content := *tc.Dto.Content
+						require.Equal(t, content, post.Content, genericError, post.Content, content)
+					}
 				}
 			})
 		}
 	})
 
+	t.Run("DeletePost", func(t *testing.T) {
+		testCases := []deletePostTestCase{
+			{
+				Name:        "Proper Delete Post",
+				Description: "It should return the deleted *Post and no error",
+				Dto:         &DeletePostDto{Id: "id", Actor: "bla", Version: 1},
+			},
+			{
+				Name:        "Not The Creator",
+				Description: "It should return a ForbiddenError",
+				Dto:         &DeletePostDto{Id: "id", Actor: "other", Version: 1},
+				ExpErr:      ErrForbidden,
+			},
+			{
+				Name:        "Missing Id",
+				Description: "It should return a MissingIdError",
+				Dto:         &DeletePostDto{Version: 1},
+				ExpErr:      ErrMissingID,
+			},
+			{
+				Name:        "Missing Version",
+				Description: "It should return a MissingVersionError",
+				Dto:         &DeletePostDto{Id: "id"},
+				ExpErr:      ErrMissingVersion,
+			},
+		}
+		for _, tc := range testCases {
+			t.Run(tc.Name, func(t *testing.T) {
+				t.Log(tc.Description)
+				post, err := repo.DeletePost(context.Background(), tc.Dto)
+				if tc.ExpErr != nil {
+					require.True(t, post == nil, "Returned PostDto should be nil")
+					require.True(t, errors.Is(err, tc.ExpErr), genericError, err, tc.ExpErr)
+				} else {
+					require.NoError(t, err)
+					require.Equal(t, tc.Dto.Id, post.Id, genericError, post.Id, tc.Dto.Id)
+				}
+			})
+		}
+	})
+
+	t.Run("Authors", func(t *testing.T) {
+		// the creator of mockStoreNotEmpty's post renamed themselves,
+		// from bla to blah
+		profiles := map[string]UserProfile{
+			"username": {ID: "id-username", Username: "username",
+				DisplayName: "User Name", AvatarURL: "https://avatars/username"},
+			"coauthor": {ID: "id-coauthor", Username: "coauthor", DisplayName: "Co Author"},
+			"blah":     {ID: "bla", Username: "blah", DisplayName: "Bla"},
+		}
+		resolver := &mockResolver{profiles: profiles}
+		authorsRepo := &PostRepository{
+			Store:     &mockStoreNotEmpty{},
+			Sanitizer: &mockSanitizer{},
+			Resolver:  resolver,
+		}
+		ctx := context.Background()
+		created, err := authorsRepo.CreatePost(ctx, &CreatePostDto{
+			Title:   "title",
+			Creator: "username",
+			Content: "content",
+			Tags:    []string{"tag1"},
+			Authors: []Author{{Login: "coauthor", Role: AuthorRoleContributor}},
+		})
+		require.NoError(t, err)
+		require.Equal(t, 1, resolver.calls, "users should be identified in bulk")
+		require.Equal(t, "id-username", created.Creator, "creators should be stored by ID")
+		require.Equal(t, "username", created.CreatorUsername)
+		require.Equal(t, "User Name", created.CreatorDisplayName)
+		require.Equal(t, []Author{
+			{ID: "id-username", Login: "username", Role: AuthorRoleAuthor,
+				DisplayName: "User Name", AvatarURL: "https://avatars/username"},
+			{ID: "id-coauthor", Login: "coauthor", Role: AuthorRoleContributor,
+				DisplayName: "Co Author"},
+		}, created.Authors)
+
+		invalidCases := []struct {
+			authors []Author
+			expErr  error
+		}{
+			{[]Author{{Login: "coauthor", Role: "owner"}}, ErrInvalidAuthorRole},
+			{[]Author{
+				{Login: "coauthor", Role: AuthorRoleEditor},
+				{Login: "coauthor", Role: AuthorRoleContributor},
+			}, ErrDuplicatedAuthor},
+			{[]Author{{Login: "ghost", Role: AuthorRoleEditor}}, ErrUserNotFound},
+		}
+		for _, tc := range invalidCases {
+			_, err := authorsRepo.CreatePost(ctx, &CreatePostDto{
+				Title:   "title",
+				Creator: "username",
+				Content: "content",
+				Tags:    []string{"tag1"},
+				Authors: tc.authors,
+			})
+			require.True(t, errors.Is(err, tc.expErr), genericError, err, tc.expErr)
+		}
+
+		found, err := authorsRepo.GetPost(ctx, "id")
+		require.NoError(t, err)
+		require.Equal(t, "blah", found.CreatorUsername, "the current username should be resolved")
+		require.Equal(t, "Bla", found.CreatorDisplayName)
+		require.Equal(t, "blah", found.Authors[0].Login)
+		require.Equal(t, "Bla", found.Authors[0].DisplayName)
+		require.Empty(t, found.Authors[1].DisplayName, "unknown users are left as they are")
+
+		_, err = authorsRepo.UpdatePost(ctx, &UpdatePostDto{
+			Id:      "id",
+			Actor:   "blah",
+			Version: 1,
+			Title:   strPtr("renamed"),
+		})
+		require.NoError(t, err, "renamed creators should keep their posts")
+		_, err = authorsRepo.UpdatePost(ctx, &UpdatePostDto{
+			Id:      "id",
+			Actor:   "bla",
+			Version: 1,
+			Title:   strPtr("renamed"),
+		})
+		require.True(t, errors.Is(err, ErrForbidden), genericError, err, ErrForbidden)
+
+		byAuthor, err := authorsRepo.FilterByAuthor(ctx, &ByAuthorDto{Author: "ghost"}, 0, 10)
+		require.NoError(t, err)
+		require.Empty(t, byAuthor, "unknown users have no posts")
+
+		failingRepo := &PostRepository{
+			Store:     &mockStoreNotEmpty{},
+			Sanitizer: &mockSanitizer{},
+			Resolver:  &mockResolver{err: errors.New("unavailable")},
+		}
+		found, err = failingRepo.GetPost(ctx, "id")
+		require.NoError(t, err, "posts should be readable without their authors' profiles")
+		require.Len(t, found.Authors, 3)
+	})
+
+	t.Run("Authors not migrated yet", func(t *testing.T) {
+		// mockStoreNotEmpty's post lists coeditor by login, as before
+		// MigrateUserIDs identifies them by ID
+		update := &UpdatePostDto{Id: "id", Actor: "coeditor", Version: 1, Title: strPtr("renamed")}
+		legacyRepo := &PostRepository{
+			Store:     &mockStoreNotEmpty{},
+			Sanitizer: &mockSanitizer{},
+			Resolver: &mockResolver{profiles: map[string]UserProfile{
+				"coeditor": {ID: "id-coeditor", Username: "coeditor"},
+			}},
+		}
+		_, err := legacyRepo.UpdatePost(context.Background(), update)
+		require.NoError(t, err, "users should be matched by login until migrated")
+
+		// coeditor renamed themselves, and another user took their login
+		hijackRepo := &PostRepository{
+			Store:     &mockStoreNotEmpty{},
+			Sanitizer: &mockSanitizer{},
+			Resolver: &mockResolver{profiles: map[string]UserProfile{
+				"coeditor":  {ID: "id-newcomer", Username: "coeditor"},
+				"coeditor2": {ID: "coeditor", Username: "coeditor2"},
+			}},
+		}
+		_, err = hijackRepo.UpdatePost(context.Background(), update)
+		require.True(t, errors.Is(err, ErrForbidden), genericError, err, ErrForbidden)
+	})
+
+	t.Run("Publish", func(t *testing.T) {
+		publisher := &InMemoryPublisher{}
+		publishingRepo := &PostRepository{
+			Store:     &mockStoreNotEmpty{},
+			Sanitizer: &mockSanitizer{},
+			Checker:   &mockTrueChecker{},
+			Publisher: publisher,
+		}
+		ctx := context.Background()
+		_, err := publishingRepo.CreatePost(ctx, &CreatePostDto{
+			Title:   "title",
+			Creator: "username",
+			Content: "content",
+			Tags:    []string{"tag1"},
+		})
+		require.NoError(t, err)
+		_, err = publishingRepo.UpdatePost(ctx, &UpdatePostDto{
+			Id: "id", Actor: "bla", Version: 1, Content: strPtr("updated"),
+		})
+		require.NoError(t, err)
+		_, err = publishingRepo.UpdatePost(ctx, &UpdatePostDto{Id: "id"})
+		require.True(t, errors.Is(err, ErrMissingVersion), genericError, err, ErrMissingVersion)
+		_, err = publishingRepo.DeletePost(ctx, &DeletePostDto{Id: "id", Actor: "bla", Version: 2})
+		require.NoError(t, err)
+
+		events := publisher.Events()
+		expected := []string{PostCreatedEventNameV1, PostUpdatedEventNameV1, PostDeletedEventNameV1}
+		require.Len(t, events, len(expected), "failed operations shouldn't publish")
+		for i, name := range expected {
+			require.Equal(t, name, events[i].Name, genericError, events[i].Name, name)
+			require.False(t, events[i].OccurredAt.IsZero())
+		}
+		require.Equal(t, "username", events[0].Post.Creator)
+		require.Equal(t, "updated", events[1].Post.Content)
+		require.Equal(t, 2, events[2].Post.Version)
+	})
+
 	testFilter := func(t *testing.T, testDto *GeneralFilter) {
 		testCases := []filterTestCase{
 			{
@@ -245,3 +646,7 @@ func TestPostRepository(t *testing.T) {
 		testFilter(t, testDto)
 	})
 }
+
+func strPtr(s string) *string {
+	return &s
+}
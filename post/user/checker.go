@@ -2,33 +2,60 @@ package user
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"log"
 
 	"github.com/mountolive/back-blog-go/post/usecase"
 	"github.com/mountolive/back-blog-go/post/user/transport"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
-// TODO Add test suite for GRPCUserChecker, posts service
-
 // GRPCUserChecker wraps a gRPC client to connect to users service
+// When failing open, the checks don't fail while the users service is
+// unavailable, as told by ErrUsersUnavailable: users are taken as existing,
+// without roles, and identified by their logins, until
+// usecase.MigrateUserIDs replaces them; their profiles are left out
 type GRPCUserChecker struct {
-	client transport.UserCheckerClient
+	client   transport.UserCheckerClient
+	failOpen bool
 }
 
 // NewGRPCUserChecker is a constructor
 func NewGRPCUserChecker(client transport.UserCheckerClient) GRPCUserChecker {
-	return GRPCUserChecker{client}
+	return GRPCUserChecker{client: client}
+}
+
+// NewResilientGRPCUserChecker is a constructor, wrapping client
+// with a ResilientClient configured by config
+func NewResilientGRPCUserChecker(client transport.UserCheckerClient,
+	config ResilienceConfig) GRPCUserChecker {
+	return GRPCUserChecker{
+		client:   NewResilientClient(client, config),
+		failOpen: config.FailOpen,
+	}
 }
 
-var _ usecase.CreatorChecker = GRPCUserChecker{}
+var (
+	_ usecase.CreatorChecker = GRPCUserChecker{}
+	_ usecase.RoleChecker    = GRPCUserChecker{}
+	_ usecase.AuthorResolver = GRPCUserChecker{}
+)
 
-const errMsgCheckUser = "grpc client check user: %w"
+const (
+	errMsgCheckUser = "grpc client check user: %w"
+	errMsgGetUsers  = "grpc client get users: %w"
+)
 
 // CheckExistence implements CreatorChecker interface
 func (g GRPCUserChecker) CheckExistence(ctx context.Context, login string) (bool, error) {
 	req := &transport.CheckUserRequest{Login: login}
 	res, err := g.client.CheckUser(ctx, req)
 	if err != nil {
+		if g.failsOpen(err) {
+			return true, nil
+		}
 		return false, fmt.Errorf(errMsgCheckUser, err)
 	}
 	if res.Id == "" {
@@ -36,3 +63,129 @@ func (g GRPCUserChecker) CheckExistence(ctx context.Context, login string) (bool
 	}
 	return true, nil
 }
+
+// Roles implements RoleChecker interface, an unknown user has none
+func (g GRPCUserChecker) Roles(ctx context.Context, login string) ([]string, error) {
+	req := &transport.CheckUserRequest{Login: login}
+	res, err := g.client.CheckUser(ctx, req)
+	if err != nil {
+		if g.failsOpen(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf(errMsgCheckUser, err)
+	}
+	return res.Roles, nil
+}
+
+// ResolveUsers implements AuthorResolver interface, looking the users up
+// by login, at once; the unknown ones are left out
+func (g GRPCUserChecker) ResolveUsers(ctx context.Context,
+	logins []string) (map[string]usecase.UserProfile, error) {
+	return g.resolve(ctx, logins, func(keys []string) *transport.GetUsersRequest {
+		return &transport.GetUsersRequest{Logins: keys}
+	}, func(login string) *transport.CheckUserRequest {
+		return &transport.CheckUserRequest{Login: login}
+	}, func(login string, user *transport.UserResponse) bool {
+		return matchesLogin(user, login)
+	}, func(login string) (usecase.UserProfile, bool) {
+		return usecase.UserProfile{ID: login, Username: login}, true
+	})
+}
+
+// ResolveUserIDs implements AuthorResolver interface, looking the users
+// up by ID, at once; the unknown ones are left out
+func (g GRPCUserChecker) ResolveUserIDs(ctx context.Context,
+	ids []string) (map[string]usecase.UserProfile, error) {
+	return g.resolve(ctx, ids, func(keys []string) *transport.GetUsersRequest {
+		return &transport.GetUsersRequest{Ids: keys}
+	}, func(id string) *transport.CheckUserRequest {
+		return &transport.CheckUserRequest{Id: id}
+	}, func(id string, user *transport.UserResponse) bool {
+		return user.Id == id
+	}, func(string) (usecase.UserProfile, bool) {
+		return usecase.UserProfile{}, false
+	})
+}
+
+// resolve looks up the users with the passed keys with a single GetUsers,
+// or checking them one at a time if the users service doesn't implement
+// it yet, falling back, when failing open, to the profile returned by
+// fallback, if any
+func (g GRPCUserChecker) resolve(ctx context.Context, keys []string,
+	batch func([]string) *transport.GetUsersRequest,
+	request func(string) *transport.CheckUserRequest,
+	matches func(string, *transport.UserResponse) bool,
+	fallback func(string) (usecase.UserProfile, bool),
+) (map[string]usecase.UserProfile, error) {
+	profiles := make(map[string]usecase.UserProfile, len(keys))
+	if len(keys) == 0 {
+		return profiles, nil
+	}
+	res, err := g.client.GetUsers(ctx, batch(keys))
+	if status.Code(err) == codes.Unimplemented {
+		return g.resolveEach(ctx, keys, request, fallback)
+	}
+	if err != nil {
+		if !g.failsOpen(err) {
+			return nil, fmt.Errorf(errMsgGetUsers, err)
+		}
+		for _, key := range keys {
+			if profile, ok := fallback(key); ok {
+				profiles[key] = profile
+			}
+		}
+		return profiles, nil
+	}
+	for _, key := range keys {
+		for _, user := range res.Users {
+			if matches(key, user) {
+				profiles[key] = newUserProfile(user)
+				break
+			}
+		}
+	}
+	return profiles, nil
+}
+
+// resolveEach checks the users with the passed keys one at a time
+func (g GRPCUserChecker) resolveEach(ctx context.Context, keys []string,
+	request func(string) *transport.CheckUserRequest,
+	fallback func(string) (usecase.UserProfile, bool),
+) (map[string]usecase.UserProfile, error) {
+	profiles := make(map[string]usecase.UserProfile, len(keys))
+	for _, key := range keys {
+		res, err := g.client.CheckUser(ctx, request(key))
+		if err != nil {
+			if !g.failsOpen(err) {
+				return nil, fmt.Errorf(errMsgCheckUser, err)
+			}
+			if profile, ok := fallback(key); ok {
+				profiles[key] = profile
+			}
+			continue
+		}
+		if res.Id == "" {
+			continue
+		}
+		profiles[key] = newUserProfile(res)
+	}
+	return profiles, nil
+}
+
+func newUserProfile(user *transport.UserResponse) usecase.UserProfile {
+	return usecase.UserProfile{
+		ID:          user.Id,
+		Username:    user.Username,
+		DisplayName: user.DisplayName,
+		AvatarURL:   user.AvatarUrl,
+	}
+}
+
+// failsOpen tells whether the check failed with err is let through
+func (g GRPCUserChecker) failsOpen(err error) bool {
+	if !g.failOpen || !errors.Is(err, ErrUsersUnavailable) {
+		return false
+	}
+	log.Printf("users service unavailable, failing open: %v", err)
+	return true
+}
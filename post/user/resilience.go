@@ -0,0 +1,444 @@
+package user
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mountolive/back-blog-go/post/user/transport"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+var (
+	// ErrUsersUnavailable returned when the users service can't be reached
+	ErrUsersUnavailable = errors.New("users service unavailable")
+	// ErrCircuitOpen returned while the calls to the users service are
+	// suspended, after it failed repeatedly
+	ErrCircuitOpen = fmt.Errorf("%w: circuit open", ErrUsersUnavailable)
+)
+
+// ResilienceConfig configures a ResilientClient
+type ResilienceConfig struct {
+	// CallTimeout is the deadline of each call to the users service
+	CallTimeout time.Duration
+	// CacheTTL is how long the users found are cached, NegativeCacheTTL
+	// how long the ones not found are; a zero TTL disables caching them
+	// CacheSize bounds the number of lookups cached
+	CacheTTL         time.Duration
+	NegativeCacheTTL time.Duration
+	CacheSize        int
+	// BatchSize bounds the users looked up by each call to GetUsers
+	BatchSize int
+	// Attempts is the maximum number of calls for a lookup; the ones failed
+	// with Unavailable are retried after a random wait of up to
+	// InitialBackoff, which doubles on each retry, up to MaxBackoff
+	Attempts       int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	// FailureThreshold is the number of consecutive lookups failed for the
+	// users service being unavailable that opens the circuit. While it's
+	// open, lookups fail right away with ErrCircuitOpen, until OpenTimeout
+	// passes and a single lookup is let through to probe the service
+	FailureThreshold int
+	OpenTimeout      time.Duration
+	// FailOpen lets the checks through while the users service is
+	// unavailable, see GRPCUserChecker; they fail otherwise
+	FailOpen bool
+}
+
+// DefaultResilienceConfig is a sensible ResilienceConfig, failing closed
+var DefaultResilienceConfig = ResilienceConfig{
+	CallTimeout:      2 * time.Second,
+	CacheTTL:         time.Minute,
+	NegativeCacheTTL: 10 * time.Second,
+	CacheSize:        10000,
+	BatchSize:        100,
+	Attempts:         3,
+	InitialBackoff:   50 * time.Millisecond,
+	MaxBackoff:       time.Second,
+	FailureThreshold: 5,
+	OpenTimeout:      30 * time.Second,
+}
+
+// ResilientClient wraps a transport.UserCheckerClient with a cache of the
+// lookups, by login and by id, a deadline per call, retries of the calls
+// failed with Unavailable and a circuit breaker. The users not found, as
+// told by NotFound, are returned as an empty UserResponse, with no error
+// GetUsers only looks up the users not cached, in batches
+// It's safe for concurrent use
+type ResilientClient struct {
+	client  transport.UserCheckerClient
+	config  ResilienceConfig
+	cache   *lookupCache
+	breaker *circuitBreaker
+	now     func() time.Time
+}
+
+var _ transport.UserCheckerClient = &ResilientClient{}
+
+// NewResilientClient is a constructor, the fields of config
+// left unset take the ones of DefaultResilienceConfig
+func NewResilientClient(client transport.UserCheckerClient,
+	config ResilienceConfig) *ResilientClient {
+	config = config.withDefaults()
+	r := &ResilientClient{client: client, config: config, now: time.Now}
+	r.cache = &lookupCache{size: config.CacheSize, entries: map[string]cacheEntry{}}
+	r.breaker = &circuitBreaker{
+		threshold:   config.FailureThreshold,
+		openTimeout: config.OpenTimeout,
+	}
+	return r
+}
+
+func (c ResilienceConfig) withDefaults() ResilienceConfig {
+	defaults := DefaultResilienceConfig
+	if c.CallTimeout <= 0 {
+		c.CallTimeout = defaults.CallTimeout
+	}
+	if c.CacheSize <= 0 {
+		c.CacheSize = defaults.CacheSize
+	}
+	if c.BatchSize <= 0 {
+		c.BatchSize = defaults.BatchSize
+	}
+	if c.Attempts <= 0 {
+		c.Attempts = defaults.Attempts
+	}
+	if c.InitialBackoff <= 0 {
+		c.InitialBackoff = defaults.InitialBackoff
+	}
+	if c.MaxBackoff <= 0 {
+		c.MaxBackoff = defaults.MaxBackoff
+	}
+	if c.FailureThreshold <= 0 {
+		c.FailureThreshold = defaults.FailureThreshold
+	}
+	if c.OpenTimeout <= 0 {
+		c.OpenTimeout = defaults.OpenTimeout
+	}
+	return c
+}
+
+// CheckUser implements transport.UserCheckerClient
+func (r *ResilientClient) CheckUser(ctx context.Context, in *transport.CheckUserRequest,
+	opts ...grpc.CallOption) (*transport.UserResponse, error) {
+	key := cacheKey(in)
+	if res, ok := r.cache.get(key, r.now()); ok {
+		return proto.Clone(res).(*transport.UserResponse), nil
+	}
+	var res *transport.UserResponse
+	err := r.guarded(ctx, func(ctx context.Context) error {
+		var err error
+		res, err = r.client.CheckUser(ctx, in, opts...)
+		if isNotFound(err) {
+			res, err = &transport.UserResponse{}, nil
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	now := r.now()
+	if res.Id == "" {
+		r.cache.put(key, res, now, r.config.NegativeCacheTTL)
+		return res, nil
+	}
+	r.cache.put(cacheKey(&transport.CheckUserRequest{Id: res.Id}), res, now, r.config.CacheTTL)
+	r.cache.put(key, res, now, r.config.CacheTTL)
+	return proto.Clone(res).(*transport.UserResponse), nil
+}
+
+// GetUsers implements transport.UserCheckerClient, looking up the users
+// not cached in batches of up to BatchSize, the ones found being cached
+// by id and by the logins they were looked up by
+func (r *ResilientClient) GetUsers(ctx context.Context, in *transport.GetUsersRequest,
+	opts ...grpc.CallOption) (*transport.GetUsersResponse, error) {
+	found := map[string]*transport.UserResponse{}
+	var missing []*transport.CheckUserRequest
+	seen := map[string]bool{}
+	lookups := make([]*transport.CheckUserRequest, 0, len(in.Ids)+len(in.Logins))
+	for _, id := range in.Ids {
+		lookups = append(lookups, &transport.CheckUserRequest{Id: id})
+	}
+	for _, login := range in.Logins {
+		lookups = append(lookups, &transport.CheckUserRequest{Login: login})
+	}
+	now := r.now()
+	for _, lookup := range lookups {
+		key := cacheKey(lookup)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		if res, ok := r.cache.get(key, now); ok {
+			if res.Id != "" {
+				found[res.Id] = res
+			}
+			continue
+		}
+		missing = append(missing, lookup)
+	}
+	for len(missing) > 0 {
+		size := r.config.BatchSize
+		if size > len(missing) {
+			size = len(missing)
+		}
+		batch := missing[:size]
+		missing = missing[size:]
+		req := &transport.GetUsersRequest{}
+		for _, lookup := range batch {
+			if lookup.Id != "" {
+				req.Ids = append(req.Ids, lookup.Id)
+			} else {
+				req.Logins = append(req.Logins, lookup.Login)
+			}
+		}
+		var res *transport.GetUsersResponse
+		err := r.guarded(ctx, func(ctx context.Context) error {
+			var err error
+			res, err = r.client.GetUsers(ctx, req, opts...)
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+		r.cacheBatch(batch, res.Users, r.now())
+		for _, user := range res.Users {
+			found[user.Id] = user
+		}
+	}
+	ids := make([]string, 0, len(found))
+	for id := range found {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	res := &transport.GetUsersResponse{Users: make([]*transport.UserResponse, 0, len(ids))}
+	for _, id := range ids {
+		res.Users = append(res.Users, proto.Clone(found[id]).(*transport.UserResponse))
+	}
+	return res, nil
+}
+
+// cacheBatch caches the users found by looking up batch,
+// and the lookups that found none
+func (r *ResilientClient) cacheBatch(batch []*transport.CheckUserRequest,
+	users []*transport.UserResponse, now time.Time) {
+	for _, lookup := range batch {
+		var match *transport.UserResponse
+		for _, user := range users {
+			if lookup.Id == user.Id || (lookup.Id == "" && matchesLogin(user, lookup.Login)) {
+				match = user
+				break
+			}
+		}
+		if match == nil {
+			r.cache.put(cacheKey(lookup), &transport.UserResponse{}, now, r.config.NegativeCacheTTL)
+			continue
+		}
+		r.cache.put(cacheKey(lookup), match, now, r.config.CacheTTL)
+	}
+	for _, user := range users {
+		r.cache.put(cacheKey(&transport.CheckUserRequest{Id: user.Id}), user, now, r.config.CacheTTL)
+	}
+}
+
+// matchesLogin tells whether login is the user's username or email,
+// the latter being case insensitive
+func matchesLogin(user *transport.UserResponse, login string) bool {
+	return user.Username == login || (user.Email != "" && strings.EqualFold(user.Email, login))
+}
+
+// guarded makes call through the circuit breaker, retrying it
+// while the users service is unavailable
+func (r *ResilientClient) guarded(ctx context.Context,
+	call func(context.Context) error) error {
+	if !r.breaker.allow(r.now()) {
+		return ErrCircuitOpen
+	}
+	err := r.retry(ctx, call)
+	now := r.now()
+	if err != nil {
+		switch {
+		case ctx.Err() != nil:
+			// the caller gave up, which tells nothing about the users service
+			r.breaker.release()
+		case isUnavailable(err):
+			r.breaker.record(true, now)
+			return fmt.Errorf("%w: %v", ErrUsersUnavailable, err)
+		default:
+			r.breaker.record(false, now)
+		}
+		return err
+	}
+	r.breaker.record(false, now)
+	return nil
+}
+
+// retry makes call, with a deadline of CallTimeout, retrying it
+// while it fails with Unavailable
+func (r *ResilientClient) retry(ctx context.Context, call func(context.Context) error) error {
+	backoff := r.config.InitialBackoff
+	for attempt := 1; ; attempt++ {
+		callCtx, cancel := context.WithTimeout(ctx, r.config.CallTimeout)
+		err := call(callCtx)
+		cancel()
+		if err == nil || attempt >= r.config.Attempts || status.Code(err) != codes.Unavailable {
+			return err
+		}
+		// full jitter, so that clients don't retry all at once
+		timer := time.NewTimer(time.Duration(rand.Int63n(int64(backoff)) + 1))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+		backoff *= 2
+		if backoff > r.config.MaxBackoff {
+			backoff = r.config.MaxBackoff
+		}
+	}
+}
+
+// isUnavailable tells whether err is due to the users service being
+// unreachable, or too slow to answer
+// isNotFound tells whether the users service didn't find the user looked up.
+// Its versions before the errors were mapped to status codes answer with
+// Unknown, the message telling the user wasn't found
+func isNotFound(err error) bool {
+	switch status.Code(err) {
+	case codes.NotFound:
+		return true
+	case codes.Unknown:
+		return strings.Contains(strings.ToLower(status.Convert(err).Message()), "not found")
+	default:
+		return false
+	}
+}
+
+func isUnavailable(err error) bool {
+	switch status.Code(err) {
+	case codes.Unavailable, codes.DeadlineExceeded:
+		return true
+	default:
+		return errors.Is(err, context.DeadlineExceeded)
+	}
+}
+
+func cacheKey(in *transport.CheckUserRequest) string {
+	if in.Id != "" {
+		return "id:" + in.Id
+	}
+	return "login:" + in.Login
+}
+
+// lookupCache keeps the users service's answers until they expire
+type lookupCache struct {
+	mu      sync.Mutex
+	size    int
+	entries map[string]cacheEntry
+}
+
+type cacheEntry struct {
+	res    *transport.UserResponse
+	expiry time.Time
+}
+
+func (c *lookupCache) get(key string, now time.Time) (*transport.UserResponse, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	if !now.Before(entry.expiry) {
+		delete(c.entries, key)
+		return nil, false
+	}
+	return entry.res, true
+}
+
+// put caches res for ttl, unless it's zero. When full, the expired
+// entries are evicted, or else any of them
+func (c *lookupCache) put(key string, res *transport.UserResponse,
+	now time.Time, ttl time.Duration) {
+	if ttl <= 0 {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.entries[key]; !ok && len(c.entries) >= c.size {
+		for cached, entry := range c.entries {
+			if !now.Before(entry.expiry) {
+				delete(c.entries, cached)
+			}
+		}
+		for cached := range c.entries {
+			if len(c.entries) < c.size {
+				break
+			}
+			delete(c.entries, cached)
+		}
+	}
+	c.entries[key] = cacheEntry{
+		res:    proto.Clone(res).(*transport.UserResponse),
+		expiry: now.Add(ttl),
+	}
+}
+
+// circuitBreaker opens after threshold consecutive failures, letting a
+// single call through once openTimeout passes: the circuit is closed
+// again if it succeeds, and reopened otherwise
+type circuitBreaker struct {
+	mu          sync.Mutex
+	threshold   int
+	openTimeout time.Duration
+	failures    int
+	openedAt    time.Time
+	probing     bool
+}
+
+// allow tells whether a call can be made
+func (b *circuitBreaker) allow(now time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.failures < b.threshold {
+		return true
+	}
+	if b.probing || now.Sub(b.openedAt) < b.openTimeout {
+		return false
+	}
+	b.probing = true
+	return true
+}
+
+// release lets another call probe the users service, when the one
+// allowed ended without telling whether it's available
+func (b *circuitBreaker) release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.probing = false
+}
+
+// record counts the outcome of a call allowed
+func (b *circuitBreaker) record(failed bool, now time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.probing = false
+	if !failed {
+		b.failures = 0
+		return
+	}
+	b.failures++
+	if b.failures >= b.threshold {
+		b.openedAt = now
+	}
+}
@@ -0,0 +1,371 @@
+package user
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mountolive/back-blog-go/post/user/transport"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// fakeClient answers the calls through answer, counting them; GetUsers
+// answers each of its lookups through it, in a single call, unless noBatch
+type fakeClient struct {
+	mu      sync.Mutex
+	calls   int
+	batches [][]string
+	noBatch bool
+	answer  func(ctx context.Context, call int,
+		in *transport.CheckUserRequest) (*transport.UserResponse, error)
+}
+
+func (f *fakeClient) CheckUser(ctx context.Context, in *transport.CheckUserRequest,
+	opts ...grpc.CallOption) (*transport.UserResponse, error) {
+	f.mu.Lock()
+	f.calls++
+	call, answer := f.calls, f.answer
+	f.mu.Unlock()
+	return answer(ctx, call, in)
+}
+
+func (f *fakeClient) GetUsers(ctx context.Context, in *transport.GetUsersRequest,
+	opts ...grpc.CallOption) (*transport.GetUsersResponse, error) {
+	f.mu.Lock()
+	f.calls++
+	call, answer, noBatch := f.calls, f.answer, f.noBatch
+	f.batches = append(f.batches, append(append([]string{}, in.Ids...), in.Logins...))
+	f.mu.Unlock()
+	if noBatch {
+		return nil, status.Error(codes.Unimplemented, "method GetUsers not implemented")
+	}
+	lookups := []*transport.CheckUserRequest{}
+	for _, id := range in.Ids {
+		lookups = append(lookups, &transport.CheckUserRequest{Id: id})
+	}
+	for _, login := range in.Logins {
+		lookups = append(lookups, &transport.CheckUserRequest{Login: login})
+	}
+	res := &transport.GetUsersResponse{}
+	for _, lookup := range lookups {
+		user, err := answer(ctx, call, lookup)
+		if status.Code(err) == codes.NotFound {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		res.Users = append(res.Users, user)
+	}
+	return res, nil
+}
+
+func (f *fakeClient) callCount() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.calls
+}
+
+// users answers with the users known by login or id
+func users(known ...*transport.UserResponse) func(context.Context, int,
+	*transport.CheckUserRequest) (*transport.UserResponse, error) {
+	return func(_ context.Context, _ int,
+		in *transport.CheckUserRequest) (*transport.UserResponse, error) {
+		for _, user := range known {
+			if in.Id == user.Id || (in.Id == "" && matchesLogin(user, in.Login)) {
+				return user, nil
+			}
+		}
+		return nil, status.Error(codes.NotFound, "user not found")
+	}
+}
+
+func unavailable(context.Context, int,
+	*transport.CheckUserRequest) (*transport.UserResponse, error) {
+	return nil, status.Error(codes.Unavailable, "connection refused")
+}
+
+// fakeClock is a settable clock
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+func newTestClient(client transport.UserCheckerClient,
+	config ResilienceConfig) (*ResilientClient, *fakeClock) {
+	clock := &fakeClock{now: time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)}
+	resilient := NewResilientClient(client, config)
+	resilient.now = clock.Now
+	return resilient, clock
+}
+
+var testConfig = ResilienceConfig{
+	CallTimeout:      100 * time.Millisecond,
+	CacheTTL:         time.Minute,
+	NegativeCacheTTL: 10 * time.Second,
+	Attempts:         3,
+	InitialBackoff:   time.Millisecond,
+	MaxBackoff:       2 * time.Millisecond,
+	FailureThreshold: 2,
+	OpenTimeout:      30 * time.Second,
+}
+
+func TestResilientClient(t *testing.T) {
+	kim := &transport.UserResponse{Id: "id-kim", Username: "kim", DisplayName: "Kim"}
+
+	t.Run("Cache", func(t *testing.T) {
+		t.Parallel()
+		fake := &fakeClient{answer: users(kim)}
+		client, clock := newTestClient(fake, testConfig)
+		ctx := context.Background()
+		res, err := client.CheckUser(ctx, &transport.CheckUserRequest{Login: "kim"})
+		require.NoError(t, err)
+		require.Equal(t, "id-kim", res.Id)
+		res, err = client.CheckUser(ctx, &transport.CheckUserRequest{Id: "id-kim"})
+		require.NoError(t, err)
+		require.Equal(t, "Kim", res.DisplayName)
+		require.Equal(t, 1, fake.callCount(), "users found should be cached by login and id")
+
+		res, err = client.CheckUser(ctx, &transport.CheckUserRequest{Login: "ghost"})
+		require.NoError(t, err, "users not found aren't errors")
+		require.Empty(t, res.Id)
+		_, _ = client.CheckUser(ctx, &transport.CheckUserRequest{Login: "ghost"})
+		require.Equal(t, 2, fake.callCount(), "users not found should be cached")
+
+		// as answered by the users service before NotFound was used
+		legacy := &fakeClient{answer: func(context.Context, int,
+			*transport.CheckUserRequest) (*transport.UserResponse, error) {
+			return nil, status.Error(codes.Unknown,
+				"grpc check user: user was not found in the DB")
+		}}
+		legacyClient, _ := newTestClient(legacy, testConfig)
+		res, err = legacyClient.CheckUser(ctx, &transport.CheckUserRequest{Login: "ghost"})
+		require.NoError(t, err, "users not found aren't errors")
+		require.Empty(t, res.Id)
+
+		clock.now = clock.now.Add(testConfig.NegativeCacheTTL)
+		_, _ = client.CheckUser(ctx, &transport.CheckUserRequest{Login: "ghost"})
+		_, _ = client.CheckUser(ctx, &transport.CheckUserRequest{Login: "kim"})
+		require.Equal(t, 3, fake.callCount(), "users not found should be cached for less time")
+
+		clock.now = clock.now.Add(testConfig.CacheTTL)
+		_, _ = client.CheckUser(ctx, &transport.CheckUserRequest{Login: "kim"})
+		require.Equal(t, 4, fake.callCount(), "expired users should be checked again")
+	})
+
+	t.Run("Cache Size", func(t *testing.T) {
+		t.Parallel()
+		fake := &fakeClient{answer: users()}
+		config := testConfig
+		config.CacheSize = 2
+		client, _ := newTestClient(fake, config)
+		for _, login := range []string{"a", "b", "c"} {
+			_, err := client.CheckUser(context.Background(), &transport.CheckUserRequest{Login: login})
+			require.NoError(t, err)
+		}
+		require.Len(t, client.cache.entries, 2)
+	})
+
+	t.Run("Batch", func(t *testing.T) {
+		t.Parallel()
+		lee := &transport.UserResponse{Id: "id-lee", Username: "lee", Email: "lee@mail.com"}
+		fake := &fakeClient{answer: users(kim, lee)}
+		config := testConfig
+		config.BatchSize = 2
+		client, _ := newTestClient(fake, config)
+		ctx := context.Background()
+		res, err := client.GetUsers(ctx, &transport.GetUsersRequest{
+			Ids:    []string{"id-kim", "id-kim"},
+			Logins: []string{"lee", "ghost"},
+		})
+		require.NoError(t, err)
+		require.Len(t, res.Users, 2, "users not found should be left out")
+		require.Equal(t, "id-kim", res.Users[0].Id)
+		require.Equal(t, "id-lee", res.Users[1].Id)
+		require.Equal(t, [][]string{{"id-kim", "lee"}, {"ghost"}}, fake.batches,
+			"lookups should be deduplicated and batched")
+
+		res, err = client.GetUsers(ctx, &transport.GetUsersRequest{
+			Ids:    []string{"id-lee"},
+			Logins: []string{"kim", "ghost", "LEE@mail.com"},
+		})
+		require.NoError(t, err)
+		require.Len(t, res.Users, 2, "users should be found by email too")
+		_, err = client.CheckUser(ctx, &transport.CheckUserRequest{Login: "lee"})
+		require.NoError(t, err)
+		require.Equal(t, [][]string{{"id-kim", "lee"}, {"ghost"}, {"kim", "LEE@mail.com"}},
+			fake.batches, "only the lookups not cached should be made")
+	})
+
+	t.Run("Batch Unavailable", func(t *testing.T) {
+		t.Parallel()
+		fake := &fakeClient{answer: unavailable}
+		client, _ := newTestClient(fake, testConfig)
+		_, err := client.GetUsers(context.Background(), &transport.GetUsersRequest{Ids: []string{"id-kim"}})
+		require.True(t, errors.Is(err, ErrUsersUnavailable), "Got: %v", err)
+		require.Equal(t, testConfig.Attempts, fake.callCount(), "batches should be retried")
+	})
+
+	t.Run("Retries", func(t *testing.T) {
+		t.Parallel()
+		fake := &fakeClient{answer: func(ctx context.Context, call int,
+			in *transport.CheckUserRequest) (*transport.UserResponse, error) {
+			if call < 3 {
+				return unavailable(ctx, call, in)
+			}
+			return kim, nil
+		}}
+		client, _ := newTestClient(fake, testConfig)
+		res, err := client.CheckUser(context.Background(), &transport.CheckUserRequest{Login: "kim"})
+		require.NoError(t, err)
+		require.Equal(t, "id-kim", res.Id)
+		require.Equal(t, 3, fake.callCount())
+	})
+
+	t.Run("No Retries", func(t *testing.T) {
+		t.Parallel()
+		fake := &fakeClient{answer: func(context.Context, int,
+			*transport.CheckUserRequest) (*transport.UserResponse, error) {
+			return nil, status.Error(codes.Internal, "boom")
+		}}
+		client, _ := newTestClient(fake, testConfig)
+		_, err := client.CheckUser(context.Background(), &transport.CheckUserRequest{Login: "kim"})
+		require.Equal(t, codes.Internal, status.Code(err))
+		require.False(t, errors.Is(err, ErrUsersUnavailable))
+		require.Equal(t, 1, fake.callCount(), "only Unavailable should be retried")
+	})
+
+	t.Run("Deadline", func(t *testing.T) {
+		t.Parallel()
+		fake := &fakeClient{answer: func(ctx context.Context, _ int,
+			_ *transport.CheckUserRequest) (*transport.UserResponse, error) {
+			<-ctx.Done()
+			return nil, status.FromContextError(ctx.Err()).Err()
+		}}
+		client, _ := newTestClient(fake, testConfig)
+		start := time.Now()
+		_, err := client.CheckUser(context.Background(), &transport.CheckUserRequest{Login: "kim"})
+		require.True(t, errors.Is(err, ErrUsersUnavailable), "Got: %v", err)
+		require.Less(t, int64(time.Since(start)), int64(time.Second),
+			"calls should be bounded by CallTimeout")
+	})
+
+	t.Run("Circuit Breaker", func(t *testing.T) {
+		t.Parallel()
+		fake := &fakeClient{answer: unavailable}
+		client, clock := newTestClient(fake, testConfig)
+		ctx := context.Background()
+		for i := 0; i < testConfig.FailureThreshold; i++ {
+			_, err := client.CheckUser(ctx, &transport.CheckUserRequest{Login: "kim"})
+			require.True(t, errors.Is(err, ErrUsersUnavailable), "Got: %v", err)
+		}
+		calls := fake.callCount()
+		require.Equal(t, testConfig.FailureThreshold*testConfig.Attempts, calls)
+		_, err := client.CheckUser(ctx, &transport.CheckUserRequest{Login: "kim"})
+		require.True(t, errors.Is(err, ErrCircuitOpen), "Got: %v", err)
+		require.Equal(t, calls, fake.callCount(), "no calls should be made while open")
+
+		// a failed probe reopens the circuit
+		clock.now = clock.now.Add(testConfig.OpenTimeout)
+		_, err = client.CheckUser(ctx, &transport.CheckUserRequest{Login: "kim"})
+		require.False(t, errors.Is(err, ErrCircuitOpen), "Got: %v", err)
+		_, err = client.CheckUser(ctx, &transport.CheckUserRequest{Login: "kim"})
+		require.True(t, errors.Is(err, ErrCircuitOpen), "Got: %v", err)
+
+		// a successful one closes it
+		fake.mu.Lock()
+		fake.answer = users(kim)
+		fake.mu.Unlock()
+		clock.now = clock.now.Add(testConfig.OpenTimeout)
+		_, err = client.CheckUser(ctx, &transport.CheckUserRequest{Login: "kim"})
+		require.NoError(t, err)
+		_, err = client.CheckUser(ctx, &transport.CheckUserRequest{Id: "ghost"})
+		require.NoError(t, err)
+	})
+}
+
+func TestGRPCUserChecker(t *testing.T) {
+	kim := &transport.UserResponse{Id: "id-kim", Username: "kim", Roles: []string{"editor"}}
+	ctx := context.Background()
+
+	t.Run("Fail Closed", func(t *testing.T) {
+		t.Parallel()
+		checker := NewResilientGRPCUserChecker(&fakeClient{answer: unavailable}, testConfig)
+		_, err := checker.CheckExistence(ctx, "kim")
+		require.True(t, errors.Is(err, ErrUsersUnavailable), "Got: %v", err)
+		_, err = checker.ResolveUsers(ctx, []string{"kim"})
+		require.True(t, errors.Is(err, ErrUsersUnavailable), "Got: %v", err)
+	})
+
+	t.Run("Fail Open", func(t *testing.T) {
+		t.Parallel()
+		config := testConfig
+		config.FailOpen = true
+		checker := NewResilientGRPCUserChecker(&fakeClient{answer: unavailable}, config)
+		exists, err := checker.CheckExistence(ctx, "kim")
+		require.NoError(t, err)
+		require.True(t, exists, "users should be taken as existing")
+		roles, err := checker.Roles(ctx, "kim")
+		require.NoError(t, err)
+		require.Empty(t, roles, "users should be taken as having no roles")
+		profiles, err := checker.ResolveUsers(ctx, []string{"kim"})
+		require.NoError(t, err)
+		require.Equal(t, "kim", profiles["kim"].ID, "users should be identified by login")
+		profiles, err = checker.ResolveUserIDs(ctx, []string{"id-kim"})
+		require.NoError(t, err)
+		require.Empty(t, profiles, "profiles should be left out")
+	})
+
+	t.Run("Not Found", func(t *testing.T) {
+		t.Parallel()
+		config := testConfig
+		config.FailOpen = true
+		checker := NewResilientGRPCUserChecker(&fakeClient{answer: users(kim)}, config)
+		exists, err := checker.CheckExistence(ctx, "ghost")
+		require.NoError(t, err)
+		require.False(t, exists, "failing open shouldn't make unknown users exist")
+		profiles, err := checker.ResolveUsers(ctx, []string{"kim", "ghost"})
+		require.NoError(t, err)
+		require.Len(t, profiles, 1)
+		require.Equal(t, "id-kim", profiles["kim"].ID)
+		roles, err := checker.Roles(ctx, "kim")
+		require.NoError(t, err)
+		require.Equal(t, []string{"editor"}, roles)
+	})
+
+	t.Run("Resolve At Once", func(t *testing.T) {
+		t.Parallel()
+		lee := &transport.UserResponse{Id: "id-lee", Username: "lee", Email: "lee@mail.com"}
+		fake := &fakeClient{answer: users(kim, lee)}
+		checker := NewGRPCUserChecker(fake)
+		profiles, err := checker.ResolveUserIDs(ctx, []string{"id-kim", "id-lee", "id-ghost"})
+		require.NoError(t, err)
+		require.Len(t, profiles, 2)
+		require.Equal(t, "lee", profiles["id-lee"].Username)
+		profiles, err = checker.ResolveUsers(ctx, []string{"kim", "lee@mail.com"})
+		require.NoError(t, err)
+		require.Equal(t, "id-kim", profiles["kim"].ID)
+		require.Equal(t, "id-lee", profiles["lee@mail.com"].ID)
+		require.Equal(t, 2, fake.callCount(), "users should be resolved in a single call")
+	})
+
+	t.Run("Resolve One At A Time", func(t *testing.T) {
+		t.Parallel()
+		fake := &fakeClient{answer: users(kim), noBatch: true}
+		checker := NewResilientGRPCUserChecker(fake, testConfig)
+		profiles, err := checker.ResolveUserIDs(ctx, []string{"id-kim", "id-ghost"})
+		require.NoError(t, err)
+		require.Len(t, profiles, 1)
+		require.Equal(t, "kim", profiles["id-kim"].Username)
+		require.Equal(t, 3, fake.callCount(),
+			"users should be checked one at a time when GetUsers isn't implemented")
+	})
+}
@@ -0,0 +1,180 @@
+package user
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/credentials"
+)
+
+// TLSConfig locates the files securing the connection to the users service
+type TLSConfig struct {
+	// CAFile holds the CAs verifying the users service's certificate,
+	// the system's are used if it's empty
+	CAFile string
+	// CertFile and KeyFile hold the certificate presented to the users
+	// service, for mutual TLS. They're optional, but go together
+	CertFile string
+	KeyFile  string
+	// ServerName, if set, is the name the users service's certificate
+	// is verified against, instead of the host dialed
+	ServerName string
+}
+
+// CertReloader keeps the files of a TLSConfig loaded. They're loaded again
+// on Reload, so rotated certificates are picked up by the connections to the
+// users service established afterwards, without restarting
+// It's safe for concurrent use
+type CertReloader struct {
+	config TLSConfig
+
+	mu    sync.RWMutex
+	cert  *tls.Certificate
+	pool  *x509.CertPool
+	files [][]byte
+}
+
+// NewCertReloader is a constructor, the files are loaded right away,
+// failing if they can't be
+func NewCertReloader(config TLSConfig) (*CertReloader, error) {
+	if (config.CertFile == "") != (config.KeyFile == "") {
+		return nil, fmt.Errorf("users tls: certificate and key files go together")
+	}
+	r := &CertReloader{config: config}
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Reload loads the files again, if they changed. The certificates loaded
+// are kept when they fail to, as when a rotation is halfway written
+func (r *CertReloader) Reload() error {
+	paths := []string{r.config.CAFile, r.config.CertFile, r.config.KeyFile}
+	files := make([][]byte, len(paths))
+	for i, path := range paths {
+		if path == "" {
+			continue
+		}
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("users tls reload: %w", err)
+		}
+		files[i] = content
+	}
+	if r.unchanged(files) {
+		return nil
+	}
+	var pool *x509.CertPool
+	if r.config.CAFile != "" {
+		pool = x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(files[0]) {
+			return fmt.Errorf("users tls reload, %s: no certificates found", r.config.CAFile)
+		}
+	}
+	var cert *tls.Certificate
+	if r.config.CertFile != "" {
+		pair, err := tls.X509KeyPair(files[1], files[2])
+		if err != nil {
+			return fmt.Errorf("users tls reload, %s: %w", r.config.CertFile, err)
+		}
+		cert = &pair
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.cert, r.pool, r.files = cert, pool, files
+	return nil
+}
+
+func (r *CertReloader) unchanged(files [][]byte) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if r.files == nil {
+		return false
+	}
+	for i := range files {
+		if !bytes.Equal(files[i], r.files[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// Watch reloads the files every interval, until ctx is done,
+// passing the errors to onError
+func (r *CertReloader) Watch(ctx context.Context, interval time.Duration, onError func(error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := r.Reload(); err != nil {
+				onError(err)
+			}
+		}
+	}
+}
+
+// TransportCredentials returns the credentials to dial the users service
+// with, taking the certificates loaded when each connection is established
+func (r *CertReloader) TransportCredentials() credentials.TransportCredentials {
+	return &reloadingCredentials{reloader: r, serverName: r.config.ServerName}
+}
+
+func (r *CertReloader) tlsConfig(serverName string) *tls.Config {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	config := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		RootCAs:    r.pool,
+		ServerName: serverName,
+	}
+	if r.cert != nil {
+		config.Certificates = []tls.Certificate{*r.cert}
+	}
+	return config
+}
+
+// reloadingCredentials are TLS credentials built again for each handshake
+type reloadingCredentials struct {
+	reloader   *CertReloader
+	serverName string
+}
+
+var _ credentials.TransportCredentials = &reloadingCredentials{}
+
+func (c *reloadingCredentials) current() credentials.TransportCredentials {
+	return credentials.NewTLS(c.reloader.tlsConfig(c.serverName))
+}
+
+func (c *reloadingCredentials) ClientHandshake(ctx context.Context, authority string,
+	rawConn net.Conn) (net.Conn, credentials.AuthInfo, error) {
+	return c.current().ClientHandshake(ctx, authority, rawConn)
+}
+
+func (c *reloadingCredentials) ServerHandshake(
+	rawConn net.Conn) (net.Conn, credentials.AuthInfo, error) {
+	return c.current().ServerHandshake(rawConn)
+}
+
+func (c *reloadingCredentials) Info() credentials.ProtocolInfo {
+	return c.current().Info()
+}
+
+func (c *reloadingCredentials) Clone() credentials.TransportCredentials {
+	return &reloadingCredentials{reloader: c.reloader, serverName: c.serverName}
+}
+
+func (c *reloadingCredentials) OverrideServerName(serverName string) error {
+	c.serverName = serverName
+	return nil
+}
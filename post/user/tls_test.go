@@ -0,0 +1,204 @@
+package user
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mountolive/back-blog-go/post/user/transport"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+)
+
+// testCA issues certificates for local tests
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+var serial int64
+
+func newTestCA(t *testing.T) *testCA {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	serial++
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(serial),
+		Subject:               pkix.Name{CommonName: "test ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return &testCA{cert: cert, key: key, pem: pemEncode("CERTIFICATE", der)}
+}
+
+// issue returns the PEM encoded certificate, and key, of commonName
+func (ca *testCA) issue(t *testing.T, commonName string, dnsNames ...string) ([]byte, []byte) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	serial++
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: commonName},
+		DNSNames:     dnsNames,
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+	return pemEncode("CERTIFICATE", der), pemEncode("EC PRIVATE KEY", keyDER)
+}
+
+func pemEncode(blockType string, der []byte) []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der})
+}
+
+func writeFile(t *testing.T, path string, content []byte) {
+	t.Helper()
+	require.NoError(t, os.WriteFile(path, content, 0600))
+}
+
+// clientFiles writes the certificate of commonName, issued by ca, and
+// the CA of the users service, returning their TLSConfig
+func clientFiles(t *testing.T, dir string, ca, serverCA *testCA, commonName string) TLSConfig {
+	t.Helper()
+	config := TLSConfig{
+		CAFile:     filepath.Join(dir, "users-ca.pem"),
+		CertFile:   filepath.Join(dir, "posts.pem"),
+		KeyFile:    filepath.Join(dir, "posts-key.pem"),
+		ServerName: "users",
+	}
+	certPEM, keyPEM := ca.issue(t, commonName)
+	writeFile(t, config.CertFile, certPEM)
+	writeFile(t, config.KeyFile, keyPEM)
+	writeFile(t, config.CAFile, serverCA.pem)
+	return config
+}
+
+// echoServer answers with the common name of the client's certificate
+type echoServer struct {
+	transport.UnimplementedUserCheckerServer
+}
+
+func (echoServer) CheckUser(ctx context.Context,
+	_ *transport.CheckUserRequest) (*transport.UserResponse, error) {
+	p, _ := peer.FromContext(ctx)
+	state := p.AuthInfo.(credentials.TLSInfo).State
+	return &transport.UserResponse{Username: state.PeerCertificates[0].Subject.CommonName}, nil
+}
+
+// serveUsers starts a users service with mutual TLS, returning its address
+func serveUsers(t *testing.T, serverCA, clientCA *testCA) string {
+	t.Helper()
+	certPEM, keyPEM := serverCA.issue(t, "users", "users")
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	require.NoError(t, err)
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(clientCA.cert)
+	server := grpc.NewServer(grpc.Creds(credentials.NewTLS(&tls.Config{
+		Certificates: []tls.Certificate{cert},
+		ClientCAs:    clientCAs,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+	})))
+	transport.RegisterUserCheckerServer(server, echoServer{})
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go func() {
+		_ = server.Serve(listener)
+	}()
+	t.Cleanup(server.Stop)
+	return listener.Addr().String()
+}
+
+// checkAs dials address with the credentials of reloader,
+// returning the identity the users service saw
+func checkAs(t *testing.T, address string, reloader *CertReloader) (string, error) {
+	t.Helper()
+	conn, err := grpc.Dial(address, grpc.WithTransportCredentials(reloader.TransportCredentials()))
+	require.NoError(t, err)
+	defer conn.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	res, err := transport.NewUserCheckerClient(conn).CheckUser(ctx, &transport.CheckUserRequest{})
+	if err != nil {
+		return "", err
+	}
+	return res.Username, nil
+}
+
+func TestCertReloader(t *testing.T) {
+	serverCA, clientCA := newTestCA(t), newTestCA(t)
+	address := serveUsers(t, serverCA, clientCA)
+
+	t.Run("Mutual TLS", func(t *testing.T) {
+		t.Parallel()
+		reloader, err := NewCertReloader(clientFiles(t, t.TempDir(), clientCA, serverCA, "posts"))
+		require.NoError(t, err)
+		identity, err := checkAs(t, address, reloader)
+		require.NoError(t, err)
+		require.Equal(t, "posts", identity)
+	})
+
+	t.Run("Untrusted Server", func(t *testing.T) {
+		t.Parallel()
+		reloader, err := NewCertReloader(
+			clientFiles(t, t.TempDir(), clientCA, newTestCA(t), "posts"))
+		require.NoError(t, err)
+		_, err = checkAs(t, address, reloader)
+		require.Error(t, err)
+	})
+
+	t.Run("Reload", func(t *testing.T) {
+		t.Parallel()
+		dir := t.TempDir()
+		reloader, err := NewCertReloader(clientFiles(t, dir, clientCA, serverCA, "posts"))
+		require.NoError(t, err)
+		identity, err := checkAs(t, address, reloader)
+		require.NoError(t, err)
+		require.Equal(t, "posts", identity)
+
+		config := clientFiles(t, dir, clientCA, serverCA, "posts-rotated")
+		require.NoError(t, reloader.Reload())
+		identity, err = checkAs(t, address, reloader)
+		require.NoError(t, err)
+		require.Equal(t, "posts-rotated", identity, "the rotated certificate should be presented")
+
+		writeFile(t, config.KeyFile, []byte("halfway written"))
+		require.Error(t, reloader.Reload())
+		identity, err = checkAs(t, address, reloader)
+		require.NoError(t, err, "the certificates loaded should be kept")
+		require.Equal(t, "posts-rotated", identity)
+	})
+
+	t.Run("Key Without Certificate", func(t *testing.T) {
+		t.Parallel()
+		_, err := NewCertReloader(TLSConfig{KeyFile: "posts-key.pem"})
+		require.Error(t, err)
+	})
+}
@@ -19,6 +19,7 @@ const _ = grpc.SupportPackageIsVersion7
 // For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
 type UserCheckerClient interface {
 	CheckUser(ctx context.Context, in *CheckUserRequest, opts ...grpc.CallOption) (*UserResponse, error)
+	GetUsers(ctx context.Context, in *GetUsersRequest, opts ...grpc.CallOption) (*GetUsersResponse, error)
 }
 
 type userCheckerClient struct {
@@ -38,11 +39,21 @@ func (c *userCheckerClient) CheckUser(ctx context.Context, in *CheckUserRequest,
 	return out, nil
 }
 
+func (c *userCheckerClient) GetUsers(ctx context.Context, in *GetUsersRequest, opts ...grpc.CallOption) (*GetUsersResponse, error) {
+	out := new(GetUsersResponse)
+	err := c.cc.Invoke(ctx, "/user.UserChecker/GetUsers", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // UserCheckerServer is the server API for UserChecker service.
 // All implementations must embed UnimplementedUserCheckerServer
 // for forward compatibility
 type UserCheckerServer interface {
 	CheckUser(context.Context, *CheckUserRequest) (*UserResponse, error)
+	GetUsers(context.Context, *GetUsersRequest) (*GetUsersResponse, error)
 	mustEmbedUnimplementedUserCheckerServer()
 }
 
@@ -53,6 +64,9 @@ type UnimplementedUserCheckerServer struct {
 func (UnimplementedUserCheckerServer) CheckUser(context.Context, *CheckUserRequest) (*UserResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method CheckUser not implemented")
 }
+func (UnimplementedUserCheckerServer) GetUsers(context.Context, *GetUsersRequest) (*GetUsersResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetUsers not implemented")
+}
 func (UnimplementedUserCheckerServer) mustEmbedUnimplementedUserCheckerServer() {}
 
 // UnsafeUserCheckerServer may be embedded to opt out of forward compatibility for this service.
@@ -84,6 +98,24 @@ func _UserChecker_CheckUser_Handler(srv interface{}, ctx context.Context, dec fu
 	return interceptor(ctx, in, info, handler)
 }
 
+func _UserChecker_GetUsers_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetUsersRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(UserCheckerServer).GetUsers(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/user.UserChecker/GetUsers",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(UserCheckerServer).GetUsers(ctx, req.(*GetUsersRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 // UserChecker_ServiceDesc is the grpc.ServiceDesc for UserChecker service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -95,6 +127,10 @@ var UserChecker_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "CheckUser",
 			Handler:    _UserChecker_CheckUser_Handler,
 		},
+		{
+			MethodName: "GetUsers",
+			Handler:    _UserChecker_GetUsers_Handler,
+		},
 	},
 	Streams:  []grpc.StreamDesc{},
 	Metadata: "checker.proto",
@@ -7,10 +7,14 @@ import (
 	"net"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
+	"time"
 
+	"github.com/mountolive/back-blog-go/user/grpc/tlsconfig"
 	"github.com/mountolive/back-blog-go/user/grpc/transport"
 	"github.com/mountolive/back-blog-go/user/pgstore"
+	"github.com/mountolive/back-blog-go/user/sqlitestore"
 	"github.com/mountolive/back-blog-go/user/usecase"
 	"github.com/mountolive/back-blog-go/user/validation"
 	"google.golang.org/grpc"
@@ -26,16 +30,7 @@ func main() {
 		cancel()
 		log.Fatalf("users server shutting down...")
 	}()
-	dbUser := os.Getenv("USERS_DB_USER")
-	dbPassword := os.Getenv("USERS_DB_PASS")
-	dbName := os.Getenv("USERS_DB_NAME")
-	dbPort := os.Getenv("USERS_DB_PORT")
-	dbHost := os.Getenv("USERS_DB_HOST")
-	dbUrl := fmt.Sprintf(
-		"postgresql://%s:%s@%s:%s/%s?sslmode=disable",
-		dbUser, dbPassword, dbHost, dbPort, dbName,
-	)
-	store, err := pgstore.NewUserPgStore(ctx, dbUrl)
+	store, err := newStore(ctx, os.Getenv("USERS_STORE_DRIVER"))
 	if err != nil {
 		log.Fatalf("users db conn: %v", err)
 	}
@@ -62,7 +57,11 @@ func main() {
 		log.Printf("unable to create admin: %v\n", err)
 	}
 	gRPCServer := transport.NewGRPCServer(repo)
-	baseServer := grpc.NewServer()
+	serverOptions, err := tlsServerOptions(ctx)
+	if err != nil {
+		log.Fatalf("users gRPC TLS setup: %v", err)
+	}
+	baseServer := grpc.NewServer(serverOptions...)
 	// Same gRPC server will resolve all usecases
 	transport.RegisterUserCheckerServer(baseServer, gRPCServer)
 	transport.RegisterUserCreatorServer(baseServer, gRPCServer)
@@ -79,3 +78,68 @@ func main() {
 		log.Fatalf("users gRPC server: %v", err)
 	}
 }
+
+// defaultTLSReloadInterval is how often the certificates are reloaded
+const defaultTLSReloadInterval = time.Minute
+
+// tlsServerOptions secures the gRPC server with the certificate and key at
+// USERS_TLS_CERT and USERS_TLS_KEY, plaintext being served if they're unset.
+// With USERS_TLS_CLIENT_CA, clients must present a certificate signed by its
+// CAs, and only the ones identified as USERS_TLS_CHECKER_IDENTITIES (comma
+// separated, posts by default) may check users
+func tlsServerOptions(ctx context.Context) ([]grpc.ServerOption, error) {
+	certFile := os.Getenv("USERS_TLS_CERT")
+	keyFile := os.Getenv("USERS_TLS_KEY")
+	clientCAFile := os.Getenv("USERS_TLS_CLIENT_CA")
+	if certFile == "" && keyFile == "" && clientCAFile == "" {
+		log.Printf("users gRPC TLS disabled, serving plaintext")
+		return nil, nil
+	}
+	reloader, err := tlsconfig.NewReloader(certFile, keyFile, clientCAFile)
+	if err != nil {
+		return nil, err
+	}
+	interval := defaultTLSReloadInterval
+	if value := os.Getenv("USERS_TLS_RELOAD_INTERVAL"); value != "" {
+		interval, err = time.ParseDuration(value)
+		if err != nil {
+			return nil, fmt.Errorf("USERS_TLS_RELOAD_INTERVAL parsing: %w", err)
+		}
+	}
+	go reloader.Watch(ctx, interval, func(err error) {
+		log.Printf("users gRPC TLS: %v", err)
+	})
+	options := []grpc.ServerOption{grpc.Creds(tlsconfig.ServerCredentials(reloader))}
+	if clientCAFile == "" {
+		return options, nil
+	}
+	identities := []string{"posts"}
+	if value := os.Getenv("USERS_TLS_CHECKER_IDENTITIES"); value != "" {
+		identities = strings.Split(value, ",")
+	}
+	return append(options, grpc.UnaryInterceptor(
+		tlsconfig.RequireIdentity("/user.UserChecker/", identities...),
+	)), nil
+}
+
+// newStore builds the store selected by driver, either
+// postgres (default) or sqlite
+func newStore(ctx context.Context, driver string) (usecase.UserStore, error) {
+	switch driver {
+	case "", "postgres":
+		dbUser := os.Getenv("USERS_DB_USER")
+		dbPassword := os.Getenv("USERS_DB_PASS")
+		dbName := os.Getenv("USERS_DB_NAME")
+		dbPort := os.Getenv("USERS_DB_PORT")
+		dbHost := os.Getenv("USERS_DB_HOST")
+		dbUrl := fmt.Sprintf(
+			"postgresql://%s:%s@%s:%s/%s?sslmode=disable",
+			dbUser, dbPassword, dbHost, dbPort, dbName,
+		)
+		return pgstore.NewUserPgStore(ctx, dbUrl)
+	case "sqlite":
+		return sqlitestore.NewUserSQLiteStore(ctx, os.Getenv("USERS_SQLITE_PATH"))
+	default:
+		return nil, fmt.Errorf("unknown store driver %q", driver)
+	}
+}
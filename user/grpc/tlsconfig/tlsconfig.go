@@ -0,0 +1,191 @@
+package tlsconfig
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// Reloader keeps a certificate, and the CAs verifying the certificates of
+// the peers, if any, loaded from files. The files are loaded again on
+// Reload, so rotated certificates are picked up by the connections
+// established afterwards, without restarting. It's safe for concurrent use
+type Reloader struct {
+	certFile, keyFile, caFile string
+
+	mu    sync.RWMutex
+	cert  *tls.Certificate
+	pool  *x509.CertPool
+	files [][]byte
+}
+
+// NewReloader is a constructor, caFile is optional. The files are
+// loaded right away, failing if they can't be
+func NewReloader(certFile, keyFile, caFile string) (*Reloader, error) {
+	if certFile == "" || keyFile == "" {
+		return nil, fmt.Errorf("tls: certificate and key files are required")
+	}
+	r := &Reloader{certFile: certFile, keyFile: keyFile, caFile: caFile}
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Reload loads the files again, if they changed. The certificates loaded
+// are kept when they fail to, as when a rotation is halfway written
+func (r *Reloader) Reload() error {
+	paths := []string{r.certFile, r.keyFile}
+	if r.caFile != "" {
+		paths = append(paths, r.caFile)
+	}
+	files := make([][]byte, len(paths))
+	for i, path := range paths {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("tls reload: %w", err)
+		}
+		files[i] = content
+	}
+	if r.unchanged(files) {
+		return nil
+	}
+	cert, err := tls.X509KeyPair(files[0], files[1])
+	if err != nil {
+		return fmt.Errorf("tls reload, %s: %w", r.certFile, err)
+	}
+	var pool *x509.CertPool
+	if r.caFile != "" {
+		pool = x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(files[2]) {
+			return fmt.Errorf("tls reload, %s: no certificates found", r.caFile)
+		}
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.cert, r.pool, r.files = &cert, pool, files
+	return nil
+}
+
+func (r *Reloader) unchanged(files [][]byte) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if len(files) != len(r.files) {
+		return false
+	}
+	for i := range files {
+		if !bytes.Equal(files[i], r.files[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// Watch reloads the files every interval, until ctx is done,
+// passing the errors to onError
+func (r *Reloader) Watch(ctx context.Context, interval time.Duration, onError func(error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := r.Reload(); err != nil {
+				onError(err)
+			}
+		}
+	}
+}
+
+func (r *Reloader) current() (*tls.Certificate, *x509.CertPool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.cert, r.pool
+}
+
+// ServerCredentials returns the credentials of a gRPC server presenting the
+// certificate of r. If r has CAs, the clients are required to present a
+// certificate signed by one of them: mutual TLS
+func ServerCredentials(r *Reloader) credentials.TransportCredentials {
+	return credentials.NewTLS(&tls.Config{
+		MinVersion: tls.VersionTLS12,
+		// resolved per connection, so that the ones reloaded are used
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			cert, pool := r.current()
+			config := &tls.Config{
+				MinVersion:   tls.VersionTLS12,
+				Certificates: []tls.Certificate{*cert},
+				NextProtos:   []string{"h2"},
+			}
+			if pool != nil {
+				config.ClientCAs = pool
+				config.ClientAuth = tls.RequireAndVerifyClientCert
+			}
+			return config, nil
+		},
+	})
+}
+
+// PeerIdentities returns the identities of the peer of ctx, as told by the
+// verified certificate it presented: its common name, DNS names and URIs
+func PeerIdentities(ctx context.Context) []string {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return nil
+	}
+	info, ok := p.AuthInfo.(credentials.TLSInfo)
+	if !ok || len(info.State.VerifiedChains) == 0 || len(info.State.VerifiedChains[0]) == 0 {
+		return nil
+	}
+	cert := info.State.VerifiedChains[0][0]
+	var identities []string
+	if cert.Subject.CommonName != "" {
+		identities = append(identities, cert.Subject.CommonName)
+	}
+	identities = append(identities, cert.DNSNames...)
+	for _, uri := range cert.URIs {
+		identities = append(identities, uri.String())
+	}
+	return identities
+}
+
+// RequireIdentity returns an interceptor refusing, with PermissionDenied,
+// the calls to the methods whose full name starts with prefix, such as
+// "/user.UserChecker/", unless the peer is identified as one of identities
+// by its certificate, see PeerIdentities
+func RequireIdentity(prefix string, identities ...string) grpc.UnaryServerInterceptor {
+	allowed := make(map[string]bool, len(identities))
+	for _, identity := range identities {
+		allowed[identity] = true
+	}
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler) (interface{}, error) {
+		if !strings.HasPrefix(info.FullMethod, prefix) {
+			return handler(ctx, req)
+		}
+		peerIdentities := PeerIdentities(ctx)
+		if len(peerIdentities) == 0 {
+			return nil, status.Error(codes.Unauthenticated, "client certificate required")
+		}
+		for _, identity := range peerIdentities {
+			if allowed[identity] {
+				return handler(ctx, req)
+			}
+		}
+		return nil, status.Errorf(codes.PermissionDenied,
+			"%v not allowed to call %s", peerIdentities, info.FullMethod)
+	}
+}
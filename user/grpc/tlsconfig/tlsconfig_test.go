@@ -0,0 +1,236 @@
+package tlsconfig
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mountolive/back-blog-go/user/grpc/transport"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// testCA issues certificates for local tests
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+var serial int64
+
+func newTestCA(t *testing.T) *testCA {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	serial++
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(serial),
+		Subject:               pkix.Name{CommonName: "test ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return &testCA{cert: cert, key: key, pem: pemEncode("CERTIFICATE", der)}
+}
+
+// issue returns the PEM encoded certificate, and key, of commonName
+func (ca *testCA) issue(t *testing.T, commonName string, dnsNames ...string) ([]byte, []byte) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	serial++
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: commonName},
+		DNSNames:     dnsNames,
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+	return pemEncode("CERTIFICATE", der), pemEncode("EC PRIVATE KEY", keyDER)
+}
+
+// clientCert returns a certificate of commonName, issued by ca
+func (ca *testCA) clientCert(t *testing.T, commonName string) tls.Certificate {
+	t.Helper()
+	certPEM, keyPEM := ca.issue(t, commonName)
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	require.NoError(t, err)
+	return cert
+}
+
+func pemEncode(blockType string, der []byte) []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der})
+}
+
+func writeFile(t *testing.T, path string, content []byte) {
+	t.Helper()
+	require.NoError(t, os.WriteFile(path, content, 0600))
+}
+
+// serverFiles writes the certificate and key of the server, issued by
+// ca, and the CA of its clients, returning their paths
+func serverFiles(t *testing.T, dir string, ca, clientCA *testCA) (string, string, string) {
+	t.Helper()
+	certFile := filepath.Join(dir, "server.pem")
+	keyFile := filepath.Join(dir, "server-key.pem")
+	caFile := filepath.Join(dir, "client-ca.pem")
+	certPEM, keyPEM := ca.issue(t, "users", "localhost")
+	writeFile(t, certFile, certPEM)
+	writeFile(t, keyFile, keyPEM)
+	writeFile(t, caFile, clientCA.pem)
+	return certFile, keyFile, caFile
+}
+
+type checkerServer struct {
+	transport.UnimplementedUserCheckerServer
+}
+
+func (checkerServer) CheckUser(context.Context,
+	*transport.CheckUserRequest) (*transport.UserResponse, error) {
+	return &transport.UserResponse{Id: "id-kim", Username: "kim"}, nil
+}
+
+// serve starts a users server with mutual TLS, allowing only
+// posts to check users, returning its address
+func serve(t *testing.T, reloader *Reloader) string {
+	t.Helper()
+	server := grpc.NewServer(
+		grpc.Creds(ServerCredentials(reloader)),
+		grpc.UnaryInterceptor(RequireIdentity("/user.UserChecker/", "posts")),
+	)
+	transport.RegisterUserCheckerServer(server, checkerServer{})
+	transport.RegisterUserCreatorServer(server, transport.UnimplementedUserCreatorServer{})
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go func() {
+		_ = server.Serve(listener)
+	}()
+	t.Cleanup(server.Stop)
+	return listener.Addr().String()
+}
+
+// dial connects to address, verifying its certificate with ca,
+// and presenting certs
+func dial(t *testing.T, address string, ca *testCA,
+	certs ...tls.Certificate) *grpc.ClientConn {
+	t.Helper()
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+	creds := credentials.NewTLS(&tls.Config{
+		RootCAs:      roots,
+		Certificates: certs,
+		ServerName:   "localhost",
+	})
+	conn, err := grpc.Dial(address, grpc.WithTransportCredentials(creds))
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = conn.Close()
+	})
+	return conn
+}
+
+func checkUser(conn *grpc.ClientConn, opts ...grpc.CallOption) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, err := transport.NewUserCheckerClient(conn).CheckUser(
+		ctx, &transport.CheckUserRequest{Login: "kim"}, opts...)
+	return err
+}
+
+func TestMutualTLS(t *testing.T) {
+	serverCA, clientCA := newTestCA(t), newTestCA(t)
+	reloader, err := NewReloader(serverFiles(t, t.TempDir(), serverCA, clientCA))
+	require.NoError(t, err)
+	address := serve(t, reloader)
+
+	t.Run("Allowed Identity", func(t *testing.T) {
+		conn := dial(t, address, serverCA, clientCA.clientCert(t, "posts"))
+		require.NoError(t, checkUser(conn))
+	})
+
+	t.Run("Other Identity", func(t *testing.T) {
+		conn := dial(t, address, serverCA, clientCA.clientCert(t, "intruder"))
+		err := checkUser(conn)
+		require.Equal(t, codes.PermissionDenied, status.Code(err), "Got: %v", err)
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_, err = transport.NewUserCreatorClient(conn).Create(ctx, &transport.CreateUserRequest{})
+		require.Equal(t, codes.Unimplemented, status.Code(err),
+			"only UserChecker should be restricted. Got: %v", err)
+	})
+
+	t.Run("No Client Certificate", func(t *testing.T) {
+		conn := dial(t, address, serverCA)
+		require.Error(t, checkUser(conn))
+	})
+
+	t.Run("Untrusted Client Certificate", func(t *testing.T) {
+		conn := dial(t, address, serverCA, newTestCA(t).clientCert(t, "posts"))
+		require.Error(t, checkUser(conn))
+	})
+}
+
+func TestReload(t *testing.T) {
+	dir := t.TempDir()
+	serverCA, clientCA := newTestCA(t), newTestCA(t)
+	certFile, keyFile, caFile := serverFiles(t, dir, serverCA, clientCA)
+	reloader, err := NewReloader(certFile, keyFile, caFile)
+	require.NoError(t, err)
+	address := serve(t, reloader)
+
+	var before peer.Peer
+	conn := dial(t, address, serverCA, clientCA.clientCert(t, "posts"))
+	require.NoError(t, checkUser(conn, grpc.Peer(&before)))
+
+	// the server's certificate and the clients' CA are rotated
+	rotatedCA := newTestCA(t)
+	serverFiles(t, dir, serverCA, rotatedCA)
+	require.NoError(t, reloader.Reload())
+
+	var after peer.Peer
+	conn = dial(t, address, serverCA, rotatedCA.clientCert(t, "posts"))
+	require.NoError(t, checkUser(conn, grpc.Peer(&after)))
+	serverCert := func(p peer.Peer) *x509.Certificate {
+		return p.AuthInfo.(credentials.TLSInfo).State.PeerCertificates[0]
+	}
+	require.NotEqual(t, serverCert(before).SerialNumber, serverCert(after).SerialNumber,
+		"the rotated certificate should be presented")
+
+	conn = dial(t, address, serverCA, clientCA.clientCert(t, "posts"))
+	require.Error(t, checkUser(conn), "the clients of the former CA should be refused")
+
+	t.Run("Invalid Files", func(t *testing.T) {
+		writeFile(t, keyFile, []byte("halfway written"))
+		require.Error(t, reloader.Reload())
+		conn := dial(t, address, serverCA, rotatedCA.clientCert(t, "posts"))
+		require.NoError(t, checkUser(conn), "the certificates loaded should be kept")
+	})
+}
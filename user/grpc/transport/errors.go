@@ -0,0 +1,42 @@
+package transport
+
+import (
+	"context"
+	"errors"
+
+	"github.com/mountolive/back-blog-go/user/usecase"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// statusError maps err, as returned by the usecases, to a gRPC status error
+// with the code telling clients what went wrong, keeping its message
+// The fields failing to be validated are attached as a BadRequest
+func statusError(err error) error {
+	var validationErr *usecase.ValidationError
+	switch {
+	case errors.Is(err, context.Canceled), errors.Is(err, usecase.ErrOperationCanceled):
+		return status.Error(codes.Canceled, err.Error())
+	case errors.Is(err, context.DeadlineExceeded):
+		return status.Error(codes.DeadlineExceeded, err.Error())
+	case errors.As(err, &validationErr):
+		st := status.New(codes.InvalidArgument, err.Error())
+		detailed, detailsErr := st.WithDetails(&errdetails.BadRequest{
+			FieldViolations: []*errdetails.BadRequest_FieldViolation{{
+				Field:       validationErr.Field,
+				Description: validationErr.Err.Error(),
+			}},
+		})
+		if detailsErr != nil {
+			return st.Err()
+		}
+		return detailed.Err()
+	case errors.Is(err, usecase.ErrUserNotFound), errors.Is(err, ErrUserNotFound):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, usecase.ErrEmailOrUsernameAlreadyInUse):
+		return status.Error(codes.AlreadyExists, err.Error())
+	default:
+		return err
+	}
+}
@@ -0,0 +1,106 @@
+package transport
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/mountolive/back-blog-go/user/memstore"
+	"github.com/mountolive/back-blog-go/user/usecase"
+	"github.com/mountolive/back-blog-go/user/validation"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+func newTestServer(t *testing.T) GRPCServer {
+	t.Helper()
+	validator, err := validation.NewValidator()
+	require.NoError(t, err)
+	return NewGRPCServer(&usecase.UserRepository{
+		Store:     memstore.NewUserMemStore(),
+		Validator: validator,
+	})
+}
+
+// requireViolation checks that err is an InvalidArgument
+// telling that field failed to be validated
+func requireViolation(t *testing.T, err error, field string) {
+	t.Helper()
+	st := status.Convert(err)
+	require.Equal(t, codes.InvalidArgument, st.Code(), "Got: %v", err)
+	require.Len(t, st.Details(), 1)
+	badRequest, ok := st.Details()[0].(*errdetails.BadRequest)
+	require.True(t, ok, "Got: %T", st.Details()[0])
+	require.Len(t, badRequest.FieldViolations, 1)
+	require.Equal(t, field, badRequest.FieldViolations[0].Field)
+	require.NotEmpty(t, badRequest.FieldViolations[0].Description)
+}
+
+func TestGRPCServerStatusCodes(t *testing.T) {
+	server := newTestServer(t)
+	ctx := context.Background()
+	ada := &CreateUserRequest{
+		Email:            "ada@lovelace.com",
+		Username:         "ada",
+		Password:         "12345678j.",
+		RepeatedPassword: "12345678j.",
+		FirstName:        "Ada",
+		LastName:         "Lovelace",
+	}
+	_, err := server.Create(ctx, ada)
+	require.NoError(t, err)
+
+	t.Run("Not Found", func(t *testing.T) {
+		_, err := server.CheckUser(ctx, &CheckUserRequest{Login: "nobody"})
+		require.Equal(t, codes.NotFound, status.Code(err), "Got: %v", err)
+		_, err = server.CheckUser(ctx, &CheckUserRequest{Id: "not-an-id"})
+		require.Equal(t, codes.NotFound, status.Code(err), "Got: %v", err)
+	})
+
+	t.Run("Already Exists", func(t *testing.T) {
+		_, err := server.Create(ctx, ada)
+		require.Equal(t, codes.AlreadyExists, status.Code(err), "Got: %v", err)
+	})
+
+	t.Run("Invalid Argument", func(t *testing.T) {
+		invalid := proto.Clone(ada).(*CreateUserRequest)
+		invalid.Email = "not-an-email"
+		_, err := server.Create(ctx, invalid)
+		requireViolation(t, err, "email")
+
+		invalid = proto.Clone(ada).(*CreateUserRequest)
+		invalid.Email, invalid.Username = "grace@hopper.com", "grace"
+		invalid.RepeatedPassword = "87654321j."
+		_, err = server.Create(ctx, invalid)
+		requireViolation(t, err, "repeatedPassword")
+
+		_, err = server.ChangePassword(ctx, &ChangePasswordRequest{
+			Email:            ada.Email,
+			OldPassword:      ada.Password,
+			NewPassword:      "short",
+			RepeatedPassword: "short",
+		})
+		requireViolation(t, err, "newPassword")
+
+		_, err = server.GetUsers(ctx, &GetUsersRequest{
+			Ids: make([]string, usecase.MaxUsersPerLookup+1),
+		})
+		requireViolation(t, err, "ids")
+	})
+
+	t.Run("Canceled", func(t *testing.T) {
+		canceled, cancel := context.WithCancel(ctx)
+		cancel()
+		_, err := server.CheckUser(canceled, &CheckUserRequest{Login: "ada"})
+		require.Equal(t, codes.Canceled, status.Code(err), "Got: %v", err)
+	})
+
+	t.Run("Unknown", func(t *testing.T) {
+		err := statusError(fmt.Errorf("wrapped: %w", errors.New("boom")))
+		require.Equal(t, codes.Unknown, status.Code(err), "Got: %v", err)
+	})
+}
@@ -15,6 +15,7 @@ const (
 	errMsgUpdateUser     = "grpc update user: %w"
 	errMsgChangePassword = "grpc change password from user: %w"
 	errMsgCheckUser      = "grpc check user: %w"
+	errMsgGetUsers       = "grpc get users: %w"
 	errMsgLogin          = "grpc login from user: %w"
 )
 
@@ -70,10 +71,10 @@ func newCreateUserDto(cu *CreateUserRequest) *usecase.CreateUserDto {
 func (g GRPCServer) Create(ctx context.Context, req *CreateUserRequest) (*UserResponse, error) {
 	user, err := g.repo.CreateUser(ctx, newCreateUserDto(req))
 	if err != nil {
-		return nil, fmt.Errorf(errMsgCreateUser, err)
+		return nil, statusError(fmt.Errorf(errMsgCreateUser, err))
 	}
 	if user == nil {
-		return nil, fmt.Errorf(errMsgCreateUser, ErrUserNotRetrieved)
+		return nil, statusError(fmt.Errorf(errMsgCreateUser, ErrUserNotRetrieved))
 	}
 	return newUserResponse(user), nil
 }
@@ -91,10 +92,10 @@ func newUpdateUserDto(uu *UpdateUserRequest) *usecase.UpdateUserDto {
 func (g GRPCServer) Update(ctx context.Context, req *UpdateUserRequest) (*UserResponse, error) {
 	user, err := g.repo.UpdateUser(ctx, req.Id, newUpdateUserDto(req))
 	if err != nil {
-		return nil, fmt.Errorf(errMsgUpdateUser, err)
+		return nil, statusError(fmt.Errorf(errMsgUpdateUser, err))
 	}
 	if user == nil {
-		return nil, fmt.Errorf(errMsgUpdateUser, ErrUserNotFound)
+		return nil, statusError(fmt.Errorf(errMsgUpdateUser, ErrUserNotFound))
 	}
 	return newUserResponse(user), nil
 }
@@ -113,23 +114,44 @@ func newChangePasswordDto(cp *ChangePasswordRequest) *usecase.ChangePasswordDto
 func (g GRPCServer) ChangePassword(ctx context.Context, req *ChangePasswordRequest) (*ChangePasswordResponse, error) {
 	err := g.repo.ChangePassword(ctx, newChangePasswordDto(req))
 	if err != nil {
-		return nil, fmt.Errorf(errMsgChangePassword, err)
+		return nil, statusError(fmt.Errorf(errMsgChangePassword, err))
 	}
 	return &ChangePasswordResponse{Success: true}, nil
 }
 
 // CheckUser implements the UserCheckerServer interface
+// The user is looked up by id when it's passed, or else by login
 func (g GRPCServer) CheckUser(ctx context.Context, req *CheckUserRequest) (*UserResponse, error) {
-	user, err := g.repo.ReadUser(ctx, req.Login)
+	var user *usecase.User
+	var err error
+	if req.Id != "" {
+		user, err = g.repo.ReadUserByID(ctx, req.Id)
+	} else {
+		user, err = g.repo.ReadUser(ctx, req.Login)
+	}
 	if err != nil {
-		return nil, fmt.Errorf(errMsgCheckUser, err)
+		return nil, statusError(fmt.Errorf(errMsgCheckUser, err))
 	}
 	if user == nil {
-		return nil, fmt.Errorf(errMsgCheckUser, ErrUserNotFound)
+		return nil, statusError(fmt.Errorf(errMsgCheckUser, ErrUserNotFound))
 	}
 	return newUserResponse(user), nil
 }
 
+// GetUsers implements the UserCheckerServer interface
+// The users are looked up by any of the ids or logins passed, at once
+func (g GRPCServer) GetUsers(ctx context.Context, req *GetUsersRequest) (*GetUsersResponse, error) {
+	users, err := g.repo.ReadUsers(ctx, req.Ids, req.Logins)
+	if err != nil {
+		return nil, statusError(fmt.Errorf(errMsgGetUsers, err))
+	}
+	res := &GetUsersResponse{Users: make([]*UserResponse, 0, len(users))}
+	for _, user := range users {
+		res.Users = append(res.Users, newUserResponse(user))
+	}
+	return res, nil
+}
+
 // Login implements the LoginServer interface
 func (g GRPCServer) Login(ctx context.Context, req *LoginRequest) (*LoginResponse, error) {
 	ok, err := g.repo.Login(
@@ -141,17 +163,20 @@ func (g GRPCServer) Login(ctx context.Context, req *LoginRequest) (*LoginRespons
 		},
 	)
 	if err != nil {
-		return nil, fmt.Errorf(errMsgLogin, err)
+		return nil, statusError(fmt.Errorf(errMsgLogin, err))
 	}
 	return &LoginResponse{Success: ok}, nil
 }
 
 func newUserResponse(u *usecase.User) *UserResponse {
 	return &UserResponse{
-		Id:        u.Id,
-		Email:     u.Email,
-		Username:  u.Username,
-		FirstName: u.FirstName,
-		LastName:  u.LastName,
+		Id:          u.Id,
+		Email:       u.Email,
+		Username:    u.Username,
+		FirstName:   u.FirstName,
+		LastName:    u.LastName,
+		Roles:       u.Roles,
+		DisplayName: u.DisplayName(),
+		AvatarUrl:   u.AvatarURL(),
 	}
 }
@@ -0,0 +1,285 @@
+// Defines an in-memory storage of Users, meant for tests and local runs
+package memstore
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mountolive/back-blog-go/user/usecase"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Store implementation that keeps users in memory, safe for concurrent use
+// Its semantics mirror PgStore's: emails are case insensitive while
+// usernames aren't, and both are unique
+type MemStore struct {
+	mu sync.RWMutex
+	// users by id
+	users map[string]*user
+	// ids by lowercased email
+	emails map[string]string
+	// ids by username
+	usernames map[string]string
+}
+
+type user struct {
+	usecase.User
+	password []byte
+}
+
+var _ usecase.UserStore = &MemStore{}
+
+func NewUserMemStore() *MemStore {
+	return &MemStore{
+		users:     map[string]*user{},
+		emails:    map[string]string{},
+		usernames: map[string]string{},
+	}
+}
+
+// Creates an User and returns it (UserDto)
+func (m *MemStore) Create(ctx context.Context,
+	data *usecase.CreateUserDto) (*usecase.User, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	hashedPass, err := bcrypt.GenerateFromPassword([]byte(data.Password), 10)
+	if err != nil {
+		return nil, fmt.Errorf("error while trying to hash password: %s", err)
+	}
+	id, err := newID()
+	if err != nil {
+		return nil, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.checkUniqueness("", data.Email, data.Username); err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	created := &user{
+		User: usecase.User{
+			Id:        id,
+			Email:     data.Email,
+			Username:  data.Username,
+			FirstName: data.FirstName,
+			LastName:  data.LastName,
+			Roles:     []string{},
+			CreatedAt: now,
+			UpdatedAt: now,
+		},
+		password: hashedPass,
+	}
+	m.users[id] = created
+	m.index(created)
+	copied := created.User
+	return &copied, nil
+}
+
+// Updates the data associated to an User
+// and returns the corresponding UserDto. Empty fields are left untouched
+func (m *MemStore) Update(ctx context.Context, id string,
+	data *usecase.UpdateUserDto) (*usecase.User, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	stored, ok := m.users[id]
+	if !ok {
+		return nil, wrapErrorInfo(usecase.ErrUserNotFound, id, "user")
+	}
+	if err := m.checkUniqueness(id, data.Email, data.Username); err != nil {
+		return nil, err
+	}
+	m.unindex(stored)
+	if data.Email != "" {
+		stored.Email = data.Email
+	}
+	if data.Username != "" {
+		stored.Username = data.Username
+	}
+	if data.FirstName != "" {
+		stored.FirstName = data.FirstName
+	}
+	if data.LastName != "" {
+		stored.LastName = data.LastName
+	}
+	stored.UpdatedAt = time.Now()
+	m.index(stored)
+	copied := stored.User
+	return &copied, nil
+}
+
+// Updates a given User's Password, as long as the old one matches
+func (m *MemStore) UpdatePassword(ctx context.Context,
+	data *usecase.ChangePasswordDto) error {
+	checker := &usecase.CheckUserAndPasswordDto{
+		Email:    data.Email,
+		Username: data.Username,
+		Password: data.OldPassword,
+	}
+	err := m.CheckIfCorrectPassword(ctx, checker)
+	if err != nil {
+		return err
+	}
+	newPassHashed, err := bcrypt.GenerateFromPassword([]byte(data.NewPassword), 10)
+	if err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	stored := m.lookup(data.Email, data.Username)
+	if stored == nil {
+		return wrapErrorInfo(usecase.ErrUserNotFound, data.Email+data.Username, "user")
+	}
+	stored.password = newPassHashed
+	stored.UpdatedAt = time.Now()
+	return nil
+}
+
+// Retrieves a single User through its Username or Email,
+// nil is returned when there's no such User
+func (m *MemStore) ReadOne(ctx context.Context,
+	query *usecase.ByUsernameOrEmail) (*usecase.User, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	stored := m.lookup(query.Email, query.Username)
+	if stored == nil {
+		return nil, nil
+	}
+	copied := stored.User
+	return &copied, nil
+}
+
+// Retrieves a single User through its Id,
+// nil is returned when there's no such User
+func (m *MemStore) ReadByID(ctx context.Context, id string) (*usecase.User, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	stored, ok := m.users[id]
+	if !ok {
+		return nil, nil
+	}
+	copied := stored.User
+	return &copied, nil
+}
+
+// Retrieves the Users with any of the ids, usernames or emails passed
+func (m *MemStore) ReadMany(ctx context.Context,
+	query *usecase.ByIDsOrLogins) ([]*usecase.User, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	ids := make(map[string]bool, len(query.IDs)+len(query.Usernames)+len(query.Emails))
+	for _, id := range query.IDs {
+		ids[id] = true
+	}
+	for _, username := range query.Usernames {
+		ids[m.usernames[username]] = true
+	}
+	for _, email := range query.Emails {
+		ids[m.emails[strings.ToLower(email)]] = true
+	}
+	users := []*usecase.User{}
+	for id := range ids {
+		if stored, ok := m.users[id]; ok {
+			copied := stored.User
+			users = append(users, &copied)
+		}
+	}
+	return users, nil
+}
+
+const errMsgCheckPasswordMatch = "user memstore check password match: %w"
+
+// Checks if User's credentials are OK
+// ErrCredentialsDontMatch is returned when the user doesn't exist
+// or the password doesn't match
+func (m *MemStore) CheckIfCorrectPassword(ctx context.Context,
+	data *usecase.CheckUserAndPasswordDto) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	m.mu.RLock()
+	stored := m.lookup(data.Email, data.Username)
+	var hashedPassword []byte
+	if stored != nil {
+		hashedPassword = stored.password
+	}
+	m.mu.RUnlock()
+	if stored == nil {
+		return fmt.Errorf(errMsgCheckPasswordMatch, usecase.ErrCredentialsDontMatch)
+	}
+	err := bcrypt.CompareHashAndPassword(hashedPassword, []byte(data.Password))
+	if err != nil {
+		return fmt.Errorf(errMsgCheckPasswordMatch, usecase.ErrCredentialsDontMatch)
+	}
+	return nil
+}
+
+// lookup retrieves the user by email or, if it's empty, by username
+func (m *MemStore) lookup(email, username string) *user {
+	var id string
+	if email == "" {
+		id = m.usernames[username]
+	} else {
+		id = m.emails[strings.ToLower(email)]
+	}
+	return m.users[id]
+}
+
+// checkUniqueness checks that email and username aren't used by
+// a user other than the one with the passed id
+func (m *MemStore) checkUniqueness(id, email, username string) error {
+	if email != "" {
+		if owner, ok := m.emails[strings.ToLower(email)]; ok && owner != id {
+			return wrapErrorInfo(usecase.ErrEmailOrUsernameAlreadyInUse, email, "user")
+		}
+	}
+	if username != "" {
+		if owner, ok := m.usernames[username]; ok && owner != id {
+			return wrapErrorInfo(usecase.ErrEmailOrUsernameAlreadyInUse, username, "user")
+		}
+	}
+	return nil
+}
+
+func (m *MemStore) index(stored *user) {
+	m.emails[strings.ToLower(stored.Email)] = stored.Id
+	if stored.Username != "" {
+		m.usernames[stored.Username] = stored.Id
+	}
+}
+
+func (m *MemStore) unindex(stored *user) {
+	delete(m.emails, strings.ToLower(stored.Email))
+	delete(m.usernames, stored.Username)
+}
+
+// newID returns a random (version 4) UUID
+func newID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:]), nil
+}
+
+func wrapErrorInfo(err error, msg string, store string) error {
+	return fmt.Errorf("%w - %s memstore: %s \n", err, store, msg)
+}
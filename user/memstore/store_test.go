@@ -0,0 +1,16 @@
+package memstore
+
+import (
+	"testing"
+
+	"github.com/mountolive/back-blog-go/user/storetest"
+	"github.com/mountolive/back-blog-go/user/usecase"
+)
+
+func TestMemStore(t *testing.T) {
+	t.Run("Canary", func(t *testing.T) {
+		var _ usecase.UserStore = &MemStore{}
+	})
+
+	storetest.Run(t, NewUserMemStore())
+}
@@ -5,14 +5,33 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"regexp"
 	"strings"
 
+	"github.com/jackc/pgconn"
 	"github.com/jackc/pgx/v4"
 	"github.com/jackc/pgx/v4/pgxpool"
 	"github.com/mountolive/back-blog-go/user/usecase"
 	"golang.org/x/crypto/bcrypt"
 )
 
+// returningColumns are the columns needed for building an User,
+// in the same order expected by rowToEntity
+const returningColumns = `RETURNING
+      id, email, first_name,
+      last_name, username, created_at, updated_at, roles`
+
+// uniqueViolationCode is Postgres' error code for unique_violation
+const uniqueViolationCode = "23505"
+
+// invalidTextRepresentationCode is Postgres' error code for
+// invalid_text_representation, as for an id that isn't a UUID
+const invalidTextRepresentationCode = "22P02"
+
+// uuidPattern matches the users' ids, which are UUIDs
+var uuidPattern = regexp.MustCompile(
+	`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
 var (
 	ConnectionError    = errors.New("error occurred when connecting to the DB")
 	TableCreationError = errors.New("error occurred when trying to create the table")
@@ -65,6 +84,8 @@ func (p *PgStore) createUserTable(ctx context.Context) error {
       updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
     );
 
+    ALTER TABLE users ADD COLUMN IF NOT EXISTS roles TEXT[] NOT NULL DEFAULT '{}';
+
     CREATE INDEX IF NOT EXISTS idx_email ON users (email);
     CREATE INDEX IF NOT EXISTS idx_username ON users (username);
 
@@ -86,6 +107,7 @@ func (p *PgStore) createUserTable(ctx context.Context) error {
 }
 
 // Creates an User and returns it (UserDto)
+// The returned User is the one written by the insert itself
 func (p *PgStore) Create(ctx context.Context,
 	data *usecase.CreateUserDto) (*usecase.User, error) {
 	columns := "(email, password, first_name, last_name"
@@ -98,8 +120,9 @@ func (p *PgStore) Create(ctx context.Context,
 	}
 	statement := fmt.Sprintf(`
     INSERT INTO users %s
-    VALUES %s;
-  `, columns+closingColumn, params+closingParams)
+    VALUES %s
+    %s;
+  `, columns+closingColumn, params+closingParams, returningColumns)
 
 	tx, err := p.db.Begin(ctx)
 	if err != nil {
@@ -110,19 +133,25 @@ func (p *PgStore) Create(ctx context.Context,
 	if err != nil {
 		return nil, fmt.Errorf("error while trying to hash password: %s", err)
 	}
-	_, err = tx.Exec(ctx, statement, data.Email, string(hashedPass),
-		data.FirstName, data.LastName, data.Username)
+	args := []interface{}{
+		data.Email, string(hashedPass), data.FirstName, data.LastName,
+	}
+	if data.Username != "" {
+		args = append(args, data.Username)
+	}
+	user := &usecase.User{}
+	err = rowToEntity(tx.QueryRow(ctx, statement, args...), user)
 	if err != nil {
+		return nil, mapUniqueViolation(err)
+	}
+	if err := tx.Commit(ctx); err != nil {
 		return nil, err
 	}
-	tx.Commit(ctx)
-
-	// TODO User's read by Email in Create's return is an open door for inconsistent results (write skew)
-	return p.userByEmail(ctx, data.Email)
+	return user, nil
 }
 
 // Updates the data associated to an User
-// and returns the corresponding UserDto
+// and returns the corresponding UserDto, as written by the update itself
 func (p *PgStore) Update(ctx context.Context, id string,
 	data *usecase.UpdateUserDto) (*usecase.User, error) {
 	updates, params := buildColumsAndValuesSlices(data, id)
@@ -132,20 +161,27 @@ func (p *PgStore) Update(ctx context.Context, id string,
 	}
 	defer tx.Rollback(ctx)
 
-	_, err = tx.Exec(ctx, fmt.Sprintf(`
+	row := tx.QueryRow(ctx, fmt.Sprintf(`
     UPDATE users
     SET %s
-    WHERE id = $%d;
-  `, strings.Join(updates, ", "), len(params)), params...)
+    WHERE id = $%d
+    %s;
+  `, strings.Join(updates, ", "), len(params), returningColumns), params...)
+	user := &usecase.User{}
+	err = rowToEntity(row, user)
 	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, wrapErrorInfo(usecase.ErrUserNotFound, id, "user")
+		}
+		return nil, mapUniqueViolation(err)
+	}
+	if err := tx.Commit(ctx); err != nil {
 		return nil, err
 	}
-	tx.Commit(ctx)
-	// TODO User's read by Id in Update's return is an open door for inconsistent results (write skew)
-	return p.userById(ctx, id)
+	return user, nil
 }
 
-// Updates a given User's Password
+// Updates a given User's Password, as long as the old one matches
 func (p *PgStore) UpdatePassword(ctx context.Context,
 	data *usecase.ChangePasswordDto) error {
 	checker := &usecase.CheckUserAndPasswordDto{
@@ -167,12 +203,16 @@ func (p *PgStore) UpdatePassword(ctx context.Context,
 	if err != nil {
 		return err
 	}
-	statement := `
+	field, value := "email", data.Email
+	if data.Email == "" {
+		field, value = "username", data.Username
+	}
+	statement := fmt.Sprintf(`
       UPDATE users
       SET password = $1
-      WHERE (email = $2 OR username = $3);
-  `
-	_, err = tx.Exec(ctx, statement, newPassHashed, data.Email, data.Username)
+      WHERE %s = $2;
+  `, field)
+	_, err = tx.Exec(ctx, statement, newPassHashed, value)
 	if err != nil {
 		return err
 	}
@@ -189,7 +229,60 @@ func (p *PgStore) ReadOne(ctx context.Context,
 	return p.userByEmail(ctx, query.Email)
 }
 
+// Retrieves a single User from DB through its Id,
+// nil is returned when there's no such User
+func (p *PgStore) ReadByID(ctx context.Context, id string) (*usecase.User, error) {
+	rawUser := p.db.QueryRow(ctx, p.statementByField("id"), id)
+	user := &usecase.User{}
+	err := rowToEntity(rawUser, user)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.Is(err, pgx.ErrNoRows) ||
+			(errors.As(err, &pgErr) && pgErr.Code == invalidTextRepresentationCode) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return user, nil
+}
+
+// Retrieves the Users with any of the ids, usernames or emails passed,
+// in a single query. The ids that aren't UUIDs match no User
+func (p *PgStore) ReadMany(ctx context.Context,
+	query *usecase.ByIDsOrLogins) ([]*usecase.User, error) {
+	ids := make([]string, 0, len(query.IDs))
+	for _, id := range query.IDs {
+		if uuidPattern.MatchString(id) {
+			ids = append(ids, id)
+		}
+	}
+	rows, err := p.db.Query(ctx, `
+    SELECT
+      id, email, first_name,
+      last_name, username, created_at, updated_at, roles
+    FROM users
+    WHERE id = ANY($1)
+      OR username = ANY($2)
+      OR email = ANY($3::text[]::citext[]);
+	`, ids, query.Usernames, query.Emails)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	users := []*usecase.User{}
+	for rows.Next() {
+		user := &usecase.User{}
+		if err := rowToEntity(rows, user); err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+	return users, rows.Err()
+}
+
 // Checks if User's credentials are OK
+// ErrCredentialsDontMatch is returned when the user doesn't exist
+// or the password doesn't match
 func (p *PgStore) CheckIfCorrectPassword(ctx context.Context,
 	data *usecase.CheckUserAndPasswordDto) error {
 	if data.Email == "" {
@@ -209,16 +302,23 @@ func (p *PgStore) checkPasswordMatch(ctx context.Context,
 	if err != nil {
 		return wrapErrorInfo(err, "Error while checking password", "UserStore")
 	}
-	if user.Id == "" {
+	if user == nil || user.Id == "" {
 		return fmt.Errorf(errMsgCheckPasswordMatch, usecase.ErrCredentialsDontMatch)
 	}
 
 	var hashedPassword []byte
-	p.db.QueryRow(ctx,
-		"SELECT password FROM users WHERE (email = $1 OR username = $2)",
-		emailOrUsername, emailOrUsername).Scan(&hashedPassword)
+	err = p.db.QueryRow(ctx,
+		"SELECT password FROM users WHERE id = $1", user.Id,
+	).Scan(&hashedPassword)
+	if err != nil {
+		return wrapErrorInfo(err, "Error while checking password", "UserStore")
+	}
 
-	return bcrypt.CompareHashAndPassword(hashedPassword, []byte(password))
+	err = bcrypt.CompareHashAndPassword(hashedPassword, []byte(password))
+	if err != nil {
+		return fmt.Errorf(errMsgCheckPasswordMatch, usecase.ErrCredentialsDontMatch)
+	}
+	return nil
 }
 
 func (p *PgStore) userByEmail(ctx context.Context,
@@ -249,22 +349,11 @@ func (p *PgStore) userByUsername(ctx context.Context,
 	return user, nil
 }
 
-func (p *PgStore) userById(ctx context.Context,
-	id string) (*usecase.User, error) {
-	rawUser := p.db.QueryRow(ctx, p.statementByField("id"), id)
-	user := &usecase.User{}
-	err := rowToEntity(rawUser, user)
-	if err != nil {
-		return nil, err
-	}
-	return user, nil
-}
-
 func (p *PgStore) statementByField(filter string) string {
 	return fmt.Sprintf(`
     SELECT
       id, email, first_name,
-      last_name, username, created_at, updated_at
+      last_name, username, created_at, updated_at, roles
     FROM users WHERE %s = $1;
 	`, filter)
 }
@@ -272,7 +361,7 @@ func (p *PgStore) statementByField(filter string) string {
 func rowToEntity(rawUser pgx.Row, user *usecase.User) error {
 	return rawUser.Scan(&user.Id, &user.Email, &user.FirstName,
 		&user.LastName, &user.Username,
-		&user.CreatedAt, &user.UpdatedAt)
+		&user.CreatedAt, &user.UpdatedAt, &user.Roles)
 }
 
 func buildColumsAndValuesSlices(data *usecase.UpdateUserDto,
@@ -305,6 +394,16 @@ func buildColumsAndValuesSlices(data *usecase.UpdateUserDto,
 	return updates, params
 }
 
+// mapUniqueViolation maps the violation of the email's or username's
+// unique constraints to ErrEmailOrUsernameAlreadyInUse
+func mapUniqueViolation(err error) error {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == uniqueViolationCode {
+		return wrapErrorInfo(usecase.ErrEmailOrUsernameAlreadyInUse, pgErr.Detail, "user")
+	}
+	return err
+}
+
 func wrapErrorInfo(err error, msg string, store string) error {
 	return fmt.Errorf("%w - %s store: %s \n", err, store, msg)
 }
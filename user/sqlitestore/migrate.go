@@ -0,0 +1,76 @@
+package sqlitestore
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"time"
+)
+
+// migrations are applied in lexical order of their file names,
+// each of them only once
+//
+//go:embed migrations/*.sql
+var migrations embed.FS
+
+const createMigrationsTable = `
+  CREATE TABLE IF NOT EXISTS schema_migrations (
+    version    TEXT NOT NULL PRIMARY KEY,
+    applied_at INTEGER NOT NULL
+  );
+`
+
+func migrate(ctx context.Context, db *sql.DB) error {
+	_, err := db.ExecContext(ctx, createMigrationsTable)
+	if err != nil {
+		return err
+	}
+	entries, err := fs.ReadDir(migrations, "migrations")
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if err := applyMigration(ctx, db, entry.Name()); err != nil {
+			return fmt.Errorf("migration %s: %w", entry.Name(), err)
+		}
+	}
+	return nil
+}
+
+func applyMigration(ctx context.Context, db *sql.DB, name string) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+	var applied int
+	err = tx.QueryRowContext(ctx,
+		"SELECT COUNT(*) FROM schema_migrations WHERE version = ?", name,
+	).Scan(&applied)
+	if err != nil {
+		return err
+	}
+	if applied > 0 {
+		return nil
+	}
+	statements, err := migrations.ReadFile("migrations/" + name)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, string(statements))
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx,
+		"INSERT INTO schema_migrations (version, applied_at) VALUES (?, ?)",
+		name, time.Now().UnixNano(),
+	)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
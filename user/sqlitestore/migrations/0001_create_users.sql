@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS users (
+  id         TEXT NOT NULL PRIMARY KEY,
+  email      TEXT NOT NULL UNIQUE COLLATE NOCASE CHECK (email <> ''),
+  username   TEXT UNIQUE CHECK (username <> ''),
+  password   TEXT NOT NULL CHECK (password <> ''),
+  first_name TEXT NOT NULL CHECK (first_name <> ''),
+  last_name  TEXT NOT NULL CHECK (last_name <> ''),
+  -- timestamps are stored as unix nanoseconds
+  created_at INTEGER NOT NULL,
+  updated_at INTEGER NOT NULL
+);
@@ -0,0 +1,2 @@
+-- roles are stored comma-separated, they're granted by the operators
+ALTER TABLE users ADD COLUMN roles TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,341 @@
+// Defines the Storage details associated with an User, with SQLite
+// It's meant for single-node deployments, where running Postgres is too heavy
+package sqlitestore
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/mountolive/back-blog-go/user/usecase"
+	"golang.org/x/crypto/bcrypt"
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// selectColumns are the columns needed for building an User,
+// in the same order expected by rowToEntity
+const selectColumns = `
+      id, email, first_name,
+      last_name, username, created_at, updated_at, roles`
+
+// connectionPragmas are set on the connection when it's opened
+const connectionPragmas = "_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)"
+
+var (
+	ConnectionError = errors.New("error occurred when opening the SQLite DB")
+	MigrationError  = errors.New("error occurred when trying to migrate the DB")
+)
+
+// Store implementation that uses SQLite for persistence,
+// all operations go through a single connection
+type SQLiteStore struct {
+	db *sql.DB
+}
+
+var _ usecase.UserStore = &SQLiteStore{}
+
+// NewUserSQLiteStore opens the SQLite DB at path, applying the pending
+// migrations. ":memory:" can be used for a transient DB
+func NewUserSQLiteStore(ctx context.Context, path string) (*SQLiteStore, error) {
+	separator := "?"
+	if strings.Contains(path, "?") {
+		separator = "&"
+	}
+	db, err := sql.Open("sqlite", path+separator+connectionPragmas)
+	if err != nil {
+		return nil, wrapErrorInfo(ConnectionError, err.Error(), "user")
+	}
+	// a single connection avoids SQLITE_BUSY errors between writers,
+	// and keeps in-memory DBs alive
+	db.SetMaxOpenConns(1)
+	db.SetConnMaxLifetime(0)
+	if err := db.PingContext(ctx); err != nil {
+		return nil, wrapErrorInfo(ConnectionError, err.Error(), "user")
+	}
+	if err := migrate(ctx, db); err != nil {
+		return nil, wrapErrorInfo(MigrationError, err.Error(), "user")
+	}
+	return &SQLiteStore{db}, nil
+}
+
+// Creates an User and returns it (UserDto)
+func (s *SQLiteStore) Create(ctx context.Context,
+	data *usecase.CreateUserDto) (*usecase.User, error) {
+	hashedPass, err := bcrypt.GenerateFromPassword([]byte(data.Password), 10)
+	if err != nil {
+		return nil, fmt.Errorf("error while trying to hash password: %s", err)
+	}
+	id, err := newID()
+	if err != nil {
+		return nil, err
+	}
+	var username interface{}
+	if data.Username != "" {
+		username = data.Username
+	}
+	now := time.Now().UnixNano()
+	row := s.db.QueryRowContext(ctx, fmt.Sprintf(`
+    INSERT INTO users
+      (id, email, password, first_name, last_name, username, created_at, updated_at)
+    VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+    RETURNING %s;
+  `, selectColumns),
+		id, data.Email, string(hashedPass), data.FirstName, data.LastName,
+		username, now, now,
+	)
+	user := &usecase.User{}
+	if err := rowToEntity(row, user); err != nil {
+		return nil, mapUniqueViolation(err)
+	}
+	return user, nil
+}
+
+// Updates the data associated to an User
+// and returns the corresponding UserDto. Empty fields are left untouched
+func (s *SQLiteStore) Update(ctx context.Context, id string,
+	data *usecase.UpdateUserDto) (*usecase.User, error) {
+	updates, params := buildColumsAndValuesSlices(data, id)
+	row := s.db.QueryRowContext(ctx, fmt.Sprintf(`
+    UPDATE users
+    SET %s
+    WHERE id = ?
+    RETURNING %s;
+  `, strings.Join(updates, ", "), selectColumns), params...)
+	user := &usecase.User{}
+	err := rowToEntity(row, user)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, wrapErrorInfo(usecase.ErrUserNotFound, id, "user")
+		}
+		return nil, mapUniqueViolation(err)
+	}
+	return user, nil
+}
+
+// Updates a given User's Password, as long as the old one matches
+func (s *SQLiteStore) UpdatePassword(ctx context.Context,
+	data *usecase.ChangePasswordDto) error {
+	checker := &usecase.CheckUserAndPasswordDto{
+		Email:    data.Email,
+		Username: data.Username,
+		Password: data.OldPassword,
+	}
+	err := s.CheckIfCorrectPassword(ctx, checker)
+	if err != nil {
+		return err
+	}
+	newPassHashed, err := bcrypt.GenerateFromPassword([]byte(data.NewPassword), 10)
+	if err != nil {
+		return err
+	}
+	field, value := lookupField(data.Email, data.Username)
+	_, err = s.db.ExecContext(ctx, fmt.Sprintf(`
+      UPDATE users
+      SET password = ?, updated_at = ?
+      WHERE %s = ?;
+  `, field), string(newPassHashed), time.Now().UnixNano(), value)
+	return err
+}
+
+// Retrieves a single User through its Username or Email,
+// nil is returned when there's no such User
+func (s *SQLiteStore) ReadOne(ctx context.Context,
+	query *usecase.ByUsernameOrEmail) (*usecase.User, error) {
+	field, value := lookupField(query.Email, query.Username)
+	row := s.db.QueryRowContext(ctx, fmt.Sprintf(
+		"SELECT %s FROM users WHERE %s = ?;", selectColumns, field,
+	), value)
+	user := &usecase.User{}
+	err := rowToEntity(row, user)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return user, nil
+}
+
+// Retrieves a single User through its Id,
+// nil is returned when there's no such User
+func (s *SQLiteStore) ReadByID(ctx context.Context, id string) (*usecase.User, error) {
+	row := s.db.QueryRowContext(ctx, fmt.Sprintf(
+		"SELECT %s FROM users WHERE id = ?;", selectColumns,
+	), id)
+	user := &usecase.User{}
+	err := rowToEntity(row, user)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return user, nil
+}
+
+// Retrieves the Users with any of the ids, usernames or emails passed,
+// in a single query
+func (s *SQLiteStore) ReadMany(ctx context.Context,
+	query *usecase.ByIDsOrLogins) ([]*usecase.User, error) {
+	conditions := []string{}
+	params := []interface{}{}
+	for _, filter := range []struct {
+		field  string
+		values []string
+	}{
+		{"id", query.IDs},
+		{"username", query.Usernames},
+		{"email", query.Emails},
+	} {
+		if len(filter.values) == 0 {
+			continue
+		}
+		placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(filter.values)), ", ")
+		conditions = append(conditions, fmt.Sprintf("%s IN (%s)", filter.field, placeholders))
+		for _, value := range filter.values {
+			params = append(params, value)
+		}
+	}
+	users := []*usecase.User{}
+	if len(conditions) == 0 {
+		return users, nil
+	}
+	rows, err := s.db.QueryContext(ctx, fmt.Sprintf(
+		"SELECT %s FROM users WHERE %s;", selectColumns, strings.Join(conditions, " OR "),
+	), params...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		user := &usecase.User{}
+		if err := rowToEntity(rows, user); err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+	return users, rows.Err()
+}
+
+const errMsgCheckPasswordMatch = "user sqlite_store check password match: %w"
+
+// Checks if User's credentials are OK
+// ErrCredentialsDontMatch is returned when the user doesn't exist
+// or the password doesn't match
+func (s *SQLiteStore) CheckIfCorrectPassword(ctx context.Context,
+	data *usecase.CheckUserAndPasswordDto) error {
+	field, value := lookupField(data.Email, data.Username)
+	var hashedPassword string
+	err := s.db.QueryRowContext(ctx, fmt.Sprintf(
+		"SELECT password FROM users WHERE %s = ?;", field,
+	), value).Scan(&hashedPassword)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf(errMsgCheckPasswordMatch, usecase.ErrCredentialsDontMatch)
+		}
+		return wrapErrorInfo(err, "Error while checking password", "UserStore")
+	}
+	err = bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(data.Password))
+	if err != nil {
+		return fmt.Errorf(errMsgCheckPasswordMatch, usecase.ErrCredentialsDontMatch)
+	}
+	return nil
+}
+
+// lookupField returns the field an User is looked up by: the email,
+// or the username if the former is empty
+func lookupField(email, username string) (string, string) {
+	if email == "" {
+		return "username", username
+	}
+	return "email", email
+}
+
+// scanner is either a *sql.Row or *sql.Rows
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func rowToEntity(rawUser scanner, user *usecase.User) error {
+	var username sql.NullString
+	var createdAt, updatedAt int64
+	var roles string
+	err := rawUser.Scan(&user.Id, &user.Email, &user.FirstName,
+		&user.LastName, &username,
+		&createdAt, &updatedAt, &roles)
+	if err != nil {
+		return err
+	}
+	user.Roles = splitRoles(roles)
+	user.Username = username.String
+	user.CreatedAt = time.Unix(0, createdAt)
+	user.UpdatedAt = time.Unix(0, updatedAt)
+	return nil
+}
+
+// splitRoles parses the roles of an User, stored comma-separated
+func splitRoles(raw string) []string {
+	roles := []string{}
+	for _, role := range strings.Split(raw, ",") {
+		if role = strings.TrimSpace(role); role != "" {
+			roles = append(roles, role)
+		}
+	}
+	return roles
+}
+
+func buildColumsAndValuesSlices(data *usecase.UpdateUserDto,
+	id string) ([]string, []interface{}) {
+	updates := []string{}
+	params := make([]interface{}, 0)
+
+	if data.Email != "" {
+		updates = append(updates, "email = ?")
+		params = append(params, data.Email)
+	}
+	if data.Username != "" {
+		updates = append(updates, "username = ?")
+		params = append(params, data.Username)
+	}
+	if data.FirstName != "" {
+		updates = append(updates, "first_name = ?")
+		params = append(params, data.FirstName)
+	}
+	if data.LastName != "" {
+		updates = append(updates, "last_name = ?")
+		params = append(params, data.LastName)
+	}
+	updates = append(updates, "updated_at = ?")
+	params = append(params, time.Now().UnixNano(), id)
+	return updates, params
+}
+
+// mapUniqueViolation maps the violation of the email's or username's
+// unique constraints to ErrEmailOrUsernameAlreadyInUse
+func mapUniqueViolation(err error) error {
+	var sqliteErr *sqlite.Error
+	if errors.As(err, &sqliteErr) && sqliteErr.Code() == sqlite3.SQLITE_CONSTRAINT_UNIQUE {
+		return wrapErrorInfo(usecase.ErrEmailOrUsernameAlreadyInUse, sqliteErr.Error(), "user")
+	}
+	return err
+}
+
+// newID returns a random (version 4) UUID
+func newID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:]), nil
+}
+
+func wrapErrorInfo(err error, msg string, store string) error {
+	return fmt.Errorf("%w - %s sqlite store: %s \n", err, store, msg)
+}
@@ -0,0 +1,33 @@
+package sqlitestore
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/mountolive/back-blog-go/user/storetest"
+	"github.com/mountolive/back-blog-go/user/usecase"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSQLiteStore(t *testing.T) {
+	t.Run("Canary", func(t *testing.T) {
+		var _ usecase.UserStore = &SQLiteStore{}
+	})
+
+	path := filepath.Join(t.TempDir(), "users.db")
+	store, err := NewUserSQLiteStore(context.Background(), path)
+	require.NoError(t, err, "Error opening the store %s", err)
+
+	storetest.Run(t, store)
+
+	t.Run("Reopen", func(t *testing.T) {
+		reopened, err := NewUserSQLiteStore(context.Background(), path)
+		require.NoError(t, err, "Migrations should be applied only once %s", err)
+		found, err := reopened.ReadOne(
+			context.Background(), &usecase.ByUsernameOrEmail{Username: "everlong"},
+		)
+		require.NoError(t, err, "An error occurred in ReadOne: %s", err)
+		require.NotNil(t, found, "Users should persist after reopening the store")
+	})
+}
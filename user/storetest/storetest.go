@@ -0,0 +1,394 @@
+// Defines the contract every usecase.UserStore implementation should honor,
+// as a test suite to be run against each of them
+package storetest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/mountolive/back-blog-go/user/usecase"
+	"github.com/stretchr/testify/require"
+)
+
+const genericErr = "Got: %s \n Expected: %s"
+
+// Run executes the contract's suite against the passed store
+// The store should be empty, as the suite relies on the emails and
+// usernames it creates
+func Run(t *testing.T, store usecase.UserStore) {
+	t.Run("Create", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		data := &usecase.CreateUserDto{
+			Email:     "abc@gmail.com",
+			Password:  "test123456",
+			Username:  "everlong",
+			FirstName: "hello",
+			LastName:  "breathout",
+		}
+		result, err := store.Create(ctx, data)
+		require.True(t, err == nil, "An error was returned %s", err)
+		require.True(t, result != nil, "No instance was returned from create")
+		require.True(t, result.Id != "", "User's Id was not properly created")
+		require.True(t, result.Email == data.Email, genericErr, result.Email, data.Email)
+		require.True(t, result.Username == data.Username, genericErr, result.Username, data.Username)
+		require.True(t, result.FirstName == data.FirstName,
+			genericErr, result.FirstName, data.FirstName)
+		require.True(t, result.LastName == data.LastName, genericErr, result.LastName, data.LastName)
+		require.False(t, result.CreatedAt.IsZero(), "CreatedAt should have been set")
+		require.False(t, result.UpdatedAt.IsZero(), "UpdatedAt should have been set")
+		require.Empty(t, result.Roles, "No roles should have been granted")
+		found, err := store.ReadOne(ctx, &usecase.ByUsernameOrEmail{Email: data.Email})
+		require.True(t, err == nil, "An error was returned on read %s", err)
+		require.True(t, found != nil, "Created user should be readable")
+		require.True(t, found.Id == result.Id, genericErr, found.Id, result.Id)
+	})
+
+	t.Run("Create already in use", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		sameEmail := &usecase.CreateUserDto{
+			Email:     "ABC@gmail.com",
+			Password:  "test123456",
+			Username:  "monkeywrench",
+			FirstName: "hello",
+			LastName:  "breathout",
+		}
+		_, err := store.Create(ctx, sameEmail)
+		require.True(t, errors.Is(err, usecase.ErrEmailOrUsernameAlreadyInUse),
+			genericErr, err, usecase.ErrEmailOrUsernameAlreadyInUse)
+
+		sameUsername := &usecase.CreateUserDto{
+			Email:     "other@gmail.com",
+			Password:  "test123456",
+			Username:  "everlong",
+			FirstName: "hello",
+			LastName:  "breathout",
+		}
+		_, err = store.Create(ctx, sameUsername)
+		require.True(t, errors.Is(err, usecase.ErrEmailOrUsernameAlreadyInUse),
+			genericErr, err, usecase.ErrEmailOrUsernameAlreadyInUse)
+	})
+
+	t.Run("Concurrent Create", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		users := []*usecase.CreateUserDto{
+			{
+				Email:     "concurrent_one@gmail.com",
+				Password:  "test123456",
+				Username:  "concurrent_one",
+				FirstName: "Kim",
+				LastName:  "Deal",
+			},
+			{
+				Email:     "concurrent_two@gmail.com",
+				Password:  "test123456",
+				Username:  "concurrent_two",
+				FirstName: "Black",
+				LastName:  "Francis",
+			},
+		}
+		results := make([]*usecase.User, len(users))
+		errs := make([]error, len(users))
+		var wg sync.WaitGroup
+		for i, user := range users {
+			wg.Add(1)
+			go func(i int, user *usecase.CreateUserDto) {
+				defer wg.Done()
+				results[i], errs[i] = store.Create(ctx, user)
+			}(i, user)
+		}
+		wg.Wait()
+		for i, user := range users {
+			require.True(t, errs[i] == nil, "An error was returned %s", errs[i])
+			require.True(t, results[i] != nil, "No instance was returned from create")
+			require.True(t, results[i].Email == user.Email, genericErr,
+				results[i].Email, user.Email)
+			require.True(t, results[i].Username == user.Username, genericErr,
+				results[i].Username, user.Username)
+		}
+		require.True(t, results[0].Id != results[1].Id, "User's Ids should be different")
+	})
+
+	t.Run("Update", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		baseUser := &usecase.CreateUserDto{
+			Email:     "test_update@gmail.com",
+			Password:  "test123456",
+			Username:  "test_update",
+			FirstName: "test",
+			LastName:  "test",
+		}
+		createResult, err := store.Create(ctx, baseUser)
+		require.True(t, err == nil, "An error was returned on create: %s", err)
+		require.True(t, createResult != nil, "No instance was returned from create")
+		require.True(t, createResult.Id != "", "User's Id was not properly created")
+
+		data := &usecase.UpdateUserDto{
+			Email:     "somethingelse@gmail.com",
+			Username:  "hello",
+			FirstName: "this",
+			LastName:  "is it",
+		}
+		result, err := store.Update(ctx, createResult.Id, data)
+		require.True(t, err == nil, "An error was returned on update: %s", err)
+		require.True(t, result != nil, "No instance was returned from update")
+		require.True(t, result.Email == data.Email, genericErr, result.Email, data.Email)
+		require.True(t, result.Username == data.Username, genericErr, result.Username, data.Username)
+		require.True(t, result.FirstName == data.FirstName,
+			genericErr, result.FirstName, data.FirstName)
+		require.True(t, result.LastName == data.LastName, genericErr, result.LastName, data.LastName)
+		require.False(t, result.CreatedAt.IsZero(), "CreatedAt should have been set")
+		require.False(t, result.UpdatedAt.IsZero(), "UpdatedAt should have been set")
+		require.True(t, result.CreatedAt.Before(result.UpdatedAt), "UpdatedAt date was not updated")
+
+		old, err := store.ReadOne(ctx, &usecase.ByUsernameOrEmail{Email: baseUser.Email})
+		require.True(t, err == nil, "An error was returned on read: %s", err)
+		require.True(t, old == nil, "Old email shouldn't find any user")
+
+		partial := &usecase.UpdateUserDto{FirstName: "only"}
+		result, err = store.Update(ctx, createResult.Id, partial)
+		require.True(t, err == nil, "An error was returned on partial update: %s", err)
+		require.True(t, result.FirstName == partial.FirstName,
+			genericErr, result.FirstName, partial.FirstName)
+		require.True(t, result.Email == data.Email, genericErr, result.Email, data.Email)
+	})
+
+	t.Run("Update already in use", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		baseUser := &usecase.CreateUserDto{
+			Email:     "test_taken@gmail.com",
+			Password:  "test123456",
+			Username:  "test_taken",
+			FirstName: "test",
+			LastName:  "test",
+		}
+		created, err := store.Create(ctx, baseUser)
+		require.True(t, err == nil, "An error was returned on create: %s", err)
+
+		data := &usecase.UpdateUserDto{Username: "everlong"}
+		result, err := store.Update(ctx, created.Id, data)
+		require.True(t, errors.Is(err, usecase.ErrEmailOrUsernameAlreadyInUse),
+			genericErr, err, usecase.ErrEmailOrUsernameAlreadyInUse)
+		require.True(t, result == nil, "No instance should be returned from update")
+	})
+
+	t.Run("Update not found", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		data := &usecase.UpdateUserDto{FirstName: "nobody"}
+		result, err := store.Update(ctx, "3bd5e1f4-8a3d-4b5e-9a57-0f0c7b0f1d2a", data)
+		require.True(t, errors.Is(err, usecase.ErrUserNotFound),
+			genericErr, err, usecase.ErrUserNotFound)
+		require.True(t, result == nil, "No instance should be returned from update")
+	})
+
+	t.Run("UpdatePassword CheckIfCorrectPassword", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		baseUser := &usecase.CreateUserDto{
+			Email:     "test_password@gmail.com",
+			Password:  "test123456",
+			Username:  "test_password",
+			FirstName: "test",
+			LastName:  "test",
+		}
+		createResult, err := store.Create(ctx, baseUser)
+		require.True(t, err == nil, "An error was returned on create: %s", err)
+		require.True(t, createResult != nil, "No instance was returned from create")
+		require.True(t, createResult.Id != "", "User's Id was not properly created")
+
+		first := &usecase.ChangePasswordDto{
+			Email:            "test_password@gmail.com",
+			NewPassword:      "new123456",
+			RepeatedPassword: "new123456",
+			OldPassword:      "test123456",
+		}
+		err = store.UpdatePassword(ctx, first)
+		require.True(t, err == nil, "An error was returned on update password, first: %s", err)
+
+		firstChecker := &usecase.CheckUserAndPasswordDto{
+			Email:    "test_password@gmail.com",
+			Username: "test_password",
+			Password: "new123456",
+		}
+		err = store.CheckIfCorrectPassword(ctx, firstChecker)
+		require.True(t, err == nil, "An error was returned on first check for password: %s", err)
+
+		second := &usecase.ChangePasswordDto{
+			Username:         "test_password",
+			NewPassword:      "evenNewer123456",
+			RepeatedPassword: "evenNewer123456",
+			OldPassword:      "new123456",
+		}
+		err = store.UpdatePassword(ctx, second)
+		require.True(t, err == nil, "An error was returned on update password, second: %s", err)
+
+		secondChecker := &usecase.CheckUserAndPasswordDto{
+			Email:    "test_password@gmail.com",
+			Username: "test_password",
+			Password: "evenNewer123456",
+		}
+		err = store.CheckIfCorrectPassword(ctx, secondChecker)
+		require.True(t, err == nil, "An error was returned on second check for password: %s", err)
+
+		wrongOld := &usecase.ChangePasswordDto{
+			Username:         "test_password",
+			NewPassword:      "hijacked123456",
+			RepeatedPassword: "hijacked123456",
+			OldPassword:      "new123456",
+		}
+		err = store.UpdatePassword(ctx, wrongOld)
+		require.True(t, errors.Is(err, usecase.ErrCredentialsDontMatch),
+			genericErr, err, usecase.ErrCredentialsDontMatch)
+	})
+
+	t.Run("CheckIfCorrectPassword not matching", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		wrongPassword := &usecase.CheckUserAndPasswordDto{
+			Username: "everlong",
+			Password: "wrong123456",
+		}
+		err := store.CheckIfCorrectPassword(ctx, wrongPassword)
+		require.True(t, errors.Is(err, usecase.ErrCredentialsDontMatch),
+			genericErr, err, usecase.ErrCredentialsDontMatch)
+
+		unknownUser := &usecase.CheckUserAndPasswordDto{
+			Email:    "nobody@gmail.com",
+			Password: "test123456",
+		}
+		err = store.CheckIfCorrectPassword(ctx, unknownUser)
+		require.True(t, errors.Is(err, usecase.ErrCredentialsDontMatch),
+			genericErr, err, usecase.ErrCredentialsDontMatch)
+	})
+
+	t.Run("ReadOne", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		baseUser := &usecase.CreateUserDto{
+			Email:     "test_read@gmail.com",
+			Password:  "test123456",
+			Username:  "test_read",
+			FirstName: "test",
+			LastName:  "test",
+		}
+		created, err := store.Create(ctx, baseUser)
+		require.True(t, err == nil, "An error was returned on create: %s", err)
+		require.True(t, created != nil, "No instance was returned from create")
+		require.True(t, created.Id != "", "User's Id was not properly created")
+
+		firstChecker := &usecase.ByUsernameOrEmail{
+			Email: "test_read@gmail.com",
+		}
+		result, err := store.ReadOne(ctx, firstChecker)
+		require.True(t, err == nil, "An error occurred while executing ReadOne, first: %s", err)
+		require.True(t, result != nil, "No instance was returned from read, first")
+		require.True(t, created.Id == result.Id, "User's Id was not properly created")
+		require.True(t, result.Email == created.Email, genericErr, result.Email, created.Email)
+		require.True(t, result.Username == created.Username, genericErr,
+			result.Username, created.Username)
+
+		secondChecker := &usecase.ByUsernameOrEmail{
+			Username: "test_read",
+		}
+		result, err = store.ReadOne(ctx, secondChecker)
+		require.True(t, err == nil, "An error occurred while executing ReadOne, second: %s", err)
+		require.True(t, result != nil, "No instance was returned from read, second", err)
+		require.True(t, created.Id == result.Id, "User's Id was not properly created")
+		require.True(t, result.Email == created.Email, genericErr, result.Email, created.Email)
+		require.True(t, result.Username == created.Username, genericErr,
+			result.Username, created.Username)
+
+		caseChecker := &usecase.ByUsernameOrEmail{
+			Email: "TEST_READ@gmail.com",
+		}
+		result, err = store.ReadOne(ctx, caseChecker)
+		require.True(t, err == nil, "An error occurred while executing ReadOne, case: %s", err)
+		require.True(t, result != nil, "Emails should be case insensitive")
+
+		missingChecker := &usecase.ByUsernameOrEmail{
+			Username: "nobody",
+		}
+		result, err = store.ReadOne(ctx, missingChecker)
+		require.True(t, err == nil, "An error occurred while executing ReadOne, missing: %s", err)
+		require.True(t, result == nil, "No instance should be returned from read, missing")
+	})
+	t.Run("ReadByID", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		created, err := store.Create(ctx, &usecase.CreateUserDto{
+			Email:     "test_read_id@gmail.com",
+			Password:  "test123456",
+			Username:  "test_read_id",
+			FirstName: "test",
+			LastName:  "test",
+		})
+		require.True(t, err == nil, "An error was returned on create: %s", err)
+		result, err := store.ReadByID(ctx, created.Id)
+		require.True(t, err == nil, "An error occurred while executing ReadByID: %s", err)
+		require.True(t, result != nil, "No instance was returned from read by id")
+		require.True(t, result.Username == created.Username, genericErr,
+			result.Username, created.Username)
+
+		renamed, err := store.Update(ctx, created.Id, &usecase.UpdateUserDto{
+			Email:     created.Email,
+			Username:  "test_read_id_renamed",
+			FirstName: created.FirstName,
+			LastName:  created.LastName,
+		})
+		require.True(t, err == nil, "An error was returned on update: %s", err)
+		result, err = store.ReadByID(ctx, created.Id)
+		require.True(t, err == nil, "An error occurred while executing ReadByID, renamed: %s", err)
+		require.True(t, result != nil, "A renamed user should be readable by id")
+		require.True(t, result.Username == renamed.Username, genericErr,
+			result.Username, renamed.Username)
+
+		for _, id := range []string{"00000000-0000-0000-0000-000000000000", "not-an-id"} {
+			result, err = store.ReadByID(ctx, id)
+			require.True(t, err == nil, "An error occurred while executing ReadByID, %s: %s", id, err)
+			require.True(t, result == nil, "No instance should be returned from read, %s", id)
+		}
+	})
+	t.Run("ReadMany", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		created := make([]*usecase.User, 3)
+		for i := range created {
+			user, err := store.Create(ctx, &usecase.CreateUserDto{
+				Email:     fmt.Sprintf("test_read_many_%d@gmail.com", i),
+				Password:  "test123456",
+				Username:  fmt.Sprintf("test_read_many_%d", i),
+				FirstName: "test",
+				LastName:  "test",
+			})
+			require.True(t, err == nil, "An error was returned on create: %s", err)
+			created[i] = user
+		}
+		result, err := store.ReadMany(ctx, &usecase.ByIDsOrLogins{
+			IDs:       []string{created[0].Id, "00000000-0000-0000-0000-000000000000", "not-an-id"},
+			Usernames: []string{created[1].Username, created[0].Username, "nobody"},
+			Emails:    []string{"TEST_READ_MANY_2@gmail.com", "nobody@gmail.com"},
+		})
+		require.True(t, err == nil, "An error occurred while executing ReadMany: %s", err)
+		found := map[string]string{}
+		for _, user := range result {
+			found[user.Id] = user.Username
+		}
+		require.Len(t, result, 3, "Each user found should be returned once")
+		for _, user := range created {
+			require.True(t, found[user.Id] == user.Username, genericErr,
+				found[user.Id], user.Username)
+		}
+
+		result, err = store.ReadMany(ctx, &usecase.ByIDsOrLogins{Usernames: []string{"nobody"}})
+		require.True(t, err == nil, "An error occurred while executing ReadMany, missing: %s", err)
+		require.Empty(t, result, "No instance should be returned from read, missing")
+	})
+}
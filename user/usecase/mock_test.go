@@ -100,6 +100,28 @@ func (m *happyPathUserStoreMock) ReadOne(ctx context.Context, filter *ByUsername
 	return user, nil
 }
 
+func (m *happyPathUserStoreMock) ReadByID(ctx context.Context, id string) (*User, error) {
+	return &User{
+		Id:       id,
+		Email:    m.email,
+		Username: m.username,
+	}, nil
+}
+
+func (m *happyPathUserStoreMock) ReadMany(ctx context.Context, query *ByIDsOrLogins) ([]*User, error) {
+	users := []*User{}
+	for _, id := range query.IDs {
+		users = append(users, &User{Id: id, Email: m.email, Username: m.username})
+	}
+	for _, username := range query.Usernames {
+		users = append(users, &User{Id: username, Email: m.email, Username: username})
+	}
+	for _, email := range query.Emails {
+		users = append(users, &User{Id: email, Email: email, Username: m.username})
+	}
+	return users, nil
+}
+
 func (m *happyPathUserStoreMock) CheckIfCorrectPassword(ctx context.Context, d *CheckUserAndPasswordDto) error {
 	return nil
 }
@@ -123,6 +145,14 @@ func (m *erroredUserStoreMock) ReadOne(ctx context.Context, filter *ByUsernameOr
 	return nil, errors.New("Something happened")
 }
 
+func (m *erroredUserStoreMock) ReadByID(ctx context.Context, id string) (*User, error) {
+	return nil, errors.New("Something happened")
+}
+
+func (m *erroredUserStoreMock) ReadMany(ctx context.Context, query *ByIDsOrLogins) ([]*User, error) {
+	return nil, errors.New("Something happened")
+}
+
 func (m *erroredUserStoreMock) CheckIfCorrectPassword(ctx context.Context, d *CheckUserAndPasswordDto) error {
 	return ErrUserPasswordNotMatching
 }
@@ -3,12 +3,17 @@ package usecase
 
 import (
 	"context"
+	"crypto/md5"
 	"errors"
 	"fmt"
 	"net/mail"
+	"strings"
 	"time"
 )
 
+// User entity representation
+//    Roles are granted by the operators, straight on the store;
+//    they're read by the other services for their own policies
 type User struct {
 	CreatedAt time.Time
 	UpdatedAt time.Time
@@ -17,6 +22,27 @@ type User struct {
 	Username  string
 	FirstName string
 	LastName  string
+	Roles     []string
+}
+
+// avatarURLFormat is Gravatar's, falling back to an identicon
+// for the emails that have no avatar
+const avatarURLFormat = "https://www.gravatar.com/avatar/%x?d=identicon"
+
+// DisplayName is the user's full name, or the username
+// when the user has no names
+func (u *User) DisplayName() string {
+	name := strings.TrimSpace(u.FirstName + " " + u.LastName)
+	if name == "" {
+		return u.Username
+	}
+	return name
+}
+
+// AvatarURL is the URL of the avatar associated with the user's email
+func (u *User) AvatarURL() string {
+	email := strings.ToLower(strings.TrimSpace(u.Email))
+	return fmt.Sprintf(avatarURLFormat, md5.Sum([]byte(email)))
 }
 
 type CreateUserDto struct {
@@ -54,6 +80,14 @@ type ByUsernameOrEmail struct {
 	Email string
 }
 
+// ByIDsOrLogins looks up many users at once, the ones matching
+// any of the IDs, Usernames or Emails
+type ByIDsOrLogins struct {
+	IDs,
+	Usernames,
+	Emails []string
+}
+
 type LoginDTO struct {
 	Email,
 	Username,
@@ -79,8 +113,28 @@ var (
 	ErrCorruptedStore = errors.New(
 		"user' store used is returning inconsistent results")
 	ErrCredentialsDontMatch = errors.New("credentials passed don't match")
+	ErrTooManyUsers         = errors.New(
+		"too many users looked up at once")
 )
 
+// ValidationError tells the field of the input that failed to be
+// validated, wrapping the validator's error
+type ValidationError struct {
+	Field string
+	Err   error
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("%s: %v", e.Field, e.Err)
+}
+
+func (e *ValidationError) Unwrap() error {
+	return e.Err
+}
+
+// MaxUsersPerLookup bounds the IDs and logins looked up by ReadUsers
+const MaxUsersPerLookup = 500
+
 const unknownErrorInStore = "Found reported from store: %s and %s, but wrong dto returned"
 
 // Contract for the needs of the repository in terms of persistance:
@@ -90,6 +144,9 @@ type UserStore interface {
 	Update(context.Context, string, *UpdateUserDto) (*User, error)
 	UpdatePassword(context.Context, *ChangePasswordDto) error
 	ReadOne(context.Context, *ByUsernameOrEmail) (*User, error)
+	ReadByID(context.Context, string) (*User, error)
+	// ReadMany returns the users found, in no particular order
+	ReadMany(context.Context, *ByIDsOrLogins) ([]*User, error)
 	CheckIfCorrectPassword(context.Context, *CheckUserAndPasswordDto) error
 }
 
@@ -120,6 +177,8 @@ type UserValidator interface {
 // Repository defines the basic usecases for the users' domain
 type Repository interface {
 	ReadUser(ctx context.Context, loginCred string) (*User, error)
+	ReadUserByID(ctx context.Context, id string) (*User, error)
+	ReadUsers(ctx context.Context, ids, logins []string) ([]*User, error)
 	ChangePassword(ctx context.Context, changePass *ChangePasswordDto) error
 	CreateUser(ctx context.Context, user *CreateUserDto) (*User, error)
 	UpdateUser(ctx context.Context, id string, user *UpdateUserDto) (*User, error)
@@ -176,6 +235,38 @@ func (r *UserRepository) ReadUser(
 	return r.Store.ReadOne(ctx, &ByUsernameOrEmail{Email: loginCred})
 }
 
+// Reads an user by her Id, which doesn't change as her Username does
+func (r *UserRepository) ReadUserByID(ctx context.Context, id string) (*User, error) {
+	return r.Store.ReadByID(ctx, id)
+}
+
+// Reads the users with any of the ids, usernames or emails passed, in a
+// single lookup; the ones not found are left out. ErrTooManyUsers is
+// returned when more than MaxUsersPerLookup are passed
+func (r *UserRepository) ReadUsers(
+	ctx context.Context,
+	ids, logins []string,
+) ([]*User, error) {
+	if len(ids)+len(logins) > MaxUsersPerLookup {
+		return nil, &ValidationError{
+			Field: "ids",
+			Err:   fmt.Errorf("%d ids and logins passed: %w", len(ids)+len(logins), ErrTooManyUsers),
+		}
+	}
+	query := &ByIDsOrLogins{IDs: ids}
+	for _, login := range logins {
+		if _, err := mail.ParseAddress(login); err != nil {
+			query.Usernames = append(query.Usernames, login)
+			continue
+		}
+		query.Emails = append(query.Emails, login)
+	}
+	if len(query.IDs)+len(query.Usernames)+len(query.Emails) == 0 {
+		return []*User{}, nil
+	}
+	return r.Store.ReadMany(ctx, query)
+}
+
 // Changes password and persists. Returns an error on validation or
 // store's retrieval/persistence
 func (r *UserRepository) ChangePassword(
@@ -184,7 +275,7 @@ func (r *UserRepository) ChangePassword(
 ) error {
 	err := r.Validator.ValidateEmail(changePass.Email)
 	if err != nil {
-		return logErrorAndWrap(err,
+		return logErrorAndWrap(&ValidationError{Field: "email", Err: err},
 			"An error occurred when validating the user's email, ChangePassword")
 	}
 	toCheck := &CheckUserAndPasswordDto{
@@ -196,7 +287,7 @@ func (r *UserRepository) ChangePassword(
 	if err != nil {
 		return logErrorAndWrap(err, "An error occurred on the UserStore, ChangePassword")
 	}
-	err = r.validatePasswords(changePass.NewPassword, changePass.RepeatedPassword)
+	err = r.validatePasswords("newPassword", changePass.NewPassword, changePass.RepeatedPassword)
 	if err != nil {
 		// This error is already wrapped by the validatePasswords function
 		return err
@@ -211,7 +302,7 @@ func (r *UserRepository) CreateUser(
 ) (*User, error) {
 	err := r.Validator.ValidateEmail(user.Email)
 	if err != nil {
-		return nil, logErrorAndWrap(err,
+		return nil, logErrorAndWrap(&ValidationError{Field: "email", Err: err},
 			"An error occurred when validating the user's email, CreateUser")
 	}
 	found, err := r.Store.ReadOne(ctx, &ByUsernameOrEmail{user.Username, user.Email})
@@ -225,7 +316,7 @@ func (r *UserRepository) CreateUser(
 		}
 		return nil, logErrorAndWrap(ErrEmailOrUsernameAlreadyInUse, "Existing user")
 	}
-	err = r.validatePasswords(user.Password, user.RepeatedPassword)
+	err = r.validatePasswords("password", user.Password, user.RepeatedPassword)
 	if err != nil {
 		// this error is already wrapped by the validatePasswords function
 		return nil, err
@@ -241,7 +332,7 @@ func (r *UserRepository) UpdateUser(
 ) (*User, error) {
 	err := r.Validator.ValidateEmail(user.Email)
 	if err != nil {
-		return nil, logErrorAndWrap(err,
+		return nil, logErrorAndWrap(&ValidationError{Field: "email", Err: err},
 			"An error occurred when validating the email, UpdateUser")
 	}
 	found, err := r.Store.ReadOne(ctx, &ByUsernameOrEmail{user.Username, user.Email})
@@ -273,14 +364,17 @@ func (r *UserRepository) mapMissingParams(user *UpdateUserDto, found *User) {
 	}
 }
 
-func (r *UserRepository) validatePasswords(password, repeatedPassword string) error {
+// validatePasswords validates the password passed as field
+func (r *UserRepository) validatePasswords(field, password, repeatedPassword string) error {
 	err := r.Validator.ValidatePassword(password)
 	if err != nil {
-		return logErrorAndWrap(err, "An error occurred on the validator")
+		return logErrorAndWrap(&ValidationError{Field: field, Err: err},
+			"An error occurred on the validator")
 	}
 	err = r.Validator.ValidatePasswordMatch(password, repeatedPassword)
 	if err != nil {
-		return logErrorAndWrap(err, "An error occurred on the validator")
+		return logErrorAndWrap(&ValidationError{Field: "repeatedPassword", Err: err},
+			"An error occurred on the validator")
 	}
 	return nil
 }
@@ -254,6 +254,56 @@ func TestUserRepository(t *testing.T) {
 		}
 	})
 
+	t.Run("Validation Errors", func(t *testing.T) {
+		dto := &CreateUserDto{
+			Email:            "ada@lovelace.com",
+			Username:         "ada",
+			Password:         "12345678j.",
+			RepeatedPassword: "12345678j.",
+		}
+		changePassword := &ChangePasswordDto{
+			Email:            "ada@lovelace.com",
+			OldPassword:      "12345678j.",
+			NewPassword:      "nope",
+			RepeatedPassword: "nope",
+		}
+		testCases := []struct {
+			name      string
+			validator UserValidator
+			call      func(*UserRepository) error
+			field     string
+		}{
+			{"Create Email", &falseValidatorEmail{}, func(r *UserRepository) error {
+				_, err := r.CreateUser(context.Background(), dto)
+				return err
+			}, "email"},
+			{"Create Password", &falseValidatorPassword{}, func(r *UserRepository) error {
+				_, err := r.CreateUser(context.Background(), dto)
+				return err
+			}, "password"},
+			{"Create Repeated Password", &falseValidatorPasswordsNotMatching{}, func(r *UserRepository) error {
+				_, err := r.CreateUser(context.Background(), dto)
+				return err
+			}, "repeatedPassword"},
+			{"Change Password", &falseValidatorPassword{}, func(r *UserRepository) error {
+				return r.ChangePassword(context.Background(), changePassword)
+			}, "newPassword"},
+			{"Update Email", &falseValidatorEmail{}, func(r *UserRepository) error {
+				_, err := r.UpdateUser(context.Background(), "1", &UpdateUserDto{Email: "bad"})
+				return err
+			}, "email"},
+		}
+		for _, tc := range testCases {
+			t.Run(tc.name, func(t *testing.T) {
+				repo := &UserRepository{Validator: tc.validator, Store: &happyPathUserStoreMock{}}
+				var validationErr *ValidationError
+				err := tc.call(repo)
+				require.True(t, errors.As(err, &validationErr), "Got: %v", err)
+				require.Equal(t, tc.field, validationErr.Field)
+			})
+		}
+	})
+
 	t.Run("Read User", func(t *testing.T) {
 		testLogin := "some@gmail.com"
 		validator := &trueValidator{}
@@ -286,6 +336,46 @@ func TestUserRepository(t *testing.T) {
 		}
 	})
 
+	t.Run("Read User By ID", func(t *testing.T) {
+		repo := &UserRepository{
+			Validator: &trueValidator{},
+			Store:     &happyPathUserStoreMock{"some@gmail.com", "some"},
+		}
+		user, err := repo.ReadUserByID(context.Background(), "42")
+		require.True(t, err == nil, "An error was returned: %s", err)
+		require.True(t, user.Id == "42", genericErrMsg, user.Id, "42")
+
+		repo.Store = &erroredUserStoreMock{}
+		_, err = repo.ReadUserByID(context.Background(), "42")
+		require.Error(t, err, "The store's error should be returned")
+	})
+
+	t.Run("Read Users", func(t *testing.T) {
+		repo := &UserRepository{
+			Validator: &trueValidator{},
+			Store:     &happyPathUserStoreMock{"some@gmail.com", "some"},
+		}
+		users, err := repo.ReadUsers(context.Background(),
+			[]string{"42"}, []string{"liskov", "barbara@liskov.com"})
+		require.True(t, err == nil, "An error was returned: %s", err)
+		require.Len(t, users, 3)
+		require.True(t, users[0].Id == "42", genericErrMsg, users[0].Id, "42")
+		require.True(t, users[1].Username == "liskov", "Logins should be looked up as usernames")
+		require.True(t, users[2].Email == "barbara@liskov.com", "Emails should be looked up as emails")
+
+		users, err = repo.ReadUsers(context.Background(), nil, nil)
+		require.True(t, err == nil, "An error was returned, empty: %s", err)
+		require.Empty(t, users)
+
+		tooMany := make([]string, MaxUsersPerLookup+1)
+		_, err = repo.ReadUsers(context.Background(), tooMany, nil)
+		require.True(t, errors.Is(err, ErrTooManyUsers), "Got: %v", err)
+
+		repo.Store = &erroredUserStoreMock{}
+		_, err = repo.ReadUsers(context.Background(), []string{"42"}, nil)
+		require.Error(t, err, "The store's error should be returned")
+	})
+
 	t.Run("Update User", func(t *testing.T) {
 		incorrectEmailDto := &UpdateUserDto{
 			Email:     "bad-company",
@@ -343,3 +433,20 @@ func TestUserRepository(t *testing.T) {
 		}
 	})
 }
+
+func TestUserProfile(t *testing.T) {
+	user := &User{
+		Email:     "  MyEmailAddress@example.com ",
+		Username:  "myuser",
+		FirstName: "My",
+		LastName:  "User",
+	}
+	require.Equal(t, "My User", user.DisplayName())
+	require.Equal(t,
+		"https://www.gravatar.com/avatar/0bc83cb571cd1c50ba6f3e8a78ef1346?d=identicon",
+		user.AvatarURL(),
+	)
+
+	nameless := &User{Username: "myuser"}
+	require.Equal(t, "myuser", nameless.DisplayName())
+}